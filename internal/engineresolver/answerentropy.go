@@ -0,0 +1,108 @@
+package engineresolver
+
+//
+// Quantifying the disagreement between child resolvers
+//
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ooni/probe-cli/v3/internal/multierror"
+)
+
+// AnswerEntropy resolves the given domain using all the child resolvers and
+// returns the Shannon entropy, in bits, of the distribution of the distinct
+// answer sets, along with the addresses returned by each child resolver that
+// did not fail, keyed by its URL. We compare the answer sets ignoring the order
+// and the duplicates of the addresses. The entropy is zero when all the child
+// resolvers agree and is log2(N) when each of the N child resolvers returns a
+// distinct answer set, hence a high entropy indicates that some of them are
+// likely being tampered with. We query the child resolvers concurrently, up to
+// MaxConcurrency at the same time, and we skip the ones we cannot use with the
+// ProxyURL. This method is meant for diagnostics: it does not change the scores,
+// it does not use or fill the answers cache, and it does not run AnswerValidator,
+// StickyAnswers, and FlagPrivateAnswers. However, we use the same child resolvers
+// as LookupHost, so the checks enabled by Use0x20 and RequireDNSSEC still apply,
+// and we treat a child resolver failing them as failed without calling
+// OnValidationMismatch. When all the child resolvers fail, we return a
+// multierror.Union error.
+func (r *Resolver) AnswerEntropy(ctx context.Context, domain string) (float64, map[string][]string, error) {
+	state := r.readstatedefault()
+	answers := make(map[string][]string)
+	me := multierror.New(ErrLookupHost)
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, e := range state {
+		if r.ProxyURL != nil && r.shouldSkipWithProxy(e) {
+			continue // we cannot proxy this URL so ignore it
+		}
+		wg.Add(1)
+		go func(URL string) {
+			defer wg.Done()
+			addrs, err := r.answerEntropyLookup(ctx, URL, domain)
+			defer mu.Unlock()
+			mu.Lock()
+			if err != nil {
+				me.Add(newErrWrapper(err, URL))
+				return
+			}
+			answers[URL] = addrs
+		}(e.URL)
+	}
+	wg.Wait()
+	if len(answers) <= 0 {
+		return 0, answers, me
+	}
+	return answerSetsEntropy(answers), answers, nil
+}
+
+// answerEntropyLookup resolves the domain using the child resolver with the given URL.
+func (r *Resolver) answerEntropyLookup(ctx context.Context, URL, domain string) ([]string, error) {
+	re, err := r.getresolver(URL)
+	if err != nil {
+		return nil, err
+	}
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	addrs, err := r.timeLimitedLookupWithRetries(ctx, re, domain, nil)
+	return addrs, err
+}
+
+// answerSetsEntropy returns the Shannon entropy, in bits, of the distribution
+// of the distinct answer sets inside the given answers.
+func answerSetsEntropy(answers map[string][]string) float64 {
+	counts := make(map[string]int)
+	for _, addrs := range answers {
+		counts[answerSetKey(addrs)]++
+	}
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / float64(len(answers))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// answerSetKey returns a key identifying the given addresses regardless
+// of their order and of their duplicates.
+func answerSetKey(addrs []string) string {
+	unique := make(map[string]bool)
+	for _, addr := range addrs {
+		unique[addr] = true
+	}
+	var sorted []string
+	for addr := range unique {
+		sorted = append(sorted, addr)
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, " ")
+}
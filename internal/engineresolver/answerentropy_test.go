@@ -0,0 +1,142 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverAnswerEntropy(t *testing.T) {
+	// newResolver returns a resolver where each child resolver returns
+	// the addresses returned by the given function for its URL.
+	newResolver := func(answer func(URL string) ([]string, error)) *Resolver {
+		return &Resolver{
+			Deterministic: true,
+			KVStore:       &kvstore.Memory{},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				if h3 {
+					URL = "http3" + URL[len("https"):]
+				}
+				re := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						return answer(URL)
+					},
+					MockCloseIdleConnections: func() {},
+				}
+				return re, nil
+			},
+		}
+	}
+
+	t.Run("when all the child resolvers agree", func(t *testing.T) {
+		reso := newResolver(func(URL string) ([]string, error) {
+			return []string{"8.8.8.8", "8.8.4.4"}, nil
+		})
+		entropy, answers, err := reso.AnswerEntropy(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entropy != 0 {
+			t.Fatal("expected zero entropy, got", entropy)
+		}
+		if len(answers) != len(reso.readstatedefault()) {
+			t.Fatal("unexpected number of answers", len(answers))
+		}
+		for URL, addrs := range answers {
+			if diff := cmp.Diff([]string{"8.8.8.8", "8.8.4.4"}, addrs); diff != "" {
+				t.Fatal(URL, diff)
+			}
+		}
+	})
+
+	t.Run("when each child resolver returns a distinct answer set", func(t *testing.T) {
+		reso := newResolver(func(URL string) ([]string, error) {
+			return []string{"8.8.8.8", URL}, nil // using the URL to make the set unique
+		})
+		entropy, answers, err := reso.AnswerEntropy(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := math.Log2(float64(len(reso.readstatedefault())))
+		if math.Abs(entropy-expect) > 1e-9 {
+			t.Fatal("expected", expect, "got", entropy)
+		}
+		if len(answers) != len(reso.readstatedefault()) {
+			t.Fatal("unexpected number of answers", len(answers))
+		}
+	})
+
+	t.Run("we ignore the order and the duplicates of the addresses", func(t *testing.T) {
+		reso := newResolver(func(URL string) ([]string, error) {
+			if URL == "https://dns.google/dns-query" {
+				return []string{"8.8.4.4", "8.8.8.8", "8.8.4.4"}, nil
+			}
+			return []string{"8.8.8.8", "8.8.4.4"}, nil
+		})
+		entropy, _, err := reso.AnswerEntropy(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entropy != 0 {
+			t.Fatal("expected zero entropy, got", entropy)
+		}
+	})
+
+	t.Run("we exclude the child resolvers that failed", func(t *testing.T) {
+		reso := newResolver(func(URL string) ([]string, error) {
+			if URL == "https://dns.google/dns-query" {
+				return []string{"8.8.8.8"}, nil
+			}
+			if URL == "https://dns.quad9.net/dns-query" {
+				return []string{"10.10.34.35"}, nil
+			}
+			return nil, errors.New("mocked error")
+		})
+		entropy, answers, err := reso.AnswerEntropy(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := map[string][]string{
+			"https://dns.google/dns-query":    {"8.8.8.8"},
+			"https://dns.quad9.net/dns-query": {"10.10.34.35"},
+		}
+		if diff := cmp.Diff(expect, answers); diff != "" {
+			t.Fatal(diff)
+		}
+		if entropy != 1 {
+			t.Fatal("expected one bit of entropy, got", entropy)
+		}
+	})
+
+	t.Run("when all the child resolvers fail", func(t *testing.T) {
+		reso := newResolver(func(URL string) ([]string, error) {
+			return nil, errors.New("mocked error")
+		})
+		entropy, answers, err := reso.AnswerEntropy(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		if entropy != 0 || len(answers) != 0 {
+			t.Fatal("unexpected results", entropy, answers)
+		}
+	})
+
+	t.Run("we do not change the scores", func(t *testing.T) {
+		reso := newResolver(func(URL string) ([]string, error) {
+			return nil, errors.New("mocked error")
+		})
+		before := reso.Scoreboard()
+		if _, _, err := reso.AnswerEntropy(context.Background(), "dns.google"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if diff := cmp.Diff(before, reso.Scoreboard()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package engineresolver
+
+//
+// Archival data format for the lookups performed by child resolvers
+//
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// ArchivalResults returns the lookups performed by the child resolvers
+// during the last LookupHost call using the OONI archival data format. For
+// each child resolver lookup, we emit an A and an AAAA entry containing
+// the answers of the corresponding type, omitting successful entries without
+// answers. The ResolverAddress field contains the child resolver URL and
+// times are relative to the beginning of LookupHost. When several LookupHost
+// calls run concurrently, this function returns the results of the call that
+// completed last. This function returns an empty list if no LookupHost
+// call has completed yet.
+func (r *Resolver) ArchivalResults() []*model.ArchivalDNSLookupResult {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	return append([]*model.ArchivalDNSLookupResult{}, r.archival...)
+}
+
+// saveArchivalResults saves the archival results of the last LookupHost call.
+func (r *Resolver) saveArchivalResults(results []*model.ArchivalDNSLookupResult) {
+	r.mu.Lock()
+	r.archival = results
+	r.mu.Unlock()
+}
+
+// LastLookupFailures returns the failed lookups performed by the child resolvers
+// during the last LookupHost call that failed, using the same format of ArchivalResults.
+// Each entry's Failure field contains the OONI failure string and the ResolverAddress
+// field contains the child resolver URL, which allows one to archive the errors wrapped
+// by the ErrLookupHost error as structured data. When several failing LookupHost calls
+// run concurrently, this function returns the failures of the call that completed last.
+// This function returns an empty list if no LookupHost call has failed yet, as well
+// as if the last failed call did not use any child resolver.
+func (r *Resolver) LastLookupFailures() []*model.ArchivalDNSLookupResult {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	return append([]*model.ArchivalDNSLookupResult{}, r.lastFailures...)
+}
+
+// saveLastLookupFailures saves the failed entries among the archival results
+// of a LookupHost call that failed.
+func (r *Resolver) saveLastLookupFailures(results []*model.ArchivalDNSLookupResult) {
+	failures := []*model.ArchivalDNSLookupResult{}
+	for _, entry := range results {
+		if entry.Failure != nil {
+			failures = append(failures, entry)
+		}
+	}
+	r.mu.Lock()
+	r.lastFailures = failures
+	r.mu.Unlock()
+}
+
+// newArchivalDNSLookupResults returns the archival results for a lookup
+// of the given hostname using the child resolver with the given URL.
+//
+// Like the legacy tracex package, we cannot know which queries the child
+// resolver actually sent, hence we generate an A and an AAAA entry, which
+// is our best guess of what happened.
+func newArchivalDNSLookupResults(URL, hostname string, addrs []string,
+	err error, started, finished time.Duration) (out []*model.ArchivalDNSLookupResult) {
+	for _, qtype := range []string{"A", "AAAA"} {
+		answers := newArchivalDNSAnswers(qtype, addrs)
+		if len(answers) <= 0 && err == nil {
+			continue // as documented
+		}
+		out = append(out, &model.ArchivalDNSLookupResult{
+			Answers:          answers,
+			Engine:           archivalEngine(URL),
+			Failure:          archivalFailure(err),
+			GetaddrinfoError: netxlite.ErrorToGetaddrinfoRetvalOrZero(err),
+			Hostname:         hostname,
+			QueryType:        qtype,
+			RawResponse:      nil,
+			Rcode:            0,
+			ResolverHostname: nil,
+			ResolverPort:     nil,
+			ResolverAddress:  URL,
+			T0:               started.Seconds(),
+			T:                finished.Seconds(),
+			Tags:             []string{},
+			TransactionID:    0,
+		})
+	}
+	return
+}
+
+// newArchivalDNSAnswers returns the answers of the given type among the given addrs.
+func newArchivalDNSAnswers(qtype string, addrs []string) (out []model.ArchivalDNSAnswer) {
+	for _, addr := range addrs {
+		ipv6, err := netxlite.IsIPv6(addr)
+		if err != nil {
+			continue // not an IP address
+		}
+		switch {
+		case qtype == "A" && !ipv6:
+			out = append(out, model.ArchivalDNSAnswer{AnswerType: qtype, IPv4: addr})
+		case qtype == "AAAA" && ipv6:
+			out = append(out, model.ArchivalDNSAnswer{AnswerType: qtype, IPv6: addr})
+		}
+	}
+	return
+}
+
+// archivalEngine returns the engine name for the given child resolver URL.
+func archivalEngine(URL string) string {
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return "unknown"
+	}
+	switch parsed.Scheme {
+	case "system":
+		return netxlite.StdlibResolverSystem
+	case "https", "http3":
+		return "doh"
+	default:
+		return parsed.Scheme
+	}
+}
+
+// archivalFailure converts the given error to an OONI failure string.
+func archivalFailure(err error) *string {
+	if err == nil {
+		return nil
+	}
+	var errWrapper *netxlite.ErrWrapper
+	if !errors.As(err, &errWrapper) {
+		errWrapper = netxlite.NewTopLevelGenericErrWrapper(err)
+	}
+	failure := errWrapper.Failure
+	return &failure
+}
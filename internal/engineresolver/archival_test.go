@@ -0,0 +1,220 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestResolverArchivalResults(t *testing.T) {
+	t.Run("before any lookup", func(t *testing.T) {
+		reso := &Resolver{KVStore: &kvstore.Memory{}}
+		if results := reso.ArchivalResults(); len(results) != 0 {
+			t.Fatal("expected no results", results)
+		}
+	})
+
+	t.Run("after a successful lookup", func(t *testing.T) {
+		const workingURL = "https://dns.google/dns-query"
+		reso := &Resolver{
+			KVStore: &kvstore.Memory{},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						if !h3 && URL == workingURL {
+							return []string{"8.8.8.8", "2001:4860:4860::8888"}, nil
+						}
+						return nil, netxlite.ErrOODNSNoSuchHost
+					},
+				}
+				return reso, nil
+			},
+		}
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		results := reso.ArchivalResults()
+		if len(results) < 2 {
+			t.Fatal("expected at least two results", len(results))
+		}
+
+		// the last two results must be the successful ones
+		success := results[len(results)-2:]
+		for _, entry := range success {
+			if entry.T0 > entry.T {
+				t.Fatal("invalid timing", entry.T0, entry.T)
+			}
+			entry.T0, entry.T = 0, 0 // make the comparison deterministic
+		}
+		expect := []*model.ArchivalDNSLookupResult{{
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "A",
+				IPv4:       "8.8.8.8",
+			}},
+			Engine:          "doh",
+			Failure:         nil,
+			Hostname:        "dns.google",
+			QueryType:       "A",
+			ResolverAddress: workingURL,
+			Tags:            []string{},
+		}, {
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "AAAA",
+				IPv6:       "2001:4860:4860::8888",
+			}},
+			Engine:          "doh",
+			Failure:         nil,
+			Hostname:        "dns.google",
+			QueryType:       "AAAA",
+			ResolverAddress: workingURL,
+			Tags:            []string{},
+		}}
+		if diff := cmp.Diff(expect, success); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// all the previous results must be failures of other resolvers
+		for _, entry := range results[:len(results)-2] {
+			if entry.ResolverAddress == workingURL {
+				t.Fatal("unexpected resolver address", entry.ResolverAddress)
+			}
+			if entry.Failure == nil || *entry.Failure != netxlite.FailureDNSNXDOMAINError {
+				t.Fatal("unexpected failure", entry.Failure)
+			}
+			if len(entry.Answers) != 0 {
+				t.Fatal("unexpected answers", entry.Answers)
+			}
+		}
+	})
+}
+
+func TestNewArchivalDNSLookupResults(t *testing.T) {
+	t.Run("with failure we emit both A and AAAA entries", func(t *testing.T) {
+		results := newArchivalDNSLookupResults(
+			systemResolverURL, "example.com", nil, errors.New("mocked error"), 1, 2)
+		if len(results) != 2 {
+			t.Fatal("expected two results")
+		}
+		for idx, qtype := range []string{"A", "AAAA"} {
+			entry := results[idx]
+			if entry.QueryType != qtype {
+				t.Fatal("unexpected query type", entry.QueryType)
+			}
+			if entry.Engine != netxlite.StdlibResolverSystem {
+				t.Fatal("unexpected engine", entry.Engine)
+			}
+			if entry.Failure == nil || *entry.Failure != "unknown_failure: mocked error" {
+				t.Fatal("unexpected failure", entry.Failure)
+			}
+		}
+	})
+
+	t.Run("with success we omit the entries without answers", func(t *testing.T) {
+		results := newArchivalDNSLookupResults(
+			"http3://dns.google/dns-query", "dns.google", []string{"8.8.4.4"}, nil, 1, 2)
+		if len(results) != 1 {
+			t.Fatal("expected one result")
+		}
+		if results[0].QueryType != "A" || results[0].Engine != "doh" {
+			t.Fatal("unexpected result", results[0])
+		}
+	})
+}
+
+func TestArchivalEngine(t *testing.T) {
+	expect := map[string]string{
+		"https://dns.google/dns-query": "doh",
+		"http3://dns.google/dns-query": "doh",
+		systemResolverURL:              netxlite.StdlibResolverSystem,
+		"dot://1.1.1.1:853/":           "dot",
+		"\t":                           "unknown",
+	}
+	for URL, engine := range expect {
+		if got := archivalEngine(URL); got != engine {
+			t.Fatal("unexpected engine for", URL, got)
+		}
+	}
+}
+
+func TestResolverLastLookupFailures(t *testing.T) {
+	t.Run("before any lookup", func(t *testing.T) {
+		reso := &Resolver{KVStore: &kvstore.Memory{}}
+		if failures := reso.LastLookupFailures(); len(failures) != 0 {
+			t.Fatal("expected no failures", failures)
+		}
+	})
+
+	const googleURL = "https://dns.google/dns-query"
+	var working bool
+	reso := &Resolver{
+		AllowedSchemes: []string{"https"},
+		KVStore:        &kvstore.Memory{},
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			reso := &mocks.Resolver{
+				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+					switch {
+					case working:
+						return []string{"8.8.8.8"}, nil
+					case URL == googleURL:
+						return nil, netxlite.ErrOODNSNoSuchHost
+					default:
+						return nil, netxlite.NewErrWrapper(
+							netxlite.ClassifyResolverError, netxlite.ResolveOperation, netxlite.ErrOODNSRefused)
+					}
+				},
+			}
+			return reso, nil
+		},
+	}
+
+	t.Run("after a failed lookup", func(t *testing.T) {
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected err", err)
+		}
+		failures := reso.LastLookupFailures()
+
+		// we expect an A and an AAAA entry for each child resolver
+		var expectURLs []string
+		for _, entry := range reso.Scoreboard() {
+			expectURLs = append(expectURLs, entry.URL, entry.URL)
+		}
+		var gotURLs []string
+		for _, entry := range failures {
+			gotURLs = append(gotURLs, entry.ResolverAddress)
+		}
+		sortURLs := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+		if diff := cmp.Diff(expectURLs, gotURLs, sortURLs); diff != "" {
+			t.Fatal(diff)
+		}
+
+		for _, entry := range failures {
+			expectFailure := netxlite.FailureDNSRefusedError
+			if entry.ResolverAddress == googleURL {
+				expectFailure = netxlite.FailureDNSNXDOMAINError
+			}
+			if entry.Failure == nil || *entry.Failure != expectFailure {
+				t.Fatal("unexpected failure for", entry.ResolverAddress, entry.Failure)
+			}
+			if entry.Engine != "doh" || entry.Hostname != "dns.google" || len(entry.Answers) != 0 {
+				t.Fatal("unexpected entry", entry)
+			}
+		}
+	})
+
+	t.Run("a successful lookup does not clear the failures", func(t *testing.T) {
+		working = true
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		if failures := reso.LastLookupFailures(); len(failures) == 0 {
+			t.Fatal("expected to see the failures of the previous lookup")
+		}
+	})
+}
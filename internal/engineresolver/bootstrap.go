@@ -0,0 +1,69 @@
+package engineresolver
+
+//
+// Bootstrap addresses for child resolvers
+//
+
+import (
+	"context"
+	"net"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// bootstrapResolver is a [model.Resolver] that returns the pre-known addresses
+// of a child resolver's hostname and otherwise uses the underlying resolver.
+type bootstrapResolver struct {
+	// addrs maps a hostname to its pre-known addresses.
+	addrs map[string][]string
+
+	// underlying is the resolver to use for other hostnames.
+	underlying model.Resolver
+}
+
+// newBootstrapResolver returns the given resolver when bootstrap is empty and
+// otherwise wraps it to return the pre-known addresses inside bootstrap.
+func newBootstrapResolver(underlying model.Resolver, bootstrap map[string][]string) model.Resolver {
+	if len(bootstrap) <= 0 {
+		return underlying
+	}
+	return &bootstrapResolver{
+		addrs:      bootstrap,
+		underlying: underlying,
+	}
+}
+
+var _ model.Resolver = &bootstrapResolver{}
+
+// LookupHost implements model.Resolver.
+func (r *bootstrapResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	if addrs := r.addrs[hostname]; len(addrs) > 0 {
+		return append([]string{}, addrs...), nil
+	}
+	return r.underlying.LookupHost(ctx, hostname)
+}
+
+// Network implements model.Resolver.
+func (r *bootstrapResolver) Network() string {
+	return r.underlying.Network()
+}
+
+// Address implements model.Resolver.
+func (r *bootstrapResolver) Address() string {
+	return r.underlying.Address()
+}
+
+// CloseIdleConnections implements model.Resolver.
+func (r *bootstrapResolver) CloseIdleConnections() {
+	r.underlying.CloseIdleConnections()
+}
+
+// LookupHTTPS implements model.Resolver.
+func (r *bootstrapResolver) LookupHTTPS(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return r.underlying.LookupHTTPS(ctx, domain)
+}
+
+// LookupNS implements model.Resolver.
+func (r *bootstrapResolver) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	return r.underlying.LookupNS(ctx, domain)
+}
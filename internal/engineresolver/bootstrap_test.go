@@ -0,0 +1,146 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestBootstrapResolver(t *testing.T) {
+	t.Run("without bootstrap addresses we return the underlying resolver", func(t *testing.T) {
+		underlying := &mocks.Resolver{}
+		if reso := newBootstrapResolver(underlying, nil); reso != underlying {
+			t.Fatal("expected the underlying resolver")
+		}
+	})
+
+	t.Run("we return the bootstrap addresses without any lookup", func(t *testing.T) {
+		underlying := &mocks.Resolver{
+			MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+				panic("should not be called")
+			},
+		}
+		bootstrap := map[string][]string{"dns.google": {"8.8.8.8", "8.8.4.4"}}
+		reso := newBootstrapResolver(underlying, bootstrap)
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8", "8.8.4.4"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we use the underlying resolver for other hostnames", func(t *testing.T) {
+		errMocked := errors.New("mocked error")
+		underlying := &mocks.Resolver{
+			MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+				return nil, errMocked
+			},
+		}
+		bootstrap := map[string][]string{"dns.google": {"8.8.8.8"}}
+		reso := newBootstrapResolver(underlying, bootstrap)
+		addrs, err := reso.LookupHost(context.Background(), "dns.quad9.net")
+		if !errors.Is(err, errMocked) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(addrs) != 0 {
+			t.Fatal("expected no addresses")
+		}
+	})
+
+	t.Run("the other methods use the underlying resolver", func(t *testing.T) {
+		var called bool
+		underlying := &mocks.Resolver{
+			MockNetwork: func() string {
+				return "antani"
+			},
+			MockAddress: func() string {
+				return "mascetti"
+			},
+			MockCloseIdleConnections: func() {
+				called = true
+			},
+			MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+				return nil, errLookupNotImplemented
+			},
+			MockLookupNS: func(ctx context.Context, domain string) ([]*net.NS, error) {
+				return nil, errLookupNotImplemented
+			},
+		}
+		reso := newBootstrapResolver(underlying, map[string][]string{"dns.google": {"8.8.8.8"}})
+		if reso.Network() != "antani" {
+			t.Fatal("unexpected network")
+		}
+		if reso.Address() != "mascetti" {
+			t.Fatal("unexpected address")
+		}
+		reso.CloseIdleConnections()
+		if !called {
+			t.Fatal("did not call CloseIdleConnections")
+		}
+		if _, err := reso.LookupHTTPS(context.Background(), "dns.google"); !errors.Is(err, errLookupNotImplemented) {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := reso.LookupNS(context.Background(), "dns.google"); !errors.Is(err, errLookupNotImplemented) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
+
+func TestResolverWithBootstrap(t *testing.T) {
+	handler := &testDNSOverHTTPSHandler{
+		A: []net.IP{net.IPv4(8, 8, 8, 8)},
+	}
+	srvr := httptest.NewServer(handler)
+	defer srvr.Close()
+	parsed, err := url.Parse(srvr.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the .invalid TLD guarantees that we cannot resolve the hostname using the DNS
+	const hostname = "dns.bootstrap.invalid"
+	URL := &url.URL{Scheme: "http", Host: net.JoinHostPort(hostname, parsed.Port()), Path: "/dns-query"}
+
+	t.Run("with bootstrap addresses we connect without looking up the hostname", func(t *testing.T) {
+		reso := &Resolver{
+			Bootstrap: map[string][]string{hostname: {parsed.Hostname()}},
+		}
+		child, err := reso.newChildResolver(false, URL.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer child.CloseIdleConnections()
+		addrs, err := child.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("without bootstrap addresses we fail to look up the hostname", func(t *testing.T) {
+		reso := &Resolver{}
+		child, err := reso.newChildResolver(false, URL.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer child.CloseIdleConnections()
+		addrs, err := child.LookupHost(context.Background(), "dns.google")
+		if err == nil {
+			t.Fatal("expected an error here")
+		}
+		if len(addrs) != 0 {
+			t.Fatal("expected no addresses")
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package engineresolver
+
+//
+// Bounding the total number of child resolver attempts
+//
+
+import "errors"
+
+// errAttemptBudgetExhausted indicates that we did not perform a
+// child resolver attempt because we exhausted the attempt budget.
+var errAttemptBudgetExhausted = errors.New("sessionresolver: attempt budget exhausted")
+
+// attemptBudget is the number of child resolver attempts that
+// LookupHost may still perform. A nil budget is unlimited.
+type attemptBudget struct {
+	remaining int
+}
+
+// newAttemptBudget returns a budget allowing the given number of
+// attempts or a nil (i.e., unlimited) budget when attempts is zero
+// or negative. The returned budget MUST NOT be shared by several
+// LookupHost calls because it is not goroutine safe.
+func newAttemptBudget(attempts int) *attemptBudget {
+	if attempts <= 0 {
+		return nil
+	}
+	return &attemptBudget{remaining: attempts}
+}
+
+// take consumes an attempt and returns whether there was one left.
+func (b *attemptBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	if b.remaining <= 0 {
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// exhausted returns whether there are no attempts left.
+func (b *attemptBudget) exhausted() bool {
+	return b != nil && b.remaining <= 0
+}
@@ -0,0 +1,151 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/multierror"
+)
+
+func TestAttemptBudget(t *testing.T) {
+	t.Run("a nil budget is unlimited", func(t *testing.T) {
+		budget := newAttemptBudget(0)
+		if budget != nil {
+			t.Fatal("expected a nil budget")
+		}
+		for idx := 0; idx < 128; idx++ {
+			if !budget.take() {
+				t.Fatal("expected to be able to take")
+			}
+		}
+		if budget.exhausted() {
+			t.Fatal("expected the budget not to be exhausted")
+		}
+	})
+
+	t.Run("a positive budget is bounded", func(t *testing.T) {
+		budget := newAttemptBudget(2)
+		for idx := 0; idx < 2; idx++ {
+			if budget.exhausted() {
+				t.Fatal("expected the budget not to be exhausted")
+			}
+			if !budget.take() {
+				t.Fatal("expected to be able to take")
+			}
+		}
+		if !budget.exhausted() {
+			t.Fatal("expected the budget to be exhausted")
+		}
+		if budget.take() {
+			t.Fatal("expected not to be able to take")
+		}
+	})
+}
+
+func TestResolverWithAttemptBudget(t *testing.T) {
+	// newResolver returns a resolver whose child resolvers always fail and
+	// which counts the number of attempts inside the given counter.
+	newResolver := func(budget, retries int, attempts *int) *Resolver {
+		return &Resolver{
+			AttemptBudget:   budget,
+			KVStore:         &kvstore.Memory{},
+			PerQueryRetries: retries,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						*attempts++
+						return nil, errors.New("mocked error")
+					},
+				}
+				return reso, nil
+			},
+		}
+	}
+
+	// countFailures returns the number of child resolver failures in err.
+	countFailures := func(t *testing.T, err error) int {
+		var me *multierror.Union
+		if !errors.As(err, &me) {
+			t.Fatal("expected a multierror.Union", err)
+		}
+		return len(me.Children)
+	}
+
+	// countSkipReasons counts the given reason inside the skip reasons.
+	countSkipReasons := func(reso *Resolver, reason string) (count int) {
+		for _, value := range reso.SkipReasons() {
+			if value == reason {
+				count++
+			}
+		}
+		return
+	}
+
+	t.Run("we stop after the budget is exhausted", func(t *testing.T) {
+		var attempts int
+		reso := newResolver(3, 0, &attempts)
+		_, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		if attempts != 3 {
+			t.Fatal("expected three attempts, got", attempts)
+		}
+		if n := countFailures(t, err); n != 3 {
+			t.Fatal("expected three failures, got", n)
+		}
+		if n := countSkipReasons(reso, SkipReasonMaxAttempts); n != len(allmakers)-3 {
+			t.Fatal("unexpected number of max-attempts skip reasons", n)
+		}
+	})
+
+	t.Run("retries consume the budget", func(t *testing.T) {
+		var attempts int
+		reso := newResolver(3, 1, &attempts)
+		_, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		if attempts != 3 {
+			t.Fatal("expected three attempts, got", attempts)
+		}
+		// the first child resolver uses two attempts and the second one just one
+		if n := countFailures(t, err); n != 2 {
+			t.Fatal("expected two failures, got", n)
+		}
+		if n := countSkipReasons(reso, SkipReasonMaxAttempts); n != len(allmakers)-2 {
+			t.Fatal("unexpected number of max-attempts skip reasons", n)
+		}
+	})
+
+	t.Run("without a budget we try all the child resolvers", func(t *testing.T) {
+		var attempts int
+		reso := newResolver(0, 0, &attempts)
+		_, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		if attempts != len(allmakers) {
+			t.Fatal("unexpected number of attempts", attempts)
+		}
+		if n := countSkipReasons(reso, SkipReasonMaxAttempts); n != 0 {
+			t.Fatal("unexpected number of max-attempts skip reasons", n)
+		}
+	})
+
+	t.Run("with a budget larger than the child resolvers", func(t *testing.T) {
+		var attempts int
+		reso := newResolver(len(allmakers)+10, 0, &attempts)
+		_, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		if attempts != len(allmakers) {
+			t.Fatal("unexpected number of attempts", attempts)
+		}
+	})
+}
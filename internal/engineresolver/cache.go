@@ -0,0 +1,206 @@
+package engineresolver
+
+//
+// Caching LookupHost answers honoring the answer TTL
+//
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// answerCacheMaxEntries is the maximum number of hostnames inside the answers cache.
+const answerCacheMaxEntries = 1024
+
+// ttlTracker tracks the minimum TTL of the answer records in the responses
+// received by a child resolver lookup. Only the child resolvers using a DNS
+// transport (i.e., DoH) surface TTLs, therefore the TTL is zero when we use
+// the system resolver or when the responses do not contain any answer.
+type ttlTracker struct {
+	mu  sync.Mutex
+	ttl uint32
+	set bool
+}
+
+// onResponse records the TTLs of the answer records of the given response.
+func (tt *ttlTracker) onResponse(msg *dns.Msg) {
+	defer tt.mu.Unlock()
+	tt.mu.Lock()
+	for _, answer := range msg.Answer {
+		if ttl := answer.Header().Ttl; !tt.set || ttl < tt.ttl {
+			tt.ttl, tt.set = ttl, true
+		}
+	}
+}
+
+// minTTL returns the minimum TTL we have seen or zero.
+func (tt *ttlTracker) minTTL() time.Duration {
+	defer tt.mu.Unlock()
+	tt.mu.Lock()
+	return time.Duration(tt.ttl) * time.Second
+}
+
+// ttlTrackerKey is the context key for the ttlTracker.
+type ttlTrackerKey struct{}
+
+// withTTLTracker returns a copy of ctx using the given tracker.
+func withTTLTracker(ctx context.Context, tracker *ttlTracker) context.Context {
+	return context.WithValue(ctx, ttlTrackerKey{}, tracker)
+}
+
+// maybeWrapDNSTransportWithTTL returns the function to wrap the DNS transport of a
+// child resolver such that we record the TTL of the answers, chaining it with the
+// given wrapper, which may be nil. We return the given wrapper when the cache is
+// disabled, such that we don't wrap the DNS transport in such a case.
+func (r *Resolver) maybeWrapDNSTransportWithTTL(
+	wrapper func(model.DNSTransport) model.DNSTransport) func(model.DNSTransport) model.DNSTransport {
+	if r.CacheMaxTTL <= 0 {
+		return wrapper
+	}
+	return func(txp model.DNSTransport) model.DNSTransport {
+		if wrapper != nil {
+			txp = wrapper(txp)
+		}
+		return &dnsTransportTTL{txp}
+	}
+}
+
+// dnsTransportTTL is a model.DNSTransport recording the TTL of
+// the answers using the ttlTracker inside the context, if any.
+type dnsTransportTTL struct {
+	txp model.DNSTransport
+}
+
+var _ model.DNSTransport = &dnsTransportTTL{}
+
+// RoundTrip implements model.DNSTransport.
+func (txp *dnsTransportTTL) RoundTrip(
+	ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+	response, err := txp.txp.RoundTrip(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if tracker, ok := ctx.Value(ttlTrackerKey{}).(*ttlTracker); ok {
+		msg := &dns.Msg{}
+		if err := msg.Unpack(response.Bytes()); err == nil {
+			tracker.onResponse(msg)
+		}
+	}
+	return response, nil
+}
+
+// RequiresPadding implements model.DNSTransport.
+func (txp *dnsTransportTTL) RequiresPadding() bool {
+	return txp.txp.RequiresPadding()
+}
+
+// Network implements model.DNSTransport.
+func (txp *dnsTransportTTL) Network() string {
+	return txp.txp.Network()
+}
+
+// Address implements model.DNSTransport.
+func (txp *dnsTransportTTL) Address() string {
+	return txp.txp.Address()
+}
+
+// CloseIdleConnections implements model.DNSTransport.
+func (txp *dnsTransportTTL) CloseIdleConnections() {
+	txp.txp.CloseIdleConnections()
+}
+
+// answerCacheEntry is an entry inside the answers cache.
+type answerCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// timeNow returns the current time using timeNowFn, if set, or time.Now.
+func (r *Resolver) timeNow() time.Time {
+	if r.timeNowFn != nil {
+		return r.timeNowFn()
+	}
+	return time.Now()
+}
+
+// cacheTTL returns the TTL for caching answers whose TTL is ttl, where zero
+// means the child resolver does not surface TTLs. We clamp the result to
+// [r.CacheMinTTL, r.CacheMaxTTL], thus we map a zero ttl to r.CacheMinTTL.
+func (r *Resolver) cacheTTL(ttl time.Duration) time.Duration {
+	if ttl < r.CacheMinTTL {
+		ttl = r.CacheMinTTL
+	}
+	if ttl > r.CacheMaxTTL {
+		ttl = r.CacheMaxTTL
+	}
+	return ttl
+}
+
+// maybeCacheAnswers caches the addrs of the given hostname when the
+// cache is enabled, i.e., when r.CacheMaxTTL is positive. To bound the
+// size of the cache, we remove the expired entries when the cache is
+// full and, if it is still full, the entry expiring first.
+func (r *Resolver) maybeCacheAnswers(hostname string, addrs []string, ttl time.Duration) {
+	if r.CacheMaxTTL <= 0 {
+		return
+	}
+	ttl = r.cacheTTL(ttl)
+	if ttl <= 0 {
+		return
+	}
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if r.answerCache == nil {
+		r.answerCache = make(map[string]*answerCacheEntry)
+	}
+	now := r.timeNow()
+	if _, found := r.answerCache[hostname]; !found && len(r.answerCache) >= answerCacheMaxEntries {
+		r.evictAnswersLocked(now)
+	}
+	r.answerCache[hostname] = &answerCacheEntry{
+		addrs:   append([]string{}, addrs...),
+		expires: now.Add(ttl),
+	}
+}
+
+// evictAnswersLocked removes the expired entries from the answers cache and,
+// when there are none, the entry expiring first. The caller MUST hold r.mu.
+func (r *Resolver) evictAnswersLocked(now time.Time) {
+	var first string
+	var firstExpires time.Time
+	for hostname, entry := range r.answerCache {
+		if !now.Before(entry.expires) {
+			delete(r.answerCache, hostname)
+			continue
+		}
+		if first == "" || entry.expires.Before(firstExpires) {
+			first, firstExpires = hostname, entry.expires
+		}
+	}
+	if len(r.answerCache) >= answerCacheMaxEntries {
+		delete(r.answerCache, first)
+	}
+}
+
+// cachedAnswers returns the cached addrs of the given hostname, if any. We
+// remove the entry from the cache when it has expired.
+func (r *Resolver) cachedAnswers(hostname string) ([]string, bool) {
+	if r.CacheMaxTTL <= 0 {
+		return nil, false
+	}
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	entry, found := r.answerCache[hostname]
+	if !found {
+		return nil, false
+	}
+	if !r.timeNow().Before(entry.expires) {
+		delete(r.answerCache, hostname)
+		return nil, false
+	}
+	return append([]string{}, entry.addrs...), true
+}
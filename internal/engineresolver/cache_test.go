@@ -0,0 +1,216 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverCache(t *testing.T) {
+	// newResolver returns a resolver using a DoH server whose answers
+	// have the given ttl along with the server's handler.
+	newResolver := func(t *testing.T, ttl uint32, now *time.Time) (*Resolver, *testDNSOverHTTPSHandler) {
+		handler := &testDNSOverHTTPSHandler{
+			A:   []net.IP{net.IPv4(8, 8, 8, 8)},
+			TTL: ttl,
+		}
+		srvr := httptest.NewServer(handler)
+		t.Cleanup(srvr.Close)
+		reso := &Resolver{
+			CacheMaxTTL: 60 * time.Second,
+			CacheMinTTL: 10 * time.Second,
+			KVStore:     &kvstore.Memory{},
+			timeNowFn: func() time.Time {
+				return *now
+			},
+		}
+		if err := reso.SetURLs([]string{srvr.URL}); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(reso.CloseIdleConnections)
+		return reso, handler
+	}
+
+	// lookupAt performs a lookup at the given offset and returns whether
+	// the lookup used the DoH server rather than the cache.
+	lookupAt := func(t *testing.T, reso *Resolver, handler *testDNSOverHTTPSHandler,
+		zero time.Time, offset time.Duration, now *time.Time) bool {
+		*now = zero.Add(offset)
+		before := handler.Queries.Load()
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		return handler.Queries.Load() > before
+	}
+
+	type step struct {
+		offset    time.Duration
+		usesChild bool
+	}
+
+	var cases = []struct {
+		name   string
+		ttl    uint32
+		minTTL time.Duration
+		steps  []step
+	}{{
+		name:   "we honor the TTL within the bounds",
+		ttl:    30,
+		minTTL: 10 * time.Second,
+		steps: []step{
+			{offset: 0, usesChild: true},
+			{offset: 29 * time.Second, usesChild: false},
+			{offset: 30 * time.Second, usesChild: true},
+			{offset: 59 * time.Second, usesChild: false},
+		},
+	}, {
+		name:   "we honor the TTL when CacheMinTTL is zero",
+		ttl:    30,
+		minTTL: 0,
+		steps: []step{
+			{offset: 0, usesChild: true},
+			{offset: 29 * time.Second, usesChild: false},
+			{offset: 30 * time.Second, usesChild: true},
+		},
+	}, {
+		name:   "we clamp a small TTL to the minimum",
+		ttl:    5,
+		minTTL: 10 * time.Second,
+		steps: []step{
+			{offset: 0, usesChild: true},
+			{offset: 9 * time.Second, usesChild: false},
+			{offset: 10 * time.Second, usesChild: true},
+		},
+	}, {
+		name:   "we clamp a large TTL to the maximum",
+		ttl:    300,
+		minTTL: 10 * time.Second,
+		steps: []step{
+			{offset: 0, usesChild: true},
+			{offset: 59 * time.Second, usesChild: false},
+			{offset: 60 * time.Second, usesChild: true},
+		},
+	}, {
+		name:   "we do not cache zero TTL answers when CacheMinTTL is zero",
+		ttl:    0,
+		minTTL: 0,
+		steps: []step{
+			{offset: 0, usesChild: true},
+			{offset: time.Second, usesChild: true},
+		},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			zero := time.Now()
+			now := zero
+			reso, handler := newResolver(t, tc.ttl, &now)
+			reso.CacheMinTTL = tc.minTTL
+			for _, s := range tc.steps {
+				if got := lookupAt(t, reso, handler, zero, s.offset, &now); got != s.usesChild {
+					t.Fatal("at", s.offset, "expected usesChild", s.usesChild, "got", got)
+				}
+			}
+		})
+	}
+
+	t.Run("we do not cache when CacheMaxTTL is zero", func(t *testing.T) {
+		zero := time.Now()
+		now := zero
+		reso, handler := newResolver(t, 30, &now)
+		reso.CacheMaxTTL = 0
+		for _, offset := range []time.Duration{0, time.Second, 2 * time.Second} {
+			if !lookupAt(t, reso, handler, zero, offset, &now) {
+				t.Fatal("expected to use the DoH server at", offset)
+			}
+		}
+	})
+
+	t.Run("we do not cache failures", func(t *testing.T) {
+		now := time.Now()
+		reso := &Resolver{
+			CacheMaxTTL: 60 * time.Second,
+			KVStore:     &kvstore.Memory{},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				return &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						return nil, errors.New("mocked error")
+					},
+				}, nil
+			},
+			timeNowFn: func() time.Time {
+				return now
+			},
+		}
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, found := reso.cachedAnswers("dns.google"); found {
+			t.Fatal("did not expect to find cached answers")
+		}
+	})
+
+	t.Run("we bound the size of the cache", func(t *testing.T) {
+		zero := time.Now()
+		now := zero
+		reso := &Resolver{
+			CacheMaxTTL: 60 * time.Second,
+			timeNowFn: func() time.Time {
+				return now
+			},
+		}
+		addrs := []string{"8.8.8.8"}
+
+		// fill the cache such that the first entry expires first
+		// and the second entry expires before the others
+		reso.maybeCacheAnswers("host-0.example", addrs, 10*time.Second)
+		reso.maybeCacheAnswers("host-1.example", addrs, 20*time.Second)
+		for idx := 2; idx < answerCacheMaxEntries; idx++ {
+			reso.maybeCacheAnswers(fmt.Sprintf("host-%d.example", idx), addrs, 30*time.Second)
+		}
+
+		// updating an existing entry does not evict anything
+		reso.maybeCacheAnswers("host-2.example", addrs, 30*time.Second)
+		if len(reso.answerCache) != answerCacheMaxEntries {
+			t.Fatal("unexpected number of entries", len(reso.answerCache))
+		}
+
+		// when no entry has expired, we evict the one expiring first
+		reso.maybeCacheAnswers("new-0.example", addrs, 30*time.Second)
+		if len(reso.answerCache) != answerCacheMaxEntries {
+			t.Fatal("unexpected number of entries", len(reso.answerCache))
+		}
+		if _, found := reso.answerCache["host-0.example"]; found {
+			t.Fatal("expected host-0.example to have been evicted")
+		}
+		if _, found := reso.answerCache["host-1.example"]; !found {
+			t.Fatal("expected host-1.example to be cached")
+		}
+
+		// when entries have expired, we only evict the expired entries
+		now = zero.Add(25 * time.Second)
+		reso.maybeCacheAnswers("new-1.example", addrs, 30*time.Second)
+		if len(reso.answerCache) != answerCacheMaxEntries {
+			t.Fatal("unexpected number of entries", len(reso.answerCache))
+		}
+		if _, found := reso.answerCache["host-1.example"]; found {
+			t.Fatal("expected host-1.example to have been evicted")
+		}
+		if _, found := reso.answerCache["host-2.example"]; !found {
+			t.Fatal("expected host-2.example to be cached")
+		}
+	})
+}
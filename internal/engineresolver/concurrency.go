@@ -0,0 +1,39 @@
+package engineresolver
+
+//
+// Bounding the number of concurrent child lookups
+//
+
+import "context"
+
+// defaultMaxConcurrency is the default maximum number of child
+// resolver lookups that may run at the same time.
+const defaultMaxConcurrency = 8
+
+// semaphore returns the semaphore bounding the concurrent child lookups.
+func (r *Resolver) semaphore() chan any {
+	r.semOnce.Do(func() {
+		size := r.MaxConcurrency
+		if size <= 0 {
+			size = defaultMaxConcurrency
+		}
+		r.sem = make(chan any, size)
+	})
+	return r.sem
+}
+
+// acquire waits until we can run a child lookup or the context is done. On
+// success, the caller MUST call the returned function when done.
+func (r *Resolver) acquire(ctx context.Context) (func(), error) {
+	// make sure we deterministically fail when the context is already done
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sem := r.semaphore()
+	select {
+	case sem <- true:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
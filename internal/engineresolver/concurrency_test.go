@@ -0,0 +1,93 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverMaxConcurrency(t *testing.T) {
+	t.Run("we use a default when the limit is not set", func(t *testing.T) {
+		reso := &Resolver{}
+		if cap(reso.semaphore()) != defaultMaxConcurrency {
+			t.Fatal("unexpected semaphore capacity", cap(reso.semaphore()))
+		}
+	})
+
+	t.Run("we never run more than MaxConcurrency lookups at once", func(t *testing.T) {
+		const limit = 2
+		var (
+			inflight = &atomic.Int64{}
+			maximum  = &atomic.Int64{}
+			unblock  = make(chan any)
+		)
+		reso := &Resolver{
+			MaxConcurrency: limit,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						current := inflight.Add(1)
+						defer inflight.Add(-1)
+						for {
+							prev := maximum.Load()
+							if current <= prev || maximum.CompareAndSwap(prev, current) {
+								break
+							}
+						}
+						<-unblock
+						return []string{"8.8.8.8"}, nil
+					},
+				}
+				return reso, nil
+			},
+		}
+		wg := &sync.WaitGroup{}
+		for idx := 0; idx < 6; idx++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ri := &resolverinfo{URL: "https://dns.google/dns-query"}
+				reso.lookupHost(context.Background(), ri, "www.example.com")
+			}()
+		}
+		// wait for the limit to be reached and then give the other
+		// goroutines some time to (incorrectly) exceed it
+		for inflight.Load() < limit {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(100 * time.Millisecond)
+		close(unblock)
+		wg.Wait()
+		if maximum.Load() != limit {
+			t.Fatal("unexpected maximum concurrency", maximum.Load())
+		}
+	})
+
+	t.Run("we stop waiting when the context is done", func(t *testing.T) {
+		reso := &Resolver{MaxConcurrency: 1}
+		release, err := reso.acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel() // fail immediately
+		ri := &resolverinfo{URL: "https://dns.google/dns-query", Score: 0.5}
+		addrs, err := reso.lookupHost(ctx, ri, "www.example.com")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal("unexpected err", err)
+		}
+		if addrs != nil {
+			t.Fatal("expected nil addrs")
+		}
+		if ri.Score != 0.5 {
+			t.Fatal("we should not have changed the score", ri.Score)
+		}
+	})
+}
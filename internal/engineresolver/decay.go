@@ -0,0 +1,42 @@
+package engineresolver
+
+//
+// Aging persisted scores
+//
+
+import "math"
+
+// neutralScore is the score toward which we pull the persisted scores
+// when ScoreHalfLife is positive. Like deterministicInitialScore, it is
+// the expected value of the random initial score.
+const neutralScore = 0.5
+
+// decayscores pulls each persisted score toward neutralScore proportionally to
+// the time elapsed since we last updated it, such that the distance from
+// neutralScore halves every ScoreHalfLife. We do not change the scores
+// when ScoreHalfLife is not positive and the entries whose update time
+// is unknown or in the future.
+func (r *Resolver) decayscores(ri []*resolverinfo) {
+	if r.ScoreHalfLife <= 0 {
+		return
+	}
+	now := r.timeNow()
+	for _, e := range ri {
+		if e.Updated.IsZero() {
+			continue // we don't know when we last updated this entry
+		}
+		elapsed := now.Sub(e.Updated)
+		if elapsed <= 0 {
+			continue // the clock may have jumped backwards
+		}
+		factor := math.Pow(0.5, float64(elapsed)/float64(r.ScoreHalfLife))
+		e.Score = neutralScore + (e.Score-neutralScore)*factor
+		e.Updated = now
+	}
+}
+
+// updatescore sets the score of the given entry and records the update time.
+func (r *Resolver) updatescore(e *resolverinfo, score float64) {
+	e.Score = score
+	e.Updated = r.timeNow()
+}
@@ -0,0 +1,114 @@
+package engineresolver
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+)
+
+func TestResolverScoreHalfLife(t *testing.T) {
+	now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	// newResolver returns a resolver using the given half life and a fixed clock
+	// whose KVStore contains an old and a recent entry having high scores.
+	newResolver := func(t *testing.T, halfLife time.Duration) *Resolver {
+		reso := &Resolver{
+			KVStore:       &kvstore.Memory{},
+			ScoreHalfLife: halfLife,
+			timeNowFn: func() time.Time {
+				return now
+			},
+		}
+		state := []*resolverinfo{{
+			URL:     "https://dns.google/dns-query",
+			Score:   0.9,
+			Updated: now.Add(-60 * 24 * time.Hour),
+		}, {
+			URL:     "https://dns.quad9.net/dns-query",
+			Score:   0.9,
+			Updated: now.Add(-time.Minute),
+		}, {
+			URL:   "https://cloudflare-dns.com/dns-query",
+			Score: 0.9,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return reso
+	}
+
+	// scoresByURL returns the scores inside the state indexed by URL.
+	scoresByURL := func(ri []*resolverinfo) map[string]float64 {
+		out := make(map[string]float64)
+		for _, e := range ri {
+			out[e.URL] = e.Score
+		}
+		return out
+	}
+
+	t.Run("we decay old scores toward neutral and preserve recent ones", func(t *testing.T) {
+		reso := newResolver(t, 30*24*time.Hour)
+		scores := scoresByURL(reso.readstatedefault())
+
+		// two half lives elapsed: 0.5 + (0.9-0.5)/4
+		if v := scores["https://dns.google/dns-query"]; math.Abs(v-0.6) > 1e-09 {
+			t.Fatal("unexpected old score", v)
+		}
+		if v := scores["https://dns.quad9.net/dns-query"]; math.Abs(v-0.9) > 1e-04 {
+			t.Fatal("unexpected recent score", v)
+		}
+		if v := scores["https://cloudflare-dns.com/dns-query"]; v != 0.9 {
+			t.Fatal("expected to preserve a score without update time", v)
+		}
+	})
+
+	t.Run("we record the update time of decayed scores", func(t *testing.T) {
+		reso := newResolver(t, 30*24*time.Hour)
+		for _, e := range reso.readstatedefault() {
+			if e.URL == "https://dns.google/dns-query" && !e.Updated.Equal(now) {
+				t.Fatal("unexpected update time", e.Updated)
+			}
+		}
+	})
+
+	t.Run("a zero ScoreHalfLife preserves all the scores", func(t *testing.T) {
+		reso := newResolver(t, 0)
+		scores := scoresByURL(reso.readstatedefault())
+		if v := scores["https://dns.google/dns-query"]; v != 0.9 {
+			t.Fatal("unexpected old score", v)
+		}
+	})
+
+	t.Run("we decay low scores upward", func(t *testing.T) {
+		reso := &Resolver{
+			ScoreHalfLife: time.Hour,
+			timeNowFn: func() time.Time {
+				return now
+			},
+		}
+		ri := []*resolverinfo{{
+			URL:     "https://dns.google/dns-query",
+			Score:   0.1,
+			Updated: now.Add(-time.Hour),
+		}}
+		reso.decayscores(ri)
+		if v := ri[0].Score; math.Abs(v-0.3) > 1e-09 {
+			t.Fatal("unexpected score", v)
+		}
+	})
+
+	t.Run("updatescore records the update time", func(t *testing.T) {
+		reso := &Resolver{
+			timeNowFn: func() time.Time {
+				return now
+			},
+		}
+		e := &resolverinfo{URL: "https://dns.google/dns-query"}
+		reso.updatescore(e, 0.7)
+		if e.Score != 0.7 || !e.Updated.Equal(now) {
+			t.Fatal("unexpected entry", e.Score, e.Updated)
+		}
+	})
+}
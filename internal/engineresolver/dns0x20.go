@@ -0,0 +1,144 @@
+package engineresolver
+
+//
+// DNS 0x20 case randomization
+//
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// ErrDNS0x20Mismatch indicates that the question inside a DNS response does
+// not use the same letter case of the query we sent, which suggests that
+// someone spoofed the response. See the documentation of Use0x20.
+var ErrDNS0x20Mismatch = errors.New("sessionresolver: DNS response does not echo the query case")
+
+// dns0x20MismatchError is the error returned when the question inside a DNS
+// response does not echo the query case. We keep the names such that we can
+// pass them to OnValidationMismatch.
+type dns0x20MismatchError struct {
+	got  string
+	want string
+}
+
+// Error implements error.Error.
+func (e *dns0x20MismatchError) Error() string {
+	return ErrDNS0x20Mismatch.Error()
+}
+
+// Unwrap allows consumers to check whether the error is ErrDNS0x20Mismatch.
+func (e *dns0x20MismatchError) Unwrap() error {
+	return ErrDNS0x20Mismatch
+}
+
+// maybeWrapDNSTransportWith0x20 returns the function to wrap the DNS transport
+// of the child resolver with the given URL using 0x20 encoding, chaining it with
+// the given wrapper, which may be nil. We return the given wrapper when Use0x20
+// is false, such that we don't wrap the DNS transport in such a case.
+func (r *Resolver) maybeWrapDNSTransportWith0x20(URL string,
+	wrapper func(model.DNSTransport) model.DNSTransport) func(model.DNSTransport) model.DNSTransport {
+	if !r.Use0x20 {
+		return wrapper
+	}
+	return func(txp model.DNSTransport) model.DNSTransport {
+		if wrapper != nil {
+			txp = wrapper(txp)
+		}
+		return newDNSTransport0x20(r.logger(), URL, txp, time.Now().UnixNano())
+	}
+}
+
+// dnsTransport0x20 is a model.DNSTransport randomizing the letter case
+// of the queried domain and ensuring that the response echoes it.
+type dnsTransport0x20 struct {
+	encoder model.DNSEncoder
+	logger  model.Logger
+	mu      sync.Mutex
+	rng     *rand.Rand
+	txp     model.DNSTransport
+	url     string
+}
+
+// newDNSTransport0x20 creates a new dnsTransport0x20 using the given seed.
+func newDNSTransport0x20(logger model.Logger, URL string, txp model.DNSTransport, seed int64) *dnsTransport0x20 {
+	return &dnsTransport0x20{
+		encoder: &netxlite.DNSEncoderMiekg{},
+		logger:  logger,
+		mu:      sync.Mutex{},
+		rng:     rand.New(rand.NewSource(seed)),
+		txp:     txp,
+		url:     URL,
+	}
+}
+
+var _ model.DNSTransport = &dnsTransport0x20{}
+
+// RoundTrip implements model.DNSTransport.
+func (txp *dnsTransport0x20) RoundTrip(
+	ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+	domain := txp.randomizeCase(query.Domain())
+	query = txp.encoder.Encode(domain, query.Type(), txp.txp.RequiresPadding())
+	response, err := txp.txp.RoundTrip(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if got, ok := dns0x20QuestionMatches(response.Bytes(), domain); !ok {
+		txp.logger.Warnf("sessionresolver: %s: response for %s does not echo the query case",
+			txp.url, domain)
+		return nil, &dns0x20MismatchError{got: got, want: dns.Fqdn(domain)}
+	}
+	return response, nil
+}
+
+// randomizeCase randomly changes the letter case of each letter of domain.
+func (txp *dnsTransport0x20) randomizeCase(domain string) string {
+	out := []byte(domain)
+	defer txp.mu.Unlock()
+	txp.mu.Lock()
+	for idx, ch := range out {
+		if (ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z') && txp.rng.Intn(2) == 1 {
+			out[idx] = ch ^ 0x20 // flip the case
+		}
+	}
+	return string(out)
+}
+
+// dns0x20QuestionMatches returns whether the raw response contains a
+// single question whose name exactly matches the given domain. This function
+// also returns the question name, which is empty when the response does not
+// contain a single question.
+func dns0x20QuestionMatches(rawResponse []byte, domain string) (string, bool) {
+	msg := &dns.Msg{}
+	if err := msg.Unpack(rawResponse); err != nil || len(msg.Question) != 1 {
+		return "", false
+	}
+	return msg.Question[0].Name, msg.Question[0].Name == dns.Fqdn(domain)
+}
+
+// RequiresPadding implements model.DNSTransport.
+func (txp *dnsTransport0x20) RequiresPadding() bool {
+	return txp.txp.RequiresPadding()
+}
+
+// Network implements model.DNSTransport.
+func (txp *dnsTransport0x20) Network() string {
+	return txp.txp.Network()
+}
+
+// Address implements model.DNSTransport.
+func (txp *dnsTransport0x20) Address() string {
+	return txp.txp.Address()
+}
+
+// CloseIdleConnections implements model.DNSTransport.
+func (txp *dnsTransport0x20) CloseIdleConnections() {
+	txp.txp.CloseIdleConnections()
+}
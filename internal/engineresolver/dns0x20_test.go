@@ -0,0 +1,177 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestResolverUse0x20(t *testing.T) {
+	// newTransport returns a DNS transport answering queries with 8.8.8.8
+	// and echoing the query case when echo is true. Otherwise, the response
+	// question uses lowercase letters, like a spoofed response would. The
+	// returned slice contains the domains we have seen inside the queries.
+	newTransport := func(echo bool) (model.DNSTransport, *[]string) {
+		var (
+			mu   sync.Mutex
+			seen []string
+		)
+		txp := &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+				rawQuery, err := query.Bytes()
+				if err != nil {
+					return nil, err
+				}
+				msg := &dns.Msg{}
+				if err := msg.Unpack(rawQuery); err != nil {
+					return nil, err
+				}
+				mu.Lock()
+				seen = append(seen, msg.Question[0].Name)
+				mu.Unlock()
+				reply := &dns.Msg{}
+				reply.SetReply(msg)
+				if !echo {
+					reply.Question[0].Name = strings.ToLower(reply.Question[0].Name)
+				}
+				if query.Type() == dns.TypeA {
+					reply.Answer = append(reply.Answer, &dns.A{
+						Hdr: dns.RR_Header{
+							Name:   reply.Question[0].Name,
+							Rrtype: dns.TypeA,
+							Class:  dns.ClassINET,
+							Ttl:    300,
+						},
+						A: net.IPv4(8, 8, 8, 8),
+					})
+				}
+				rawReply, err := reply.Pack()
+				if err != nil {
+					return nil, err
+				}
+				return (&netxlite.DNSDecoderMiekg{}).DecodeResponse(rawReply, query)
+			},
+			MockRequiresPadding: func() bool {
+				return false
+			},
+		}
+		return txp, &seen
+	}
+
+	// newResolver returns a resolver whose only child resolver uses the given
+	// transport, which we wrap like we would wrap the transport of a DoH resolver.
+	newResolver := func(use0x20 bool, txp model.DNSTransport) *Resolver {
+		reso := &Resolver{
+			AllowedSchemes: []string{"https"},
+			KVStore:        &kvstore.Memory{},
+			Use0x20:        use0x20,
+		}
+		reso.newChildResolverFn = func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			var wrapped model.DNSTransport = txp
+			if wrap := reso.maybeWrapDNSTransportWith0x20(URL, nil); wrap != nil {
+				wrapped = wrap(txp)
+			}
+			return netxlite.NewUnwrappedParallelResolver(wrapped), nil
+		}
+		state := []*resolverinfo{{
+			URL:   "https://dns.google/dns-query",
+			Score: 1,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return reso
+	}
+
+	// firstScore returns the score of the first resolver in the scoreboard.
+	firstScore := func(reso *Resolver) float64 {
+		return reso.Scoreboard()[0].Score
+	}
+
+	const domain = "www.example.com"
+
+	t.Run("when Use0x20 is false we do not randomize the case", func(t *testing.T) {
+		txp, seen := newTransport(false)
+		reso := newResolver(false, txp)
+		if _, err := reso.LookupHost(context.Background(), domain); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range *seen {
+			if name != domain+"." {
+				t.Fatal("unexpected query name", name)
+			}
+		}
+	})
+
+	t.Run("we accept responses echoing the query case", func(t *testing.T) {
+		txp, seen := newTransport(true)
+		reso := newResolver(true, txp)
+		addrs, err := reso.LookupHost(context.Background(), domain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+			t.Fatal("unexpected addrs", addrs)
+		}
+		if len(*seen) <= 0 {
+			t.Fatal("expected to see queries")
+		}
+		for _, name := range *seen {
+			if !strings.EqualFold(name, domain+".") {
+				t.Fatal("unexpected query name", name)
+			}
+		}
+		if score := firstScore(reso); score != 1 {
+			t.Fatal("unexpected score", score)
+		}
+	})
+
+	t.Run("we reject responses not echoing the query case", func(t *testing.T) {
+		txp, _ := newTransport(false)
+		reso := newResolver(true, txp)
+		addrs, err := reso.LookupHost(context.Background(), domain)
+		if !errors.Is(err, ErrDNS0x20Mismatch) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(addrs) != 0 {
+			t.Fatal("expected no addrs", addrs)
+		}
+		if score := firstScore(reso); score >= 1 {
+			t.Fatal("expected the resolver to be penalized", score)
+		}
+		var failures int
+		for _, entry := range reso.ArchivalResults() {
+			if entry.Failure != nil && strings.HasSuffix(*entry.Failure, ErrDNS0x20Mismatch.Error()) {
+				failures++
+			}
+		}
+		if failures <= 0 {
+			t.Fatal("expected to record the 0x20 mismatch")
+		}
+	})
+}
+
+func TestDNSTransport0x20RandomizeCase(t *testing.T) {
+	txp := newDNSTransport0x20(model.DiscardLogger, "https://dns.google/dns-query", nil, 4)
+	domain := "www.example-123.com"
+	var changed bool
+	for idx := 0; idx < 16; idx++ {
+		out := txp.randomizeCase(domain)
+		if !strings.EqualFold(out, domain) {
+			t.Fatal("unexpected domain", out)
+		}
+		changed = changed || out != domain
+	}
+	if !changed {
+		t.Fatal("expected to randomize the case at least once")
+	}
+}
@@ -0,0 +1,150 @@
+package engineresolver
+
+//
+// Requiring DNSSEC authenticated answers
+//
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// ErrDNSSECNotAuthenticated indicates that a DNS response contains DNSSEC
+// signatures, meaning that the zone is signed, but the child resolver did not
+// set the AD bit, meaning that it did not authenticate the answer.
+var ErrDNSSECNotAuthenticated = errors.New("sessionresolver: DNSSEC answer not authenticated")
+
+// LastAuthenticated returns whether the child resolver lookup that succeeded last
+// returned answers authenticated using DNSSEC, i.e., whether all the responses
+// had the AD bit set. This function only returns meaningful results when the
+// RequireDNSSEC field is true and returns false when no lookup has succeeded yet.
+func (r *Resolver) LastAuthenticated() bool {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	return r.lastAuthenticated
+}
+
+// setLastAuthenticated sets the value returned by LastAuthenticated.
+func (r *Resolver) setLastAuthenticated(value bool) {
+	r.mu.Lock()
+	r.lastAuthenticated = value
+	r.mu.Unlock()
+}
+
+// dnssecTracker tracks whether all the responses of a child
+// resolver lookup contained answers authenticated using DNSSEC.
+type dnssecTracker struct {
+	authenticated int64
+	mu            sync.Mutex
+	responses     int64
+}
+
+// onResponse records whether a response had the AD bit set.
+func (dt *dnssecTracker) onResponse(authenticated bool) {
+	dt.mu.Lock()
+	dt.responses++
+	if authenticated {
+		dt.authenticated++
+	}
+	dt.mu.Unlock()
+}
+
+// allAuthenticated returns whether we have seen responses and
+// all of them contained authenticated answers.
+func (dt *dnssecTracker) allAuthenticated() bool {
+	defer dt.mu.Unlock()
+	dt.mu.Lock()
+	return dt.responses > 0 && dt.authenticated == dt.responses
+}
+
+// dnssecTrackerKey is the context key for the dnssecTracker.
+type dnssecTrackerKey struct{}
+
+// withDNSSECTracker returns a copy of ctx using the given tracker.
+func withDNSSECTracker(ctx context.Context, tracker *dnssecTracker) context.Context {
+	return context.WithValue(ctx, dnssecTrackerKey{}, tracker)
+}
+
+// maybeWrapDNSTransportWithDNSSEC returns the function to wrap the DNS transport
+// of the child resolver with the given URL to validate the DNSSEC status of the
+// responses, chaining it with the given wrapper, which may be nil. We return the
+// given wrapper when RequireDNSSEC is false, such that we don't wrap the DNS
+// transport in such a case.
+func (r *Resolver) maybeWrapDNSTransportWithDNSSEC(URL string,
+	wrapper func(model.DNSTransport) model.DNSTransport) func(model.DNSTransport) model.DNSTransport {
+	if !r.RequireDNSSEC {
+		return wrapper
+	}
+	return func(txp model.DNSTransport) model.DNSTransport {
+		if wrapper != nil {
+			txp = wrapper(txp)
+		}
+		return &dnsTransportDNSSEC{logger: r.logger(), txp: txp, url: URL}
+	}
+}
+
+// dnsTransportDNSSEC is a model.DNSTransport failing when the response
+// to a query for a signed zone does not have the AD bit set.
+type dnsTransportDNSSEC struct {
+	logger model.Logger
+	txp    model.DNSTransport
+	url    string
+}
+
+var _ model.DNSTransport = &dnsTransportDNSSEC{}
+
+// RoundTrip implements model.DNSTransport.
+func (txp *dnsTransportDNSSEC) RoundTrip(
+	ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+	response, err := txp.txp.RoundTrip(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	msg := &dns.Msg{}
+	if err := msg.Unpack(response.Bytes()); err != nil {
+		return nil, err
+	}
+	if tracker, ok := ctx.Value(dnssecTrackerKey{}).(*dnssecTracker); ok {
+		tracker.onResponse(msg.AuthenticatedData)
+	}
+	if !msg.AuthenticatedData && dnssecHasSignatures(msg) {
+		txp.logger.Warnf("sessionresolver: %s: response for %s is signed but not authenticated",
+			txp.url, query.Domain())
+		return nil, ErrDNSSECNotAuthenticated
+	}
+	return response, nil
+}
+
+// dnssecHasSignatures returns whether the answer section contains RRSIG records.
+func dnssecHasSignatures(msg *dns.Msg) bool {
+	for _, answer := range msg.Answer {
+		if answer.Header().Rrtype == dns.TypeRRSIG {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresPadding implements model.DNSTransport.
+func (txp *dnsTransportDNSSEC) RequiresPadding() bool {
+	return txp.txp.RequiresPadding()
+}
+
+// Network implements model.DNSTransport.
+func (txp *dnsTransportDNSSEC) Network() string {
+	return txp.txp.Network()
+}
+
+// Address implements model.DNSTransport.
+func (txp *dnsTransportDNSSEC) Address() string {
+	return txp.txp.Address()
+}
+
+// CloseIdleConnections implements model.DNSTransport.
+func (txp *dnsTransportDNSSEC) CloseIdleConnections() {
+	txp.txp.CloseIdleConnections()
+}
@@ -0,0 +1,157 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestResolverRequireDNSSEC(t *testing.T) {
+	// newTransport returns a padding DNS transport answering A queries with
+	// 8.8.8.8, setting the AD bit when authenticated is true and including
+	// an RRSIG record when signed is true. The returned function tells us
+	// whether all the queries we have seen had the DO bit set.
+	newTransport := func(authenticated, signed bool) (model.DNSTransport, func() bool) {
+		var (
+			mu      sync.Mutex
+			queries int
+			withDO  int
+		)
+		txp := &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+				rawQuery, err := query.Bytes()
+				if err != nil {
+					return nil, err
+				}
+				msg := &dns.Msg{}
+				if err := msg.Unpack(rawQuery); err != nil {
+					return nil, err
+				}
+				mu.Lock()
+				queries++
+				if opt := msg.IsEdns0(); opt != nil && opt.Do() {
+					withDO++
+				}
+				mu.Unlock()
+				reply := &dns.Msg{}
+				reply.SetReply(msg)
+				reply.AuthenticatedData = authenticated
+				header := dns.RR_Header{
+					Name:   reply.Question[0].Name,
+					Rrtype: query.Type(),
+					Class:  dns.ClassINET,
+					Ttl:    300,
+				}
+				if query.Type() == dns.TypeA {
+					reply.Answer = append(reply.Answer, &dns.A{Hdr: header, A: net.IPv4(8, 8, 8, 8)})
+				}
+				if signed {
+					header.Rrtype = dns.TypeRRSIG
+					reply.Answer = append(reply.Answer, &dns.RRSIG{Hdr: header, TypeCovered: query.Type()})
+				}
+				rawReply, err := reply.Pack()
+				if err != nil {
+					return nil, err
+				}
+				return (&netxlite.DNSDecoderMiekg{}).DecodeResponse(rawReply, query)
+			},
+			MockRequiresPadding: func() bool {
+				return true
+			},
+		}
+		allDO := func() bool {
+			defer mu.Unlock()
+			mu.Lock()
+			return queries > 0 && withDO == queries
+		}
+		return txp, allDO
+	}
+
+	// newResolver returns a resolver whose only child resolver uses the given
+	// transport, which we wrap like we would wrap the transport of a DoH resolver.
+	newResolver := func(requireDNSSEC bool, txp model.DNSTransport) *Resolver {
+		reso := &Resolver{
+			AllowedSchemes: []string{"https"},
+			Deterministic:  true,
+			KVStore:        &kvstore.Memory{},
+			RequireDNSSEC:  requireDNSSEC,
+		}
+		reso.newChildResolverFn = func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			var wrapped model.DNSTransport = txp
+			if wrap := reso.maybeWrapDNSTransportWithDNSSEC(URL, nil); wrap != nil {
+				wrapped = wrap(txp)
+			}
+			return netxlite.NewUnwrappedParallelResolver(wrapped), nil
+		}
+		state := []*resolverinfo{{
+			URL:   "https://dns.google/dns-query",
+			Score: 1,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return reso
+	}
+
+	t.Run("we accept authenticated answers", func(t *testing.T) {
+		txp, allDO := newTransport(true, true)
+		reso := newResolver(true, txp)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		if !allDO() {
+			t.Fatal("expected all the queries to set the DO bit")
+		}
+		if !reso.LastAuthenticated() {
+			t.Fatal("expected the answers to be authenticated")
+		}
+		if score := reso.Scoreboard()[0].Score; score != 1 {
+			t.Fatal("unexpected score", score)
+		}
+	})
+
+	t.Run("we accept unauthenticated answers for unsigned zones", func(t *testing.T) {
+		txp, _ := newTransport(false, false)
+		reso := newResolver(true, txp)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		if reso.LastAuthenticated() {
+			t.Fatal("expected the answers not to be authenticated")
+		}
+	})
+
+	t.Run("we reject unauthenticated answers for signed zones", func(t *testing.T) {
+		txp, _ := newTransport(false, true)
+		reso := newResolver(true, txp)
+		_, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrDNSSECNotAuthenticated) {
+			t.Fatal("unexpected error", err)
+		}
+		if reso.LastAuthenticated() {
+			t.Fatal("expected the answers not to be authenticated")
+		}
+		if score := reso.Scoreboard()[0].Score; score >= 1 {
+			t.Fatal("expected the resolver to be penalized", score)
+		}
+	})
+
+	t.Run("when RequireDNSSEC is false we accept any answer", func(t *testing.T) {
+		txp, _ := newTransport(false, true)
+		reso := newResolver(false, txp)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		if reso.LastAuthenticated() {
+			t.Fatal("expected LastAuthenticated to be false")
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package engineresolver
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"net/url"
 
@@ -30,7 +32,22 @@ var errUnsupportedResolverScheme = errors.New("unsupported resolver scheme")
 //
 // - counter is the OPTIONAL byte counter;
 //
-// - proxyURL is the OPTIONAL proxy URL.
+// - proxyURL is the OPTIONAL proxy URL;
+//
+// - wrapTransport is the OPTIONAL function to wrap the DNS transport
+// used by DoH resolvers (it does not apply to the system resolver);
+//
+// - bootstrap OPTIONALLY maps the hostname of DoH resolvers to the addresses
+// to use without performing any DNS lookup for such hostname;
+//
+// - rootCAs contains the OPTIONAL root CAs to use for DoH resolvers (when
+// nil, we use the default root CAs);
+//
+// - maxResponseBytes is the maximum number of bytes we read from a single
+// DoH response (when zero or negative, we use defaultMaxDoHResponseBytes);
+//
+// - dialer is the OPTIONAL dialer DoH resolvers not using HTTP/3 should use to
+// connect to the IP addresses of the server (when nil, we use the default dialer).
 //
 // Using a proxy URL is incompatible with using HTTP/3 and this
 // factory will return an error if that happens.
@@ -42,6 +59,11 @@ func newChildResolver(
 	http3Enabled bool,
 	counter *bytecounter.Counter,
 	proxyURL *url.URL,
+	wrapTransport func(model.DNSTransport) model.DNSTransport,
+	bootstrap map[string][]string,
+	rootCAs *x509.CertPool,
+	maxResponseBytes int64,
+	dialer model.Dialer,
 ) (model.Resolver, error) {
 	runtimex.Assert(logger != nil, "passed a nil model.Logger")
 	runtimex.Assert(URL != "", "passed an empty URL")
@@ -55,7 +77,8 @@ func newChildResolver(
 	var reso model.Resolver
 	switch parsed.Scheme {
 	case "http", "https": // http is here for testing
-		reso = newChildResolverHTTPS(logger, URL, http3Enabled, counter, proxyURL)
+		reso = newChildResolverHTTPS(
+			logger, URL, http3Enabled, counter, proxyURL, wrapTransport, bootstrap, rootCAs, maxResponseBytes, dialer)
 	case "system":
 		reso = bytecounter.MaybeWrapSystemResolver(
 			netxlite.NewStdlibResolver(logger),
@@ -76,26 +99,47 @@ func newChildResolverHTTPS(
 	http3Enabled bool,
 	counter *bytecounter.Counter,
 	proxyURL *url.URL,
+	wrapTransport func(model.DNSTransport) model.DNSTransport,
+	bootstrap map[string][]string,
+	rootCAs *x509.CertPool,
+	maxResponseBytes int64,
+	dialer model.Dialer,
 ) model.Resolver {
+	reso := newBootstrapResolver(netxlite.NewStdlibResolver(logger), bootstrap)
 	var txp model.HTTPTransport
 	switch http3Enabled {
 	case false:
 		dialer := netxlite.MaybeWrapWithProxyDialer(
-			netxlite.NewDialerWithStdlibResolver(logger),
+			newChildResolverDialer(logger, reso, dialer),
 			proxyURL, // handles correctly the case where proxyURL is nil
 		)
 		thx := netxlite.NewTLSHandshakerStdlib(logger)
-		tlsDialer := netxlite.NewTLSDialer(dialer, thx)
+		tlsDialer := netxlite.NewTLSDialerWithConfig(dialer, thx, &tls.Config{RootCAs: rootCAs})
 		// TODO(https://github.com/ooni/probe/issues/2534): here we're using the QUIRKY netxlite.NewHTTPTransport
 		// function, but we can probably avoid using it, given that this code is
 		// not using tracing and does not care about those quirks.
 		txp = netxlite.NewHTTPTransport(logger, dialer, tlsDialer)
 	case true:
-		txp = netxlite.NewHTTP3TransportStdlib(logger)
+		qd := netxlite.NewQUICDialerWithResolver(netxlite.NewUDPListener(), logger, reso)
+		txp = netxlite.NewHTTP3Transport(logger, qd, &tls.Config{RootCAs: rootCAs})
 	}
 	txp = bytecounter.MaybeWrapHTTPTransport(txp, counter)
-	dnstxp := netxlite.NewDNSOverHTTPSTransportWithHTTPTransport(txp, URL)
+	txp = newHTTPTransportResponseSizeLimit(txp, maxResponseBytes)
+	var dnstxp model.DNSTransport = netxlite.NewDNSOverHTTPSTransportWithHTTPTransport(txp, URL)
+	if wrapTransport != nil {
+		dnstxp = wrapTransport(dnstxp)
+	}
 	underlying := netxlite.NewUnwrappedParallelResolver(dnstxp)
 	wrapped := netxlite.WrapResolver(logger, underlying)
 	return wrapped
 }
+
+// newChildResolverDialer returns the dialer to use for DoH resolvers not using HTTP/3. When
+// the given dialer is not nil, we use the resolver to resolve the server hostname and the
+// given dialer to connect to each resolved IP address. Otherwise, we use the default dialer.
+func newChildResolverDialer(logger model.Logger, reso model.Resolver, dialer model.Dialer) model.Dialer {
+	if dialer != nil {
+		return netxlite.WrapDialer(logger, reso, dialer)
+	}
+	return netxlite.NewDialerWithResolver(logger, reso)
+}
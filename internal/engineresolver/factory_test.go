@@ -2,12 +2,14 @@ package engineresolver
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"testing"
 
@@ -23,12 +25,19 @@ import (
 type testDNSOverHTTPSHandler struct {
 	// A contains the addresses to return.
 	A []net.IP
+
+	// Queries counts the queries we have served.
+	Queries atomic.Int64
+
+	// TTL is the TTL of the returned addresses.
+	TTL uint32
 }
 
 var _ http.Handler = &testDNSOverHTTPSHandler{}
 
 // ServeHTTP implements http.Handler
 func (h *testDNSOverHTTPSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Queries.Add(1)
 	rawQuery, err := netxlite.ReadAllContext(r.Context(), r.Body)
 	if err != nil {
 		panic(err)
@@ -51,7 +60,7 @@ func (h *testDNSOverHTTPSHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 					Name:   question0.Name,
 					Rrtype: dns.TypeA,
 					Class:  dns.ClassINET,
-					Ttl:    0,
+					Ttl:    h.TTL,
 				},
 				A: entry,
 			})
@@ -76,6 +85,11 @@ func Test_newChildResolver(t *testing.T) {
 			true,
 			bytecounter.New(),
 			&url.URL{}, // even an empty URL is enough
+			nil,
+			nil,
+			nil,
+			0,
+			nil,
 		)
 		if !errors.Is(err, errCannotUseHTTP3WithAProxyURL) {
 			t.Fatal("unexpected error", err)
@@ -92,6 +106,11 @@ func Test_newChildResolver(t *testing.T) {
 			true,
 			bytecounter.New(),
 			nil,
+			nil,
+			nil,
+			nil,
+			0,
+			nil,
 		)
 		if err == nil || !strings.HasSuffix(err.Error(), "invalid control character in URL") {
 			t.Fatal("unexpected error", err)
@@ -108,6 +127,11 @@ func Test_newChildResolver(t *testing.T) {
 			true,
 			bytecounter.New(),
 			nil,
+			nil,
+			nil,
+			nil,
+			0,
+			nil,
 		)
 		if !errors.Is(err, errUnsupportedResolverScheme) {
 			t.Fatal("unexpected error", err)
@@ -119,6 +143,40 @@ func Test_newChildResolver(t *testing.T) {
 
 	t.Run("for HTTPS resolvers", func(t *testing.T) {
 
+		t.Run("the returned resolver uses the given root CAs", func(t *testing.T) {
+			handler := &testDNSOverHTTPSHandler{
+				A: []net.IP{net.IPv4(8, 8, 8, 8)},
+			}
+			srvr := httptest.NewTLSServer(handler)
+			defer srvr.Close()
+
+			rootCAs := x509.NewCertPool()
+			rootCAs.AddCert(srvr.Certificate())
+			reso, err := newChildResolver(
+				model.DiscardLogger,
+				srvr.URL,
+				false,
+				bytecounter.New(),
+				nil,
+				nil,
+				nil,
+				rootCAs,
+				0,
+				nil,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reso.CloseIdleConnections()
+			addrs, err := reso.LookupHost(context.Background(), "dns.google")
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+				t.Fatal("unexpected addrs", addrs)
+			}
+		})
+
 		t.Run("the returned resolver wraps errors", func(t *testing.T) {
 			handler := &testDNSOverHTTPSHandler{
 				A: []net.IP{net.IPv4(8, 8, 8, 8)},
@@ -135,6 +193,11 @@ func Test_newChildResolver(t *testing.T) {
 				false,
 				bytecounter.New(),
 				nil,
+				nil,
+				nil,
+				nil,
+				0,
+				nil,
 			)
 			if err != nil {
 				t.Fatal(err)
@@ -161,6 +224,11 @@ func Test_newChildResolver(t *testing.T) {
 				false,
 				bytecounter.New(),
 				nil,
+				nil,
+				nil,
+				nil,
+				0,
+				nil,
 			)
 			if err != nil {
 				t.Fatal(err)
@@ -193,6 +261,11 @@ func Test_newChildResolver(t *testing.T) {
 				false,
 				counter,
 				nil,
+				nil,
+				nil,
+				nil,
+				0,
+				nil,
 			)
 			if err != nil {
 				t.Fatal(err)
@@ -232,6 +305,11 @@ func Test_newChildResolver(t *testing.T) {
 				false,
 				bytecounter.New(),
 				nil,
+				nil,
+				nil,
+				nil,
+				0,
+				nil,
 			)
 			if err != nil {
 				t.Fatal(err)
@@ -265,6 +343,11 @@ func Test_newChildResolver(t *testing.T) {
 					false,
 					bytecounter.New(),
 					nil,
+					nil,
+					nil,
+					nil,
+					0,
+					nil,
 				)
 				if err != nil {
 					t.Fatal(err)
@@ -297,6 +380,11 @@ func Test_newChildResolver(t *testing.T) {
 					false,
 					bytecounter.New(),
 					nil,
+					nil,
+					nil,
+					nil,
+					0,
+					nil,
 				)
 				if err != nil {
 					t.Fatal(err)
@@ -331,6 +419,11 @@ func Test_newChildResolver(t *testing.T) {
 					false,
 					counter,
 					nil,
+					nil,
+					nil,
+					nil,
+					0,
+					nil,
 				)
 				if err != nil {
 					t.Fatal(err)
@@ -0,0 +1,30 @@
+package engineresolver
+
+//
+// Failing open when there are no available child resolvers
+//
+
+// failOpenURLs contains the URLs of the child resolvers we use when FailOpen
+// is true and the effective list of child resolvers would otherwise be empty.
+var failOpenURLs = []string{
+	"https://dns.google/dns-query",
+	"https://cloudflare-dns.com/dns-query",
+}
+
+// failopenstate returns the state to use when failing open. We reuse the
+// scores of the given state, if any, and otherwise use the deterministic
+// initial score, since we do not know anything about these child resolvers.
+func failopenstate(ri []*resolverinfo) (out []*resolverinfo) {
+	scores := make(map[string]float64)
+	for _, e := range ri {
+		scores[e.URL] = e.Score
+	}
+	for _, URL := range failOpenURLs {
+		score, found := scores[URL]
+		if !found {
+			score = deterministicInitialScore
+		}
+		out = append(out, &resolverinfo{URL: URL, Score: score})
+	}
+	return
+}
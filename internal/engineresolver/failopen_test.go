@@ -0,0 +1,109 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverFailOpen(t *testing.T) {
+	// newResolver returns a deterministic resolver only allowing the given schemes whose
+	// child resolvers fail when fail is true, along with a function returning the URLs
+	// of the child resolvers we have used.
+	newResolver := func(failOpen bool, schemes []string, fail bool) (*Resolver, func() []string) {
+		var (
+			mu   sync.Mutex
+			used []string
+		)
+		reso := &Resolver{
+			AllowedSchemes: schemes,
+			Deterministic:  true,
+			FailOpen:       failOpen,
+			KVStore:        &kvstore.Memory{},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				re := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						mu.Lock()
+						used = append(used, URL)
+						mu.Unlock()
+						if fail {
+							return nil, errors.New("mocked error")
+						}
+						return []string{"8.8.8.8"}, nil
+					},
+				}
+				return re, nil
+			},
+		}
+		getUsed := func() []string {
+			defer mu.Unlock()
+			mu.Lock()
+			return append([]string{}, used...)
+		}
+		return reso, getUsed
+	}
+
+	t.Run("with an empty list and FailOpen we use the fallback list", func(t *testing.T) {
+		reso, used := newResolver(true, []string{"dot"}, true)
+		_, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		// note: the lexical order breaks the tie between the initial scores
+		expect := []string{"https://cloudflare-dns.com/dns-query", "https://dns.google/dns-query"}
+		if diff := cmp.Diff(expect, used()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when failing open we reuse the persisted scores", func(t *testing.T) {
+		reso, used := newResolver(true, []string{"dot"}, false)
+		state := []*resolverinfo{{
+			URL:   "https://dns.google/dns-query",
+			Score: 0.9,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff([]string{"https://dns.google/dns-query"}, used()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with an empty list and without FailOpen we fail", func(t *testing.T) {
+		reso, used := newResolver(false, []string{"dot"}, false)
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(addrs) != 0 {
+			t.Fatal("expected no addrs")
+		}
+		if len(used()) != 0 {
+			t.Fatal("expected to use no child resolvers", used())
+		}
+	})
+
+	t.Run("with a nonempty list we do not use the fallback list", func(t *testing.T) {
+		reso, used := newResolver(true, []string{"system"}, true)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		if diff := cmp.Diff([]string{systemResolverURL}, used()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package engineresolver
+
+//
+// Closing idle child resolvers
+//
+
+import "time"
+
+// idleReaperMinInterval is the minimum interval between checks for idle resolvers.
+const idleReaperMinInterval = time.Second
+
+// maybeStartIdleReaper starts the background goroutine closing idle child resolvers
+// when IdleTimeout is positive and the goroutine is not running. The caller MUST
+// hold r.mu. We stop the goroutine when closing all the child resolvers and we
+// do not restart it afterwards, since CloseIdleConnections runs just once.
+func (r *Resolver) maybeStartIdleReaper() {
+	if r.IdleTimeout <= 0 || r.idleReaperStop != nil || r.idleReaperClosed {
+		return
+	}
+	interval := r.IdleTimeout / 2
+	if interval < idleReaperMinInterval {
+		interval = idleReaperMinInterval
+	}
+	r.idleReaperStop = make(chan any)
+	go r.idleReaperLoop(interval, r.idleReaperStop)
+}
+
+// idleReaperLoop periodically closes the idle child resolvers until stop is closed.
+func (r *Resolver) idleReaperLoop(interval time.Duration, stop <-chan any) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.closeidleresolvers()
+		}
+	}
+}
+
+// closeidleresolvers closes and forgets the child resolvers we have not used
+// for at least IdleTimeout. Like eviction, we keep the scores, thus, when
+// needed again, we will create a new child resolver.
+func (r *Resolver) closeidleresolvers() {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if r.IdleTimeout <= 0 {
+		return
+	}
+	now := r.timeNow()
+	var lru []string
+	for _, URL := range r.resLRU {
+		if now.Sub(r.resLastUsed[URL]) < r.IdleTimeout {
+			lru = append(lru, URL)
+			continue
+		}
+		if re, found := r.res[URL]; found {
+			r.logger().Infof("sessionresolver: closing idle resolver: %s", URL)
+			re.CloseIdleConnections()
+			delete(r.res, URL)
+		}
+		delete(r.resLastUsed, URL)
+	}
+	r.resLRU = lru
+}
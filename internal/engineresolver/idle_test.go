@@ -0,0 +1,168 @@
+package engineresolver
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverIdleTimeout(t *testing.T) {
+	// newResolver returns a resolver using the given clock and
+	// a map counting how many times we closed each child resolver.
+	newResolver := func(idleTimeout time.Duration, now *time.Time) (*Resolver, map[string]int) {
+		closed := make(map[string]int)
+		reso := &Resolver{
+			IdleTimeout: idleTimeout,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				re := &mocks.Resolver{
+					MockCloseIdleConnections: func() {
+						closed[URL]++
+					},
+				}
+				return re, nil
+			},
+			timeNowFn: func() time.Time {
+				return *now
+			},
+		}
+		return reso, closed
+	}
+
+	mustGet := func(t *testing.T, reso *Resolver, URL string) {
+		if _, err := reso.getresolver(URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("we close a resolver after it has been idle for IdleTimeout", func(t *testing.T) {
+		now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		reso, closed := newResolver(time.Minute, &now)
+		defer reso.CloseIdleConnections()
+		mustGet(t, reso, "https://a.example.com/")
+
+		now = now.Add(59 * time.Second)
+		reso.closeidleresolvers()
+		if len(closed) != 0 {
+			t.Fatal("expected no resolver to be closed", closed)
+		}
+
+		now = now.Add(time.Second)
+		reso.closeidleresolvers()
+		if diff := cmp.Diff(map[string]int{"https://a.example.com/": 1}, closed); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(reso.res) != 0 || len(reso.resLRU) != 0 || len(reso.resLastUsed) != 0 {
+			t.Fatal("expected the resolver to be forgotten")
+		}
+	})
+
+	t.Run("activity resets the idle timer", func(t *testing.T) {
+		now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		reso, closed := newResolver(time.Minute, &now)
+		defer reso.CloseIdleConnections()
+		mustGet(t, reso, "https://a.example.com/")
+		mustGet(t, reso, "https://b.example.com/")
+
+		now = now.Add(30 * time.Second)
+		mustGet(t, reso, "https://a.example.com/")
+
+		now = now.Add(30 * time.Second)
+		reso.closeidleresolvers()
+		if diff := cmp.Diff(map[string]int{"https://b.example.com/": 1}, closed); diff != "" {
+			t.Fatal(diff)
+		}
+		if _, found := reso.res["https://a.example.com/"]; !found {
+			t.Fatal("expected a to still be cached")
+		}
+
+		now = now.Add(30 * time.Second)
+		reso.closeidleresolvers()
+		expectClosed := map[string]int{
+			"https://a.example.com/": 1,
+			"https://b.example.com/": 1,
+		}
+		if diff := cmp.Diff(expectClosed, closed); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("a zero IdleTimeout disables closing idle resolvers", func(t *testing.T) {
+		now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		reso, closed := newResolver(0, &now)
+		mustGet(t, reso, "https://a.example.com/")
+		if reso.idleReaperStop != nil {
+			t.Fatal("expected the idle reaper not to be running")
+		}
+
+		now = now.Add(24 * time.Hour)
+		reso.closeidleresolvers()
+		if len(closed) != 0 {
+			t.Fatal("expected no resolver to be closed", closed)
+		}
+	})
+
+	t.Run("we lazily start the idle reaper and CloseIdleConnections stops it", func(t *testing.T) {
+		now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		reso, _ := newResolver(time.Minute, &now)
+		if reso.idleReaperStop != nil {
+			t.Fatal("expected the idle reaper not to be running")
+		}
+
+		mustGet(t, reso, "https://a.example.com/")
+		stop := reso.idleReaperStop
+		if stop == nil {
+			t.Fatal("expected the idle reaper to be running")
+		}
+
+		reso.CloseIdleConnections()
+		if reso.idleReaperStop != nil {
+			t.Fatal("expected the idle reaper to have been stopped")
+		}
+		select {
+		case <-stop:
+		default:
+			t.Fatal("expected the stop channel to be closed")
+		}
+	})
+	t.Run("we do not restart the idle reaper after CloseIdleConnections", func(t *testing.T) {
+		// countIdleReapers returns the number of running idle reaper goroutines.
+		countIdleReapers := func() int {
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			return strings.Count(string(buf), "(*Resolver).idleReaperLoop(")
+		}
+
+		// waitIdleReapers waits for the number of idle reaper goroutines to become expected.
+		waitIdleReapers := func(t *testing.T, expected int) {
+			deadline := time.Now().Add(5 * time.Second)
+			for countIdleReapers() != expected {
+				if time.Now().After(deadline) {
+					t.Fatal("expected", expected, "idle reapers but got", countIdleReapers())
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		before := countIdleReapers()
+		now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		reso, _ := newResolver(time.Minute, &now)
+		mustGet(t, reso, "https://a.example.com/")
+		waitIdleReapers(t, before+1)
+
+		reso.CloseIdleConnections()
+		waitIdleReapers(t, before)
+
+		mustGet(t, reso, "https://a.example.com/")
+		if reso.idleReaperStop != nil {
+			t.Fatal("expected the idle reaper not to be running")
+		}
+		if got := countIdleReapers(); got != before {
+			t.Fatal("expected", before, "idle reapers but got", got)
+		}
+	})
+}
@@ -6,6 +6,7 @@ package engineresolver
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -39,3 +40,31 @@ func timeLimitedLookupWithTimeout(ctx context.Context, re model.Resolver,
 	defer cancel()
 	return re.LookupHost(ctx, hostname)
 }
+
+// timeLimitedLookupWithRetries is like timeLimitedLookup but retries a
+// failed lookup up to r.PerQueryRetries times unless the context is done
+// or we have exhausted the OPTIONAL budget. A nil budget is unlimited.
+func (r *Resolver) timeLimitedLookupWithRetries(ctx context.Context,
+	re model.Resolver, hostname string, budget *attemptBudget) ([]string, error) {
+	for attempt := 0; ; attempt++ {
+		if !budget.take() {
+			return nil, errAttemptBudgetExhausted
+		}
+		addrs, err := timeLimitedLookup(ctx, re, hostname)
+		if err == nil || attempt >= r.PerQueryRetries || ctx.Err() != nil || budget.exhausted() {
+			return addrs, err
+		}
+		r.logger().Infof("sessionresolver: retrying lookup %s after: %s", hostname, err.Error())
+	}
+}
+
+// maybeTruncateAnswers returns at most r.MaxAnswers sorted addresses when
+// r.MaxAnswers is positive and otherwise returns the original addresses.
+func (r *Resolver) maybeTruncateAnswers(addrs []string) []string {
+	if r.MaxAnswers <= 0 || len(addrs) <= r.MaxAnswers {
+		return addrs
+	}
+	out := append([]string{}, addrs...)
+	sort.Strings(out)
+	return out[:r.MaxAnswers]
+}
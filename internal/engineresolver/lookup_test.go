@@ -3,11 +3,14 @@ package engineresolver
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
 	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 func TestTimeLimitedLookupSuccess(t *testing.T) {
@@ -42,3 +45,82 @@ func TestTimeLimitedLookupFailure(t *testing.T) {
 		t.Fatal("expected nil here")
 	}
 }
+
+func TestMaybeTruncateAnswers(t *testing.T) {
+	addrs := []string{"8.8.8.8", "2001:4860:4860::8888", "8.8.4.4", "2001:4860:4860::8844"}
+
+	type testcase struct {
+		name       string
+		maxAnswers int
+		input      []string
+		expect     []string
+	}
+
+	cases := []testcase{{
+		name:       "with zero we do not truncate",
+		maxAnswers: 0,
+		input:      addrs,
+		expect:     addrs,
+	}, {
+		name:       "with negative values we do not truncate",
+		maxAnswers: -1,
+		input:      addrs,
+		expect:     addrs,
+	}, {
+		name:       "with fewer addresses than the limit we do not truncate",
+		maxAnswers: 10,
+		input:      addrs,
+		expect:     addrs,
+	}, {
+		name:       "with more addresses than the limit we truncate deterministically",
+		maxAnswers: 2,
+		input:      addrs,
+		expect:     []string{"2001:4860:4860::8844", "2001:4860:4860::8888"},
+	}, {
+		name:       "we keep at least one address",
+		maxAnswers: 1,
+		input:      addrs,
+		expect:     []string{"2001:4860:4860::8844"},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := append([]string{}, tc.input...)
+			reso := &Resolver{MaxAnswers: tc.maxAnswers}
+			got := reso.maybeTruncateAnswers(input)
+			if diff := cmp.Diff(tc.expect, got); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.input, input); diff != "" {
+				t.Fatal("modified the input", diff)
+			}
+		})
+	}
+}
+
+func TestLookupHostWithMaxAnswers(t *testing.T) {
+	reso := &Resolver{
+		KVStore:    &kvstore.Memory{},
+		MaxAnswers: 3,
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			reso := &mocks.Resolver{
+				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+					var addrs []string
+					for idx := 20; idx > 0; idx-- {
+						addrs = append(addrs, fmt.Sprintf("10.0.0.%d", idx))
+					}
+					return addrs, nil
+				},
+			}
+			return reso, nil
+		},
+	}
+	addrs, err := reso.LookupHost(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"10.0.0.1", "10.0.0.10", "10.0.0.11"}
+	if diff := cmp.Diff(expect, addrs); diff != "" {
+		t.Fatal(diff)
+	}
+}
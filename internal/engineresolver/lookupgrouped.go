@@ -0,0 +1,35 @@
+package engineresolver
+
+//
+// Resolving a domain and grouping the addresses by family
+//
+
+import (
+	"context"
+
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// LookupHostGrouped is like LookupHost except that it partitions the resolved addresses
+// into IPv4 and IPv6 addresses, preserving their relative order within each family. We
+// only perform a single LookupHost call. We ignore the entries that are not valid IP
+// addresses, which should not happen. On failure, this function returns nil slices and
+// the error returned by LookupHost.
+func (r *Resolver) LookupHostGrouped(ctx context.Context, domain string) (ipv4, ipv6 []string, err error) {
+	addrs, err := r.LookupHost(ctx, domain)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, addr := range addrs {
+		isv6, err := netxlite.IsIPv6(addr)
+		switch {
+		case err != nil:
+			r.logger().Warnf("sessionresolver: ignoring invalid address: %s", addr)
+		case isv6:
+			ipv6 = append(ipv6, addr)
+		default:
+			ipv4 = append(ipv4, addr)
+		}
+	}
+	return ipv4, ipv6, nil
+}
@@ -0,0 +1,93 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverLookupHostGrouped(t *testing.T) {
+	// newResolver returns a resolver whose only child resolver
+	// invokes the given function to resolve domains.
+	newResolver := func(t *testing.T, lookupHost func(ctx context.Context, domain string) ([]string, error)) (*Resolver, *int) {
+		var count int
+		reso := &Resolver{
+			Deterministic: true,
+			KVStore:       &kvstore.Memory{},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				re := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						count++
+						return lookupHost(ctx, domain)
+					},
+				}
+				return re, nil
+			},
+		}
+		state := []*resolverinfo{{
+			URL:   "https://dns.google/dns-query",
+			Score: 1,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return reso, &count
+	}
+
+	t.Run("with mixed-family addresses", func(t *testing.T) {
+		reso, count := newResolver(t, func(ctx context.Context, domain string) ([]string, error) {
+			return []string{
+				"2001:4860:4860::8888", "8.8.8.8", "antani",
+				"8.8.4.4", "2001:4860:4860::8844",
+			}, nil
+		})
+		ipv4, ipv6, err := reso.LookupHostGrouped(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8", "8.8.4.4"}, ipv4); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff([]string{"2001:4860:4860::8888", "2001:4860:4860::8844"}, ipv6); diff != "" {
+			t.Fatal(diff)
+		}
+		if *count != 1 {
+			t.Fatal("expected a single lookup, got", *count)
+		}
+	})
+
+	t.Run("with only IPv4 addresses", func(t *testing.T) {
+		reso, _ := newResolver(t, func(ctx context.Context, domain string) ([]string, error) {
+			return []string{"8.8.8.8", "8.8.4.4"}, nil
+		})
+		ipv4, ipv6, err := reso.LookupHostGrouped(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8", "8.8.4.4"}, ipv4); diff != "" {
+			t.Fatal(diff)
+		}
+		if ipv6 != nil {
+			t.Fatal("expected nil ipv6", ipv6)
+		}
+	})
+
+	t.Run("on failure", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		reso, _ := newResolver(t, func(ctx context.Context, domain string) ([]string, error) {
+			return nil, expected
+		})
+		ipv4, ipv6, err := reso.LookupHostGrouped(context.Background(), "dns.google")
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if ipv4 != nil || ipv6 != nil {
+			t.Fatal("expected nil addresses", ipv4, ipv6)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package engineresolver
+
+//
+// Resolving several domains at once
+//
+
+import (
+	"context"
+	"sync"
+)
+
+// LookupHosts resolves all the given domains using LookupHost and returns the
+// addresses of the domains we could resolve and the errors of the domains we could
+// not resolve. We resolve at most MaxConcurrency domains at the same time (or
+// defaultMaxConcurrency when MaxConcurrency is zero or negative) and we resolve
+// duplicate domains just once. Because each lookup uses LookupHost, the lookups
+// share the already created child resolvers and the answers cache and update the
+// scores like concurrent LookupHost calls would do.
+func (r *Resolver) LookupHosts(ctx context.Context, domains []string) (map[string][]string, map[string]error) {
+	addrs := make(map[string][]string)
+	errs := make(map[string]error)
+	concurrency := r.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultMaxConcurrency
+	}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	work := make(chan string)
+	for idx := 0; idx < concurrency; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range work {
+				result, err := r.LookupHost(ctx, domain)
+				mu.Lock()
+				if err != nil {
+					errs[domain] = err
+				} else {
+					addrs[domain] = result
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		if seen[domain] {
+			continue // we have already scheduled this domain
+		}
+		seen[domain] = true
+		work <- domain
+	}
+	close(work)
+	wg.Wait()
+	return addrs, errs
+}
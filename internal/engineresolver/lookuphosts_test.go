@@ -0,0 +1,96 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverLookupHosts(t *testing.T) {
+	answers := map[string][]string{
+		"dns.google":      {"8.8.8.8"},
+		"www.example.com": {"93.184.216.34"},
+		"www.example.org": {"93.184.216.34"},
+	}
+	expected := errors.New("mocked error")
+
+	var (
+		mu      sync.Mutex
+		created = make(map[string]int)
+		lookups = make(map[string]int)
+	)
+	reso := &Resolver{
+		Deterministic:  true,
+		KVStore:        &kvstore.Memory{},
+		MaxConcurrency: 2,
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			mu.Lock()
+			created[URL]++
+			mu.Unlock()
+			re := &mocks.Resolver{
+				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+					mu.Lock()
+					lookups[domain]++
+					mu.Unlock()
+					if addrs, found := answers[domain]; found {
+						return addrs, nil
+					}
+					return nil, expected
+				},
+			}
+			return re, nil
+		},
+	}
+	state := []*resolverinfo{{
+		URL:   "https://dns.google/dns-query",
+		Score: 1,
+	}}
+	if err := reso.writestate(state); err != nil {
+		t.Fatal(err)
+	}
+
+	domains := []string{"dns.google", "www.example.com", "www.example.org", "dns.google"}
+	addrs, errs := reso.LookupHosts(context.Background(), domains)
+	if diff := cmp.Diff(answers, addrs); diff != "" {
+		t.Fatal(diff)
+	}
+	if len(errs) != 0 {
+		t.Fatal("unexpected errors", errs)
+	}
+
+	t.Run("we reuse the child resolvers", func(t *testing.T) {
+		if diff := cmp.Diff(map[string]int{"https://dns.google/dns-query": 1}, created); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we resolve duplicate domains once", func(t *testing.T) {
+		expect := map[string]int{"dns.google": 1, "www.example.com": 1, "www.example.org": 1}
+		if diff := cmp.Diff(expect, lookups); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we return the per-domain errors", func(t *testing.T) {
+		addrs, errs := reso.LookupHosts(context.Background(), []string{"dns.google", "nonexistent.example"})
+		if diff := cmp.Diff(map[string][]string{"dns.google": {"8.8.8.8"}}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(errs) != 1 || !errors.Is(errs["nonexistent.example"], ErrLookupHost) {
+			t.Fatal("unexpected errors", errs)
+		}
+	})
+
+	t.Run("with no domains", func(t *testing.T) {
+		addrs, errs := reso.LookupHosts(context.Background(), nil)
+		if len(addrs) != 0 || len(errs) != 0 {
+			t.Fatal("expected empty results", addrs, errs)
+		}
+	})
+}
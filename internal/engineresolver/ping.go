@@ -0,0 +1,38 @@
+package engineresolver
+
+//
+// Checking whether a single child resolver works
+//
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// pingResolverDomain is the domain we resolve in PingResolver.
+const pingResolverDomain = "dns.google"
+
+// PingResolver creates the child resolver with the given URL (e.g.,
+// "https://dns.google/dns-query" or "http3://dns.google/dns-query"), uses it to
+// resolve a well-known domain, and returns how much time the lookup took or
+// the error that occurred. This method is meant for diagnostics: it does not
+// change the scores, it does not use or fill the cache of child resolvers, and
+// it does not record the lookup using the Recorder.
+func (r *Resolver) PingResolver(ctx context.Context, URL string) (time.Duration, error) {
+	h3 := strings.HasPrefix(URL, "http3://")
+	childURL := URL
+	if h3 {
+		childURL = strings.Replace(URL, "http3://", "https://", 1)
+	}
+	re, err := r.newChildResolver(h3, childURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer re.CloseIdleConnections()
+	t0 := r.timeNow()
+	if _, err := re.LookupHost(ctx, pingResolverDomain); err != nil {
+		return 0, err
+	}
+	return r.timeNow().Sub(t0), nil
+}
@@ -0,0 +1,116 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverPingResolver(t *testing.T) {
+	// newResolver returns a resolver whose child resolvers use the given lookup
+	// function and whose clock advances by one second each time we read it.
+	newResolver := func(lookup func(ctx context.Context, domain string) ([]string, error)) (*Resolver, map[string]int) {
+		closed := make(map[string]int)
+		now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		reso := &Resolver{
+			KVStore: &kvstore.Memory{},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				re := &mocks.Resolver{
+					MockLookupHost: lookup,
+					MockCloseIdleConnections: func() {
+						closed[URL]++
+					},
+				}
+				return re, nil
+			},
+			timeNowFn: func() time.Time {
+				now = now.Add(time.Second)
+				return now
+			},
+		}
+		return reso, closed
+	}
+
+	// initialState is the state we store before pinging.
+	initialState := []*resolverinfo{{
+		URL:   "https://dns.google/dns-query",
+		Score: 0.5,
+	}}
+
+	// checkUnchanged ensures that pinging did not mutate the resolver.
+	checkUnchanged := func(t *testing.T, reso *Resolver) {
+		state, err := reso.readstate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(initialState, state); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(reso.res) != 0 {
+			t.Fatal("expected no cached child resolvers")
+		}
+	}
+
+	t.Run("on success", func(t *testing.T) {
+		var domains []string
+		reso, closed := newResolver(func(ctx context.Context, domain string) ([]string, error) {
+			domains = append(domains, domain)
+			return []string{"8.8.8.8"}, nil
+		})
+		if err := reso.writestate(initialState); err != nil {
+			t.Fatal(err)
+		}
+		latency, err := reso.PingResolver(context.Background(), "http3://dns.google/dns-query")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if latency != time.Second {
+			t.Fatal("unexpected latency", latency)
+		}
+		if diff := cmp.Diff([]string{pingResolverDomain}, domains); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff(map[string]int{"https://dns.google/dns-query": 1}, closed); diff != "" {
+			t.Fatal(diff)
+		}
+		checkUnchanged(t, reso)
+	})
+
+	t.Run("on failure", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		reso, closed := newResolver(func(ctx context.Context, domain string) ([]string, error) {
+			return nil, expected
+		})
+		if err := reso.writestate(initialState); err != nil {
+			t.Fatal(err)
+		}
+		latency, err := reso.PingResolver(context.Background(), "https://dns.google/dns-query")
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if latency != 0 {
+			t.Fatal("unexpected latency", latency)
+		}
+		if diff := cmp.Diff(map[string]int{"https://dns.google/dns-query": 1}, closed); diff != "" {
+			t.Fatal(diff)
+		}
+		checkUnchanged(t, reso)
+	})
+
+	t.Run("when we cannot create the child resolver", func(t *testing.T) {
+		reso := &Resolver{KVStore: &kvstore.Memory{}}
+		latency, err := reso.PingResolver(context.Background(), "antani://dns.google/")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if latency != 0 {
+			t.Fatal("unexpected latency", latency)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package engineresolver
+
+//
+// Flagging private answers for public domains
+//
+
+import (
+	"strings"
+
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// privateAnswers returns the private or bogon addresses inside addrs when
+// FlagPrivateAnswers is true and the hostname is a public domain, i.e., it
+// does not end with ".local". Otherwise, this function returns nil.
+func (r *Resolver) privateAnswers(hostname string, addrs []string) (out []string) {
+	if !r.FlagPrivateAnswers || isLocalDomain(hostname) {
+		return nil
+	}
+	for _, addr := range addrs {
+		if netxlite.IsBogon(addr) {
+			out = append(out, addr)
+		}
+	}
+	return
+}
+
+// isLocalDomain returns whether the given hostname is a multicast DNS
+// domain (see RFC 6762), for which private addresses are legitimate.
+func isLocalDomain(hostname string) bool {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	return hostname == "local" || strings.HasSuffix(hostname, ".local")
+}
+
+// checkPrivateAnswers counts, logs, and reports the given addrs when they
+// contain private addresses for a public domain (see FlagPrivateAnswers) and
+// returns whether this happened, such that the caller can penalize the child
+// resolver when PenalizePrivateAnswers is true.
+func (r *Resolver) checkPrivateAnswers(URL, hostname string, addrs []string) bool {
+	private := r.privateAnswers(hostname, addrs)
+	if len(private) <= 0 {
+		return false
+	}
+	r.logger().Warnf("sessionresolver: %s returned private addresses for %s: %v", URL, hostname, private)
+	r.mu.Lock()
+	if r.privateAnswersCount == nil {
+		r.privateAnswersCount = make(map[string]int64)
+	}
+	r.privateAnswersCount[URL]++
+	r.mu.Unlock()
+	r.reportValidationMismatch(URL, hostname, ValidationMismatchPrivateAnswers, private, nil)
+	return true
+}
@@ -0,0 +1,169 @@
+package engineresolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverFlagPrivateAnswers(t *testing.T) {
+	const googleURL = "https://dns.google/dns-query"
+
+	// mismatch is a call to OnValidationMismatch
+	type mismatch struct {
+		URL, Domain, Reason string
+		Got, Want           []string
+	}
+
+	// newResolver returns a resolver using a single child resolver
+	// that returns the given addresses for any domain.
+	newResolver := func(t *testing.T, flag, penalize bool, addrs []string, mismatches *[]mismatch) *Resolver {
+		reso := &Resolver{
+			Deterministic:          true,
+			FlagPrivateAnswers:     flag,
+			KVStore:                &kvstore.Memory{},
+			PenalizePrivateAnswers: penalize,
+			OnValidationMismatch: func(URL, domain string, reason string, got, want []string) {
+				*mismatches = append(*mismatches, mismatch{URL, domain, reason, got, want})
+			},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				re := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						return addrs, nil
+					},
+				}
+				return re, nil
+			},
+		}
+		state := []*resolverinfo{{
+			URL:   googleURL,
+			Score: 1,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return reso
+	}
+
+	// entryOf returns the scoreboard entry of googleURL.
+	entryOf := func(t *testing.T, reso *Resolver) ResolverScore {
+		for _, entry := range reso.Scoreboard() {
+			if entry.URL == googleURL {
+				return entry
+			}
+		}
+		t.Fatal("cannot find", googleURL)
+		return ResolverScore{}
+	}
+
+	t.Run("we flag private answers for a public domain", func(t *testing.T) {
+		var mismatches []mismatch
+		reso := newResolver(t, true, false, []string{"10.0.0.1", "93.184.216.34"}, &mismatches)
+		addrs, err := reso.LookupHost(context.Background(), "www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"10.0.0.1", "93.184.216.34"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		expect := []mismatch{{
+			URL:    googleURL,
+			Domain: "www.example.com",
+			Reason: ValidationMismatchPrivateAnswers,
+			Got:    []string{"10.0.0.1"},
+		}}
+		if diff := cmp.Diff(expect, mismatches); diff != "" {
+			t.Fatal(diff)
+		}
+		entry := entryOf(t, reso)
+		if entry.PrivateAnswers != 1 {
+			t.Fatal("unexpected private answers", entry.PrivateAnswers)
+		}
+		if entry.Score != 1 {
+			t.Fatal("unexpected score", entry.Score)
+		}
+	})
+
+	t.Run("we optionally penalize the child resolver", func(t *testing.T) {
+		var mismatches []mismatch
+		reso := newResolver(t, true, true, []string{"192.168.1.1"}, &mismatches)
+		addrs, err := reso.LookupHost(context.Background(), "www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"192.168.1.1"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		entry := entryOf(t, reso)
+		if entry.PrivateAnswers != 1 {
+			t.Fatal("unexpected private answers", entry.PrivateAnswers)
+		}
+		if entry.Score >= 1 {
+			t.Fatal("expected the score to decrease", entry.Score)
+		}
+		if entry.ConsecutiveFailures != 0 {
+			t.Fatal("unexpected consecutive failures", entry.ConsecutiveFailures)
+		}
+	})
+
+	t.Run("we do not flag private answers for .local domains", func(t *testing.T) {
+		var mismatches []mismatch
+		reso := newResolver(t, true, true, []string{"192.168.1.1"}, &mismatches)
+		if _, err := reso.LookupHost(context.Background(), "printer.local"); err != nil {
+			t.Fatal(err)
+		}
+		if len(mismatches) != 0 {
+			t.Fatal("unexpected mismatches", mismatches)
+		}
+		if entry := entryOf(t, reso); entry.PrivateAnswers != 0 {
+			t.Fatal("unexpected private answers", entry.PrivateAnswers)
+		}
+	})
+
+	t.Run("we do not flag public answers", func(t *testing.T) {
+		var mismatches []mismatch
+		reso := newResolver(t, true, true, []string{"93.184.216.34"}, &mismatches)
+		if _, err := reso.LookupHost(context.Background(), "www.example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if len(mismatches) != 0 {
+			t.Fatal("unexpected mismatches", mismatches)
+		}
+	})
+
+	t.Run("we do nothing when the flag is not set", func(t *testing.T) {
+		var mismatches []mismatch
+		reso := newResolver(t, false, true, []string{"10.0.0.1"}, &mismatches)
+		if _, err := reso.LookupHost(context.Background(), "www.example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if len(mismatches) != 0 {
+			t.Fatal("unexpected mismatches", mismatches)
+		}
+		if entry := entryOf(t, reso); entry.PrivateAnswers != 0 || entry.Score != 1 {
+			t.Fatal("unexpected entry", entry)
+		}
+	})
+}
+
+func TestIsLocalDomain(t *testing.T) {
+	cases := map[string]bool{
+		"printer.local":   true,
+		"PRINTER.LOCAL.":  true,
+		"local":           true,
+		"www.example.com": false,
+		"localhost":       false,
+		"notlocal":        false,
+	}
+	for input, expect := range cases {
+		t.Run(input, func(t *testing.T) {
+			if got := isLocalDomain(input); got != expect {
+				t.Fatal("expected", expect, "got", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package engineresolver
+
+//
+// Rate limiting the lookups of each child resolver
+//
+
+import "time"
+
+// RateLimit configures a token bucket limiting how frequently we use a child resolver.
+type RateLimit struct {
+	// QueriesPerSecond is the rate at which we refill the bucket. When this
+	// field is zero or negative, we do not limit the rate.
+	QueriesPerSecond float64
+
+	// Burst is the maximum number of queries we can issue in a burst, i.e., the
+	// bucket capacity. When this field is zero or negative, we use one.
+	Burst int
+}
+
+// tokenBucket is the token bucket of a child resolver.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// allowlookup returns whether the rate limit allows us to use the child resolver
+// with the given URL now, in which case we consume a token. This function always
+// returns true when the rate limit is disabled, i.e., when the QueriesPerSecond
+// field of PerResolverRate is zero or negative.
+func (r *Resolver) allowlookup(URL string) bool {
+	qps := r.PerResolverRate.QueriesPerSecond
+	if qps <= 0 {
+		return true
+	}
+	burst := float64(r.PerResolverRate.Burst)
+	if burst <= 0 {
+		burst = 1
+	}
+	now := r.timeNow()
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if r.buckets == nil {
+		r.buckets = make(map[string]*tokenBucket)
+	}
+	bucket, found := r.buckets[URL]
+	if !found {
+		bucket = &tokenBucket{tokens: burst, updated: now} // we start with a full bucket
+		r.buckets[URL] = bucket
+	}
+	if elapsed := now.Sub(bucket.updated); elapsed > 0 {
+		bucket.tokens += elapsed.Seconds() * qps
+		if bucket.tokens > burst {
+			bucket.tokens = burst
+		}
+	}
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
@@ -0,0 +1,105 @@
+package engineresolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverPerResolverRate(t *testing.T) {
+	const (
+		google = "https://dns.google/dns-query"
+		quad9  = "https://dns.quad9.net/dns-query"
+	)
+
+	// newResolver returns a resolver preferring google and quad9, using the given
+	// clock and rate limit, and the list of the child resolvers we used.
+	newResolver := func(t *testing.T, now *time.Time, rate RateLimit) (*Resolver, *[]string) {
+		used := &[]string{}
+		reso := &Resolver{
+			Deterministic:   true,
+			KVStore:         &kvstore.Memory{},
+			PerResolverRate: rate,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				re := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						*used = append(*used, URL)
+						return []string{"8.8.8.8"}, nil
+					},
+				}
+				return re, nil
+			},
+			timeNowFn: func() time.Time {
+				return *now
+			},
+		}
+		state := []*resolverinfo{{URL: google, Score: 1}, {URL: quad9, Score: 0.9}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return reso, used
+	}
+
+	mustLookup := func(t *testing.T, reso *Resolver) {
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("we skip a resolver once its bucket is empty and resume after refill", func(t *testing.T) {
+		now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		reso, used := newResolver(t, &now, RateLimit{QueriesPerSecond: 1, Burst: 2})
+
+		mustLookup(t, reso)
+		mustLookup(t, reso)
+		mustLookup(t, reso) // google's bucket is empty
+		if diff := cmp.Diff([]string{google, google, quad9}, *used); diff != "" {
+			t.Fatal(diff)
+		}
+		if reason := reso.SkipReasons()[google]; reason != SkipReasonRateLimited {
+			t.Fatal("unexpected skip reason", reason)
+		}
+
+		now = now.Add(500 * time.Millisecond)
+		mustLookup(t, reso) // we have refilled just half a token
+		now = now.Add(500 * time.Millisecond)
+		mustLookup(t, reso) // we have refilled a token
+		if diff := cmp.Diff([]string{google, google, quad9, quad9, google}, *used); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we never refill more than the burst", func(t *testing.T) {
+		now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		reso, used := newResolver(t, &now, RateLimit{QueriesPerSecond: 1, Burst: 0})
+
+		mustLookup(t, reso)
+		now = now.Add(time.Hour)
+		mustLookup(t, reso)
+		mustLookup(t, reso) // a zero burst means a bucket of one token
+		if diff := cmp.Diff([]string{google, google, quad9}, *used); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("a zero rate disables rate limiting", func(t *testing.T) {
+		now := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		reso, used := newResolver(t, &now, RateLimit{})
+		for idx := 0; idx < 8; idx++ {
+			mustLookup(t, reso)
+		}
+		for _, URL := range *used {
+			if URL != google {
+				t.Fatal("unexpected resolver", URL)
+			}
+		}
+		if reso.buckets != nil {
+			t.Fatal("expected no token buckets")
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package engineresolver
+
+//
+// Recording the DNS response codes returned by child resolvers
+//
+
+import (
+	"context"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// rcodeTracker tracks the DNS response codes of a child resolver lookup
+// indexed by query type (e.g., "A", "AAAA"). When there are several responses
+// for the same query type (e.g., because we retried), we keep the last one.
+type rcodeTracker struct {
+	mu     sync.Mutex
+	rcodes map[string]int64
+}
+
+// onResponse records the response code of a response to a query of the given type.
+func (rt *rcodeTracker) onResponse(qtype uint16, rcode int) {
+	rt.mu.Lock()
+	if rt.rcodes == nil {
+		rt.rcodes = make(map[string]int64)
+	}
+	rt.rcodes[dns.TypeToString[qtype]] = int64(rcode)
+	rt.mu.Unlock()
+}
+
+// setArchivalRcodes sets the Rcode field of the given archival results
+// using the response codes we have seen for the corresponding query type.
+func (rt *rcodeTracker) setArchivalRcodes(results []*model.ArchivalDNSLookupResult) {
+	defer rt.mu.Unlock()
+	rt.mu.Lock()
+	for _, entry := range results {
+		if rcode, found := rt.rcodes[entry.QueryType]; found {
+			entry.Rcode = rcode
+		}
+	}
+}
+
+// rcodeTrackerKey is the context key for the rcodeTracker.
+type rcodeTrackerKey struct{}
+
+// withRcodeTracker returns a copy of ctx using the given tracker.
+func withRcodeTracker(ctx context.Context, tracker *rcodeTracker) context.Context {
+	return context.WithValue(ctx, rcodeTrackerKey{}, tracker)
+}
+
+// maybeWrapDNSTransportWithRcode returns the function to wrap the DNS transport
+// of a child resolver such that we record the response codes, chaining it with the
+// given wrapper, which may be nil. We return the given wrapper when RecordRcodes
+// is false, such that we don't wrap the DNS transport in such a case. We wrap the
+// DNS transport before validating the responses (e.g., using DNSSEC), such that
+// we also record the response codes of the responses we reject.
+func (r *Resolver) maybeWrapDNSTransportWithRcode(
+	wrapper func(model.DNSTransport) model.DNSTransport) func(model.DNSTransport) model.DNSTransport {
+	if !r.RecordRcodes {
+		return wrapper
+	}
+	return func(txp model.DNSTransport) model.DNSTransport {
+		if wrapper != nil {
+			txp = wrapper(txp)
+		}
+		return &dnsTransportRcode{txp}
+	}
+}
+
+// dnsTransportRcode is a model.DNSTransport recording the response
+// codes using the rcodeTracker inside the context, if any.
+type dnsTransportRcode struct {
+	txp model.DNSTransport
+}
+
+var _ model.DNSTransport = &dnsTransportRcode{}
+
+// RoundTrip implements model.DNSTransport.
+func (txp *dnsTransportRcode) RoundTrip(
+	ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+	response, err := txp.txp.RoundTrip(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if tracker, ok := ctx.Value(rcodeTrackerKey{}).(*rcodeTracker); ok {
+		tracker.onResponse(query.Type(), response.Rcode())
+	}
+	return response, nil
+}
+
+// RequiresPadding implements model.DNSTransport.
+func (txp *dnsTransportRcode) RequiresPadding() bool {
+	return txp.txp.RequiresPadding()
+}
+
+// Network implements model.DNSTransport.
+func (txp *dnsTransportRcode) Network() string {
+	return txp.txp.Network()
+}
+
+// Address implements model.DNSTransport.
+func (txp *dnsTransportRcode) Address() string {
+	return txp.txp.Address()
+}
+
+// CloseIdleConnections implements model.DNSTransport.
+func (txp *dnsTransportRcode) CloseIdleConnections() {
+	txp.txp.CloseIdleConnections()
+}
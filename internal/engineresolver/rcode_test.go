@@ -0,0 +1,167 @@
+package engineresolver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestResolverRecordRcodes(t *testing.T) {
+	// newTransport returns a DNS transport answering with the given rcode for
+	// each query type, and answering A queries with 8.8.8.8 on success.
+	newTransport := func(rcodes map[uint16]int) model.DNSTransport {
+		return &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+				rawQuery, err := query.Bytes()
+				if err != nil {
+					return nil, err
+				}
+				msg := &dns.Msg{}
+				if err := msg.Unpack(rawQuery); err != nil {
+					return nil, err
+				}
+				reply := &dns.Msg{}
+				reply.SetRcode(msg, rcodes[query.Type()])
+				if query.Type() == dns.TypeA && reply.Rcode == dns.RcodeSuccess {
+					reply.Answer = append(reply.Answer, &dns.A{
+						Hdr: dns.RR_Header{
+							Name:   reply.Question[0].Name,
+							Rrtype: dns.TypeA,
+							Class:  dns.ClassINET,
+							Ttl:    300,
+						},
+						A: net.IPv4(8, 8, 8, 8),
+					})
+				}
+				rawReply, err := reply.Pack()
+				if err != nil {
+					return nil, err
+				}
+				return (&netxlite.DNSDecoderMiekg{}).DecodeResponse(rawReply, query)
+			},
+			MockRequiresPadding: func() bool {
+				return true
+			},
+		}
+	}
+
+	// newResolver returns a resolver whose only child resolver uses the given
+	// transport, which we wrap like we would wrap the transport of a DoH resolver.
+	newResolver := func(recordRcodes bool, txp model.DNSTransport) *Resolver {
+		reso := &Resolver{
+			AllowedSchemes: []string{"https"},
+			Deterministic:  true,
+			KVStore:        &kvstore.Memory{},
+			RecordRcodes:   recordRcodes,
+		}
+		reso.newChildResolverFn = func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			var wrapped model.DNSTransport = txp
+			if wrap := reso.maybeWrapDNSTransportWithRcode(nil); wrap != nil {
+				wrapped = wrap(txp)
+			}
+			return netxlite.NewUnwrappedParallelResolver(wrapped), nil
+		}
+		state := []*resolverinfo{{
+			URL:   "https://dns.google/dns-query",
+			Score: 1,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return reso
+	}
+
+	// rcodesByQueryType returns the rcodes inside the given results.
+	rcodesByQueryType := func(results []*model.ArchivalDNSLookupResult) map[string]int64 {
+		out := make(map[string]int64)
+		for _, entry := range results {
+			out[entry.QueryType] = entry.Rcode
+		}
+		return out
+	}
+
+	type testcase struct {
+		name   string
+		rcodes map[uint16]int
+		expect map[string]int64
+	}
+
+	failures := []testcase{{
+		name:   "with NXDOMAIN",
+		rcodes: map[uint16]int{dns.TypeA: dns.RcodeNameError, dns.TypeAAAA: dns.RcodeNameError},
+		expect: map[string]int64{"A": dns.RcodeNameError, "AAAA": dns.RcodeNameError},
+	}, {
+		name:   "with SERVFAIL",
+		rcodes: map[uint16]int{dns.TypeA: dns.RcodeServerFailure, dns.TypeAAAA: dns.RcodeServerFailure},
+		expect: map[string]int64{"A": dns.RcodeServerFailure, "AAAA": dns.RcodeServerFailure},
+	}, {
+		name:   "with REFUSED and NOTIMP",
+		rcodes: map[uint16]int{dns.TypeA: dns.RcodeRefused, dns.TypeAAAA: dns.RcodeNotImplemented},
+		expect: map[string]int64{"A": dns.RcodeRefused, "AAAA": dns.RcodeNotImplemented},
+	}}
+
+	for _, tc := range failures {
+		t.Run(tc.name, func(t *testing.T) {
+			reso := newResolver(true, newTransport(tc.rcodes))
+			if _, err := reso.LookupHost(context.Background(), "dns.google"); err == nil {
+				t.Fatal("expected an error")
+			}
+			if diff := cmp.Diff(tc.expect, rcodesByQueryType(reso.ArchivalResults())); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.expect, rcodesByQueryType(reso.LastLookupFailures())); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("with a successful lookup", func(t *testing.T) {
+		reso := newResolver(true, newTransport(map[uint16]int{}))
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		// note: we omit the AAAA entry because it does not contain any answer
+		expect := map[string]int64{"A": dns.RcodeSuccess}
+		if diff := cmp.Diff(expect, rcodesByQueryType(reso.ArchivalResults())); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we do not record rcodes by default", func(t *testing.T) {
+		reso := newResolver(false, newTransport(map[uint16]int{
+			dns.TypeA:    dns.RcodeRefused,
+			dns.TypeAAAA: dns.RcodeRefused,
+		}))
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err == nil {
+			t.Fatal("expected an error")
+		}
+		expect := map[string]int64{"A": 0, "AAAA": 0}
+		if diff := cmp.Diff(expect, rcodesByQueryType(reso.ArchivalResults())); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("the wrapper forwards the other methods", func(t *testing.T) {
+		var called bool
+		txp := &dnsTransportRcode{&mocks.DNSTransport{
+			MockRequiresPadding:      func() bool { return true },
+			MockNetwork:              func() string { return "doh" },
+			MockAddress:              func() string { return "https://dns.google/dns-query" },
+			MockCloseIdleConnections: func() { called = true },
+		}}
+		if !txp.RequiresPadding() || txp.Network() != "doh" || txp.Address() != "https://dns.google/dns-query" {
+			t.Fatal("unexpected forwarding")
+		}
+		txp.CloseIdleConnections()
+		if !called {
+			t.Fatal("did not call CloseIdleConnections")
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package engineresolver
+
+//
+// Recording and replaying child resolver lookups
+//
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// ErrLookupNotRecorded indicates that a [*LookupRecorder] in replay mode
+// does not contain the result of the lookup we are trying to perform.
+var ErrLookupNotRecorded = errors.New("sessionresolver: lookup not recorded")
+
+// LookupRecorder records the lookups performed by child resolvers and
+// replays them later without using the network, which is useful to write
+// deterministic tests. The zero value is ready to use and records lookups.
+//
+// You MUST NOT modify the Replay field while a [*Resolver] is using
+// this recorder, because that MAY lead to data races.
+type LookupRecorder struct {
+	// Replay OPTIONALLY switches the recorder to replay mode. In such a
+	// mode, we do not create child resolvers, we serve the previously recorded
+	// results, and we fail with ErrLookupNotRecorded for unrecorded lookups.
+	Replay bool
+
+	// entries maps a child resolver URL and a domain to the lookup result.
+	entries map[lookupRecorderKey]*lookupRecorderEntry
+
+	// mu protects entries from concurrent access.
+	mu sync.Mutex
+}
+
+// lookupRecorderKey is the key of a recorded lookup.
+type lookupRecorderKey struct {
+	URL    string
+	domain string
+}
+
+// lookupRecorderEntry is the result of a recorded lookup.
+type lookupRecorderEntry struct {
+	addrs []string
+	err   error
+}
+
+// record records the result of a lookup overwriting any previous result.
+func (lr *LookupRecorder) record(URL, domain string, addrs []string, err error) {
+	defer lr.mu.Unlock()
+	lr.mu.Lock()
+	if lr.entries == nil {
+		lr.entries = make(map[lookupRecorderKey]*lookupRecorderEntry)
+	}
+	lr.entries[lookupRecorderKey{URL: URL, domain: domain}] = &lookupRecorderEntry{
+		addrs: append([]string{}, addrs...),
+		err:   err,
+	}
+}
+
+// replay returns the recorded result of a lookup.
+func (lr *LookupRecorder) replay(URL, domain string) ([]string, error) {
+	defer lr.mu.Unlock()
+	lr.mu.Lock()
+	entry, found := lr.entries[lookupRecorderKey{URL: URL, domain: domain}]
+	if !found {
+		return nil, fmt.Errorf("%w: %s using %s", ErrLookupNotRecorded, domain, URL)
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return append([]string{}, entry.addrs...), nil
+}
+
+// lookupRecorderResolver is the child resolver we use with a [*LookupRecorder].
+type lookupRecorderResolver struct {
+	// URL is the child resolver URL.
+	URL string
+
+	// recorder is the recorder to use.
+	recorder *LookupRecorder
+
+	// underlying is the underlying child resolver or nil in replay mode.
+	underlying model.Resolver
+}
+
+var _ model.Resolver = &lookupRecorderResolver{}
+
+// LookupHost implements model.Resolver.
+func (lrr *lookupRecorderResolver) LookupHost(ctx context.Context, domain string) ([]string, error) {
+	if lrr.underlying == nil {
+		return lrr.recorder.replay(lrr.URL, domain)
+	}
+	addrs, err := lrr.underlying.LookupHost(ctx, domain)
+	lrr.recorder.record(lrr.URL, domain, addrs, err)
+	return addrs, err
+}
+
+// LookupHTTPS implements model.Resolver.
+func (lrr *lookupRecorderResolver) LookupHTTPS(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	return nil, errLookupNotImplemented
+}
+
+// LookupNS implements model.Resolver.
+func (lrr *lookupRecorderResolver) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	return nil, errLookupNotImplemented
+}
+
+// Network implements model.Resolver.
+func (lrr *lookupRecorderResolver) Network() string {
+	if lrr.underlying == nil {
+		return "replay"
+	}
+	return lrr.underlying.Network()
+}
+
+// Address implements model.Resolver.
+func (lrr *lookupRecorderResolver) Address() string {
+	if lrr.underlying == nil {
+		return lrr.URL
+	}
+	return lrr.underlying.Address()
+}
+
+// CloseIdleConnections implements model.Resolver.
+func (lrr *lookupRecorderResolver) CloseIdleConnections() {
+	if lrr.underlying != nil {
+		lrr.underlying.CloseIdleConnections()
+	}
+}
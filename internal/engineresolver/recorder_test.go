@@ -0,0 +1,122 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverWithRecorder(t *testing.T) {
+	const workingURL = "https://dns.google/dns-query"
+
+	// newRecordingResolver returns a resolver where only workingURL works and
+	// counting the number of lookups performed by the child resolvers.
+	newRecordingResolver := func(recorder *LookupRecorder, lookups *atomic.Int64) *Resolver {
+		return &Resolver{
+			KVStore:  &kvstore.Memory{},
+			Recorder: recorder,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						lookups.Add(1)
+						if !h3 && URL == workingURL {
+							return []string{"8.8.8.8", "8.8.4.4"}, nil
+						}
+						return nil, errors.New("mocked error")
+					},
+				}
+				return reso, nil
+			},
+		}
+	}
+
+	// newReplayingResolver returns a resolver failing the test if
+	// we attempt to create a child resolver.
+	newReplayingResolver := func(t *testing.T, recorder *LookupRecorder) *Resolver {
+		return &Resolver{
+			KVStore:  &kvstore.Memory{},
+			Recorder: recorder,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				t.Fatal("should not be called")
+				return nil, nil
+			},
+		}
+	}
+
+	t.Run("we can record and then replay lookups", func(t *testing.T) {
+		recorder := &LookupRecorder{}
+		lookups := &atomic.Int64{}
+
+		recording := newRecordingResolver(recorder, lookups)
+		expect, err := recording.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lookups.Load() < 1 {
+			t.Fatal("expected at least a lookup")
+		}
+
+		recorder.Replay = true
+		lookups.Store(0)
+		replaying := newReplayingResolver(t, recorder)
+		got, err := replaying.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+		if lookups.Load() != 0 {
+			t.Fatal("expected no lookups using the network")
+		}
+	})
+
+	t.Run("we replay recorded failures", func(t *testing.T) {
+		recorder := &LookupRecorder{}
+		expectErr := errors.New("mocked error")
+		recorder.record(workingURL, "dns.google", nil, expectErr)
+		recorder.Replay = true
+		addrs, err := recorder.replay(workingURL, "dns.google")
+		if !errors.Is(err, expectErr) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(addrs) != 0 {
+			t.Fatal("expected no addrs")
+		}
+	})
+
+	t.Run("replaying an unrecorded lookup fails", func(t *testing.T) {
+		recorder := &LookupRecorder{Replay: true}
+		replaying := newReplayingResolver(t, recorder)
+		addrs, err := replaying.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		if !errors.Is(err, ErrLookupNotRecorded) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(addrs) != 0 {
+			t.Fatal("expected no addrs")
+		}
+	})
+
+	t.Run("the recorded addresses are a copy", func(t *testing.T) {
+		recorder := &LookupRecorder{}
+		addrs := []string{"8.8.8.8"}
+		recorder.record(workingURL, "dns.google", addrs, nil)
+		addrs[0] = "1.1.1.1"
+		got, err := recorder.replay(workingURL, "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8"}, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
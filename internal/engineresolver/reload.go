@@ -0,0 +1,28 @@
+package engineresolver
+
+//
+// Reloading the persisted state
+//
+
+// ReloadState validates the state persisted into the KVStore, which another
+// component sharing the KVStore may have updated, and invalidates the cached
+// answers. It returns an error if we cannot read the persisted state or it does
+// not contain any supported entry, in which case we keep the cached answers.
+//
+// There is no in-memory copy of the scores to merge with the persisted ones,
+// because LookupHost reads the persisted state on each call, hence the ranking
+// of the child resolvers always reflects the persisted scores. What may be stale
+// are the cached answers (see CacheMaxTTL), which we obtained using the previous
+// ranking, so we drop them such that the next LookupHost uses the child resolvers
+// in the persisted order. This method is safe to call concurrently with LookupHost,
+// and a concurrent LookupHost may overwrite the persisted state when it completes,
+// as it always does.
+func (r *Resolver) ReloadState() error {
+	if _, err := r.readstateandprune(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.answerCache = nil
+	r.mu.Unlock()
+	return nil
+}
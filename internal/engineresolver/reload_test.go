@@ -0,0 +1,123 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverReloadState(t *testing.T) {
+	t.Run("we fail without a KVStore", func(t *testing.T) {
+		reso := &Resolver{}
+		if err := reso.ReloadState(); !errors.Is(err, ErrNilKVStore) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we fail when the state contains no supported entry", func(t *testing.T) {
+		reso := &Resolver{KVStore: &kvstore.Memory{}}
+		if err := reso.writestate([]*resolverinfo{{URL: "antani", Score: 1}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := reso.ReloadState(); !errors.Is(err, errNoEntries) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	// newResolver returns a resolver caching the answers along with the list
+	// of the child resolvers the resolver has used, in order, and the state
+	// we wrote to the KVStore, where google precedes quad9.
+	newResolver := func(t *testing.T) (*Resolver, *[]string, []*resolverinfo) {
+		used := &[]string{}
+		reso := &Resolver{
+			CacheMaxTTL:   time.Hour,
+			CacheMinTTL:   time.Hour,
+			Deterministic: true,
+			KVStore:       &kvstore.Memory{},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				re := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						*used = append(*used, URL)
+						return []string{"8.8.8.8"}, nil
+					},
+				}
+				return re, nil
+			},
+		}
+		state := []*resolverinfo{{
+			URL:   "https://dns.google/dns-query",
+			Score: 1,
+		}, {
+			URL:   "https://dns.quad9.net/dns-query",
+			Score: 0.1,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		return reso, used, state
+	}
+
+	t.Run("without reloading we keep using the cached answers", func(t *testing.T) {
+		reso, used, state := newResolver(t)
+
+		// another component promotes quad9 by updating the shared KVStore
+		state[0].Score, state[1].Score = 0.1, 1
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		expect := []string{"https://dns.google/dns-query"}
+		if diff := cmp.Diff(expect, *used); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("reloading drops the cached answers so we use the updated state", func(t *testing.T) {
+		reso, used, state := newResolver(t)
+
+		// another component promotes quad9 by updating the shared KVStore
+		state[0].Score, state[1].Score = 0.1, 1
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := reso.ReloadState(); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := reso.cachedAnswers("dns.google"); found {
+			t.Fatal("did not expect to find cached answers")
+		}
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		expect := []string{"https://dns.google/dns-query", "https://dns.quad9.net/dns-query"}
+		if diff := cmp.Diff(expect, *used); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we keep the cached answers when reloading fails", func(t *testing.T) {
+		reso, _, _ := newResolver(t)
+		if err := reso.writestate([]*resolverinfo{{URL: "antani", Score: 1}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := reso.ReloadState(); !errors.Is(err, errNoEntries) {
+			t.Fatal("unexpected error", err)
+		}
+		if _, found := reso.cachedAnswers("dns.google"); !found {
+			t.Fatal("expected to find cached answers")
+		}
+	})
+}
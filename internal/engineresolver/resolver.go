@@ -6,10 +6,12 @@ package engineresolver
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
 	"math/rand"
 	"net"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,46 +34,391 @@ import (
 // You MUST NOT modify public fields of this structure once it
 // has been created, because that MAY lead to data races.
 type Resolver struct {
+	// AllowedSchemes is the OPTIONAL list of URL schemes (e.g., "https",
+	// "http3", "system") that child resolvers may use. We drop the child
+	// resolvers using other schemes when we read the state, regardless of
+	// whether the persisted state contains them, so LookupHost never uses
+	// them and we stop persisting their scores. If this field is empty, we
+	// allow all the schemes we support.
+	AllowedSchemes []string
+
+	// AnswerValidator is the OPTIONAL function we call after a child
+	// resolver has successfully resolved a domain. If this function returns
+	// an error, we treat the lookup as failed, meaning that we penalize the
+	// child resolver and try with the next one. You can use this hook to
+	// reject answers containing known-bad IP addresses. If this field is
+	// not set, we accept all the answers returned by child resolvers.
+	AnswerValidator func(domain string, addrs []string) error
+
+	// AttemptBudget is the OPTIONAL maximum number of child resolver
+	// lookups, including retries and http3 fallbacks, that a single
+	// LookupHost call may perform across all the child resolvers. When
+	// we exhaust the budget, LookupHost fails with ErrLookupHost even if
+	// there are child resolvers we have not tried yet. If this field is
+	// zero or negative, we do not bound the number of lookups.
+	AttemptBudget int
+
+	// Bootstrap OPTIONALLY maps the hostname of DoH child resolvers
+	// (e.g., "dns.google") to pre-known IP addresses. When set, child
+	// resolvers connect to such addresses without performing any
+	// DNS lookup for their own hostname, which avoids bootstrap
+	// loops and resists blocking of the bootstrap lookup.
+	Bootstrap map[string][]string
+
 	// ByteCounter is the OPTIONAL byte counter. It will count
 	// the bytes used by any child resolver except for the
 	// system resolver, whose bytes ARE NOT counted. If this
 	// field is not set, then we won't count the bytes.
 	ByteCounter *bytecounter.Counter
 
+	// CacheMaxTTL is the OPTIONAL maximum amount of time for which we cache
+	// the answers returned by LookupHost. When this field is positive, we cache
+	// successful answers for the minimum TTL of the answer records, clamped to
+	// [CacheMinTTL, CacheMaxTTL]. We only know such a TTL for DoH child
+	// resolvers, otherwise (e.g., for the system resolver) we use CacheMinTTL,
+	// hence we do not cache their answers when CacheMinTTL is zero. If this field is
+	// zero or negative, we do not cache answers. Because LookupHost calls
+	// served from the cache do not use child resolvers, they do not change
+	// what SkipReasons and ArchivalResults return.
+	CacheMaxTTL time.Duration
+
+	// CacheMinTTL is the OPTIONAL minimum amount of time for which we cache
+	// the answers returned by LookupHost. See CacheMaxTTL for more details.
+	CacheMinTTL time.Duration
+
+	// Deterministic OPTIONALLY makes the order in which we try child
+	// resolvers only depend on the persisted state, which is useful to run
+	// reproducible experiments. When set, we do not randomly rearrange the
+	// first child resolvers, we break ties between equal scores using the
+	// SchemePriority and then the lexical order of the URLs, and we give
+	// child resolvers missing from the state the same initial score rather
+	// than a random one (see deterministicInitialScore).
+	Deterministic bool
+
+	// Dialer is the OPTIONAL dialer that DoH child resolvers not using
+	// HTTP/3 should use to connect to each IP address of the server, e.g.,
+	// to set socket options using a custom [net.Dialer] Control hook. We
+	// still resolve the server hostname as usual (including Bootstrap) and,
+	// when ProxyURL is set, we use this dialer to connect to the proxy. When
+	// this field is nil, we use the default dialer. This field does not apply
+	// to HTTP/3 and to the system resolver.
+	Dialer model.Dialer
+
+	// FailOpen OPTIONALLY enables using a bundled list of well-known DoH
+	// child resolvers when the effective list of child resolvers would
+	// otherwise be empty (e.g., because AllowedSchemes excludes all of
+	// them), such that LookupHost has something to try in case of a
+	// misconfiguration. We ignore AllowedSchemes when failing open. When
+	// this field is false, LookupHost fails in such a case.
+	FailOpen bool
+
+	// FallbackKVStore is the OPTIONAL key-value store we read
+	// statistics from when reading from the KVStore fails. When
+	// this field is set, we also write statistics into it, such
+	// that the statistics survive failures of the KVStore.
+	FallbackKVStore model.KeyValueStore
+
+	// FlagPrivateAnswers OPTIONALLY enables checking whether the addresses
+	// returned by a successful lookup of a public domain, i.e., a domain not
+	// ending with ".local", contain private or bogon addresses, which is a signal
+	// of DNS poisoning. When this happens, we log a warning, we count the lookup
+	// (see the Scoreboard), and we call OnValidationMismatch. We never modify
+	// the returned addresses. See also PenalizePrivateAnswers.
+	FlagPrivateAnswers bool
+
+	// HTTP3Fallback OPTIONALLY enables retrying a failed lookup
+	// using an http3 child resolver with the https child resolver
+	// using the same URL. We update the score of each child
+	// resolver according to the result of its own lookup.
+	HTTP3Fallback bool
+
+	// IdleTimeout is the OPTIONAL time after which we close a child
+	// resolver we have not used, such that we do not keep around idle
+	// connections wasting battery and data. When this field is positive,
+	// we lazily start a background goroutine closing idle child resolvers,
+	// which we stop when you call CloseIdleConnections. When this field is
+	// zero or negative, we keep child resolvers until they are evicted.
+	IdleTimeout time.Duration
+
 	// KVStore is the MANDATORY key-value store where you
 	// want us to write statistics about which resolver is
 	// working better in your network.
 	KVStore model.KeyValueStore
 
+	// LogDNSWireSizes OPTIONALLY enables logging the size of the
+	// wire-format DNS queries and responses exchanged by each child
+	// DoH resolver. When enabled, you can also obtain the cumulative
+	// sizes for each child resolver by calling DNSWireSizes.
+	LogDNSWireSizes bool
+
 	// Logger is the OPTIONAL logger you want us to use
 	// to emit log messages.
 	Logger model.Logger
 
+	// MaxAnswers is the OPTIONAL maximum number of addresses returned
+	// by LookupHost. When a child resolver returns more addresses, we
+	// sort them and we keep the first MaxAnswers addresses, such that
+	// the result is deterministic. We always return at least one
+	// address. If this field is zero or negative, we return all the
+	// addresses returned by the child resolver.
+	MaxAnswers int
+
+	// MaxCachedResolvers is the OPTIONAL maximum number of child
+	// resolvers we keep alive. When we exceed this limit, we close
+	// the idle connections of the least recently used child resolver
+	// and we stop caching it. We do not modify the resolver score
+	// when we evict a child resolver. If this field is zero or
+	// negative, we cache all the child resolvers we create.
+	MaxCachedResolvers int
+
+	// MaxConcurrency is the OPTIONAL maximum number of child resolver
+	// lookups that may run at the same time across all the goroutines
+	// using this resolver. If this field is zero or negative, we use
+	// a reasonable default (see defaultMaxConcurrency).
+	MaxConcurrency int
+
+	// MaxDoHResponseBytes is the OPTIONAL maximum number of bytes we read
+	// from a single DoH response. When a child resolver returns a larger
+	// response, we treat the lookup as failed with ErrResponseTooLarge,
+	// meaning that we penalize the child resolver. If this field is zero or
+	// negative, we use a default limit of 64 KiB, which is the maximum size
+	// of a DNS message. This field does not apply to the system resolver.
+	MaxDoHResponseBytes int64
+
+	// OnValidationMismatch is the OPTIONAL function we call whenever a child
+	// resolver returns an answer failing one of the validation checks, that is,
+	// AnswerValidator, StickyAnswers, Use0x20, RequireDNSSEC, and
+	// FlagPrivateAnswers, such that a single observer can collect all the
+	// signals of DNS poisoning. We call it with the child resolver URL, the
+	// domain, the reason (one of the ValidationMismatch constants), and the
+	// reason-specific got and want values, which are documented along with
+	// each reason. We call this function from the goroutines performing
+	// lookups, so it should be safe for concurrent use. If this field is nil, we do nothing.
+	OnValidationMismatch func(URL, domain string, reason string, got, want []string)
+
+	// PenalizePrivateAnswers OPTIONALLY causes us to decrease the score of a
+	// child resolver returning private addresses for a public domain as if the
+	// lookup had failed, while still returning its addresses. This field only
+	// matters when FlagPrivateAnswers is true.
+	PenalizePrivateAnswers bool
+
+	// PerQueryRetries is the OPTIONAL number of times we should
+	// retry a failed lookup using the same child resolver before
+	// giving up and penalizing its score. Retries happen immediately
+	// and stop as soon as the context is done. If this field is
+	// zero or negative, we WON'T retry failed lookups.
+	PerQueryRetries int
+
+	// PerResolverRate OPTIONALLY limits how frequently we use each child
+	// resolver, to avoid triggering rate limits of the upstream service,
+	// which would then make lookups fail and decrease the scores. When a
+	// child resolver has exhausted its tokens, LookupHost skips it. When
+	// the QueriesPerSecond field is zero, we do not limit the rate.
+	PerResolverRate RateLimit
+
 	// ProxyURL is the OPTIONAL URL of the socks5 proxy
 	// we should be using. If not set, then we WON'T use
 	// any proxy. If set, then we WON'T use any http3
 	// based resolvers and we WON'T use the system resolver.
 	ProxyURL *url.URL
 
+	// RecordRcodes OPTIONALLY enables recording the DNS response code returned
+	// by child resolvers into the Rcode field of the entries returned by the
+	// ArchivalResults and LastLookupFailures functions, such that one can know
+	// the exact response code beyond the failure string. We record the response
+	// codes of every child resolver using the wire format, i.e., DoH child
+	// resolvers, but we cannot record those of the system resolver, for which
+	// the Rcode field is always zero.
+	RecordRcodes bool
+
+	// Recorder is the OPTIONAL [*LookupRecorder] recording the lookups
+	// performed by child resolvers or, when its Replay field is true,
+	// replaying them without using the network. We key the lookups by
+	// child resolver URL and domain. This is meant for testing.
+	Recorder *LookupRecorder
+
+	// RequireDNSSEC OPTIONALLY enables validating the DNSSEC status of the
+	// responses returned by DoH child resolvers, whose queries already set
+	// the DO bit. When a response contains DNSSEC signatures, meaning that
+	// the zone is signed, but the child resolver did not set the AD bit, we
+	// treat the lookup as failed with ErrDNSSECNotAuthenticated, meaning
+	// that we penalize the child resolver. We accept responses for unsigned
+	// zones, and you can use LastAuthenticated to know whether the answers
+	// were authenticated. This field does not apply to the system resolver.
+	RequireDNSSEC bool
+
+	// RootCAs OPTIONALLY maps the URL of a child resolver (e.g.,
+	// "http3://dns.google/dns-query") to the root CAs to use when
+	// verifying the certificate of its server, which is useful for
+	// resolvers using a private CA. For URLs not in this map, we use
+	// the default root CAs. This field does not apply to the system
+	// resolver and to child resolvers created by unit tests.
+	RootCAs map[string]*x509.CertPool
+
+	// SchemePriority is the OPTIONAL list of URL schemes (e.g.,
+	// "dot", "https", "http3", "system") sorted by decreasing
+	// preference. We use it to break ties between child resolvers
+	// having the same score, and unlisted schemes sort last. If this
+	// field is empty, we sort child resolvers just by score.
+	SchemePriority []string
+
+	// ScoreHalfLife OPTIONALLY enables aging the persisted scores when
+	// we read them, such that a child resolver that worked well (or
+	// badly) long ago does not delay adapting to the current network
+	// conditions. We pull each score toward a neutral value such that
+	// its distance from the neutral value halves every ScoreHalfLife
+	// since we last updated the score. When this field is zero or
+	// negative, we use the persisted scores as they are.
+	ScoreHalfLife time.Duration
+
+	// ServfailScore is the OPTIONAL score, between zero and one, we use for
+	// updating the score of a child resolver that returned SERVFAIL, which
+	// may indicate upstream problems rather than a blocked resolver. For any
+	// other failure we use zero and for successes we use one. If this field
+	// is zero, we treat SERVFAIL like any other failure. Regardless of this
+	// field, we wrap SERVFAIL errors such that they match ErrServfail.
+	ServfailScore float64
+
+	// StaticHosts OPTIONALLY maps domain names to the addresses that LookupHost
+	// should return for them, like /etc/hosts does. We consult this map before
+	// the cache and before using any child resolver, and we use the domain as
+	// is, without any case or trailing dot normalization. When a domain matches,
+	// we do not modify the scores of the child resolvers, nor what SkipReasons
+	// and ArchivalResults return. Domains mapped to no addresses do not match.
+	StaticHosts map[string][]string
+
+	// StickyAnswers OPTIONALLY enables remembering the last good addresses of
+	// recently resolved domains (up to maxStickyAnswers domains) to resist
+	// intermittent poisoning. When a child resolver returns addresses having
+	// nothing in common with the remembered ones, we treat the lookup as failed
+	// with ErrStickyAnswersMismatch, meaning that we penalize the child resolver,
+	// we count the deviation (see the Scoreboard), and we try with the next
+	// one. When all the child resolvers fail and some of them deviated, we
+	// return the addresses of the first deviating child resolver and we
+	// remember them, such that legitimate changes do not break LookupHost.
+	StickyAnswers bool
+
+	// Use0x20 OPTIONALLY enables DNS 0x20 encoding, a cheap anti-spoofing
+	// measure where we randomize the letter case of the domain inside each
+	// query and check whether the question inside the response uses the
+	// same letter case. When it does not, we treat the lookup as failed
+	// with ErrDNS0x20Mismatch, meaning that we penalize the child resolver
+	// and we record the failure into the ArchivalResults. Because the
+	// system resolver does not expose the wire-format messages, we only
+	// use 0x20 encoding with DoH child resolvers.
+	Use0x20 bool
+
+	// answerCache maps a hostname to its cached answers. Accessing this
+	// field requires one to hold the mu mutex.
+	answerCache map[string]*answerCacheEntry
+
+	// archival contains the archival results of the last LookupHost call. Accessing
+	// this field requires one to hold the mu mutex. Use ArchivalResults to read it.
+	archival []*model.ArchivalDNSLookupResult
+
+	// buckets maps the URL of a child resolver to its token bucket when
+	// PerResolverRate is configured. Accessing this field requires one
+	// to hold the mu mutex.
+	buckets map[string]*tokenBucket
+
+	// consecutiveFailures maps the URL of a child resolver to the number of
+	// lookups that failed since its last successful lookup. Accessing this
+	// field requires one to hold the mu mutex. Use Scoreboard to read it.
+	consecutiveFailures map[string]int64
+
+	// idleReaperClosed indicates that CloseIdleConnections has stopped the
+	// goroutine closing idle child resolvers, which we MUST NOT restart
+	// because we would not stop it again. Accessing this field requires
+	// one to hold the mu mutex.
+	idleReaperClosed bool
+
+	// idleReaperStop is closed to stop the goroutine closing idle child
+	// resolvers. Accessing this field requires one to hold the mu mutex.
+	idleReaperStop chan any
+
 	// jsonCodec is the OPTIONAL JSON Codec to use. If not set,
 	// we will construct a default codec.
 	jsonCodec jsonCodec
 
+	// lastAuthenticated is the value returned by LastAuthenticated. Accessing
+	// this field requires one to hold the mu mutex.
+	lastAuthenticated bool
+
+	// lastFailures contains the failed archival results of the last LookupHost call
+	// that failed. Accessing this field requires one to hold the mu mutex. Use
+	// LastLookupFailures to read it.
+	lastFailures []*model.ArchivalDNSLookupResult
+
+	// makers contains the makers of the child resolvers set using SetURLs. When
+	// empty, we use allmakers. Accessing this field requires one to hold the mu
+	// mutex. Use resolvermakers to read it.
+	makers []*resolvermaker
+
 	// mu provides synchronisation of internal fields.
 	mu sync.Mutex
 
 	// newChildResolverFn is the OPTIONAL function to override
-	// the construction of a new resolver in unit tests
-	newChildResolverFn func(h3 bool, URL string) (model.Resolver, error)
+	// the construction of a new resolver in unit tests, which
+	// receives the OPTIONAL function to wrap the DNS transport
+	newChildResolverFn func(h3 bool, URL string,
+		wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error)
 
 	// once ensures that CloseIdleConnection is
 	// run just once.
 	once sync.Once
 
+	// privateAnswersCount maps the URL of a child resolver to the number of
+	// lookups returning private addresses for public domains. Accessing this
+	// field requires one to hold the mu mutex. Use Scoreboard to read it.
+	privateAnswersCount map[string]int64
+
 	// res maps a URL to a child resolver. We will
 	// construct child resolvers just once and we
 	// will track them into this field.
 	res map[string]model.Resolver
+
+	// resLRU contains the URLs of the child resolvers inside
+	// res sorted from the least to the most recently used.
+	resLRU []string
+
+	// resLastUsed maps the URL of each child resolver inside res to
+	// the time when we last used it. Accessing this field requires
+	// one to hold the mu mutex.
+	resLastUsed map[string]time.Time
+
+	// sem is the semaphore bounding the number of child resolver
+	// lookups running concurrently. Use semaphore to access it.
+	sem chan any
+
+	// semOnce ensures we initialize sem just once.
+	semOnce sync.Once
+
+	// skipReasons maps the URL of each child resolver the last LookupHost
+	// call did not attempt to the reason why. Accessing this field requires
+	// one to hold the mu mutex. Use SkipReasons to read it.
+	skipReasons map[string]string
+
+	// stickyAnswers maps a hostname to the last good addresses we remembered
+	// when StickyAnswers is true. Accessing this field requires one to hold
+	// the mu mutex.
+	stickyAnswers map[string][]string
+
+	// stickyAnswersLRU contains the hostnames inside stickyAnswers sorted from
+	// the least to the most recently remembered. Accessing this field requires
+	// one to hold the mu mutex.
+	stickyAnswersLRU []string
+
+	// stickyDeviations maps the URL of a child resolver to the number of
+	// lookups whose addresses deviated from the remembered ones. Accessing this
+	// field requires one to hold the mu mutex. Use Scoreboard to read it.
+	stickyDeviations map[string]int64
+
+	// timeNowFn is the OPTIONAL function to override time.Now in unit tests.
+	timeNowFn func() time.Time
+
+	// wireSizes maps a URL to the recorder of the wire-format
+	// DNS message sizes used when LogDNSWireSizes is true.
+	wireSizes map[string]*dnsWireSizesRecorder
 }
 
 // CloseIdleConnections closes the idle connections, if any. This
@@ -100,24 +447,120 @@ var ErrLookupHost = errors.New("sessionresolver: LookupHost failed")
 // multierror.Union error on failure, so you can see individual errors
 // and get a better picture of what's been going wrong.
 func (r *Resolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	if addrs, found := r.staticHostsAnswers(hostname); found {
+		return r.maybeTruncateAnswers(addrs), nil
+	}
+	if addrs, found := r.cachedAnswers(hostname); found {
+		return r.maybeTruncateAnswers(addrs), nil
+	}
 	state := r.readstatedefault()
-	r.maybeConfusion(state, time.Now().UnixNano())
+	if !r.Deterministic {
+		r.maybeConfusion(state, time.Now().UnixNano())
+	}
 	defer r.writestate(state)
 	me := multierror.New(ErrLookupHost)
+	tried := make(map[string]bool)
+	rateLimited := make(map[string]bool)
+	budget := newAttemptBudget(r.AttemptBudget)
+	var outOfBudget bool
+	defer func() {
+		r.saveSkipReasons(state, tried, rateLimited, outOfBudget)
+	}()
+	zeroTime := time.Now()
+	var archival []*model.ArchivalDNSLookupResult
+	defer func() {
+		r.saveArchivalResults(archival)
+	}()
+	var deviated []string
+	lookup := func(e *resolverinfo) ([]string, error) {
+		started := time.Since(zeroTime)
+		tracker, rcodes, ttls := &dnssecTracker{}, &rcodeTracker{}, &ttlTracker{}
+		addrs, err := r.lookupHostWithBudget(
+			withTTLTracker(withRcodeTracker(withDNSSECTracker(ctx, tracker), rcodes), ttls), e, hostname, budget)
+		results := newArchivalDNSLookupResults(e.URL, hostname, addrs, err, started, time.Since(zeroTime))
+		rcodes.setArchivalRcodes(results)
+		archival = append(archival, results...)
+		if err == nil {
+			r.maybeCacheAnswers(hostname, addrs, ttls.minTTL())
+			r.setLastAuthenticated(tracker.allAuthenticated())
+		}
+		if addrs, found := stickyAnswersDeviation(err); found && deviated == nil {
+			deviated = addrs
+		}
+		return addrs, err
+	}
 	for _, e := range state {
+		if tried[e.URL] {
+			continue // we have already used this URL as an http3 fallback
+		}
 		if r.ProxyURL != nil && r.shouldSkipWithProxy(e) {
 			r.logger().Infof("sessionresolver: skipping with proxy: %+v", e)
 			continue // we cannot proxy this URL so ignore it
 		}
-		addrs, err := r.lookupHost(ctx, e, hostname)
+		if budget.exhausted() {
+			r.logger().Infof("sessionresolver: attempt budget exhausted")
+			outOfBudget = true
+			break
+		}
+		if !r.allowlookup(e.URL) {
+			r.logger().Infof("sessionresolver: skipping rate limited resolver: %s", e.URL)
+			rateLimited[e.URL] = true
+			continue // we are querying this URL too frequently
+		}
+		tried[e.URL] = true
+		addrs, err := lookup(e)
 		if err == nil {
-			return addrs, nil
+			return r.maybeTruncateAnswers(addrs), nil
 		}
 		me.Add(newErrWrapper(err, e.URL))
+		fe := r.http3Fallback(state, e)
+		if fe == nil || tried[fe.URL] {
+			continue
+		}
+		if budget.exhausted() {
+			r.logger().Infof("sessionresolver: attempt budget exhausted")
+			outOfBudget = true
+			break
+		}
+		if !r.allowlookup(fe.URL) {
+			r.logger().Infof("sessionresolver: skipping rate limited resolver: %s", fe.URL)
+			rateLimited[fe.URL] = true
+			continue // we are querying this URL too frequently
+		}
+		r.logger().Infof("sessionresolver: falling back from %s to %s", e.URL, fe.URL)
+		tried[fe.URL] = true
+		addrs, err = lookup(fe)
+		if err == nil {
+			return r.maybeTruncateAnswers(addrs), nil
+		}
+		me.Add(newErrWrapper(err, fe.URL))
+	}
+	if deviated != nil {
+		r.logger().Warnf("sessionresolver: all resolvers deviated for %s: using %v", hostname, deviated)
+		r.rememberStickyAnswers(hostname, deviated)
+		return r.maybeTruncateAnswers(deviated), nil
 	}
+	r.saveLastLookupFailures(archival)
 	return nil, me
 }
 
+// http3Fallback returns the entry inside the state using the https
+// equivalent of the given http3 entry when HTTP3Fallback is true. This
+// function returns nil when HTTP3Fallback is false, when the entry
+// does not use http3, or when there's no https equivalent in the state.
+func (r *Resolver) http3Fallback(state []*resolverinfo, e *resolverinfo) *resolverinfo {
+	if !r.HTTP3Fallback || !strings.HasPrefix(e.URL, "http3://") {
+		return nil
+	}
+	URL := strings.Replace(e.URL, "http3://", "https://", 1)
+	for _, entry := range state {
+		if entry.URL == URL {
+			return entry
+		}
+	}
+	return nil
+}
+
 func (r *Resolver) shouldSkipWithProxy(e *resolverinfo) bool {
 	URL, err := url.Parse(e.URL)
 	if err != nil {
@@ -132,22 +575,58 @@ func (r *Resolver) shouldSkipWithProxy(e *resolverinfo) bool {
 }
 
 func (r *Resolver) lookupHost(ctx context.Context, ri *resolverinfo, hostname string) ([]string, error) {
+	return r.lookupHostWithBudget(ctx, ri, hostname, nil)
+}
+
+// lookupHostWithBudget is like lookupHost but consumes the OPTIONAL budget
+// for each attempt, including retries. A nil budget is unlimited.
+func (r *Resolver) lookupHostWithBudget(ctx context.Context, ri *resolverinfo,
+	hostname string, budget *attemptBudget) ([]string, error) {
 	const ewma = 0.9 // the last sample is very important
 	re, err := r.getresolver(ri.URL)
 	if err != nil {
 		r.logger().Warnf("sessionresolver: getresolver: %s", err.Error())
-		ri.Score = 0 // this is a hard error
+		r.updatescore(ri, 0) // this is a hard error
+		r.recordoutcome(ri.URL, err)
 		return nil, err
 	}
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err // the context is done and we did not use the resolver
+	}
+	defer release()
 	op := logx.NewOperationLogger(
 		r.logger(), "sessionresolver: lookup %s using %s", hostname, ri.URL)
-	addrs, err := timeLimitedLookup(ctx, re, hostname)
+	addrs, err := r.timeLimitedLookupWithRetries(ctx, re, hostname, budget)
+	if err != nil {
+		r.maybeReportLookupValidationMismatch(ri.URL, hostname, err)
+	}
+	if err == nil && r.AnswerValidator != nil {
+		if err = r.AnswerValidator(hostname, addrs); err != nil {
+			r.reportValidationMismatch(ri.URL, hostname, ValidationMismatchAnswerValidator, addrs, nil)
+		}
+	}
+	if err == nil {
+		var stickyErr *stickyAnswersError
+		if err = r.checkStickyAnswers(ri.URL, hostname, addrs); errors.As(err, &stickyErr) {
+			r.reportValidationMismatch(ri.URL, hostname, ValidationMismatchStickyAnswers,
+				stickyErr.addrs, stickyErr.remembered)
+		}
+	}
 	op.Stop(err)
 	if err == nil {
-		ri.Score = ewma*1.0 + (1-ewma)*ri.Score // increase score
+		if r.checkPrivateAnswers(ri.URL, hostname, addrs) && r.PenalizePrivateAnswers {
+			r.updatescore(ri, (1-ewma)*ri.Score) // decrease score but keep the addrs
+			r.recordoutcome(ri.URL, nil)
+			return addrs, nil
+		}
+		r.updatescore(ri, ewma*1.0+(1-ewma)*ri.Score) // increase score
+		r.recordoutcome(ri.URL, nil)
 		return addrs, nil
 	}
-	ri.Score = ewma*0.0 + (1-ewma)*ri.Score // decrease score
+	err = maybeWrapServfail(err)
+	r.updatescore(ri, ewma*r.failureScore(err)+(1-ewma)*ri.Score) // decrease score
+	r.recordoutcome(ri.URL, err)
 	return nil, err
 }
 
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net"
 	"net/url"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"syscall"
@@ -87,7 +88,7 @@ func TestTypicalUsageWithSuccess(t *testing.T) {
 	ctx := context.Background()
 	reso := &Resolver{
 		KVStore: &kvstore.Memory{},
-		newChildResolverFn: func(h3 bool, URL string) (model.Resolver, error) {
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
 			reso := &mocks.Resolver{
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return expected, nil
@@ -124,7 +125,7 @@ func TestLittleLLookupHostWithInvalidURL(t *testing.T) {
 func TestLittleLLookupHostWithSuccess(t *testing.T) {
 	expected := []string{"8.8.8.8", "8.8.4.4"}
 	reso := &Resolver{
-		newChildResolverFn: func(h3 bool, URL string) (model.Resolver, error) {
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
 			reso := &mocks.Resolver{
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return expected, nil
@@ -150,7 +151,7 @@ func TestLittleLLookupHostWithSuccess(t *testing.T) {
 func TestLittleLLookupHostWithFailure(t *testing.T) {
 	errMocked := errors.New("mocked error")
 	reso := &Resolver{
-		newChildResolverFn: func(h3 bool, URL string) (model.Resolver, error) {
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
 			reso := &mocks.Resolver{
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return nil, errMocked
@@ -173,6 +174,377 @@ func TestLittleLLookupHostWithFailure(t *testing.T) {
 	}
 }
 
+func TestLittleLLookupHostWithRetries(t *testing.T) {
+	// newResolver returns a resolver failing the first [failures] lookups
+	newResolver := func(failures int64, count *atomic.Int64) *Resolver {
+		return &Resolver{
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						if count.Add(1) <= failures {
+							return nil, errors.New("mocked error")
+						}
+						return []string{"8.8.8.8"}, nil
+					},
+				}
+				return reso, nil
+			},
+		}
+	}
+
+	t.Run("we do not penalize the score when a retry succeeds", func(t *testing.T) {
+		count := &atomic.Int64{}
+		reso := newResolver(1, count)
+		reso.PerQueryRetries = 1
+		ri := &resolverinfo{URL: "dot://www.ooni.nonexistent", Score: 0.1}
+		addrs, err := reso.lookupHost(context.Background(), ri, "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if count.Load() != 2 {
+			t.Fatal("unexpected number of lookups", count.Load())
+		}
+		if ri.Score < 0.88 || ri.Score > 0.92 {
+			t.Fatal("unexpected score", ri.Score)
+		}
+	})
+
+	t.Run("we penalize the score when all the retries fail", func(t *testing.T) {
+		count := &atomic.Int64{}
+		reso := newResolver(3, count)
+		reso.PerQueryRetries = 2
+		ri := &resolverinfo{URL: "dot://www.ooni.nonexistent", Score: 0.95}
+		addrs, err := reso.lookupHost(context.Background(), ri, "dns.google")
+		if err == nil || err.Error() != "mocked error" {
+			t.Fatal("not the error we expected", err)
+		}
+		if addrs != nil {
+			t.Fatal("expected nil addrs here")
+		}
+		if count.Load() != 3 {
+			t.Fatal("unexpected number of lookups", count.Load())
+		}
+		if ri.Score < 0.094 || ri.Score > 0.096 {
+			t.Fatal("unexpected score", ri.Score)
+		}
+	})
+
+	t.Run("we do not retry by default", func(t *testing.T) {
+		count := &atomic.Int64{}
+		reso := newResolver(1, count)
+		ri := &resolverinfo{URL: "dot://www.ooni.nonexistent", Score: 0.95}
+		if _, err := reso.lookupHost(context.Background(), ri, "dns.google"); err == nil {
+			t.Fatal("expected an error here")
+		}
+		if count.Load() != 1 {
+			t.Fatal("unexpected number of lookups", count.Load())
+		}
+	})
+
+	t.Run("we do not retry when the context is done", func(t *testing.T) {
+		count := &atomic.Int64{}
+		ctx, cancel := context.WithCancel(context.Background())
+		reso := &Resolver{
+			PerQueryRetries: 4,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						count.Add(1)
+						cancel() // the context is done after the first lookup
+						return nil, errors.New("mocked error")
+					},
+				}
+				return reso, nil
+			},
+		}
+		ri := &resolverinfo{URL: "dot://www.ooni.nonexistent", Score: 0.95}
+		if _, err := reso.lookupHost(ctx, ri, "dns.google"); err == nil {
+			t.Fatal("expected an error here")
+		}
+		if count.Load() != 1 {
+			t.Fatal("unexpected number of lookups", count.Load())
+		}
+	})
+}
+
+func TestResolverWithAnswerValidator(t *testing.T) {
+	errBadAnswer := errors.New("bad answer")
+
+	// all the DoH resolvers return a bogus answer while the system resolver works
+	newResolver := func(store model.KeyValueStore) *Resolver {
+		return &Resolver{
+			AnswerValidator: func(domain string, addrs []string) error {
+				for _, addr := range addrs {
+					if addr == "10.10.34.35" {
+						return errBadAnswer
+					}
+				}
+				return nil
+			},
+			KVStore: store,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						if URL == systemResolverURL {
+							return []string{"104.18.26.46"}, nil
+						}
+						return []string{"10.10.34.35"}, nil
+					},
+				}
+				return reso, nil
+			},
+		}
+	}
+
+	// initialize the state so that the system resolver comes last
+	store := &kvstore.Memory{}
+	var state []*resolverinfo
+	for _, e := range allmakers {
+		score := 0.5
+		if e.url == systemResolverURL {
+			score = 0
+		}
+		state = append(state, &resolverinfo{URL: e.url, Score: score})
+	}
+	reso := newResolver(store)
+	if err := reso.writestate(state); err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := reso.LookupHost(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"104.18.26.46"}, addrs); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// make sure we penalized all the resolvers returning bogus answers
+	state, err = reso.readstate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range state {
+		switch e.URL {
+		case systemResolverURL:
+			if e.Score < 0.88 || e.Score > 0.92 {
+				t.Fatal("unexpected score", e.URL, e.Score)
+			}
+		default:
+			if e.Score < 0.049 || e.Score > 0.051 {
+				t.Fatal("unexpected score", e.URL, e.Score)
+			}
+		}
+	}
+}
+
+func TestResolverWithHTTP3Fallback(t *testing.T) {
+	// newResolver returns a resolver where only https://dns.google/dns-query works
+	newResolver := func(store model.KeyValueStore, fallback bool, calls *[]string) *Resolver {
+		return &Resolver{
+			HTTP3Fallback: fallback,
+			KVStore:       store,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				if h3 {
+					URL = strings.Replace(URL, "https://", "http3://", 1)
+				}
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						*calls = append(*calls, URL)
+						if URL == "https://dns.google/dns-query" {
+							return []string{"8.8.8.8"}, nil
+						}
+						return nil, errors.New("mocked error")
+					},
+				}
+				return reso, nil
+			},
+		}
+	}
+
+	// newStore returns a store where http3://dns.google/dns-query comes first
+	// and the https one has zero score. We also make sure that the second and the
+	// third entries are failing cloudflare resolvers, so that maybeConfusion
+	// cannot move the https one at the beginning of the state.
+	newStore := func(t *testing.T) model.KeyValueStore {
+		store := &kvstore.Memory{}
+		var state []*resolverinfo
+		for _, e := range allmakers {
+			var score float64
+			switch e.url {
+			case "http3://dns.google/dns-query":
+				score = 0.9
+			case "https://cloudflare-dns.com/dns-query":
+				score = 0.8
+			case "http3://cloudflare-dns.com/dns-query":
+				score = 0.7
+			}
+			state = append(state, &resolverinfo{URL: e.url, Score: score})
+		}
+		reso := &Resolver{KVStore: store}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+
+	t.Run("with HTTP3Fallback we immediately retry using https", func(t *testing.T) {
+		var calls []string
+		reso := newResolver(newStore(t), true, &calls)
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(calls) < 2 {
+			t.Fatal("expected at least two calls", calls)
+		}
+		expect := []string{"http3://dns.google/dns-query", "https://dns.google/dns-query"}
+		if diff := cmp.Diff(expect, calls[len(calls)-2:]); diff != "" {
+			t.Fatal(diff)
+		}
+		state, err := reso.readstate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range state {
+			switch e.URL {
+			case "http3://dns.google/dns-query":
+				if e.Score < 0.089 || e.Score > 0.091 {
+					t.Fatal("unexpected score", e.URL, e.Score)
+				}
+			case "https://dns.google/dns-query":
+				if e.Score < 0.89 || e.Score > 0.91 {
+					t.Fatal("unexpected score", e.URL, e.Score)
+				}
+			}
+		}
+	})
+
+	t.Run("without HTTP3Fallback we do not fall back", func(t *testing.T) {
+		reso := &Resolver{HTTP3Fallback: false}
+		state := []*resolverinfo{
+			{URL: "http3://dns.google/dns-query"},
+			{URL: "https://dns.google/dns-query"},
+		}
+		if fe := reso.http3Fallback(state, state[0]); fe != nil {
+			t.Fatal("expected nil", fe)
+		}
+	})
+
+	t.Run("we fall back to the https entry inside the state", func(t *testing.T) {
+		reso := &Resolver{HTTP3Fallback: true}
+		state := []*resolverinfo{
+			{URL: "http3://dns.google/dns-query"},
+			{URL: "https://dns.google/dns-query"},
+		}
+		if fe := reso.http3Fallback(state, state[0]); fe != state[1] {
+			t.Fatal("unexpected entry", fe)
+		}
+	})
+
+	t.Run("we do not fall back without an https entry inside the state", func(t *testing.T) {
+		reso := &Resolver{HTTP3Fallback: true}
+		state := []*resolverinfo{{URL: "http3://dns.google/dns-query"}}
+		if fe := reso.http3Fallback(state, state[0]); fe != nil {
+			t.Fatal("expected nil", fe)
+		}
+	})
+
+	t.Run("we do not fall back for non-http3 URLs", func(t *testing.T) {
+		reso := &Resolver{HTTP3Fallback: true}
+		state := []*resolverinfo{{URL: "https://dns.google/dns-query"}}
+		if fe := reso.http3Fallback(state, state[0]); fe != nil {
+			t.Fatal("expected nil", fe)
+		}
+	})
+}
+
+func TestResolverWithDeterministic(t *testing.T) {
+	// newResolver returns a deterministic resolver whose child resolvers
+	// always fail and record the URL in calls when we use them.
+	newResolver := func(store model.KeyValueStore, calls *[]string) *Resolver {
+		return &Resolver{
+			Deterministic: true,
+			KVStore:       store,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				if h3 {
+					URL = strings.Replace(URL, "https://", "http3://", 1)
+				}
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						*calls = append(*calls, URL)
+						return nil, errors.New("mocked error")
+					},
+				}
+				return reso, nil
+			},
+		}
+	}
+
+	// newStore returns a store where all the entries have the same score
+	// except for the system resolver, which has the lowest score.
+	newStore := func(t *testing.T) model.KeyValueStore {
+		store := &kvstore.Memory{}
+		var state []*resolverinfo
+		for _, e := range allmakers {
+			score := 0.5
+			if e.url == systemResolverURL {
+				score = 0.1
+			}
+			state = append(state, &resolverinfo{URL: e.url, Score: score})
+		}
+		reso := &Resolver{KVStore: store}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+
+	// expectedOrder returns the URLs sorted lexically except for
+	// the system resolver URL, which comes last.
+	expectedOrder := func() (out []string) {
+		for _, e := range allmakers {
+			if e.url != systemResolverURL {
+				out = append(out, e.url)
+			}
+		}
+		sort.Strings(out)
+		return append(out, systemResolverURL)
+	}
+
+	t.Run("repeated lookups over identical state use the same order", func(t *testing.T) {
+		for idx := 0; idx < 32; idx++ {
+			var calls []string
+			reso := newResolver(newStore(t), &calls)
+			if _, err := reso.LookupHost(context.Background(), "dns.google"); !errors.Is(err, ErrLookupHost) {
+				t.Fatal("not the error we expected", err)
+			}
+			if diff := cmp.Diff(expectedOrder(), calls); diff != "" {
+				t.Fatal(idx, diff)
+			}
+		}
+	})
+
+	t.Run("entries missing from the state do not use a random score", func(t *testing.T) {
+		for idx := 0; idx < 32; idx++ {
+			var calls []string
+			reso := newResolver(&kvstore.Memory{}, &calls)
+			if _, err := reso.LookupHost(context.Background(), "dns.google"); !errors.Is(err, ErrLookupHost) {
+				t.Fatal("not the error we expected", err)
+			}
+			if diff := cmp.Diff(expectedOrder(), calls); diff != "" {
+				t.Fatal(idx, diff)
+			}
+		}
+	})
+}
+
 func TestMaybeConfusionNoConfusion(t *testing.T) {
 	reso := &Resolver{}
 	rv := reso.maybeConfusion(nil, 0)
@@ -5,6 +5,7 @@ package engineresolver
 //
 
 import (
+	"crypto/x509"
 	"math/rand"
 	"strings"
 	"time"
@@ -66,9 +67,10 @@ func (r *Resolver) logger() model.Logger {
 }
 
 // newChildResolver creates a new child model.Resolver.
-func (r *Resolver) newChildResolver(h3 bool, URL string) (model.Resolver, error) {
+func (r *Resolver) newChildResolver(h3 bool, URL string,
+	wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
 	if r.newChildResolverFn != nil {
-		return r.newChildResolverFn(h3, URL)
+		return r.newChildResolverFn(h3, URL, wrapTransport)
 	}
 	return newChildResolver(
 		r.logger(),
@@ -76,17 +78,44 @@ func (r *Resolver) newChildResolver(h3 bool, URL string) (model.Resolver, error)
 		h3,
 		r.ByteCounter, // newChildResolver handles the nil case
 		r.ProxyURL,    // ditto
+		wrapTransport, // ditto
+		r.Bootstrap,   // ditto
+		r.rootCAs(h3, URL),
+		r.MaxDoHResponseBytes, // ditto
+		r.Dialer,              // ditto
 	)
 }
 
+// rootCAs returns the OPTIONAL root CAs to use for the child resolver with the given
+// URL, which uses the https scheme also when h3 is true (see newresolver).
+func (r *Resolver) rootCAs(h3 bool, URL string) *x509.CertPool {
+	if h3 {
+		URL = strings.Replace(URL, "https://", "http3://", 1)
+	}
+	return r.RootCAs[URL] // works even if the map is nil
+}
+
 // newresolver creates a new resolver with the given config and URL. This is
 // where we expand http3 to https and set the h3 options.
+//
+// When the Recorder is set, we wrap the child resolver such that we record its
+// lookups, or, in replay mode, we return a resolver not using the network.
 func (r *Resolver) newresolver(URL string) (model.Resolver, error) {
+	if r.Recorder != nil && r.Recorder.Replay {
+		return &lookupRecorderResolver{URL: URL, recorder: r.Recorder, underlying: nil}, nil
+	}
+	wrapTransport := r.maybeWrapDNSTransportWith0x20(URL, r.maybeWrapDNSTransportWithDNSSEC(URL,
+		r.maybeWrapDNSTransportWithTTL(r.maybeWrapDNSTransportWithRcode(r.maybeNewDNSTransportWrapper(URL)))))
 	h3 := strings.HasPrefix(URL, "http3://")
+	childURL := URL
 	if h3 {
-		URL = strings.Replace(URL, "http3://", "https://", 1)
+		childURL = strings.Replace(URL, "http3://", "https://", 1)
+	}
+	re, err := r.newChildResolver(h3, childURL, wrapTransport)
+	if err != nil || r.Recorder == nil {
+		return re, err
 	}
-	return r.newChildResolver(h3, URL)
+	return &lookupRecorderResolver{URL: URL, recorder: r.Recorder, underlying: re}, nil
 }
 
 // getresolver returns a resolver with the given URL. This function caches
@@ -95,6 +124,7 @@ func (r *Resolver) getresolver(URL string) (model.Resolver, error) {
 	defer r.mu.Unlock()
 	r.mu.Lock()
 	if re, found := r.res[URL]; found {
+		r.touchresolver(URL)
 		return re, nil // already created
 	}
 	re, err := r.newresolver(URL)
@@ -105,15 +135,62 @@ func (r *Resolver) getresolver(URL string) (model.Resolver, error) {
 		r.res = make(map[string]model.Resolver)
 	}
 	r.res[URL] = re
+	r.touchresolver(URL)
+	r.maybeEvictresolvers()
+	r.maybeStartIdleReaper()
 	return re, nil
 }
 
-// closeall closes the cached resolvers.
+// touchresolver marks the resolver with the given URL as the most
+// recently used one. The caller MUST hold r.mu.
+func (r *Resolver) touchresolver(URL string) {
+	for idx, entry := range r.resLRU {
+		if entry == URL {
+			r.resLRU = append(r.resLRU[:idx], r.resLRU[idx+1:]...)
+			break
+		}
+	}
+	r.resLRU = append(r.resLRU, URL)
+	if r.resLastUsed == nil {
+		r.resLastUsed = make(map[string]time.Time)
+	}
+	r.resLastUsed[URL] = r.timeNow()
+}
+
+// maybeEvictresolvers evicts the least recently used resolvers when we
+// are caching more than MaxCachedResolvers resolvers. The caller MUST hold r.mu.
+//
+// Eviction only closes and forgets the child resolver. We keep the scores,
+// thus, when needed again, we will create a new child resolver.
+func (r *Resolver) maybeEvictresolvers() {
+	if r.MaxCachedResolvers <= 0 {
+		return
+	}
+	for len(r.res) > r.MaxCachedResolvers && len(r.resLRU) > 0 {
+		URL := r.resLRU[0]
+		r.resLRU = r.resLRU[1:]
+		if re, found := r.res[URL]; found {
+			r.logger().Infof("sessionresolver: evicting cached resolver: %s", URL)
+			re.CloseIdleConnections()
+			delete(r.res, URL)
+		}
+		delete(r.resLastUsed, URL)
+	}
+}
+
+// closeall closes the cached resolvers and stops closing idle resolvers.
 func (r *Resolver) closeall() {
 	defer r.mu.Unlock()
 	r.mu.Lock()
+	if r.idleReaperStop != nil {
+		close(r.idleReaperStop)
+		r.idleReaperStop = nil
+	}
+	r.idleReaperClosed = true
 	for _, re := range r.res {
 		re.CloseIdleConnections()
 	}
 	r.res = nil
+	r.resLRU = nil
+	r.resLastUsed = nil
 }
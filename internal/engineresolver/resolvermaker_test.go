@@ -1,9 +1,16 @@
 package engineresolver
 
 import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/bytecounter"
 	"github.com/ooni/probe-cli/v3/internal/mocks"
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -43,7 +50,7 @@ func TestGetResolverHTTPSStandard(t *testing.T) {
 	)
 	reso := &Resolver{
 		ByteCounter: bc,
-		newChildResolverFn: func(h3 bool, URL string) (model.Resolver, error) {
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
 			savedURL = URL
 			savedH3 = h3
 			return re, nil
@@ -90,7 +97,7 @@ func TestGetResolverHTTP3(t *testing.T) {
 	)
 	reso := &Resolver{
 		ByteCounter: bc,
-		newChildResolverFn: func(h3 bool, URL string) (model.Resolver, error) {
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
 			savedURL = URL
 			savedH3 = h3
 			return re, nil
@@ -121,3 +128,185 @@ func TestGetResolverHTTP3(t *testing.T) {
 		t.Fatal("expected true")
 	}
 }
+
+func TestGetResolverWithMaxCachedResolvers(t *testing.T) {
+	closed := make(map[string]int)
+	created := make(map[string]int)
+	reso := &Resolver{
+		MaxCachedResolvers: 2,
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			created[URL]++
+			re := &mocks.Resolver{
+				MockCloseIdleConnections: func() {
+					closed[URL]++
+				},
+			}
+			return re, nil
+		},
+	}
+	mustGet := func(URL string) {
+		if _, err := reso.getresolver(URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustGet("https://a.example.com/")
+	mustGet("https://b.example.com/")
+	mustGet("https://a.example.com/") // now b is the least recently used
+	if len(closed) != 0 {
+		t.Fatal("expected no evictions", closed)
+	}
+
+	mustGet("https://c.example.com/")
+	if diff := cmp.Diff(map[string]int{"https://b.example.com/": 1}, closed); diff != "" {
+		t.Fatal(diff)
+	}
+	if len(reso.res) != 2 {
+		t.Fatal("unexpected number of cached resolvers", len(reso.res))
+	}
+	if _, found := reso.res["https://b.example.com/"]; found {
+		t.Fatal("expected b to have been evicted")
+	}
+
+	mustGet("https://b.example.com/") // now a is the least recently used
+	expectClosed := map[string]int{
+		"https://a.example.com/": 1,
+		"https://b.example.com/": 1,
+	}
+	if diff := cmp.Diff(expectClosed, closed); diff != "" {
+		t.Fatal(diff)
+	}
+	expectCreated := map[string]int{
+		"https://a.example.com/": 1,
+		"https://b.example.com/": 2,
+		"https://c.example.com/": 1,
+	}
+	if diff := cmp.Diff(expectCreated, created); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestResolverRootCAs(t *testing.T) {
+	pool := x509.NewCertPool()
+	reso := &Resolver{
+		RootCAs: map[string]*x509.CertPool{
+			"https://dns.google/dns-query":    pool,
+			"http3://dns.quad9.net/dns-query": pool,
+		},
+	}
+
+	type testcase struct {
+		name   string
+		h3     bool
+		URL    string
+		expect *x509.CertPool
+	}
+
+	cases := []testcase{{
+		name:   "for a matching https URL",
+		h3:     false,
+		URL:    "https://dns.google/dns-query",
+		expect: pool,
+	}, {
+		name:   "for a matching http3 URL",
+		h3:     true,
+		URL:    "https://dns.quad9.net/dns-query",
+		expect: pool,
+	}, {
+		name:   "the http3 URL does not match the https entry",
+		h3:     true,
+		URL:    "https://dns.google/dns-query",
+		expect: nil,
+	}, {
+		name:   "for an unmatched URL",
+		h3:     false,
+		URL:    "https://mozilla.cloudflare-dns.com/dns-query",
+		expect: nil,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := reso.rootCAs(tc.h3, tc.URL); got != tc.expect {
+				t.Fatal("unexpected root CAs", got)
+			}
+		})
+	}
+
+	t.Run("with a nil map", func(t *testing.T) {
+		reso := &Resolver{}
+		if got := reso.rootCAs(false, "https://dns.google/dns-query"); got != nil {
+			t.Fatal("unexpected root CAs", got)
+		}
+	})
+}
+
+func TestResolverDialer(t *testing.T) {
+	handler := &testDNSOverHTTPSHandler{
+		A: []net.IP{net.IPv4(8, 8, 8, 8)},
+	}
+	srvr := httptest.NewServer(handler)
+	defer srvr.Close()
+	parsed, err := url.Parse(srvr.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the .invalid TLD guarantees that we cannot resolve the hostname using the DNS
+	const hostname = "dns.dialer.invalid"
+	URL := &url.URL{Scheme: "http", Host: net.JoinHostPort(hostname, parsed.Port()), Path: "/dns-query"}
+
+	t.Run("with a custom dialer we use it to connect to the server addresses", func(t *testing.T) {
+		var (
+			addresses []string
+			mu        sync.Mutex
+		)
+		dialer := &mocks.Dialer{
+			MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				mu.Lock()
+				addresses = append(addresses, address)
+				mu.Unlock()
+				return (&net.Dialer{}).DialContext(ctx, network, address)
+			},
+			MockCloseIdleConnections: func() {
+				// nothing
+			},
+		}
+		reso := &Resolver{
+			Bootstrap: map[string][]string{hostname: {parsed.Hostname()}},
+			Dialer:    dialer,
+		}
+		child, err := reso.newChildResolver(false, URL.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer child.CloseIdleConnections()
+		addrs, err := child.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff([]string{parsed.Host}, addresses); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("without a custom dialer we use the default dialer", func(t *testing.T) {
+		reso := &Resolver{
+			Bootstrap: map[string][]string{hostname: {parsed.Hostname()}},
+		}
+		child, err := reso.newChildResolver(false, URL.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer child.CloseIdleConnections()
+		addrs, err := child.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
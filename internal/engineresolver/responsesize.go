@@ -0,0 +1,72 @@
+package engineresolver
+
+//
+// Limiting the size of DoH responses
+//
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// ErrResponseTooLarge indicates that a DoH response was larger than
+// the limit configured using Resolver.MaxDoHResponseBytes.
+var ErrResponseTooLarge = errors.New("sessionresolver: DoH response too large")
+
+// defaultMaxDoHResponseBytes is the default maximum size of a DoH
+// response, which is the maximum size of a DNS message.
+const defaultMaxDoHResponseBytes = 1 << 16
+
+// httpTransportResponseSizeLimit is a model.HTTPTransport failing
+// with ErrResponseTooLarge when a response body is too large.
+type httpTransportResponseSizeLimit struct {
+	model.HTTPTransport
+	maxBytes int64
+}
+
+// newHTTPTransportResponseSizeLimit wraps txp such that we read at most maxBytes
+// from each response body. When maxBytes is zero or negative, we use the
+// defaultMaxDoHResponseBytes limit.
+func newHTTPTransportResponseSizeLimit(txp model.HTTPTransport, maxBytes int64) model.HTTPTransport {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxDoHResponseBytes
+	}
+	return &httpTransportResponseSizeLimit{HTTPTransport: txp, maxBytes: maxBytes}
+}
+
+// RoundTrip implements model.HTTPTransport.
+func (txp *httpTransportResponseSizeLimit) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := txp.HTTPTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength > txp.maxBytes {
+		resp.Body.Close()
+		return nil, ErrResponseTooLarge
+	}
+	resp.Body = &responseBodySizeLimit{ReadCloser: resp.Body, remaining: txp.maxBytes}
+	return resp, nil
+}
+
+// responseBodySizeLimit is an io.ReadCloser failing with ErrResponseTooLarge
+// as soon as we read more than the configured number of bytes.
+type responseBodySizeLimit struct {
+	io.ReadCloser
+	remaining int64
+}
+
+// Read implements io.Reader.
+func (b *responseBodySizeLimit) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1] // enough to see whether we're over the limit
+	}
+	count, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(count)
+	if b.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	return count, err
+}
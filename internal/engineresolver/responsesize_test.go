@@ -0,0 +1,129 @@
+package engineresolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverMaxDoHResponseBytes(t *testing.T) {
+	// the server returns an oversized DNS response
+	srvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/dns-message")
+		w.Write(make([]byte, 4096))
+	}))
+	defer srvr.Close()
+
+	// newResolver returns a resolver whose only child resolver uses the server
+	newResolver := func(maxBytes int64) *Resolver {
+		reso := &Resolver{
+			AllowedSchemes:      []string{"https"},
+			KVStore:             &kvstore.Memory{},
+			MaxDoHResponseBytes: maxBytes,
+		}
+		reso.newChildResolverFn = func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			return newChildResolver(
+				model.DiscardLogger, srvr.URL, false, nil, nil, nil, nil, nil, reso.MaxDoHResponseBytes, nil)
+		}
+		state := []*resolverinfo{{
+			URL:   "https://dns.google/dns-query",
+			Score: 1,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return reso
+	}
+
+	t.Run("we fail and penalize the resolver when the response is too large", func(t *testing.T) {
+		reso := newResolver(1024)
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrResponseTooLarge) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(addrs) != 0 {
+			t.Fatal("expected no addrs", addrs)
+		}
+		if score := reso.Scoreboard()[0].Score; score >= 1 {
+			t.Fatal("expected the resolver to be penalized", score)
+		}
+	})
+
+	t.Run("with the default limit we read the whole response", func(t *testing.T) {
+		reso := newResolver(0)
+		_, err := reso.LookupHost(context.Background(), "dns.google")
+		if err == nil || errors.Is(err, ErrResponseTooLarge) {
+			t.Fatal("unexpected error", err) // we expect to fail decoding the zeroes
+		}
+	})
+}
+
+func TestHTTPTransportResponseSizeLimit(t *testing.T) {
+	// newTransport returns a transport returning the given body and content length
+	newTransport := func(body []byte, contentLength int64, maxBytes int64) model.HTTPTransport {
+		underlying := &mocks.HTTPTransport{
+			MockRoundTrip: func(req *http.Request) (*http.Response, error) {
+				resp := &http.Response{
+					StatusCode:    200,
+					Body:          io.NopCloser(bytes.NewReader(body)),
+					ContentLength: contentLength,
+				}
+				return resp, nil
+			},
+		}
+		return newHTTPTransportResponseSizeLimit(underlying, maxBytes)
+	}
+
+	// readBody performs a round trip and reads the whole response body
+	readBody := func(txp model.HTTPTransport) ([]byte, error) {
+		req, err := http.NewRequest("GET", "https://dns.google/dns-query", nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := txp.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+
+	t.Run("we read bodies within the limit", func(t *testing.T) {
+		body, err := readBody(newTransport(make([]byte, 512), -1, 512))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body) != 512 {
+			t.Fatal("unexpected body length", len(body))
+		}
+	})
+
+	t.Run("we fail with bodies exceeding the limit", func(t *testing.T) {
+		_, err := readBody(newTransport(make([]byte, 513), -1, 512))
+		if !errors.Is(err, ErrResponseTooLarge) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we fail early when the content length exceeds the limit", func(t *testing.T) {
+		_, err := readBody(newTransport(nil, 513, 512))
+		if !errors.Is(err, ErrResponseTooLarge) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we use the default limit when the limit is not positive", func(t *testing.T) {
+		_, err := readBody(newTransport(make([]byte, defaultMaxDoHResponseBytes+1), -1, 0))
+		if !errors.Is(err, ErrResponseTooLarge) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
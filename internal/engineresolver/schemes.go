@@ -0,0 +1,37 @@
+package engineresolver
+
+//
+// Restricting the schemes used by child resolvers
+//
+
+import "net/url"
+
+// filterschemes returns the entries of the state whose URL scheme
+// is inside AllowedSchemes. When AllowedSchemes is empty, we return
+// the original state without filtering it.
+func (r *Resolver) filterschemes(ri []*resolverinfo) []*resolverinfo {
+	if len(r.AllowedSchemes) <= 0 {
+		return ri
+	}
+	out := []*resolverinfo{}
+	for _, e := range ri {
+		if r.schemeallowed(e.URL) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// schemeallowed returns whether AllowedSchemes contains the scheme of the URL.
+func (r *Resolver) schemeallowed(URL string) bool {
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return false
+	}
+	for _, scheme := range r.AllowedSchemes {
+		if parsed.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverAllowedSchemes(t *testing.T) {
+	// newResolver returns a resolver allowing the given schemes whose child
+	// resolvers fail and record the URLs of the child resolvers we used.
+	newResolver := func(allowed ...string) (*Resolver, *[]string) {
+		var used []string
+		reso := &Resolver{
+			AllowedSchemes: allowed,
+			Deterministic:  true,
+			KVStore:        &kvstore.Memory{},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				if h3 {
+					URL = "http3" + URL[len("https"):]
+				}
+				re := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						used = append(used, URL)
+						return nil, errors.New("mocked error")
+					},
+				}
+				return re, nil
+			},
+		}
+		return reso, &used
+	}
+
+	t.Run("with no allowed schemes we use all the resolvers", func(t *testing.T) {
+		reso, used := newResolver()
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(*used) != len(allmakers) {
+			t.Fatal("expected to use all the resolvers", *used)
+		}
+		if board := reso.Scoreboard(); len(board) != len(allmakers) {
+			t.Fatal("expected all the resolvers in the scoreboard", board)
+		}
+	})
+
+	t.Run("we only use resolvers with allowed schemes", func(t *testing.T) {
+		reso, used := newResolver("https")
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(*used) <= 0 {
+			t.Fatal("expected to use some resolvers")
+		}
+		for _, URL := range *used {
+			if !strings.HasPrefix(URL, "https://") {
+				t.Fatal("used a resolver with a disallowed scheme", URL)
+			}
+		}
+		board := reso.Scoreboard()
+		if len(board) != len(*used) {
+			t.Fatal("unexpected scoreboard length", board)
+		}
+		for _, entry := range board {
+			if !strings.HasPrefix(entry.URL, "https://") {
+				t.Fatal("scoreboard contains a disallowed scheme", entry.URL)
+			}
+		}
+	})
+
+	t.Run("we drop persisted entries with disallowed schemes", func(t *testing.T) {
+		reso, used := newResolver("http3")
+		state := []*resolverinfo{{
+			URL:   systemResolverURL,
+			Score: 1,
+		}, {
+			URL:   "http3://dns.google/dns-query",
+			Score: 0.9,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(*used) <= 0 || (*used)[0] != "http3://dns.google/dns-query" {
+			t.Fatal("expected to use the persisted http3 resolver first", *used)
+		}
+		for _, URL := range *used {
+			if URL == systemResolverURL {
+				t.Fatal("used the system resolver")
+			}
+		}
+		for _, entry := range reso.Scoreboard() {
+			if entry.URL == systemResolverURL {
+				t.Fatal("the scoreboard contains the system resolver")
+			}
+		}
+	})
+
+	t.Run("when no scheme is supported the lookup fails", func(t *testing.T) {
+		reso, used := newResolver("dot")
+		_, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(*used) != 0 {
+			t.Fatal("expected to use no resolvers", *used)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package engineresolver
+
+//
+// Introspecting the child resolvers
+//
+
+// ResolverScore describes a child resolver inside the [*Resolver] scoreboard.
+type ResolverScore struct {
+	// URL is the URL of the child resolver.
+	URL string
+
+	// Score is the persisted score of the child resolver.
+	Score float64
+
+	// ConsecutiveFailures is the number of lookups that failed using the child
+	// resolver since its last successful lookup. We do not persist this value,
+	// hence it only covers the lookups performed by this [*Resolver].
+	ConsecutiveFailures int64
+
+	// StickyDeviations is the number of lookups using the child resolver whose
+	// addresses deviated from the remembered ones when StickyAnswers is true. We
+	// do not persist this value, hence it only covers the lookups performed by
+	// this [*Resolver].
+	StickyDeviations int64
+
+	// PrivateAnswers is the number of lookups using the child resolver that
+	// returned private addresses for public domains when FlagPrivateAnswers is
+	// true. We do not persist this value, hence it only covers the lookups
+	// performed by this [*Resolver].
+	PrivateAnswers int64
+}
+
+// Scoreboard returns the child resolvers in the order in which LookupHost
+// would attempt them, ignoring the low probability random reordering that
+// LookupHost performs when the Resolver is not Deterministic. This function
+// reads the persisted state and does not perform any network I/O.
+//
+// The [*Resolver] does not implement any circuit breaker, hence the scoreboard
+// only contains the scores, the consecutive failures, the deviations, and
+// the private answers.
+func (r *Resolver) Scoreboard() (out []ResolverScore) {
+	state := r.readstatedefault()
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	for _, e := range state {
+		out = append(out, ResolverScore{
+			URL:                 e.URL,
+			Score:               e.Score,
+			ConsecutiveFailures: r.consecutiveFailures[e.URL],
+			StickyDeviations:    r.stickyDeviations[e.URL],
+			PrivateAnswers:      r.privateAnswersCount[e.URL],
+		})
+	}
+	return
+}
+
+// recordoutcome updates the consecutive failures of the child resolver with
+// the given URL depending on whether the lookup failed.
+func (r *Resolver) recordoutcome(URL string, err error) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if err == nil {
+		delete(r.consecutiveFailures, URL)
+		return
+	}
+	if r.consecutiveFailures == nil {
+		r.consecutiveFailures = make(map[string]int64)
+	}
+	r.consecutiveFailures[URL]++
+}
@@ -0,0 +1,113 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverScoreboard(t *testing.T) {
+	failing := map[string]bool{}
+	reso := &Resolver{
+		Deterministic: true,
+		KVStore:       &kvstore.Memory{},
+		newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			if h3 {
+				URL = "http3" + URL[len("https"):]
+			}
+			re := &mocks.Resolver{
+				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+					if failing[URL] {
+						return nil, errors.New("mocked error")
+					}
+					return []string{"8.8.8.8"}, nil
+				},
+			}
+			return re, nil
+		},
+	}
+	state := []*resolverinfo{{
+		URL:   "https://dns.google/dns-query",
+		Score: 1,
+	}, {
+		URL:   "https://dns.quad9.net/dns-query",
+		Score: 0.9,
+	}}
+	if err := reso.writestate(state); err != nil {
+		t.Fatal(err)
+	}
+
+	// google fails and quad9 succeeds
+	failing["https://dns.google/dns-query"] = true
+	if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+		t.Fatal(err)
+	}
+
+	// quad9, which is now the first one, fails and the next one succeeds
+	failing["https://dns.quad9.net/dns-query"] = true
+	if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []ResolverScore{{
+		URL:                 "http3://cloudflare-dns.com/dns-query",
+		Score:               0.95, // 0.9*1 + 0.1*0.5
+		ConsecutiveFailures: 0,
+	}, {
+		URL:                 "http3://dns.google/dns-query",
+		Score:               0.5,
+		ConsecutiveFailures: 0,
+	}, {
+		URL:                 "http3://mozilla.cloudflare-dns.com/dns-query",
+		Score:               0.5,
+		ConsecutiveFailures: 0,
+	}, {
+		URL:                 "https://cloudflare-dns.com/dns-query",
+		Score:               0.5,
+		ConsecutiveFailures: 0,
+	}, {
+		URL:                 "https://mozilla.cloudflare-dns.com/dns-query",
+		Score:               0.5,
+		ConsecutiveFailures: 0,
+	}, {
+		URL:                 "https://dns.google/dns-query",
+		Score:               0.1, // 0.9*0 + 0.1*1
+		ConsecutiveFailures: 1,
+	}, {
+		URL:                 "https://dns.quad9.net/dns-query",
+		Score:               0.099, // 0.9*0 + 0.1*(0.9*1 + 0.1*0.9)
+		ConsecutiveFailures: 1,
+	}, {
+		URL:                 "system:///",
+		Score:               0,
+		ConsecutiveFailures: 0,
+	}}
+	if diff := cmp.Diff(expect, reso.Scoreboard(), cmpopts.EquateApprox(0, 1e-09)); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// further failures accumulate and a success resets them
+	consecutiveFailures := func(URL string) int64 {
+		for _, entry := range reso.Scoreboard() {
+			if entry.URL == URL {
+				return entry.ConsecutiveFailures
+			}
+		}
+		t.Fatal("cannot find", URL)
+		return 0
+	}
+	reso.recordoutcome("https://dns.quad9.net/dns-query", errors.New("mocked error"))
+	if v := consecutiveFailures("https://dns.quad9.net/dns-query"); v != 2 {
+		t.Fatal("unexpected consecutive failures", v)
+	}
+	reso.recordoutcome("https://dns.quad9.net/dns-query", nil)
+	if v := consecutiveFailures("https://dns.quad9.net/dns-query"); v != 0 {
+		t.Fatal("unexpected consecutive failures", v)
+	}
+}
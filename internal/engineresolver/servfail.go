@@ -0,0 +1,72 @@
+package engineresolver
+
+//
+// Distinguishing SERVFAIL from other failures
+//
+
+import (
+	"errors"
+
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// ErrServfail indicates that a child resolver returned SERVFAIL. Because we wrap
+// the original error, you can use errors.Is to check for this error both on the
+// errors returned by child resolvers and on the error returned by LookupHost.
+var ErrServfail = errors.New("sessionresolver: SERVFAIL")
+
+// servfailError wraps a child resolver error indicating SERVFAIL.
+type servfailError struct {
+	err error
+}
+
+// Error implements error.Error. We return the original error string, such that
+// logs and archival results are the same as for the original error.
+func (e *servfailError) Error() string {
+	return e.err.Error()
+}
+
+// Is allows consumers to check whether the error is ErrServfail.
+func (e *servfailError) Is(target error) bool {
+	return target == ErrServfail
+}
+
+// Unwrap returns the original error.
+func (e *servfailError) Unwrap() error {
+	return e.err
+}
+
+// isServfail returns whether the given child resolver error indicates SERVFAIL.
+func isServfail(err error) bool {
+	if errors.Is(err, netxlite.ErrOODNSServfail) {
+		return true
+	}
+	var errWrapper *netxlite.ErrWrapper
+	return errors.As(err, &errWrapper) && errWrapper.Failure == netxlite.FailureDNSServfailError
+}
+
+// maybeWrapServfail wraps the given child resolver error using a [*servfailError]
+// when it indicates SERVFAIL and otherwise returns the original error.
+func maybeWrapServfail(err error) error {
+	if err == nil || !isServfail(err) {
+		return err
+	}
+	return &servfailError{err}
+}
+
+// failureScore returns the sample we use for updating the score of a child
+// resolver that failed with the given error, which is ServfailScore, clamped
+// to [0, 1], for SERVFAIL, and zero for any other error.
+func (r *Resolver) failureScore(err error) float64 {
+	if !errors.Is(err, ErrServfail) {
+		return 0
+	}
+	switch {
+	case r.ServfailScore < 0:
+		return 0
+	case r.ServfailScore > 1:
+		return 1
+	default:
+		return r.ServfailScore
+	}
+}
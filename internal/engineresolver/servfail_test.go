@@ -0,0 +1,109 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestResolverServfail(t *testing.T) {
+	// newResolver returns a resolver whose child resolvers fail with the given error.
+	newResolver := func(servfailScore float64, err error) *Resolver {
+		return &Resolver{
+			KVStore:       &kvstore.Memory{},
+			ServfailScore: servfailScore,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						return nil, err
+					},
+				}
+				return reso, nil
+			},
+		}
+	}
+
+	servfail := &netxlite.ErrWrapper{
+		Failure:    netxlite.FailureDNSServfailError,
+		Operation:  netxlite.ResolveOperation,
+		WrappedErr: netxlite.ErrOODNSServfail,
+	}
+
+	t.Run("LookupHost surfaces SERVFAIL as ErrServfail", func(t *testing.T) {
+		reso := newResolver(0, servfail)
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrServfail) {
+			t.Fatal("not the error we expected", err)
+		}
+		if !errors.Is(err, netxlite.ErrOODNSServfail) {
+			t.Fatal("we should preserve the original error", err)
+		}
+		if len(addrs) != 0 {
+			t.Fatal("expected no addrs")
+		}
+	})
+
+	t.Run("we do not surface other failures as ErrServfail", func(t *testing.T) {
+		reso := newResolver(0, errors.New("mocked error"))
+		_, err := reso.LookupHost(context.Background(), "dns.google")
+		if !errors.Is(err, ErrLookupHost) || errors.Is(err, ErrServfail) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("we use ServfailScore to update the score", func(t *testing.T) {
+		type testcase struct {
+			name          string
+			servfailScore float64
+			err           error
+			expect        float64
+		}
+
+		cases := []testcase{{
+			name:          "SERVFAIL with the default score",
+			servfailScore: 0,
+			err:           servfail,
+			expect:        0.05, // 0.9*0.0 + 0.1*0.5
+		}, {
+			name:          "SERVFAIL with a configured score",
+			servfailScore: 0.5,
+			err:           servfail,
+			expect:        0.5, // 0.9*0.5 + 0.1*0.5
+		}, {
+			name:          "SERVFAIL with a score larger than one",
+			servfailScore: 7,
+			err:           servfail,
+			expect:        0.95, // 0.9*1.0 + 0.1*0.5
+		}, {
+			name:          "SERVFAIL detected using the failure string",
+			servfailScore: 0.5,
+			err:           &netxlite.ErrWrapper{Failure: netxlite.FailureDNSServfailError},
+			expect:        0.5, // 0.9*0.5 + 0.1*0.5
+		}, {
+			name:          "other failures with a configured score",
+			servfailScore: 0.5,
+			err:           errors.New("mocked error"),
+			expect:        0.05, // 0.9*0.0 + 0.1*0.5
+		}}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				reso := newResolver(tc.servfailScore, tc.err)
+				ri := &resolverinfo{URL: "https://dns.google/dns-query", Score: 0.5}
+				_, err := reso.lookupHost(context.Background(), ri, "dns.google")
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if math.Abs(ri.Score-tc.expect) > 1e-9 {
+					t.Fatal("unexpected score", ri.Score)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package engineresolver
+
+//
+// Reporting why we did not attempt child resolvers
+//
+
+// SkipReasonProxy means we skipped a child resolver because
+// we cannot use it along with the configured ProxyURL.
+const SkipReasonProxy = "proxy"
+
+// SkipReasonMaxAttempts means we did not attempt a child resolver
+// because we had exhausted the Resolver's AttemptBudget.
+const SkipReasonMaxAttempts = "max-attempts"
+
+// SkipReasonRateLimited means we did not attempt a child resolver
+// because it had exhausted the tokens allowed by PerResolverRate.
+const SkipReasonRateLimited = "rate-limited"
+
+// SkipReasonNotReached means we did not attempt a child resolver
+// because a previous child resolver had already succeeded.
+const SkipReasonNotReached = "not-reached"
+
+// SkipReasons returns a map from the URL of each child resolver that
+// the last LookupHost call did not attempt to the reason why it did not
+// attempt it (e.g., SkipReasonProxy). When several LookupHost calls run
+// concurrently, this function returns the reasons of the call that
+// completed last. This function returns an empty map if no LookupHost
+// call has completed yet or if the last call attempted all resolvers.
+func (r *Resolver) SkipReasons() map[string]string {
+	out := make(map[string]string)
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	for URL, reason := range r.skipReasons {
+		out[URL] = reason
+	}
+	return out
+}
+
+// saveSkipReasons saves the reasons why LookupHost did not attempt
+// some child resolvers. The state argument contains all the child
+// resolvers, tried contains the ones we actually attempted, rateLimited contains
+// the ones we skipped because of PerResolverRate, and outOfBudget indicates
+// whether we stopped because we exhausted the attempt budget.
+func (r *Resolver) saveSkipReasons(state []*resolverinfo,
+	tried map[string]bool, rateLimited map[string]bool, outOfBudget bool) {
+	reasons := make(map[string]string)
+	for _, e := range state {
+		switch {
+		case tried[e.URL]:
+			// nothing to do
+		case r.ProxyURL != nil && r.shouldSkipWithProxy(e):
+			reasons[e.URL] = SkipReasonProxy
+		case rateLimited[e.URL]:
+			reasons[e.URL] = SkipReasonRateLimited
+		case outOfBudget:
+			reasons[e.URL] = SkipReasonMaxAttempts
+		default:
+			reasons[e.URL] = SkipReasonNotReached
+		}
+	}
+	r.mu.Lock()
+	r.skipReasons = reasons
+	r.mu.Unlock()
+}
@@ -0,0 +1,137 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverSkipReasons(t *testing.T) {
+	// newResolver returns a resolver whose child resolvers succeed when
+	// success is true and fail otherwise, using the given proxy URL.
+	newResolver := func(success bool, proxyURL *url.URL) *Resolver {
+		return &Resolver{
+			KVStore:  &kvstore.Memory{},
+			ProxyURL: proxyURL,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						if success {
+							return []string{"8.8.8.8"}, nil
+						}
+						return nil, errors.New("mocked error")
+					},
+				}
+				return reso, nil
+			},
+		}
+	}
+
+	// isProxyIncompatible returns whether we cannot use the URL with a proxy.
+	isProxyIncompatible := func(URL string) bool {
+		return strings.HasPrefix(URL, "http3://") || URL == systemResolverURL
+	}
+
+	proxyURL := &url.URL{Scheme: "socks5", Host: "127.0.0.1:9050"}
+
+	t.Run("before any lookup", func(t *testing.T) {
+		reso := newResolver(true, nil)
+		if reasons := reso.SkipReasons(); len(reasons) != 0 {
+			t.Fatal("expected no reasons", reasons)
+		}
+	})
+
+	t.Run("when we attempt all the resolvers", func(t *testing.T) {
+		reso := newResolver(false, nil)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if reasons := reso.SkipReasons(); len(reasons) != 0 {
+			t.Fatal("expected no reasons", reasons)
+		}
+	})
+
+	t.Run("when a previous resolver succeeds", func(t *testing.T) {
+		reso := newResolver(true, nil)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		reasons := reso.SkipReasons()
+		if len(reasons) != len(allmakers)-1 {
+			t.Fatal("expected all resolvers but one", reasons)
+		}
+		for URL, reason := range reasons {
+			if reason != SkipReasonNotReached {
+				t.Fatal("unexpected reason", URL, reason)
+			}
+		}
+	})
+
+	t.Run("when we are using a proxy", func(t *testing.T) {
+		reso := newResolver(false, proxyURL)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err == nil {
+			t.Fatal("expected an error")
+		}
+		reasons := reso.SkipReasons()
+		for _, e := range allmakers {
+			switch {
+			case isProxyIncompatible(e.url):
+				if reasons[e.url] != SkipReasonProxy {
+					t.Fatal("unexpected reason", e.url, reasons[e.url])
+				}
+			default:
+				if _, found := reasons[e.url]; found {
+					t.Fatal("did not expect a reason", e.url, reasons[e.url])
+				}
+			}
+		}
+	})
+
+	t.Run("when we are using a proxy and a previous resolver succeeds", func(t *testing.T) {
+		reso := newResolver(true, proxyURL)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		reasons := reso.SkipReasons()
+		var notReached int
+		for _, e := range allmakers {
+			switch reason, found := reasons[e.url]; {
+			case isProxyIncompatible(e.url):
+				if reason != SkipReasonProxy {
+					t.Fatal("unexpected reason", e.url, reason)
+				}
+			case found:
+				if reason != SkipReasonNotReached {
+					t.Fatal("unexpected reason", e.url, reason)
+				}
+				notReached++
+			}
+		}
+		if len(reasons) != len(allmakers)-1 {
+			t.Fatal("expected all resolvers but one", reasons)
+		}
+		if notReached < 1 {
+			t.Fatal("expected at least a not-reached resolver")
+		}
+	})
+
+	t.Run("SkipReasons returns a copy", func(t *testing.T) {
+		reso := newResolver(true, nil)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		reasons := reso.SkipReasons()
+		for URL := range reasons {
+			delete(reasons, URL)
+		}
+		if len(reso.SkipReasons()) != len(allmakers)-1 {
+			t.Fatal("SkipReasons did not return a copy")
+		}
+	})
+}
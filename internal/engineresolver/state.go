@@ -6,7 +6,9 @@ package engineresolver
 
 import (
 	"errors"
+	"net/url"
 	"sort"
+	"time"
 )
 
 // TODO(bassosimone): we may want to change the key and rename or
@@ -23,6 +25,10 @@ type resolverinfo struct {
 
 	// Score is the score of a resolver.
 	Score float64
+
+	// Updated is when we last updated the score. The zero value
+	// means that we don't know, e.g., because we read old state.
+	Updated time.Time
 }
 
 // ErrNilKVStore indicates that the KVStore is nil.
@@ -34,6 +40,10 @@ func (r *Resolver) readstate() ([]*resolverinfo, error) {
 		return nil, ErrNilKVStore
 	}
 	data, err := r.KVStore.Get(storekey)
+	if err != nil && r.FallbackKVStore != nil {
+		r.logger().Warnf("sessionresolver: cannot read state from KVStore: %s", err.Error())
+		data, err = r.FallbackKVStore.Get(storekey)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -55,9 +65,13 @@ func (r *Resolver) readstateandprune() ([]*resolverinfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	supported := make(map[string]bool)
+	for _, e := range r.resolvermakers() {
+		supported[e.url] = true
+	}
 	var out []*resolverinfo
 	for _, e := range ri {
-		if _, found := allbyurl[e.URL]; !found {
+		if !supported[e.URL] {
 			continue // we don't support this specific entry
 		}
 		out = append(out, e)
@@ -68,35 +82,83 @@ func (r *Resolver) readstateandprune() ([]*resolverinfo, error) {
 	return out, nil
 }
 
-// sortstate sorts the state by descending score
-func sortstate(ri []*resolverinfo) {
+// sortstate sorts the state by descending score. When the priority
+// is not empty, we use the priority of the URL scheme to break ties
+// between entries having the same score. When lexical is true, we break
+// the remaining ties using the lexical order of the URLs, such that the
+// result does not depend on the original order of the entries.
+func sortstate(ri []*resolverinfo, priority []string, lexical bool) {
+	if len(priority) <= 0 && !lexical {
+		sort.SliceStable(ri, func(i, j int) bool {
+			return ri[i].Score >= ri[j].Score
+		})
+		return
+	}
 	sort.SliceStable(ri, func(i, j int) bool {
-		return ri[i].Score >= ri[j].Score
+		if ri[i].Score != ri[j].Score {
+			return ri[i].Score > ri[j].Score
+		}
+		ranki, rankj := schemerank(ri[i].URL, priority), schemerank(ri[j].URL, priority)
+		if ranki != rankj {
+			return ranki < rankj
+		}
+		return lexical && ri[i].URL < ri[j].URL
 	})
 }
 
+// schemerank returns the index of the URL scheme inside the priority
+// list or the length of the list when the scheme is not listed.
+func schemerank(URL string, priority []string) int {
+	if parsed, err := url.Parse(URL); err == nil {
+		for idx, scheme := range priority {
+			if parsed.Scheme == scheme {
+				return idx
+			}
+		}
+	}
+	return len(priority)
+}
+
+// deterministicInitialScore is the initial score we give to the child
+// resolvers missing from the state, except for the system resolver, when
+// the Resolver is Deterministic. It is the expected value of the random
+// initial score we use otherwise.
+const deterministicInitialScore = 0.5
+
 // readstatedefault reads the state from disk and merges the state
 // so that all supported entries are represented.
 func (r *Resolver) readstatedefault() []*resolverinfo {
 	ri, _ := r.readstateandprune()
+	r.decayscores(ri)
 	here := make(map[string]bool)
 	for _, e := range ri {
 		here[e.URL] = true // record what we already have
 	}
-	for _, e := range allmakers {
+	for _, e := range r.resolvermakers() {
 		if _, found := here[e.url]; found {
 			continue // already here so no need to add
 		}
+		score := e.score
+		if r.Deterministic && e.url != systemResolverURL {
+			score = deterministicInitialScore
+		}
 		ri = append(ri, &resolverinfo{
 			URL:   e.url,
-			Score: e.score,
+			Score: score,
 		})
 	}
-	sortstate(ri)
-	return ri
+	filtered := r.filterschemes(ri)
+	if len(filtered) <= 0 && r.FailOpen {
+		r.logger().Warnf("sessionresolver: no available child resolvers: failing open")
+		filtered = failopenstate(ri)
+	}
+	sortstate(filtered, r.SchemePriority, r.Deterministic)
+	return filtered
 }
 
-// writestate writes the state to the kvstore.
+// writestate writes the state to the kvstore and, when it's
+// configured, also to the fallback kvstore. We always attempt to
+// write into both stores and we return the first error.
 func (r *Resolver) writestate(ri []*resolverinfo) error {
 	if r.KVStore == nil {
 		return ErrNilKVStore
@@ -105,5 +167,11 @@ func (r *Resolver) writestate(ri []*resolverinfo) error {
 	if err != nil {
 		return err
 	}
-	return r.KVStore.Set(storekey, data)
+	err = r.KVStore.Set(storekey, data)
+	if r.FallbackKVStore != nil {
+		if fallbackErr := r.FallbackKVStore.Set(storekey, data); err == nil {
+			err = fallbackErr
+		}
+	}
+	return err
 }
@@ -2,9 +2,13 @@ package engineresolver
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 func TestReadStateNoKVStore(t *testing.T) {
@@ -146,3 +150,242 @@ func TestWriteStateCannotSerialize(t *testing.T) {
 		t.Fatal("not the error we expected", err)
 	}
 }
+
+func TestReadStateWithFallbackKVStore(t *testing.T) {
+	t.Run("we read from the fallback when the primary fails", func(t *testing.T) {
+		errMocked := errors.New("mocked error")
+		reso := &Resolver{
+			FallbackKVStore: &kvstore.Memory{},
+			KVStore: &mocks.KeyValueStore{
+				MockGet: func(key string) ([]byte, error) {
+					return nil, errMocked
+				},
+			},
+		}
+		expected := []*resolverinfo{{
+			URL:   "https://dns.google/dns-query",
+			Score: 0.88,
+		}}
+		data, err := reso.codec().Encode(expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reso.FallbackKVStore.Set(storekey, data); err != nil {
+			t.Fatal(err)
+		}
+		out, err := reso.readstate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we return the fallback error when both stores fail", func(t *testing.T) {
+		reso := &Resolver{
+			FallbackKVStore: &kvstore.Memory{},
+			KVStore:         &kvstore.Memory{},
+		}
+		out, err := reso.readstate()
+		if !errors.Is(err, kvstore.ErrNoSuchKey) {
+			t.Fatal("not the error we expected", err)
+		}
+		if out != nil {
+			t.Fatal("expected nil here")
+		}
+	})
+}
+
+func TestWriteStateWithFallbackKVStore(t *testing.T) {
+	in := []*resolverinfo{{
+		URL:   "https://dns.google/dns-query",
+		Score: 0.88,
+	}}
+
+	t.Run("we write into both stores", func(t *testing.T) {
+		reso := &Resolver{
+			FallbackKVStore: &kvstore.Memory{},
+			KVStore:         &kvstore.Memory{},
+		}
+		if err := reso.writestate(in); err != nil {
+			t.Fatal(err)
+		}
+		for _, store := range []model.KeyValueStore{reso.KVStore, reso.FallbackKVStore} {
+			data, err := store.Get(storekey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out []*resolverinfo
+			if err := reso.codec().Decode(data, &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(in, out); diff != "" {
+				t.Fatal(diff)
+			}
+		}
+	})
+
+	t.Run("we write into the fallback even if the primary fails", func(t *testing.T) {
+		errMocked := errors.New("mocked error")
+		reso := &Resolver{
+			FallbackKVStore: &kvstore.Memory{},
+			KVStore: &mocks.KeyValueStore{
+				MockSet: func(key string, value []byte) error {
+					return errMocked
+				},
+			},
+		}
+		if err := reso.writestate(in); !errors.Is(err, errMocked) {
+			t.Fatal("not the error we expected", err)
+		}
+		if _, err := reso.FallbackKVStore.Get(storekey); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("we return the fallback error if only the fallback fails", func(t *testing.T) {
+		errMocked := errors.New("mocked error")
+		reso := &Resolver{
+			FallbackKVStore: &mocks.KeyValueStore{
+				MockSet: func(key string, value []byte) error {
+					return errMocked
+				},
+			},
+			KVStore: &kvstore.Memory{},
+		}
+		if err := reso.writestate(in); !errors.Is(err, errMocked) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+}
+
+func TestSortStateWithSchemePriority(t *testing.T) {
+	newState := func() []*resolverinfo {
+		return []*resolverinfo{{
+			URL:   "system:///",
+			Score: 0.5,
+		}, {
+			URL:   "https://dns.google/dns-query",
+			Score: 0.5,
+		}, {
+			URL:   "http3://dns.google/dns-query",
+			Score: 0.9,
+		}, {
+			URL:   "dot://dns.google/",
+			Score: 0.5,
+		}, {
+			URL:   "http3://cloudflare-dns.com/dns-query",
+			Score: 0.1,
+		}}
+	}
+
+	type testcase struct {
+		name     string
+		priority []string
+		lexical  bool
+		expect   []string
+	}
+
+	cases := []testcase{{
+		name:     "without priority we only sort by score",
+		priority: nil,
+		expect:   nil, // the order of equal scores is not defined
+	}, {
+		name:     "the priority breaks ties between equal scores",
+		priority: []string{"dot", "https", "system"},
+		expect: []string{
+			"http3://dns.google/dns-query",
+			"dot://dns.google/",
+			"https://dns.google/dns-query",
+			"system:///",
+			"http3://cloudflare-dns.com/dns-query",
+		},
+	}, {
+		name:     "unlisted schemes sort last among equal scores",
+		priority: []string{"system"},
+		expect: []string{
+			"http3://dns.google/dns-query",
+			"system:///",
+			"https://dns.google/dns-query",
+			"dot://dns.google/",
+			"http3://cloudflare-dns.com/dns-query",
+		},
+	}, {
+		name:     "the priority does not override the score",
+		priority: []string{"http3", "system"},
+		expect: []string{
+			"http3://dns.google/dns-query",
+			"system:///",
+			"https://dns.google/dns-query",
+			"dot://dns.google/",
+			"http3://cloudflare-dns.com/dns-query",
+		},
+	}, {
+		name:     "with lexical we break ties between equal scores using the URL",
+		priority: nil,
+		lexical:  true,
+		expect: []string{
+			"http3://dns.google/dns-query",
+			"dot://dns.google/",
+			"https://dns.google/dns-query",
+			"system:///",
+			"http3://cloudflare-dns.com/dns-query",
+		},
+	}, {
+		name:     "with lexical the priority comes before the URL",
+		priority: []string{"system"},
+		lexical:  true,
+		expect: []string{
+			"http3://dns.google/dns-query",
+			"system:///",
+			"dot://dns.google/",
+			"https://dns.google/dns-query",
+			"http3://cloudflare-dns.com/dns-query",
+		},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := newState()
+			sortstate(state, tc.priority, tc.lexical)
+			var got []string
+			for idx, e := range state {
+				if idx > 0 && e.Score > state[idx-1].Score {
+					t.Fatal("not sorted by descending score")
+				}
+				got = append(got, e.URL)
+			}
+			if tc.expect == nil {
+				return
+			}
+			if diff := cmp.Diff(tc.expect, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestReadStateDefaultWithSchemePriority(t *testing.T) {
+	reso := &Resolver{
+		KVStore:        &kvstore.Memory{},
+		SchemePriority: []string{"system", "https"},
+	}
+	var in []*resolverinfo
+	for _, e := range allmakers {
+		in = append(in, &resolverinfo{URL: e.url, Score: 0.5})
+	}
+	if err := reso.writestate(in); err != nil {
+		t.Fatal(err)
+	}
+	out := reso.readstatedefault()
+	if len(out) != len(allmakers) {
+		t.Fatal("unexpected number of entries", len(out))
+	}
+	if out[0].URL != systemResolverURL {
+		t.Fatal("expected the system resolver first, got", out[0].URL)
+	}
+	if last := out[len(out)-1]; !strings.HasPrefix(last.URL, "http3://") {
+		t.Fatal("expected an http3 resolver last, got", last.URL)
+	}
+}
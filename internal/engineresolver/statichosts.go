@@ -0,0 +1,15 @@
+package engineresolver
+
+//
+// Static hosts overriding lookups
+//
+
+// staticHostsAnswers returns a copy of the addresses that StaticHosts maps the
+// given hostname to and true, or nil and false when there is no such mapping.
+func (r *Resolver) staticHostsAnswers(hostname string) ([]string, bool) {
+	addrs := r.StaticHosts[hostname] // works even if the map is nil
+	if len(addrs) <= 0 {
+		return nil, false
+	}
+	return append([]string{}, addrs...), true
+}
@@ -0,0 +1,98 @@
+package engineresolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverStaticHosts(t *testing.T) {
+	// newResolver returns a resolver with static hosts whose child
+	// resolvers succeed and count the lookups.
+	newResolver := func(lookups *int) *Resolver {
+		return &Resolver{
+			KVStore: &kvstore.Memory{},
+			StaticHosts: map[string][]string{
+				"api.ooni.io": {"10.0.0.1", "10.0.0.2"},
+				"example.com": {},
+			},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				reso := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						*lookups++
+						return []string{"8.8.8.8"}, nil
+					},
+				}
+				return reso, nil
+			},
+		}
+	}
+
+	t.Run("a static match short-circuits the walk", func(t *testing.T) {
+		var lookups int
+		reso := newResolver(&lookups)
+		addrs, err := reso.LookupHost(context.Background(), "api.ooni.io")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"10.0.0.1", "10.0.0.2"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if lookups != 0 {
+			t.Fatal("expected no lookups", lookups)
+		}
+		if _, err := reso.KVStore.Get(storekey); err == nil {
+			t.Fatal("expected no state to be written")
+		}
+	})
+
+	t.Run("we return a copy of the static addresses", func(t *testing.T) {
+		var lookups int
+		reso := newResolver(&lookups)
+		addrs, err := reso.LookupHost(context.Background(), "api.ooni.io")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs[0] = "127.0.0.1"
+		if reso.StaticHosts["api.ooni.io"][0] != "10.0.0.1" {
+			t.Fatal("the static addresses have been modified")
+		}
+	})
+
+	t.Run("we honor MaxAnswers for static matches", func(t *testing.T) {
+		var lookups int
+		reso := newResolver(&lookups)
+		reso.MaxAnswers = 1
+		addrs, err := reso.LookupHost(context.Background(), "api.ooni.io")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"10.0.0.1"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	for _, domain := range []string{"www.example.com", "example.com"} {
+		t.Run("non-matches proceed normally for "+domain, func(t *testing.T) {
+			var lookups int
+			reso := newResolver(&lookups)
+			addrs, err := reso.LookupHost(context.Background(), domain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+			if lookups != 1 {
+				t.Fatal("expected one lookup", lookups)
+			}
+			if _, err := reso.KVStore.Get(storekey); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package engineresolver
+
+//
+// Preferring child resolvers whose answers match prior answers
+//
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStickyAnswersMismatch indicates that a child resolver returned addresses
+// having nothing in common with the addresses we remembered for the domain.
+var ErrStickyAnswersMismatch = errors.New("sessionresolver: answers deviate from remembered answers")
+
+// maxStickyAnswers is the maximum number of domains for which we remember
+// the last good answers when StickyAnswers is true.
+const maxStickyAnswers = 128
+
+// stickyAnswersError is the error returned when a child resolver returns
+// addresses deviating from the remembered ones. We keep the addresses such
+// that LookupHost can use them when all the child resolvers deviate and
+// we keep the remembered addresses to pass them to OnValidationMismatch.
+type stickyAnswersError struct {
+	addrs      []string
+	remembered []string
+}
+
+// Error implements error.Error.
+func (e *stickyAnswersError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrStickyAnswersMismatch.Error(), e.addrs)
+}
+
+// Unwrap allows consumers to check whether the error is ErrStickyAnswersMismatch.
+func (e *stickyAnswersError) Unwrap() error {
+	return ErrStickyAnswersMismatch
+}
+
+// stickyAnswersDeviation returns the addresses carried by the given error
+// when the error indicates that the addresses deviated from the remembered ones.
+func stickyAnswersDeviation(err error) ([]string, bool) {
+	var stickyErr *stickyAnswersError
+	if !errors.As(err, &stickyErr) {
+		return nil, false
+	}
+	return stickyErr.addrs, true
+}
+
+// checkStickyAnswers returns a [*stickyAnswersError] when StickyAnswers is true
+// and the given addrs have no address in common with the addresses we remembered
+// for the given hostname. We consider the addrs good when they share at least an
+// address with the remembered ones, since CDNs rotate some of their addresses. In
+// such a case, and when we do not remember any address for the hostname, we
+// remember the given addrs as the last good answers for the hostname.
+func (r *Resolver) checkStickyAnswers(URL, hostname string, addrs []string) error {
+	if !r.StickyAnswers {
+		return nil
+	}
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if remembered, found := r.stickyAnswers[hostname]; found && !stickyAnswersOverlap(remembered, addrs) {
+		if r.stickyDeviations == nil {
+			r.stickyDeviations = make(map[string]int64)
+		}
+		r.stickyDeviations[URL]++
+		return &stickyAnswersError{
+			addrs:      append([]string{}, addrs...),
+			remembered: append([]string{}, remembered...),
+		}
+	}
+	r.rememberStickyAnswersLocked(hostname, addrs)
+	return nil
+}
+
+// rememberStickyAnswers remembers the given addrs as the last good answers
+// for the given hostname when StickyAnswers is true.
+func (r *Resolver) rememberStickyAnswers(hostname string, addrs []string) {
+	if !r.StickyAnswers {
+		return
+	}
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	r.rememberStickyAnswersLocked(hostname, addrs)
+}
+
+// rememberStickyAnswersLocked is like rememberStickyAnswers but assumes that
+// the caller holds the mu mutex. We forget the least recently remembered
+// hostname when we remember more than maxStickyAnswers hostnames.
+func (r *Resolver) rememberStickyAnswersLocked(hostname string, addrs []string) {
+	if r.stickyAnswers == nil {
+		r.stickyAnswers = make(map[string][]string)
+	}
+	if _, found := r.stickyAnswers[hostname]; found {
+		for idx, entry := range r.stickyAnswersLRU {
+			if entry == hostname {
+				r.stickyAnswersLRU = append(r.stickyAnswersLRU[:idx:idx], r.stickyAnswersLRU[idx+1:]...)
+				break
+			}
+		}
+	}
+	r.stickyAnswers[hostname] = append([]string{}, addrs...)
+	r.stickyAnswersLRU = append(r.stickyAnswersLRU, hostname)
+	for len(r.stickyAnswersLRU) > maxStickyAnswers {
+		delete(r.stickyAnswers, r.stickyAnswersLRU[0])
+		r.stickyAnswersLRU = r.stickyAnswersLRU[1:]
+	}
+}
+
+// stickyAnswersOverlap returns whether the two lists share at least an address.
+func stickyAnswersOverlap(left, right []string) bool {
+	set := make(map[string]bool)
+	for _, addr := range left {
+		set[addr] = true
+	}
+	for _, addr := range right {
+		if set[addr] {
+			return true
+		}
+	}
+	return false
+}
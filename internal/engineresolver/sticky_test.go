@@ -0,0 +1,197 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverStickyAnswers(t *testing.T) {
+	const (
+		googleURL = "https://dns.google/dns-query"
+		quad9URL  = "https://dns.quad9.net/dns-query"
+	)
+
+	// newResolver returns a resolver where google and quad9 come first and
+	// each child resolver returns the addresses inside the given map.
+	newResolver := func(t *testing.T, sticky bool, answers map[string][]string) *Resolver {
+		reso := &Resolver{
+			Deterministic: true,
+			KVStore:       &kvstore.Memory{},
+			StickyAnswers: sticky,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				re := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						if addrs, found := answers[URL]; found {
+							return addrs, nil
+						}
+						return nil, errors.New("mocked error")
+					},
+				}
+				return re, nil
+			},
+		}
+		state := []*resolverinfo{{
+			URL:   googleURL,
+			Score: 1,
+		}, {
+			URL:   quad9URL,
+			Score: 0.9,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		return reso
+	}
+
+	// scoreOf returns the scoreboard entry of the given URL.
+	scoreOf := func(t *testing.T, reso *Resolver, URL string) ResolverScore {
+		for _, entry := range reso.Scoreboard() {
+			if entry.URL == URL {
+				return entry
+			}
+		}
+		t.Fatal("cannot find", URL)
+		return ResolverScore{}
+	}
+
+	t.Run("we demote the deviating resolver", func(t *testing.T) {
+		answers := map[string][]string{
+			googleURL: {"8.8.8.8", "8.8.4.4"},
+			quad9URL:  {"8.8.4.4", "8.8.8.8"},
+		}
+		reso := newResolver(t, true, answers)
+
+		// the first lookup remembers the google answers
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+
+		// google now deviates and quad9 is still consistent
+		answers[googleURL] = []string{"10.10.34.35"}
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.4.4", "8.8.8.8"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+
+		google, quad9 := scoreOf(t, reso, googleURL), scoreOf(t, reso, quad9URL)
+		if google.Score >= quad9.Score {
+			t.Fatal("expected google to be demoted", google.Score, quad9.Score)
+		}
+		if google.StickyDeviations != 1 || quad9.StickyDeviations != 0 {
+			t.Fatal("unexpected deviations", google.StickyDeviations, quad9.StickyDeviations)
+		}
+
+		t.Run("and we record the deviation", func(t *testing.T) {
+			results := reso.ArchivalResults()
+			if len(results) < 1 || results[0].ResolverAddress != googleURL {
+				t.Fatal("unexpected archival results", results)
+			}
+			if results[0].Failure == nil {
+				t.Fatal("expected a failure")
+			}
+		})
+	})
+
+	t.Run("we use the deviating answers when all resolvers deviate", func(t *testing.T) {
+		answers := map[string][]string{
+			googleURL: {"8.8.8.8"},
+		}
+		reso := newResolver(t, true, answers)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+
+		// all the resolvers either fail or deviate
+		answers[googleURL] = []string{"10.10.34.35"}
+		answers[quad9URL] = []string{"10.10.34.36"}
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"10.10.34.35"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// we now remember the new answers, hence google is consistent again
+		addrs, err = reso.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"10.10.34.35"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if deviations := scoreOf(t, reso, googleURL).StickyDeviations; deviations != 1 {
+			t.Fatal("unexpected deviations", deviations)
+		}
+	})
+
+	t.Run("we do not check the answers by default", func(t *testing.T) {
+		answers := map[string][]string{
+			googleURL: {"8.8.8.8"},
+		}
+		reso := newResolver(t, false, answers)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		answers[googleURL] = []string{"10.10.34.35"}
+		addrs, err := reso.LookupHost(context.Background(), "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"10.10.34.35"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		if deviations := scoreOf(t, reso, googleURL).StickyDeviations; deviations != 0 {
+			t.Fatal("unexpected deviations", deviations)
+		}
+	})
+}
+
+func TestResolverRememberStickyAnswers(t *testing.T) {
+	reso := &Resolver{StickyAnswers: true}
+	for idx := 0; idx < maxStickyAnswers+2; idx++ {
+		reso.rememberStickyAnswers(fmt.Sprintf("%d.example.com", idx), []string{"10.0.0.1"})
+	}
+
+	// we remember again the first hostname, which becomes the most recent one
+	reso.rememberStickyAnswers("1.example.com", []string{"10.0.0.2"})
+
+	if len(reso.stickyAnswers) != maxStickyAnswers || len(reso.stickyAnswersLRU) != maxStickyAnswers {
+		t.Fatal("unexpected number of entries", len(reso.stickyAnswers), len(reso.stickyAnswersLRU))
+	}
+	for _, hostname := range []string{"0.example.com", "2.example.com"} {
+		if _, found := reso.stickyAnswers[hostname]; found {
+			t.Fatal("expected to have forgotten", hostname)
+		}
+	}
+	if diff := cmp.Diff([]string{"10.0.0.2"}, reso.stickyAnswers["1.example.com"]); diff != "" {
+		t.Fatal(diff)
+	}
+	if last := reso.stickyAnswersLRU[len(reso.stickyAnswersLRU)-1]; last != "1.example.com" {
+		t.Fatal("unexpected most recent hostname", last)
+	}
+}
+
+func TestStickyAnswersError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &stickyAnswersError{addrs: []string{"10.10.34.35"}})
+	if !errors.Is(err, ErrStickyAnswersMismatch) {
+		t.Fatal("expected ErrStickyAnswersMismatch")
+	}
+	addrs, found := stickyAnswersDeviation(err)
+	if !found {
+		t.Fatal("expected to find the deviation")
+	}
+	if diff := cmp.Diff([]string{"10.10.34.35"}, addrs); diff != "" {
+		t.Fatal(diff)
+	}
+}
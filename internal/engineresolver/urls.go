@@ -0,0 +1,89 @@
+package engineresolver
+
+//
+// Replacing the URLs of the child resolvers at runtime
+//
+
+import (
+	"errors"
+	"net/url"
+)
+
+// ErrNoURLs indicates that SetURLs was called with an empty list.
+var ErrNoURLs = errors.New("sessionresolver: no resolver URLs")
+
+// SetURLs atomically replaces the URLs of the child resolvers, which by default
+// are the ones of the public DoH resolvers we know about and of the system resolver,
+// and returns an error when the list is empty or contains an invalid URL, in which
+// case we do not change anything. We accept the http3, https, http, and system schemes,
+// where the http3 scheme means using DoH over HTTP/3, like in the persisted state.
+//
+// The persisted scores of the URLs we retain are unchanged, we ignore and eventually
+// stop persisting the scores of the URLs we remove, and we give the URLs we add the
+// same initial score we would give them if we had never seen them before. We close
+// the cached child resolvers of the removed URLs and drop the cached answers.
+//
+// This method is safe to call concurrently with LookupHost. The LookupHost calls
+// in progress continue using the child resolvers they have already selected.
+func (r *Resolver) SetURLs(urls []string) error {
+	if len(urls) <= 0 {
+		return ErrNoURLs
+	}
+	var makers []*resolvermaker
+	retained := make(map[string]bool)
+	for _, URL := range urls {
+		if retained[URL] {
+			continue // ignore duplicates
+		}
+		parsed, err := url.Parse(URL)
+		if err != nil {
+			return err
+		}
+		switch parsed.Scheme {
+		case "http3", "https", "http", "system":
+		default:
+			return errUnsupportedResolverScheme
+		}
+		makers = append(makers, newResolverMaker(URL))
+		retained[URL] = true
+	}
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	r.makers = makers
+	for URL, re := range r.res {
+		if !retained[URL] {
+			re.CloseIdleConnections()
+			delete(r.res, URL)
+			delete(r.resLastUsed, URL)
+		}
+	}
+	resLRU := []string{}
+	for _, URL := range r.resLRU {
+		if retained[URL] {
+			resLRU = append(resLRU, URL)
+		}
+	}
+	r.resLRU = resLRU
+	r.answerCache = nil
+	return nil
+}
+
+// newResolverMaker returns the [*resolvermaker] for the given URL, which is the
+// default one when we know about the URL. Otherwise, we return a new one whose
+// initial score is the expected value of the initial score of the default ones.
+func newResolverMaker(URL string) *resolvermaker {
+	if e, found := allbyurl[URL]; found {
+		return e
+	}
+	return &resolvermaker{url: URL, score: deterministicInitialScore}
+}
+
+// resolvermakers returns the makers set using SetURLs or the default ones.
+func (r *Resolver) resolvermakers() []*resolvermaker {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if len(r.makers) <= 0 {
+		return allmakers
+	}
+	return r.makers
+}
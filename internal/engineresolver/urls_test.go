@@ -0,0 +1,212 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestResolverSetURLs(t *testing.T) {
+	const (
+		google  = "https://dns.google/dns-query"
+		quad9   = "https://dns.quad9.net/dns-query"
+		example = "https://dns.example.com/dns-query"
+	)
+
+	// newResolver returns a deterministic resolver whose child resolvers always succeed
+	// and whose state contains google and quad9, along with a function returning the
+	// URLs of the child resolvers we closed.
+	newResolver := func(t *testing.T) (*Resolver, func() []string) {
+		var (
+			closed []string
+			mu     sync.Mutex
+		)
+		reso := &Resolver{
+			CacheMaxTTL:   3600e9,
+			CacheMinTTL:   3600e9,
+			Deterministic: true,
+			KVStore:       &kvstore.Memory{},
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				re := &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						return []string{"8.8.8.8"}, nil
+					},
+					MockCloseIdleConnections: func() {
+						mu.Lock()
+						closed = append(closed, URL)
+						mu.Unlock()
+					},
+				}
+				return re, nil
+			},
+		}
+		state := []*resolverinfo{{
+			URL:   google,
+			Score: 0.9,
+		}, {
+			URL:   quad9,
+			Score: 0.7,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		getClosed := func() []string {
+			defer mu.Unlock()
+			mu.Lock()
+			return append([]string{}, closed...)
+		}
+		return reso, getClosed
+	}
+
+	// scores returns the scores inside the scoreboard
+	scores := func(reso *Resolver) map[string]float64 {
+		out := make(map[string]float64)
+		for _, entry := range reso.Scoreboard() {
+			out[entry.URL] = entry.Score
+		}
+		return out
+	}
+
+	t.Run("we reject invalid lists without changing anything", func(t *testing.T) {
+		type testcase struct {
+			name   string
+			urls   []string
+			expect error
+		}
+		cases := []testcase{{
+			name:   "with an empty list",
+			urls:   []string{},
+			expect: ErrNoURLs,
+		}, {
+			name:   "with an unsupported scheme",
+			urls:   []string{google, "dot://8.8.8.8:853/"},
+			expect: errUnsupportedResolverScheme,
+		}, {
+			name:   "with an invalid URL",
+			urls:   []string{google, "\t"},
+			expect: nil, // we just check that there is an error
+		}}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				reso, _ := newResolver(t)
+				expect := scores(reso)
+				err := reso.SetURLs(tc.urls)
+				if err == nil || (tc.expect != nil && !errors.Is(err, tc.expect)) {
+					t.Fatal("unexpected error", err)
+				}
+				if diff := cmp.Diff(expect, scores(reso)); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+		}
+	})
+
+	t.Run("we retain, remove, and add URLs", func(t *testing.T) {
+		reso, closed := newResolver(t)
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		retained := scores(reso)[google]
+		if err := reso.SetURLs([]string{google, example, google}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the retained URL keeps its score and the added one has the initial score
+		expect := map[string]float64{
+			google:  retained,
+			example: deterministicInitialScore,
+		}
+		if diff := cmp.Diff(expect, scores(reso)); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// we do not close the retained child resolver
+		if diff := cmp.Diff([]string{}, closed()); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// we stop persisting the removed URL after the next LookupHost, which
+		// does not use the cached answers obtained using the previous URLs
+		if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+			t.Fatal(err)
+		}
+		state, err := reso.readstate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var persisted []string
+		for _, e := range state {
+			persisted = append(persisted, e.URL)
+		}
+		if diff := cmp.Diff([]string{google, example}, persisted); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we close the cached child resolvers of the removed URLs", func(t *testing.T) {
+		reso, closed := newResolver(t)
+		reso.AnswerValidator = func(domain string, addrs []string) error {
+			if domain == "www.example.com" {
+				return errors.New("mocked error")
+			}
+			return nil
+		}
+		reso.LookupHost(context.Background(), "www.example.com") // we use all the child resolvers
+		if err := reso.SetURLs([]string{quad9}); err != nil {
+			t.Fatal(err)
+		}
+		for _, URL := range closed() {
+			if URL == quad9 {
+				t.Fatal("we closed the retained child resolver")
+			}
+		}
+		if len(closed()) != len(allmakers)-1 {
+			t.Fatal("unexpected closed child resolvers", closed())
+		}
+	})
+
+	t.Run("we can swap the URLs while performing lookups", func(t *testing.T) {
+		reso, _ := newResolver(t)
+		reso.CacheMaxTTL = 0
+		lists := [][]string{{google, quad9}, {google, example}, {example}, {quad9, google}}
+		wg := &sync.WaitGroup{}
+		errch := make(chan error, 64)
+		for idx := 0; idx < 8; idx++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for count := 0; count < 16; count++ {
+					if _, err := reso.LookupHost(context.Background(), "dns.google"); err != nil {
+						errch <- err
+						return
+					}
+				}
+			}()
+		}
+		for _, list := range lists {
+			if err := reso.SetURLs(list); err != nil {
+				t.Fatal(err)
+			}
+		}
+		wg.Wait()
+		close(errch)
+		for err := range errch {
+			t.Fatal(err)
+		}
+		board := reso.Scoreboard()
+		if len(board) != 2 {
+			t.Fatal("unexpected scoreboard", board)
+		}
+		for _, entry := range board {
+			if entry.URL != google && entry.URL != quad9 {
+				t.Fatal("unexpected scoreboard entry", entry)
+			}
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package engineresolver
+
+//
+// Reporting answers failing validation checks
+//
+
+import "errors"
+
+// These are the reasons we pass to OnValidationMismatch.
+const (
+	// ValidationMismatchAnswerValidator means that AnswerValidator rejected
+	// the addresses. In such a case, got contains the rejected addresses and
+	// want is nil.
+	ValidationMismatchAnswerValidator = "answer_validator"
+
+	// ValidationMismatchStickyAnswers means that the addresses have nothing in
+	// common with the remembered ones (see StickyAnswers). In such a case, got
+	// contains the addresses and want contains the remembered addresses.
+	ValidationMismatchStickyAnswers = "sticky_answers"
+
+	// ValidationMismatchDNS0x20 means that a DNS response did not echo the
+	// query case (see Use0x20). In such a case, got contains the name inside
+	// the response question, which is empty when there is not a single question,
+	// and want contains the name we sent.
+	ValidationMismatchDNS0x20 = "dns0x20"
+
+	// ValidationMismatchDNSSEC means that a DNS response contained signatures
+	// but was not authenticated (see RequireDNSSEC). In such a case, both got
+	// and want are nil because the child resolver did not return any address.
+	ValidationMismatchDNSSEC = "dnssec"
+
+	// ValidationMismatchPrivateAnswers means that a successful lookup of a
+	// public domain returned private addresses (see FlagPrivateAnswers). In
+	// such a case, got contains the private addresses and want is nil. Note
+	// that we do not treat such a lookup as failed.
+	ValidationMismatchPrivateAnswers = "private_answers"
+)
+
+// reportValidationMismatch calls OnValidationMismatch, if set, with the given arguments.
+func (r *Resolver) reportValidationMismatch(URL, domain, reason string, got, want []string) {
+	if r.OnValidationMismatch != nil {
+		r.OnValidationMismatch(URL, domain, reason, got, want)
+	}
+}
+
+// maybeReportLookupValidationMismatch calls reportValidationMismatch when the
+// given lookup error indicates that the DNS transport rejected a response.
+func (r *Resolver) maybeReportLookupValidationMismatch(URL, domain string, err error) {
+	var dns0x20Err *dns0x20MismatchError
+	switch {
+	case errors.As(err, &dns0x20Err):
+		r.reportValidationMismatch(URL, domain, ValidationMismatchDNS0x20,
+			[]string{dns0x20Err.got}, []string{dns0x20Err.want})
+	case errors.Is(err, ErrDNSSECNotAuthenticated):
+		r.reportValidationMismatch(URL, domain, ValidationMismatchDNSSEC, nil, nil)
+	}
+}
@@ -0,0 +1,213 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestResolverOnValidationMismatch(t *testing.T) {
+	// newTransport returns a DNS transport answering A queries with 8.8.8.8 like a
+	// spoofed response would, i.e., the response question uses lowercase letters and
+	// the answer contains signatures but the response is not authenticated.
+	newTransport := func() model.DNSTransport {
+		return &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+				rawQuery, err := query.Bytes()
+				if err != nil {
+					return nil, err
+				}
+				msg := &dns.Msg{}
+				if err := msg.Unpack(rawQuery); err != nil {
+					return nil, err
+				}
+				reply := &dns.Msg{}
+				reply.SetReply(msg)
+				reply.Question[0].Name = strings.ToLower(reply.Question[0].Name)
+				header := dns.RR_Header{
+					Name:   reply.Question[0].Name,
+					Rrtype: query.Type(),
+					Class:  dns.ClassINET,
+					Ttl:    300,
+				}
+				if query.Type() == dns.TypeA {
+					reply.Answer = append(reply.Answer, &dns.A{Hdr: header, A: net.IPv4(8, 8, 8, 8)})
+				}
+				header.Rrtype = dns.TypeRRSIG
+				reply.Answer = append(reply.Answer, &dns.RRSIG{Hdr: header, TypeCovered: query.Type()})
+				rawReply, err := reply.Pack()
+				if err != nil {
+					return nil, err
+				}
+				return (&netxlite.DNSDecoderMiekg{}).DecodeResponse(rawReply, query)
+			},
+			MockRequiresPadding: func() bool {
+				return true
+			},
+		}
+	}
+
+	// validationMismatch is an event passed to OnValidationMismatch.
+	type validationMismatch struct {
+		URL    string
+		Domain string
+		Reason string
+		Got    []string
+		Want   []string
+	}
+
+	// newResolver returns a resolver whose child resolvers use the transport returned
+	// by newTransport, which we wrap like we would wrap the transport of a DoH resolver,
+	// along with a function returning the events passed to OnValidationMismatch for
+	// the first child resolver. We filter the events because LookupHost also tries
+	// the other child resolvers when the first one fails.
+	newResolver := func(configure func(reso *Resolver)) (*Resolver, func() []validationMismatch) {
+		var (
+			events []validationMismatch
+			mu     sync.Mutex
+		)
+		reso := &Resolver{
+			AllowedSchemes: []string{"https"},
+			Deterministic:  true,
+			KVStore:        &kvstore.Memory{},
+			OnValidationMismatch: func(URL, domain, reason string, got, want []string) {
+				mu.Lock()
+				events = append(events, validationMismatch{URL, domain, reason, got, want})
+				mu.Unlock()
+			},
+		}
+		configure(reso)
+		reso.newChildResolverFn = func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+			var wrapped model.DNSTransport = newTransport()
+			wrap := reso.maybeWrapDNSTransportWith0x20(URL, reso.maybeWrapDNSTransportWithDNSSEC(URL, nil))
+			if wrap != nil {
+				wrapped = wrap(wrapped)
+			}
+			return netxlite.NewUnwrappedParallelResolver(wrapped), nil
+		}
+		state := []*resolverinfo{{
+			URL:   "https://dns.google/dns-query",
+			Score: 1,
+		}}
+		if err := reso.writestate(state); err != nil {
+			t.Fatal(err)
+		}
+		getEvents := func() []validationMismatch {
+			defer mu.Unlock()
+			mu.Lock()
+			out := []validationMismatch{}
+			for _, ev := range events {
+				if ev.URL == "https://dns.google/dns-query" {
+					out = append(out, ev)
+				}
+			}
+			return out
+		}
+		return reso, getEvents
+	}
+
+	const domain = "www.example.com"
+
+	t.Run("without validation checks we do not call the callback", func(t *testing.T) {
+		reso, events := newResolver(func(reso *Resolver) {})
+		if _, err := reso.LookupHost(context.Background(), domain); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]validationMismatch{}, events()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when AnswerValidator rejects the answer", func(t *testing.T) {
+		expectedErr := errors.New("mocked error")
+		reso, events := newResolver(func(reso *Resolver) {
+			reso.AnswerValidator = func(domain string, addrs []string) error {
+				return expectedErr
+			}
+		})
+		if _, err := reso.LookupHost(context.Background(), domain); !errors.Is(err, expectedErr) {
+			t.Fatal("unexpected error", err)
+		}
+		expect := []validationMismatch{{
+			URL:    "https://dns.google/dns-query",
+			Domain: domain,
+			Reason: ValidationMismatchAnswerValidator,
+			Got:    []string{"8.8.8.8"},
+			Want:   nil,
+		}}
+		if diff := cmp.Diff(expect, events()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when the answer deviates from the sticky answers", func(t *testing.T) {
+		reso, events := newResolver(func(reso *Resolver) {
+			reso.StickyAnswers = true
+		})
+		reso.rememberStickyAnswers(domain, []string{"1.1.1.1"})
+		if _, err := reso.LookupHost(context.Background(), domain); err != nil {
+			t.Fatal(err) // we fall back to the deviated addresses
+		}
+		expect := []validationMismatch{{
+			URL:    "https://dns.google/dns-query",
+			Domain: domain,
+			Reason: ValidationMismatchStickyAnswers,
+			Got:    []string{"8.8.8.8"},
+			Want:   []string{"1.1.1.1"},
+		}}
+		if diff := cmp.Diff(expect, events()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when the response does not echo the query case", func(t *testing.T) {
+		reso, events := newResolver(func(reso *Resolver) {
+			reso.Use0x20 = true
+		})
+		if _, err := reso.LookupHost(context.Background(), domain); !errors.Is(err, ErrDNS0x20Mismatch) {
+			t.Fatal("unexpected error", err)
+		}
+		got := events()
+		if len(got) != 1 {
+			t.Fatal("expected a single event", got)
+		}
+		if got[0].Reason != ValidationMismatchDNS0x20 || got[0].Domain != domain {
+			t.Fatal("unexpected event", got[0])
+		}
+		if diff := cmp.Diff([]string{domain + "."}, got[0].Got); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(got[0].Want) != 1 || !strings.EqualFold(got[0].Want[0], domain+".") || got[0].Want[0] == domain+"." {
+			t.Fatal("unexpected want", got[0].Want)
+		}
+	})
+
+	t.Run("when the signed response is not authenticated", func(t *testing.T) {
+		reso, events := newResolver(func(reso *Resolver) {
+			reso.RequireDNSSEC = true
+		})
+		if _, err := reso.LookupHost(context.Background(), domain); !errors.Is(err, ErrDNSSECNotAuthenticated) {
+			t.Fatal("unexpected error", err)
+		}
+		expect := []validationMismatch{{
+			URL:    "https://dns.google/dns-query",
+			Domain: domain,
+			Reason: ValidationMismatchDNSSEC,
+			Got:    nil,
+			Want:   nil,
+		}}
+		if diff := cmp.Diff(expect, events()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package engineresolver
+
+//
+// Wire-format DNS query and response sizes
+//
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// DNSWireSizes contains the cumulative sizes of the wire-format DNS
+// queries and responses exchanged using a given child resolver.
+type DNSWireSizes struct {
+	// URL is the URL of the child resolver.
+	URL string
+
+	// Queries is the number of queries we sent.
+	Queries int64
+
+	// QueryBytes is the total size of the queries we sent.
+	QueryBytes int64
+
+	// Responses is the number of responses we received.
+	Responses int64
+
+	// ResponseBytes is the total size of the responses we received.
+	ResponseBytes int64
+}
+
+// dnsWireSizesRecorder records the DNSWireSizes of a child resolver.
+type dnsWireSizesRecorder struct {
+	mu    sync.Mutex
+	sizes DNSWireSizes
+}
+
+// onQuery records that we sent a query of the given size.
+func (wsr *dnsWireSizesRecorder) onQuery(size int) {
+	wsr.mu.Lock()
+	wsr.sizes.Queries++
+	wsr.sizes.QueryBytes += int64(size)
+	wsr.mu.Unlock()
+}
+
+// onResponse records that we received a response of the given size.
+func (wsr *dnsWireSizesRecorder) onResponse(size int) {
+	wsr.mu.Lock()
+	wsr.sizes.Responses++
+	wsr.sizes.ResponseBytes += int64(size)
+	wsr.mu.Unlock()
+}
+
+// snapshot returns a copy of the recorded sizes.
+func (wsr *dnsWireSizesRecorder) snapshot() DNSWireSizes {
+	defer wsr.mu.Unlock()
+	wsr.mu.Lock()
+	return wsr.sizes
+}
+
+// maybeNewDNSTransportWrapper returns the function to wrap the DNS transport
+// of the child resolver with the given URL, or nil if we don't need to wrap
+// the DNS transport. The caller MUST hold r.mu when calling this function.
+func (r *Resolver) maybeNewDNSTransportWrapper(URL string) func(model.DNSTransport) model.DNSTransport {
+	if !r.LogDNSWireSizes {
+		return nil
+	}
+	if r.wireSizes == nil {
+		r.wireSizes = make(map[string]*dnsWireSizesRecorder)
+	}
+	recorder, found := r.wireSizes[URL]
+	if !found {
+		recorder = &dnsWireSizesRecorder{sizes: DNSWireSizes{URL: URL}}
+		r.wireSizes[URL] = recorder
+	}
+	return func(txp model.DNSTransport) model.DNSTransport {
+		return &dnsTransportWireSizes{
+			logger:   r.logger(),
+			recorder: recorder,
+			txp:      txp,
+			url:      URL,
+		}
+	}
+}
+
+// DNSWireSizes returns the sizes of the wire-format DNS queries and responses
+// exchanged by each child resolver, sorted by URL. This function only returns
+// meaningful results when LogDNSWireSizes is true. Because the system resolver
+// does not expose the wire-format messages, we don't track its sizes.
+func (r *Resolver) DNSWireSizes() (out []DNSWireSizes) {
+	r.mu.Lock()
+	for _, recorder := range r.wireSizes {
+		out = append(out, recorder.snapshot())
+	}
+	r.mu.Unlock()
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].URL < out[j].URL
+	})
+	return
+}
+
+// dnsTransportWireSizes is a model.DNSTransport recording the size
+// of the wire-format DNS queries and responses.
+type dnsTransportWireSizes struct {
+	logger   model.Logger
+	recorder *dnsWireSizesRecorder
+	txp      model.DNSTransport
+	url      string
+}
+
+var _ model.DNSTransport = &dnsTransportWireSizes{}
+
+// RoundTrip implements model.DNSTransport.
+func (txp *dnsTransportWireSizes) RoundTrip(
+	ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+	if rawQuery, err := query.Bytes(); err == nil {
+		txp.recorder.onQuery(len(rawQuery))
+		txp.logger.Infof("sessionresolver: %s: query for %s: %d bytes",
+			txp.url, query.Domain(), len(rawQuery))
+	}
+	response, err := txp.txp.RoundTrip(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rawResponse := response.Bytes()
+	txp.recorder.onResponse(len(rawResponse))
+	txp.logger.Infof("sessionresolver: %s: response for %s: %d bytes",
+		txp.url, query.Domain(), len(rawResponse))
+	return response, nil
+}
+
+// RequiresPadding implements model.DNSTransport.
+func (txp *dnsTransportWireSizes) RequiresPadding() bool {
+	return txp.txp.RequiresPadding()
+}
+
+// Network implements model.DNSTransport.
+func (txp *dnsTransportWireSizes) Network() string {
+	return txp.txp.Network()
+}
+
+// Address implements model.DNSTransport.
+func (txp *dnsTransportWireSizes) Address() string {
+	return txp.txp.Address()
+}
+
+// CloseIdleConnections implements model.DNSTransport.
+func (txp *dnsTransportWireSizes) CloseIdleConnections() {
+	txp.txp.CloseIdleConnections()
+}
@@ -0,0 +1,177 @@
+package engineresolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestDNSTransportWireSizes(t *testing.T) {
+	newQuery := func(size int) model.DNSQuery {
+		return &mocks.DNSQuery{
+			MockDomain: func() string {
+				return "dns.google"
+			},
+			MockBytes: func() ([]byte, error) {
+				return make([]byte, size), nil
+			},
+		}
+	}
+
+	t.Run("we record the size of queries and responses", func(t *testing.T) {
+		recorder := &dnsWireSizesRecorder{sizes: DNSWireSizes{URL: "https://dns.google/dns-query"}}
+		txp := &dnsTransportWireSizes{
+			logger:   model.DiscardLogger,
+			recorder: recorder,
+			txp: &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+					resp := &mocks.DNSResponse{
+						MockBytes: func() []byte {
+							return make([]byte, 468)
+						},
+					}
+					return resp, nil
+				},
+			},
+			url: "https://dns.google/dns-query",
+		}
+		for _, size := range []int{128, 256} {
+			if _, err := txp.RoundTrip(context.Background(), newQuery(size)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expect := DNSWireSizes{
+			URL:           "https://dns.google/dns-query",
+			Queries:       2,
+			QueryBytes:    384,
+			Responses:     2,
+			ResponseBytes: 936,
+		}
+		if diff := cmp.Diff(expect, recorder.snapshot()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we do not record responses on failure", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		recorder := &dnsWireSizesRecorder{}
+		txp := &dnsTransportWireSizes{
+			logger:   model.DiscardLogger,
+			recorder: recorder,
+			txp: &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+					return nil, expected
+				},
+			},
+		}
+		resp, err := txp.RoundTrip(context.Background(), newQuery(128))
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if resp != nil {
+			t.Fatal("expected nil response")
+		}
+		expect := DNSWireSizes{Queries: 1, QueryBytes: 128}
+		if diff := cmp.Diff(expect, recorder.snapshot()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we forward the other methods", func(t *testing.T) {
+		var called bool
+		txp := &dnsTransportWireSizes{
+			txp: &mocks.DNSTransport{
+				MockRequiresPadding: func() bool {
+					return true
+				},
+				MockNetwork: func() string {
+					return "doh"
+				},
+				MockAddress: func() string {
+					return "https://dns.google/dns-query"
+				},
+				MockCloseIdleConnections: func() {
+					called = true
+				},
+			},
+		}
+		if !txp.RequiresPadding() {
+			t.Fatal("unexpected RequiresPadding")
+		}
+		if txp.Network() != "doh" {
+			t.Fatal("unexpected Network")
+		}
+		if txp.Address() != "https://dns.google/dns-query" {
+			t.Fatal("unexpected Address")
+		}
+		txp.CloseIdleConnections()
+		if !called {
+			t.Fatal("did not call CloseIdleConnections")
+		}
+	})
+}
+
+func TestResolverDNSWireSizes(t *testing.T) {
+	t.Run("we do not record anything by default", func(t *testing.T) {
+		reso := &Resolver{}
+		if reso.maybeNewDNSTransportWrapper("https://dns.google/dns-query") != nil {
+			t.Fatal("expected nil wrapper")
+		}
+		if len(reso.DNSWireSizes()) != 0 {
+			t.Fatal("expected no sizes")
+		}
+	})
+
+	t.Run("we record the sizes of the child resolvers", func(t *testing.T) {
+		handler := &testDNSOverHTTPSHandler{
+			A: []net.IP{net.IPv4(8, 8, 8, 8)},
+		}
+		srvr := httptest.NewServer(handler)
+		defer srvr.Close()
+		reso := &Resolver{LogDNSWireSizes: true}
+		ri := &resolverinfo{URL: srvr.URL, Score: 0.1}
+		addrs, err := reso.lookupHost(context.Background(), ri, "dns.google")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+		sizes := reso.DNSWireSizes()
+		if len(sizes) != 1 {
+			t.Fatal("expected a single entry")
+		}
+		// we send both A and AAAA queries and the server replies to both
+		if sizes[0].URL != srvr.URL || sizes[0].Queries != 2 || sizes[0].Responses != 2 {
+			t.Fatalf("unexpected sizes: %+v", sizes[0])
+		}
+		if sizes[0].QueryBytes <= 0 || sizes[0].ResponseBytes <= 0 {
+			t.Fatalf("unexpected sizes: %+v", sizes[0])
+		}
+	})
+	t.Run("we pass the wrapper to newChildResolverFn", func(t *testing.T) {
+		var wrapped model.DNSTransport
+		reso := &Resolver{
+			LogDNSWireSizes: true,
+			newChildResolverFn: func(h3 bool, URL string, wrapTransport func(model.DNSTransport) model.DNSTransport) (model.Resolver, error) {
+				if wrapTransport == nil {
+					t.Fatal("expected a non-nil wrapper")
+				}
+				wrapped = wrapTransport(&mocks.DNSTransport{})
+				return &mocks.Resolver{}, nil
+			},
+		}
+		if _, err := reso.newresolver("https://dns.google/dns-query"); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := wrapped.(*dnsTransportWireSizes); !ok {
+			t.Fatalf("unexpected wrapped transport: %T", wrapped)
+		}
+	})
+}
@@ -16,7 +16,7 @@ func TestQA(t *testing.T) {
 				t.Skip("skip test in short mode")
 			}
 			measurer := NewExperimentMeasurer(&Config{})
-			if err := webconnectivityqa.RunTestCase(measurer, tc); err != nil {
+			if err := webconnectivityqa.RunTestCase(measurer, tc, webconnectivityqa.RunTestCaseOptionLogPrefixWithName()); err != nil {
 				t.Fatal(err)
 			}
 		})
@@ -0,0 +1,28 @@
+package webconnectivityqa
+
+// bodyReadTimeout is the case where the TCP connect succeeds and we receive the
+// response headers, but then the body stalls until we time out. The web server
+// stalls the body only for the probe's autonomous system (see
+// [netemx.StalledBodyWebPageHandlerFactory]), hence the control succeeds.
+func bodyReadTimeout() *TestCase {
+	return &TestCase{
+		Name:      "bodyReadTimeout",
+		Flags:     TestCaseFlagNoLTE, // BUG: LTE considers the website accessible when the body read times out
+		Input:     "http://www.stalledbody.org/",
+		LongTest:  true,
+		Configure: nil,
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSExperimentFailure:  nil,
+			DNSConsistency:        "consistent",
+			HTTPExperimentFailure: "generic_timeout_error",
+			StatusCodeMatch:       true,
+			HeadersMatch:          true,
+			XStatus:               8704, // StatusExperimentHTTP | StatusAnomalyUnknown
+			XDNSFlags:             0,
+			XBlockingFlags:        8, // analysisFlagHTTPBlocking
+			Accessible:            false,
+			Blocking:              "http-failure",
+		},
+	}
+}
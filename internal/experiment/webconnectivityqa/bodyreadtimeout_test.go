@@ -0,0 +1,50 @@
+package webconnectivityqa
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/netemx"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/runtimex"
+)
+
+func TestBodyReadTimeout(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := bodyReadTimeout()
+	runtimex.Assert(tc.Configure == nil, "expected no custom configuration")
+
+	env.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
+		client := netxlite.NewHTTPClientStdlib(log.Log)
+		req := runtimex.Try1(http.NewRequestWithContext(ctx, "GET", "http://www.stalledbody.org/", nil))
+
+		t.Run("we receive the response headers", func(t *testing.T) {
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatal("unexpected status code", resp.StatusCode)
+			}
+
+			t.Run("but we cannot read the body", func(t *testing.T) {
+				body, err := netxlite.ReadAllContext(ctx, resp.Body)
+				if err == nil || err.Error() != netxlite.FailureGenericTimeoutError {
+					t.Fatal("unexpected err", err)
+				}
+				if len(body) != 0 {
+					t.Fatal("expected empty body")
+				}
+			})
+		})
+	})
+}
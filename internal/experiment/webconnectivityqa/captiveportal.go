@@ -0,0 +1,55 @@
+package webconnectivityqa
+
+import (
+	"github.com/apex/log"
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-cli/v3/internal/netemx"
+)
+
+// captivePortalRedirect is the case where a captive portal transparently intercepts
+// the cleartext HTTP traffic and redirects the probe to the portal login page.
+func captivePortalRedirect() *TestCase {
+	return &TestCase{
+		Name:  "captivePortalRedirect",
+		Flags: 0,
+		Input: "http://www.example.org/",
+		Configure: func(env *netemx.QAEnv) {
+
+			// make the portal host resolve to the blockpage server, which
+			// serves the portal login page over HTTP
+			env.AddRecordToAllResolvers("captiveportal.local", "", netemx.AddressPublicBlockpage)
+
+			// spoof a redirect to the portal login page
+			env.DPIEngine().AddRule(&netem.DPISpoofBlockpageForString{
+				HTTPResponse:    []byte(captivePortalRedirectResponse),
+				Logger:          log.Log,
+				ServerIPAddress: netemx.AddressWwwExampleCom,
+				ServerPort:      80,
+				String:          "www.example.org",
+			})
+
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSConsistency:  "consistent",
+			BodyLengthMatch: false,
+			BodyProportion:  0.12263535551206783,
+			StatusCodeMatch: true,
+			HeadersMatch:    true,
+			TitleMatch:      false,
+			XStatus:         2,  // StatusSuccessCleartext
+			XBlockingFlags:  32, // analysisFlagSuccess
+			Accessible:      true,
+			Blocking:        false,
+			HTTPRedirects:   []string{"http://captiveportal.local/login"},
+		},
+	}
+}
+
+// captivePortalRedirectResponse is the response with which the captive portal
+// redirects the probe to the portal login page.
+const captivePortalRedirectResponse = "HTTP/1.1 302 Found\r\n" +
+	"Location: http://captiveportal.local/login\r\n" +
+	"Content-Length: 0\r\n" +
+	"Connection: close\r\n" +
+	"\r\n"
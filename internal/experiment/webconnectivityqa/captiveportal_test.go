@@ -0,0 +1,43 @@
+package webconnectivityqa
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/netemx"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/runtimex"
+)
+
+func TestCaptivePortalRedirect(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := captivePortalRedirect()
+	tc.Configure(env)
+
+	env.Do(func() {
+		// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
+		client := netxlite.NewHTTPClientStdlib(log.Log)
+		req := runtimex.Try1(http.NewRequestWithContext(
+			context.Background(), "GET", "http://www.example.org/", nil))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if URL := resp.Request.URL.String(); URL != "http://captiveportal.local/login" {
+			t.Fatal("unexpected final URL", URL)
+		}
+		body, err := netxlite.ReadAllContext(req.Context(), resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]byte(netemx.Blockpage), body); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -96,3 +96,30 @@ func controlFailureWithSuccessfulHTTPSWebsite() *TestCase {
 		},
 	}
 }
+
+// controlDNSNXDOMAIN verifies that we correctly handle the case where the control's
+// resolver returns NXDOMAIN for the website domain while the probe resolves it fine.
+//
+// LTE deliberately treats a local DNS success along with a remote NXDOMAIN as a sign
+// of local DNS interception for an expired domain (see analysisFlagNullNullNXDOMAINWithCensorship).
+// Instead, v0.4 considers the DNS inconsistent and the control failed, therefore it
+// sets accessible and blocking to null, so we only run this test case with LTE.
+func controlDNSNXDOMAIN() *TestCase {
+	return &TestCase{
+		Name:  "controlDNSNXDOMAIN",
+		Flags: TestCaseFlagNoV04, // see above
+		Input: "http://www.example.org/",
+		Configure: func(env *netemx.QAEnv) {
+			// remove the record from the resolver used by the test helpers, such
+			// that the control's DNS lookup returns NXDOMAIN
+			env.RootResolverConfig().RemoveRecord("www.example.org")
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSConsistency: "consistent",
+			XNullNullFlags: 16, // analysisFlagNullNullNXDOMAINWithCensorship
+			Accessible:     false,
+			Blocking:       "dns",
+		},
+	}
+}
@@ -55,3 +55,38 @@ func TestControlFailureWithSuccessfulHTTPSWebsite(t *testing.T) {
 		}
 	})
 }
+
+func TestControlDNSNXDOMAIN(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := controlDNSNXDOMAIN()
+	tc.Configure(env)
+
+	env.Do(func() {
+		t.Run("the root resolver used by the control returns NXDOMAIN", func(t *testing.T) {
+			dialer := netxlite.NewDialerWithoutResolver(log.Log)
+			endpoint := net.JoinHostPort(netemx.RootResolverAddress, "53")
+			reso := netxlite.NewParallelUDPResolver(log.Log, dialer, endpoint)
+			defer reso.CloseIdleConnections()
+			addrs, err := reso.LookupHost(context.Background(), "www.example.org")
+			if err == nil || err.Error() != netxlite.FailureDNSNXDOMAINError {
+				t.Fatal("unexpected error", err)
+			}
+			if len(addrs) != 0 {
+				t.Fatal("expected no addrs")
+			}
+		})
+
+		t.Run("the probe resolver returns the expected addresses", func(t *testing.T) {
+			reso := netxlite.NewStdlibResolver(log.Log)
+			addrs, err := reso.LookupHost(context.Background(), "www.example.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 1 || addrs[0] != netemx.AddressWwwExampleCom {
+				t.Fatal("unexpected addrs", addrs)
+			}
+		})
+	})
+}
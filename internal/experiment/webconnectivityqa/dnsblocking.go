@@ -1,6 +1,8 @@
 package webconnectivityqa
 
 import (
+	"github.com/apex/log"
+	"github.com/ooni/netem"
 	"github.com/ooni/probe-cli/v3/internal/netemx"
 )
 
@@ -62,3 +64,48 @@ func dnsBlockingNXDOMAIN() *TestCase {
 		},
 	}
 }
+
+// dnsBlockingProbeEncryptedResolvers is the case where the censor blocks the encrypted
+// DNS resolvers (DoH and DoT) used by the probe but leaves the ISP resolver and the
+// control alone, hence the probe must fall back to using the ISP resolver.
+func dnsBlockingProbeEncryptedResolvers() *TestCase {
+	return &TestCase{
+		Name:  "dnsBlockingProbeEncryptedResolvers",
+		Flags: 0,
+		Input: "http://www.example.com/",
+		Configure: func(env *netemx.QAEnv) {
+
+			// reset connections to the DoH and DoT endpoints the probe may use
+			addrs := []string{
+				netemx.AddressDNSGoogle8844,
+				netemx.AddressDNSGoogle8888,
+				netemx.AddressDNSQuad9Net,
+				netemx.AddressMozillaCloudflareDNSCom,
+			}
+			for _, addr := range addrs {
+				for _, port := range []uint16{443, 853} {
+					env.DPIEngine().AddRule(&netem.DPICloseConnectionForServerEndpoint{
+						Logger:          log.Log,
+						ServerIPAddress: addr,
+						ServerPort:      port,
+					})
+				}
+			}
+
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSExperimentFailure: nil,
+			DNSConsistency:       "consistent",
+			BodyLengthMatch:      true,
+			BodyProportion:       1,
+			StatusCodeMatch:      true,
+			HeadersMatch:         true,
+			TitleMatch:           true,
+			XStatus:              2,  // StatusSuccessCleartext
+			XBlockingFlags:       32, // analysisFlagSuccess
+			Accessible:           true,
+			Blocking:             false,
+		},
+	}
+}
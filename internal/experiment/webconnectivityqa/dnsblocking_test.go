@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/netemx"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
@@ -47,3 +48,36 @@ func TestDNSBlockingNXDOMAIN(t *testing.T) {
 		}
 	})
 }
+
+func TestDNSBlockingProbeEncryptedResolvers(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := dnsBlockingProbeEncryptedResolvers()
+	tc.Configure(env)
+
+	env.Do(func() {
+		t.Run("the DoH resolver is blocked", func(t *testing.T) {
+			reso := netxlite.NewParallelDNSOverHTTPSResolver(log.Log, "https://dns.google/dns-query")
+			defer reso.CloseIdleConnections()
+			addrs, err := reso.LookupHost(context.Background(), "www.example.com")
+			if err == nil || err.Error() != netxlite.FailureConnectionRefused {
+				t.Fatal("unexpected error", err)
+			}
+			if len(addrs) != 0 {
+				t.Fatal("expected to see no addresses")
+			}
+		})
+
+		t.Run("the ISP resolver works", func(t *testing.T) {
+			reso := netxlite.NewStdlibResolver(log.Log)
+			addrs, err := reso.LookupHost(context.Background(), "www.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{netemx.AddressWwwExampleCom}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+}
@@ -0,0 +1,44 @@
+package webconnectivityqa
+
+import "github.com/ooni/probe-cli/v3/internal/netemx"
+
+// cnameChain is the case where www.example.org resolves through a CNAME to
+// a reachable address, which is common with CDNs and with some blocking.
+//
+// TODO: netem's DNS server returns at most a single CNAME record, without
+// following the target, so we can only model a chain with a single hop. Once
+// netem supports longer chains, we should add more intermediate names here.
+func cnameChain() *TestCase {
+	return &TestCase{
+		Name:  "cnameChain",
+		Flags: TestCaseFlagNoV04, // BUG: v0.4 does not record CNAMEs
+		Input: "http://www.example.org/",
+		Configure: func(env *netemx.QAEnv) {
+
+			// make www.example.org a CNAME for a CDN name while still
+			// resolving to the address of the www.example.org webserver
+			env.AddRecordToAllResolvers(
+				"www.example.org",
+				"www.example.org.cdn.cloudflare.net",
+				netemx.AddressWwwExampleCom,
+			)
+
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSConsistency:  "consistent",
+			BodyLengthMatch: true,
+			BodyProportion:  1,
+			StatusCodeMatch: true,
+			HeadersMatch:    true,
+			TitleMatch:      true,
+			XStatus:         2,  // StatusSuccessCleartext
+			XBlockingFlags:  32, // analysisFlagSuccess
+			Accessible:      true,
+			Blocking:        false,
+			CNAMEs: map[string]string{
+				"www.example.org": "www.example.org.cdn.cloudflare.net.",
+			},
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package webconnectivityqa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/netemx"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestCNAMEChain(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := cnameChain()
+	tc.Configure(env)
+
+	env.Do(func() {
+		d := netxlite.NewDialerWithoutResolver(log.Log)
+		txp := netxlite.NewUnwrappedDNSOverUDPTransport(d, "8.8.8.8:53")
+		encoder := &netxlite.DNSEncoderMiekg{}
+		query := encoder.Encode("www.example.org", dns.TypeA, false)
+		resp, err := txp.RoundTrip(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cname, err := resp.DecodeCNAME()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cname != "www.example.org.cdn.cloudflare.net." {
+			t.Fatal("unexpected CNAME", cname)
+		}
+		addrs, err := resp.DecodeLookupHost()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != netemx.AddressWwwExampleCom {
+			t.Fatal("unexpected addrs", addrs)
+		}
+	})
+}
@@ -78,3 +78,37 @@ func dnsHijackingToProxyWithHTTPSURL() *TestCase {
 		},
 	}
 }
+
+// udpDNSHijackDoHClean is the case where the ISP hijacks the cleartext DNS queries for
+// a given domain, pointing the clients to a passthrough proxy, but does not tamper with
+// DoH. Like for dnsHijackingToProxyWithHTTPSURL, LTE does not flag the hijacking, and we
+// record its current results here such that we notice when we fix this bug.
+//
+// Note that LTE only performs DoH lookups opportunistically, using a random DoH server, hence
+// we cannot assert on the DoH queries here.
+func udpDNSHijackDoHClean() *TestCase {
+	return &TestCase{
+		Name:  "udpDNSHijackDoHClean",
+		Flags: TestCaseFlagNoV04, // v0.4 only uses the system resolver, hence it sees inconsistent DNS
+		Input: "https://www.example.org/",
+		Configure: func(env *netemx.QAEnv) {
+
+			// add DPI rule to force all the cleartext DNS queries to
+			// point the client to used the ISPProxyAddress
+			env.DPIEngine().AddRule(&netem.DPISpoofDNSResponse{
+				Addresses: []string{netemx.ISPProxyAddress},
+				Logger:    env.Logger(),
+				Domain:    "www.example.org",
+			})
+
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSConsistency: "consistent", // BUG: LTE thinks the DNS is consistent
+			XDNSFlags:      0,
+			XBlockingFlags: 32,    // analysisFlagSuccess
+			Accessible:     true,  // BUG: we should flag the DNS hijacking
+			Blocking:       false, // BUG: ditto
+		},
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/apex/log"
 	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/engineresolver"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
 	"github.com/ooni/probe-cli/v3/internal/netemx"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
@@ -52,3 +54,73 @@ func TestDNSHijackingTestCases(t *testing.T) {
 		})
 	}
 }
+
+func TestUDPDNSHijackDoHClean(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := udpDNSHijackDoHClean()
+	tc.Configure(env)
+
+	env.Do(func() {
+		t.Run("the cleartext DNS is hijacked", func(t *testing.T) {
+			expect := []string{netemx.ISPProxyAddress}
+
+			t.Run("with stdlib resolver", func(t *testing.T) {
+				reso := netxlite.NewStdlibResolver(log.Log)
+				addrs, err := reso.LookupHost(context.Background(), "www.example.org")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(expect, addrs); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+
+			t.Run("with UDP resolver", func(t *testing.T) {
+				d := netxlite.NewDialerWithoutResolver(log.Log)
+				reso := netxlite.NewParallelUDPResolver(log.Log, d, "8.8.8.8:53")
+				addrs, err := reso.LookupHost(context.Background(), "www.example.org")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(expect, addrs); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+		})
+
+		t.Run("DoH is clean", func(t *testing.T) {
+			expect := []string{netemx.AddressWwwExampleCom}
+
+			t.Run("with DoH resolver", func(t *testing.T) {
+				reso := netxlite.NewParallelDNSOverHTTPSResolver(log.Log, "https://dns.google/dns-query")
+				defer reso.CloseIdleConnections()
+				addrs, err := reso.LookupHost(context.Background(), "www.example.org")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(expect, addrs); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+
+			t.Run("with the engine resolver", func(t *testing.T) {
+				reso := &engineresolver.Resolver{
+					AllowedSchemes: []string{"https", "system"},
+					Deterministic:  true,
+					KVStore:        &kvstore.Memory{},
+					Logger:         log.Log,
+				}
+				defer reso.CloseIdleConnections()
+				addrs, err := reso.LookupHost(context.Background(), "www.example.org")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(expect, addrs); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+		})
+	})
+}
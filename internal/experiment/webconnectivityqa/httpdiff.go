@@ -98,3 +98,120 @@ func httpDiffWithInconsistentDNS() *TestCase {
 		},
 	}
 }
+
+// statusCodeMismatch verifies the case where the probe gets a 403 response, e.g.,
+// because of geo/IP-based blocking, while the control gets the 200 response. We
+// use DPI to spoof the response because DPI only applies to the probe's traffic.
+func statusCodeMismatch() *TestCase {
+	return &TestCase{
+		Name:  "statusCodeMismatch",
+		Flags: 0,
+		Input: "http://www.example.com/",
+		Configure: func(env *netemx.QAEnv) {
+
+			// spoof a 403 response for the probe
+			env.DPIEngine().AddRule(&netem.DPISpoofBlockpageForString{
+				HTTPResponse:    []byte(statusCodeMismatchResponse),
+				Logger:          log.Log,
+				ServerIPAddress: netemx.AddressWwwExampleCom,
+				ServerPort:      80,
+				String:          "www.example.com",
+			})
+
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSExperimentFailure:  nil,
+			DNSConsistency:        "consistent",
+			HTTPExperimentFailure: nil,
+			BodyLengthMatch:       false,
+			BodyProportion:        0.0410958904109589,
+			StatusCodeMatch:       false,
+			HeadersMatch:          true,
+			TitleMatch:            false,
+			XStatus:               64, // StatusAnomalyHTTPDiff
+			XDNSFlags:             0,
+			XBlockingFlags:        16, // analysisFlagHTTPDiff
+			Accessible:            false,
+			Blocking:              "http-diff",
+		},
+	}
+}
+
+// statusCodeMismatchResponse is the 403 response we spoof for the probe.
+const statusCodeMismatchResponse = "HTTP/1.1 403 Forbidden\r\n" +
+	"Content-Type: text/html\r\n" +
+	"Content-Length: 63\r\n" +
+	"Connection: close\r\n" +
+	"\r\n" +
+	"<html><head><title>Forbidden</title></head><body></body></html>"
+
+// metaRefreshBlockpage verifies the case where the probe gets a 200 response containing
+// a blockpage that uses an HTML meta refresh to bounce the user to a portal. Because HTTP
+// clients do not follow meta refreshes, there is no redirect and we can only detect this
+// blockpage by comparing its body, title, and headers with the ones seen by the control.
+func metaRefreshBlockpage() *TestCase {
+	return &TestCase{
+		Name:  "metaRefreshBlockpage",
+		Flags: TestCaseFlagNoLTE, // BUG: LTE does not set whether the headers match
+		Input: "http://www.example.org/",
+		Configure: func(env *netemx.QAEnv) {
+
+			// spoof the meta refresh blockpage for the probe
+			env.DPIEngine().AddRule(&netem.DPISpoofBlockpageForString{
+				HTTPResponse:    netem.DPIFormatHTTPResponse([]byte(netemx.MetaRefreshBlockpage)),
+				Logger:          log.Log,
+				ServerIPAddress: netemx.AddressWwwExampleCom,
+				ServerPort:      80,
+				String:          "www.example.org",
+			})
+
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSExperimentFailure:  nil,
+			DNSConsistency:        "consistent",
+			HTTPExperimentFailure: nil,
+			BodyLengthMatch:       false,
+			BodyProportion:        0.10306588388780169,
+			StatusCodeMatch:       true,
+			HeadersMatch:          false,
+			TitleMatch:            false,
+			XStatus:               64, // StatusAnomalyHTTPDiff
+			XDNSFlags:             0,
+			XBlockingFlags:        16, // analysisFlagHTTPDiff
+			Accessible:            false,
+			Blocking:              "http-diff",
+		},
+	}
+}
+
+// geoDifferentialContent verifies the case where the website returns a "not available
+// in your region" webpage to the probe's autonomous system and the real webpage to the
+// test helper, which belongs to another autonomous system. Because the same server returns
+// both webpages, the status code and the uncommon headers (i.e., Content-Length) match, so
+// both implementations consider the website accessible despite the body mismatch.
+func geoDifferentialContent() *TestCase {
+	return &TestCase{
+		Name:      "geoDifferentialContent",
+		Flags:     0,
+		Input:     "http://www.geodifferential.org/",
+		Configure: nil,
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSExperimentFailure:  nil,
+			DNSConsistency:        "consistent",
+			BodyLengthMatch:       false,
+			BodyProportion:        0.1187214611872146,
+			StatusCodeMatch:       true,
+			HeadersMatch:          true,
+			TitleMatch:            false,
+			HTTPExperimentFailure: nil,
+			XStatus:               2, // StatusSuccessCleartext
+			XDNSFlags:             0,
+			XBlockingFlags:        32,    // analysisFlagSuccess
+			Accessible:            true,  // BUG: we should flag the body mismatch as http-diff
+			Blocking:              false, // BUG: ditto
+		},
+	}
+}
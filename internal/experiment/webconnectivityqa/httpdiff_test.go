@@ -106,3 +106,80 @@ func TestHTTPDiffWithInconsistentDNS(t *testing.T) {
 		})
 	}
 }
+
+func TestStatusCodeMismatch(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := statusCodeMismatch()
+	tc.Configure(env)
+
+	env.Do(func() {
+		// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
+		client := netxlite.NewHTTPClientStdlib(log.Log)
+		req := runtimex.Try1(http.NewRequest("GET", "http://www.example.com/", nil))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatal("unexpected status code", resp.StatusCode)
+		}
+	})
+}
+
+func TestMetaRefreshBlockpage(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := metaRefreshBlockpage()
+	tc.Configure(env)
+
+	env.Do(func() {
+		// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
+		client := netxlite.NewHTTPClientStdlib(log.Log)
+		req := runtimex.Try1(http.NewRequest("GET", "http://www.example.org/", nil))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status code", resp.StatusCode)
+		}
+		body, err := netxlite.ReadAllContext(req.Context(), resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]byte(netemx.MetaRefreshBlockpage), body); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestGeoDifferentialContent(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := geoDifferentialContent()
+	runtimex.Assert(tc.Configure == nil, "expected no configure function")
+
+	env.Do(func() {
+		// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
+		client := netxlite.NewHTTPClientStdlib(log.Log)
+		req := runtimex.Try1(http.NewRequest("GET", "http://www.geodifferential.org/", nil))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := netxlite.ReadAllContext(req.Context(), resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]byte(netemx.GeoBlockedWebPage), body); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -12,8 +12,90 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
+// RunTestCaseOption is an option to modify [RunTestCase] default behavior.
+type RunTestCaseOption func(config *runTestCaseConfig)
+
+// runTestCaseConfig contains the [RunTestCase] configuration.
+type runTestCaseConfig struct {
+	logger            model.Logger
+	logPrefixWithName bool
+	onProgress        func(fraction float64, message string)
+}
+
+// RunTestCaseOptionLogger sets the logger used by the probe. If you do not
+// set this option, we will use [log.Log].
+func RunTestCaseOptionLogger(logger model.Logger) RunTestCaseOption {
+	return func(config *runTestCaseConfig) {
+		config.logger = logger
+	}
+}
+
+// RunTestCaseOptionLogPrefixWithName includes the [TestCase] name into the prefix of
+// the log lines emitted by the probe, which allows one to tell apart the log lines of
+// distinct test cases. If you do not set this option, the prefix is just "PROBE".
+func RunTestCaseOptionLogPrefixWithName() RunTestCaseOption {
+	return func(config *runTestCaseConfig) {
+		config.logPrefixWithName = true
+	}
+}
+
+// RunTestCaseOptionOnProgress sets the function receiving the experiment progress, which
+// replaces the default [model.PrinterCallbacks] logging the progress.
+func RunTestCaseOptionOnProgress(fn func(fraction float64, message string)) RunTestCaseOption {
+	return func(config *runTestCaseConfig) {
+		config.onProgress = fn
+	}
+}
+
+// progressCallbacks adapts a function to the [model.ExperimentCallbacks] interface.
+type progressCallbacks func(fraction float64, message string)
+
+var _ model.ExperimentCallbacks = progressCallbacks(nil)
+
+// OnProgress implements model.ExperimentCallbacks.
+func (fn progressCallbacks) OnProgress(fraction float64, message string) {
+	fn(fraction, message)
+}
+
+// newCallbacks returns the [model.ExperimentCallbacks] to use.
+func (config *runTestCaseConfig) newCallbacks(logger model.Logger) model.ExperimentCallbacks {
+	if config.onProgress != nil {
+		return progressCallbacks(config.onProgress)
+	}
+	return model.NewPrinterCallbacks(logger)
+}
+
+// probeLogPrefixWidth is the width of the probe log prefix when it does not
+// include the test case name. We use the same width used by [netemx].
+const probeLogPrefixWidth = 16
+
+// namedProbeLogPrefixWidth is the width of the probe log prefix when it includes
+// the test case name. We truncate longer names to keep log lines aligned.
+const namedProbeLogPrefixWidth = 40
+
+// newProbeLogPrefix returns the prefix of the log lines emitted by the probe.
+func newProbeLogPrefix(name string, withName bool) string {
+	if !withName || name == "" {
+		return fmt.Sprintf("%-*s", probeLogPrefixWidth, "PROBE")
+	}
+	prefix := "PROBE " + name
+	if len(prefix) > namedProbeLogPrefixWidth-1 {
+		prefix = prefix[:namedProbeLogPrefixWidth-1] // leave room for a space
+	}
+	return fmt.Sprintf("%-*s", namedProbeLogPrefixWidth, prefix)
+}
+
 // RunTestCase runs a [testCase].
-func RunTestCase(measurer model.ExperimentMeasurer, tc *TestCase) error {
+func RunTestCase(measurer model.ExperimentMeasurer, tc *TestCase, options ...RunTestCaseOption) error {
+	config := &runTestCaseConfig{
+		logger:            log.Log,
+		logPrefixWithName: false,
+		onProgress:        nil,
+	}
+	for _, option := range options {
+		option(config)
+	}
+
 	// configure the netemx scenario
 	env := netemx.MustNewScenario(netemx.InternetScenario)
 	defer env.Close()
@@ -27,17 +109,20 @@ func RunTestCase(measurer model.ExperimentMeasurer, tc *TestCase) error {
 
 	// create a logger for the probe
 	prefixLogger := &logx.PrefixLogger{
-		Prefix: fmt.Sprintf("%-16s", "PROBE"),
-		Logger: log.Log,
+		Prefix: newProbeLogPrefix(tc.Name, config.logPrefixWithName),
+		Logger: config.logger,
 	}
 
+	// create the experiment callbacks
+	callbacks := config.newCallbacks(prefixLogger)
+
 	var err error
 	env.Do(func() {
 		// create an HTTP client inside the env.Do function so we're using netem
 		// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
 		httpClient := netxlite.NewHTTPClientStdlib(prefixLogger)
 		arguments := &model.ExperimentArgs{
-			Callbacks:   model.NewPrinterCallbacks(prefixLogger),
+			Callbacks:   callbacks,
 			Measurement: measurement,
 			Session:     newSession(httpClient, prefixLogger),
 		}
@@ -3,9 +3,12 @@ package webconnectivityqa
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/mocks"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netemx"
@@ -336,6 +339,186 @@ func TestRunTestCase(t *testing.T) {
 		}
 	})
 
+	t.Run("we compare DNSQueries when we have expectations", func(t *testing.T) {
+		tc := &TestCase{
+			Name:      "",
+			Input:     "",
+			Configure: nil,
+			ExpectErr: false,
+			ExpectTestKeys: &testKeys{
+				Accessible: true,
+				Blocking:   false,
+				DNSQueries: []*testKeysDNSQuery{{
+					Engine:    "system",
+					Hostname:  "www.example.com",
+					QueryType: "A",
+					Addrs:     []string{"10.0.0.1"},
+				}},
+			},
+		}
+		measurer := &mocks.ExperimentMeasurer{
+			MockExperimentName: func() string {
+				return "web_connectivity"
+			},
+			MockExperimentVersion: func() string {
+				return "0.4.2"
+			},
+			MockRun: func(ctx context.Context, args *model.ExperimentArgs) error {
+				args.Measurement.TestKeys = map[string]any{
+					"accessible": true,
+					"blocking":   false,
+					"queries": []*model.ArchivalDNSLookupResult{{
+						Engine:    "system",
+						Hostname:  "www.example.com",
+						QueryType: "A",
+						Answers: []model.ArchivalDNSAnswer{{
+							AnswerType: "A",
+							IPv4:       "10.0.0.2",
+						}},
+					}},
+				}
+				return nil
+			},
+		}
+		err := RunTestCase(measurer, tc)
+		if err == nil || !strings.HasPrefix(err.Error(), "test keys mismatch: ") {
+			t.Fatal("unexpected error:", err)
+		}
+	})
+
+	t.Run("we compare CNAMEs when we have expectations", func(t *testing.T) {
+		tc := &TestCase{
+			Name:      "",
+			Input:     "",
+			Configure: nil,
+			ExpectErr: false,
+			ExpectTestKeys: &testKeys{
+				Accessible: true,
+				Blocking:   false,
+				CNAMEs: map[string]string{
+					"www.example.com": "www.example.com.cdn.example.net.",
+				},
+			},
+		}
+		measurer := &mocks.ExperimentMeasurer{
+			MockExperimentName: func() string {
+				return "web_connectivity"
+			},
+			MockExperimentVersion: func() string {
+				return "0.4.2"
+			},
+			MockRun: func(ctx context.Context, args *model.ExperimentArgs) error {
+				args.Measurement.TestKeys = map[string]any{
+					"accessible": true,
+					"blocking":   false,
+					"queries": []*model.ArchivalDNSLookupResult{{
+						Engine:    "udp",
+						Hostname:  "www.example.com",
+						QueryType: "A",
+						Answers: []model.ArchivalDNSAnswer{{
+							AnswerType: "A",
+							IPv4:       "10.0.0.1",
+						}, {
+							AnswerType: "CNAME",
+							Hostname:   "www.example.com.edge.example.net.",
+						}},
+					}},
+				}
+				return nil
+			},
+		}
+		err := RunTestCase(measurer, tc)
+		if err == nil || !strings.HasPrefix(err.Error(), "test keys mismatch: ") {
+			t.Fatal("unexpected error:", err)
+		}
+	})
+
+	t.Run("we ignore DNSQueries when we do not have expectations", func(t *testing.T) {
+		tc := &TestCase{
+			Name:      "",
+			Input:     "",
+			Configure: nil,
+			ExpectErr: false,
+			ExpectTestKeys: &testKeys{
+				Accessible: true,
+				Blocking:   false,
+			},
+		}
+		measurer := &mocks.ExperimentMeasurer{
+			MockExperimentName: func() string {
+				return "web_connectivity"
+			},
+			MockExperimentVersion: func() string {
+				return "0.4.2"
+			},
+			MockRun: func(ctx context.Context, args *model.ExperimentArgs) error {
+				args.Measurement.TestKeys = map[string]any{
+					"accessible": true,
+					"blocking":   false,
+					"queries": []*model.ArchivalDNSLookupResult{{
+						Engine:    "system",
+						Hostname:  "www.example.com",
+						QueryType: "A",
+						Answers: []model.ArchivalDNSAnswer{{
+							AnswerType: "A",
+							IPv4:       "10.0.0.2",
+						}},
+					}},
+				}
+				return nil
+			},
+		}
+		err := RunTestCase(measurer, tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("we compare ResolvedASNs when we have expectations", func(t *testing.T) {
+		tc := &TestCase{
+			Name:      "",
+			Input:     "",
+			Configure: nil,
+			ExpectErr: false,
+			ExpectTestKeys: &testKeys{
+				Accessible: true,
+				Blocking:   false,
+				ResolvedASNs: map[string]int64{
+					"8.8.8.8": 15169,
+				},
+			},
+		}
+		measurer := &mocks.ExperimentMeasurer{
+			MockExperimentName: func() string {
+				return "web_connectivity"
+			},
+			MockExperimentVersion: func() string {
+				return "0.4.2"
+			},
+			MockRun: func(ctx context.Context, args *model.ExperimentArgs) error {
+				args.Measurement.TestKeys = map[string]any{
+					"accessible": true,
+					"blocking":   false,
+					"queries": []*model.ArchivalDNSLookupResult{{
+						Engine:    "system",
+						Hostname:  "dns.google",
+						QueryType: "A",
+						Answers: []model.ArchivalDNSAnswer{{
+							ASN:        13335,
+							AnswerType: "A",
+							IPv4:       "8.8.8.8",
+						}},
+					}},
+				}
+				return nil
+			},
+		}
+		err := RunTestCase(measurer, tc)
+		if err == nil || !strings.HasPrefix(err.Error(), "test keys mismatch: ") {
+			t.Fatal("unexpected error:", err)
+		}
+	})
+
 	t.Run("we return an error if the experiment version is unknown", func(t *testing.T) {
 		tc := &TestCase{
 			Name:      "",
@@ -406,3 +589,129 @@ func TestRunTestCase(t *testing.T) {
 		}
 	})
 }
+
+func TestRunTestCaseLogPrefix(t *testing.T) {
+	// runAndCollectLogs runs a test case logging a message and returns the collected logs.
+	runAndCollectLogs := func(t *testing.T, tc *TestCase, options ...RunTestCaseOption) []string {
+		var (
+			lines []string
+			mu    sync.Mutex
+		)
+		collect := func(format string, v ...interface{}) {
+			defer mu.Unlock()
+			mu.Lock()
+			lines = append(lines, fmt.Sprintf(format, v...))
+		}
+		logger := &mocks.Logger{
+			MockDebugf: collect,
+			MockInfof:  collect,
+			MockWarnf:  collect,
+		}
+		measurer := &mocks.ExperimentMeasurer{
+			MockExperimentName: func() string {
+				return "web_connectivity"
+			},
+			MockExperimentVersion: func() string {
+				return "0.5.26"
+			},
+			MockRun: func(ctx context.Context, args *model.ExperimentArgs) error {
+				args.Session.Logger().Infof("hello, %s", "world")
+				args.Measurement.TestKeys = &testKeys{}
+				return nil
+			},
+		}
+		options = append([]RunTestCaseOption{RunTestCaseOptionLogger(logger)}, options...)
+		if err := RunTestCase(measurer, tc, options...); err != nil {
+			t.Fatal(err)
+		}
+		return lines
+	}
+
+	tc := &TestCase{
+		Name:           "dnsBlockingNXDOMAIN",
+		Input:          "",
+		Configure:      nil,
+		ExpectErr:      false,
+		ExpectTestKeys: &testKeys{},
+	}
+
+	t.Run("by default the prefix is PROBE", func(t *testing.T) {
+		lines := runAndCollectLogs(t, tc)
+		expect := []string{
+			"PROBE           hello, world",
+		}
+		if diff := cmp.Diff(expect, lines); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we can include the test case name into the prefix", func(t *testing.T) {
+		lines := runAndCollectLogs(t, tc, RunTestCaseOptionLogPrefixWithName())
+		prefix := fmt.Sprintf("%-*s", namedProbeLogPrefixWidth, "PROBE dnsBlockingNXDOMAIN")
+		expect := []string{
+			prefix + "hello, world",
+		}
+		if diff := cmp.Diff(expect, lines); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we truncate long test case names", func(t *testing.T) {
+		prefix := newProbeLogPrefix(strings.Repeat("x", 100), true)
+		expect := "PROBE " + strings.Repeat("x", namedProbeLogPrefixWidth-7) + " "
+		if prefix != expect {
+			t.Fatal("unexpected prefix", prefix)
+		}
+	})
+
+	t.Run("we use PROBE when the test case has no name", func(t *testing.T) {
+		if prefix := newProbeLogPrefix("", true); prefix != "PROBE           " {
+			t.Fatal("unexpected prefix", prefix)
+		}
+	})
+}
+
+func TestRunTestCaseOnProgress(t *testing.T) {
+	type progressEvent struct {
+		Fraction float64
+		Message  string
+	}
+
+	var events []progressEvent
+	onProgress := func(fraction float64, message string) {
+		events = append(events, progressEvent{Fraction: fraction, Message: message})
+	}
+
+	tc := &TestCase{
+		Name:           "successWithHTTPS",
+		Input:          "",
+		Configure:      nil,
+		ExpectErr:      false,
+		ExpectTestKeys: &testKeys{},
+	}
+	measurer := &mocks.ExperimentMeasurer{
+		MockExperimentName: func() string {
+			return "web_connectivity"
+		},
+		MockExperimentVersion: func() string {
+			return "0.5.26"
+		},
+		MockRun: func(ctx context.Context, args *model.ExperimentArgs) error {
+			args.Callbacks.OnProgress(0.5, "halfway")
+			args.Measurement.TestKeys = &testKeys{}
+			return nil
+		},
+	}
+
+	if err := RunTestCase(measurer, tc, RunTestCaseOptionOnProgress(onProgress)); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []progressEvent{{
+		Fraction: 0.5,
+		Message:  "halfway",
+	}}
+	if diff := cmp.Diff(expect, events); diff != "" {
+		t.Fatal(diff)
+	}
+}
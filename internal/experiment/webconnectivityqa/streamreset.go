@@ -0,0 +1,26 @@
+package webconnectivityqa
+
+// httpStreamResetAfterRequestHeaders is the case where the TCP connect and the TLS
+// handshake succeed but the HTTP/2 stream is reset after the server sees the request
+// headers, which emulates a middlebox resetting the stream. The web server only resets
+// the streams of the probe's autonomous system (see [netemx.StreamResetWebPageHandlerFactory]),
+// hence the control succeeds.
+func httpStreamResetAfterRequestHeaders() *TestCase {
+	return &TestCase{
+		Name:      "httpStreamResetAfterRequestHeaders",
+		Flags:     0,
+		Input:     "https://www.streamreset.org/",
+		Configure: nil,
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSExperimentFailure:  nil,
+			DNSConsistency:        "consistent",
+			HTTPExperimentFailure: "unknown_failure: stream error: stream ID 1; INTERNAL_ERROR; received from peer",
+			XStatus:               8192, // StatusExperimentHTTP
+			XDNSFlags:             0,
+			XBlockingFlags:        0,
+			Accessible:            nil, // BUG: we should flag the stream reset as http-failure
+			Blocking:              nil, // BUG: ditto
+		},
+	}
+}
@@ -0,0 +1,34 @@
+package webconnectivityqa
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/netemx"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/runtimex"
+)
+
+func TestHTTPStreamResetAfterRequestHeaders(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := httpStreamResetAfterRequestHeaders()
+	runtimex.Assert(tc.Configure == nil, "expected no custom configuration")
+
+	env.Do(func() {
+		// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
+		client := netxlite.NewHTTPClientStdlib(log.Log)
+		req := runtimex.Try1(http.NewRequestWithContext(context.Background(), "GET", tc.Input, nil))
+		resp, err := client.Do(req)
+		if err == nil || !strings.HasSuffix(err.Error(), "INTERNAL_ERROR; received from peer") {
+			t.Fatal("unexpected err", err)
+		}
+		if resp != nil {
+			t.Fatal("expected nil response")
+		}
+	})
+}
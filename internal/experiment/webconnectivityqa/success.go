@@ -1,5 +1,7 @@
 package webconnectivityqa
 
+import "github.com/ooni/probe-cli/v3/internal/netemx"
+
 // successWithHTTP ensures we can successfully measure an HTTP URL.
 func sucessWithHTTP() *TestCase {
 	return &TestCase{
@@ -19,6 +21,9 @@ func sucessWithHTTP() *TestCase {
 			XBlockingFlags:  32,
 			Accessible:      true,
 			Blocking:        false,
+			ResolvedASNs: map[string]int64{
+				netemx.AddressWwwExampleCom: 15133, // the ASN of the real www.example.com
+			},
 		},
 	}
 }
@@ -42,6 +47,12 @@ func sucessWithHTTPS() *TestCase {
 			XBlockingFlags:  32,
 			Accessible:      true,
 			Blocking:        false,
+			DNSQueries: []*testKeysDNSQuery{{
+				Engine:    "system",
+				Hostname:  "www.example.com",
+				QueryType: "A",
+				Addrs:     []string{netemx.AddressWwwExampleCom},
+			}},
 		},
 	}
 }
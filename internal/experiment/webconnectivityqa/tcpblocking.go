@@ -74,3 +74,35 @@ func tcpBlockingConnectionRefusedWithInconsistentDNS() *TestCase {
 		},
 	}
 }
+
+// tcpBlockingAllEndpointsConnectionRefused verifies that we correctly handle the case
+// where the DNS is consistent and every resolved endpoint refuses the connection.
+func tcpBlockingAllEndpointsConnectionRefused() *TestCase {
+	return &TestCase{
+		Name:  "tcpBlockingAllEndpointsConnectionRefused",
+		Flags: 0,
+		Input: "http://www.example.org/",
+		Configure: func(env *netemx.QAEnv) {
+
+			// make sure we cannot connect to any endpoint of www.example.org
+			for _, port := range []uint16{80, 443} {
+				env.DPIEngine().AddRule(&netem.DPICloseConnectionForServerEndpoint{
+					Logger:          log.Log,
+					ServerIPAddress: netemx.AddressWwwExampleCom,
+					ServerPort:      port,
+				})
+			}
+
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSExperimentFailure:  nil,
+			DNSConsistency:        "consistent",
+			HTTPExperimentFailure: "connection_refused",
+			XStatus:               4224, // StatusAnomalyConnect | StatusExperimentConnect
+			XBlockingFlags:        2,    // analysisFlagTCPIPBlocking
+			Accessible:            false,
+			Blocking:              "tcp_ip",
+		},
+	}
+}
@@ -48,3 +48,24 @@ func TestTCPBlockingConnectionRefusedWithInconsistentDNS(t *testing.T) {
 		}
 	})
 }
+
+func TestTCPBlockingAllEndpointsConnectionRefused(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := tcpBlockingAllEndpointsConnectionRefused()
+	tc.Configure(env)
+
+	env.Do(func() {
+		dialer := netxlite.NewDialerWithResolver(log.Log, netxlite.NewStdlibResolver(log.Log))
+		for _, endpoint := range []string{"www.example.org:80", "www.example.org:443"} {
+			conn, err := dialer.DialContext(context.Background(), "tcp", endpoint)
+			if err == nil || err.Error() != netxlite.FailureConnectionRefused {
+				t.Fatal("unexpected error", err)
+			}
+			if conn != nil {
+				t.Fatal("expected to see nil conn")
+			}
+		}
+	})
+}
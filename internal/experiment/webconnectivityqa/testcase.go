@@ -42,17 +42,31 @@ func AllTestCases() []*TestCase {
 		badSSLWithWrongServerName(),
 		badSSLWithUnknownAuthorityWithInconsistentDNS(),
 
+		bodyReadTimeout(),
+		httpStreamResetAfterRequestHeaders(),
+
+		captivePortalRedirect(),
+
 		controlFailureWithSuccessfulHTTPWebsite(),
 		controlFailureWithSuccessfulHTTPSWebsite(),
+		controlDNSNXDOMAIN(),
+
+		cnameChain(),
 
 		dnsBlockingAndroidDNSCacheNoData(),
 		dnsBlockingNXDOMAIN(),
+		dnsBlockingProbeEncryptedResolvers(),
 
 		dnsHijackingToProxyWithHTTPURL(),
 		dnsHijackingToProxyWithHTTPSURL(),
+		udpDNSHijackDoHClean(),
 
 		httpDiffWithConsistentDNS(),
 		httpDiffWithInconsistentDNS(),
+		statusCodeMismatch(),
+		metaRefreshBlockpage(),
+		bandwidthThrottling(),
+		geoDifferentialContent(),
 
 		redirectWithConsistentDNSAndThenConnectionRefusedForHTTP(),
 		redirectWithConsistentDNSAndThenConnectionRefusedForHTTPS(),
@@ -69,10 +83,22 @@ func AllTestCases() []*TestCase {
 
 		tcpBlockingConnectTimeout(),
 		tcpBlockingConnectionRefusedWithInconsistentDNS(),
+		tcpBlockingAllEndpointsConnectionRefused(),
 
 		tlsBlockingConnectionResetWithConsistentDNS(),
 		tlsBlockingConnectionResetWithInconsistentDNS(),
+		tlsHandshakeStall(),
 
 		websiteDownNXDOMAIN(),
 	}
 }
+
+// TestCaseByName returns the test case with the given name, if any.
+func TestCaseByName(name string) (*TestCase, bool) {
+	for _, tc := range AllTestCases() {
+		if tc.Name == name {
+			return tc, true
+		}
+	}
+	return nil, false
+}
@@ -8,4 +8,38 @@ func TestAllTestCases(t *testing.T) {
 			t.Fatal("expected at least a single test case")
 		}
 	})
+
+	t.Run("test case names are unique", func(t *testing.T) {
+		names := make(map[string]bool)
+		for _, tc := range AllTestCases() {
+			if names[tc.Name] {
+				t.Fatal("duplicate test case name", tc.Name)
+			}
+			names[tc.Name] = true
+		}
+	})
+}
+
+func TestTestCaseByName(t *testing.T) {
+	t.Run("we can find every registered test case", func(t *testing.T) {
+		for _, expect := range AllTestCases() {
+			tc, found := TestCaseByName(expect.Name)
+			if !found {
+				t.Fatal("cannot find", expect.Name)
+			}
+			if tc.Name != expect.Name || tc.Input != expect.Input {
+				t.Fatal("unexpected test case", tc.Name)
+			}
+		}
+	})
+
+	t.Run("we return false for an unknown test case", func(t *testing.T) {
+		tc, found := TestCaseByName("nonexistentTestCase")
+		if found {
+			t.Fatal("expected not to find the test case")
+		}
+		if tc != nil {
+			t.Fatal("expected a nil test case")
+		}
+	})
 }
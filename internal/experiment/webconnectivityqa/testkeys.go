@@ -3,6 +3,9 @@ package webconnectivityqa
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"sort"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -49,6 +52,196 @@ type testKeys struct {
 
 	// Blocking is either nil or a string classifying the blocking type.
 	Blocking any `json:"blocking"`
+
+	// DNSQueries summarizes the DNS queries performed by the probe. We only compare this
+	// field when the expected test keys contain a non-nil value. Note that different
+	// implementations use different resolvers and hence record different queries.
+	DNSQueries []*testKeysDNSQuery `json:"-"`
+
+	// ResolvedASNs maps each IP address resolved by the probe to the ASN the probe
+	// attributed to it. We only compare this field when the expected test keys
+	// contain a non-nil value. Use this field to catch geoip attribution changes.
+	ResolvedASNs map[string]int64 `json:"-"`
+
+	// CNAMEs maps each hostname queried by the probe to the CNAME the probe recorded
+	// for it, such that following the map from the input hostname yields the CNAME
+	// chain. We only compare this field when the expected test keys contain a
+	// non-nil value. Use this field to check that we record CNAMEs.
+	CNAMEs map[string]string `json:"-"`
+
+	// HTTPRedirects contains the sorted Location headers of the HTTP redirects received
+	// by the probe. We only compare this field when the expected test keys contain a
+	// non-nil value. Use this field to check where the probe has been redirected to.
+	HTTPRedirects []string `json:"-"`
+
+	// SlowTLSHandshakes contains the sorted addresses of the TLS handshakes that took at
+	// least slowTLSHandshakeThreshold. We only compare this field when the expected test
+	// keys contain a non-nil value. Use this field to check the effect of throttling.
+	SlowTLSHandshakes []string `json:"-"`
+
+	// SlowHTTPTransfers contains the sorted URLs of the successful HTTP requests that took at
+	// least slowHTTPTransferThreshold after the TLS handshake. We only compare this field when
+	// the expected test keys contain a non-nil value. Use this field to check the effect of
+	// throttling on the transfer of the response body.
+	SlowHTTPTransfers []string `json:"-"`
+}
+
+// testKeysDNSQuery summarizes a DNS query performed by the probe.
+type testKeysDNSQuery struct {
+	// Engine is the resolver engine (e.g., "system", "udp", "doh").
+	Engine string
+
+	// Hostname is the hostname we queried for.
+	Hostname string
+
+	// QueryType is the query type (e.g., "A", "AAAA", "ANY").
+	QueryType string
+
+	// Addrs contains the sorted IPv4 and IPv6 addresses we resolved.
+	Addrs []string
+}
+
+// newTestKeysDNSQueries summarizes the queries inside the raw test keys. We sort the
+// summaries because some implementations perform DNS lookups concurrently.
+func newTestKeysDNSQueries(queries []*model.ArchivalDNSLookupResult) (out []*testKeysDNSQuery) {
+	for _, query := range queries {
+		summary := &testKeysDNSQuery{
+			Engine:    query.Engine,
+			Hostname:  query.Hostname,
+			QueryType: query.QueryType,
+			Addrs:     nil,
+		}
+		for _, answer := range query.Answers {
+			switch answer.AnswerType {
+			case "A":
+				summary.Addrs = append(summary.Addrs, answer.IPv4)
+			case "AAAA":
+				summary.Addrs = append(summary.Addrs, answer.IPv6)
+			}
+		}
+		sort.Strings(summary.Addrs)
+		out = append(out, summary)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		left, right := out[i], out[j]
+		if left.Engine != right.Engine {
+			return left.Engine < right.Engine
+		}
+		if left.Hostname != right.Hostname {
+			return left.Hostname < right.Hostname
+		}
+		return left.QueryType < right.QueryType
+	})
+	return
+}
+
+// newTestKeysResolvedASNs returns the ASN of each address resolved by the probe. This
+// function returns nil when the probe did not resolve any address.
+func newTestKeysResolvedASNs(queries []*model.ArchivalDNSLookupResult) (out map[string]int64) {
+	for _, query := range queries {
+		for _, answer := range query.Answers {
+			var addr string
+			switch answer.AnswerType {
+			case "A":
+				addr = answer.IPv4
+			case "AAAA":
+				addr = answer.IPv6
+			default:
+				continue
+			}
+			if out == nil {
+				out = make(map[string]int64)
+			}
+			out[addr] = answer.ASN
+		}
+	}
+	return
+}
+
+// newTestKeysCNAMEs returns the CNAME recorded for each hostname queried by the
+// probe. This function returns nil when the probe did not record any CNAME.
+func newTestKeysCNAMEs(queries []*model.ArchivalDNSLookupResult) (out map[string]string) {
+	for _, query := range queries {
+		for _, answer := range query.Answers {
+			if answer.AnswerType != "CNAME" {
+				continue
+			}
+			if out == nil {
+				out = make(map[string]string)
+			}
+			out[query.Hostname] = answer.Hostname
+		}
+	}
+	return
+}
+
+// newTestKeysHTTPRedirects returns the sorted Location headers of the HTTP redirects
+// received by the probe. This function returns nil when there are no redirects.
+func newTestKeysHTTPRedirects(requests []*model.ArchivalHTTPRequestResult) (out []string) {
+	for _, request := range requests {
+		if request.Response.Code < 300 || request.Response.Code > 399 {
+			continue
+		}
+		for key, value := range request.Response.Headers {
+			if http.CanonicalHeaderKey(key) == "Location" {
+				out = append(out, string(value))
+			}
+		}
+	}
+	sort.Strings(out)
+	return
+}
+
+// slowTLSHandshakeThreshold is the minimum duration of a slow TLS handshake.
+const slowTLSHandshakeThreshold = 500 * time.Millisecond
+
+// newTestKeysSlowTLSHandshakes returns the sorted addresses of the TLS handshakes that
+// took at least slowTLSHandshakeThreshold. This function returns nil when there are no
+// slow TLS handshakes. Because v0.4 does not set T0, in such a case we measure the
+// time elapsed since the beginning of the measurement, which is fine because the DNS
+// lookup and the TCP connect are fast when there is no throttling.
+func newTestKeysSlowTLSHandshakes(handshakes []*model.ArchivalTLSOrQUICHandshakeResult) (out []string) {
+	for _, handshake := range handshakes {
+		elapsed := time.Duration((handshake.T - handshake.T0) * float64(time.Second))
+		if elapsed >= slowTLSHandshakeThreshold {
+			out = append(out, handshake.Address)
+		}
+	}
+	sort.Strings(out)
+	return
+}
+
+// slowHTTPTransferThreshold is the minimum duration of a slow HTTP transfer.
+const slowHTTPTransferThreshold = 500 * time.Millisecond
+
+// newTestKeysSlowHTTPTransfers returns the sorted URLs of the successful HTTP requests that
+// took at least slowHTTPTransferThreshold since the end of the last TLS handshake that
+// completed before the request. Because v0.4 sets neither the T0 nor the address of the HTTP
+// requests, we cannot pair each request with its handshake in a more precise way. This
+// function returns nil when there are no slow HTTP transfers.
+func newTestKeysSlowHTTPTransfers(handshakes []*model.ArchivalTLSOrQUICHandshakeResult,
+	requests []*model.ArchivalHTTPRequestResult) (out []string) {
+	for _, request := range requests {
+		if request.Failure != nil {
+			continue
+		}
+		var handshakeDone float64
+		var found bool
+		for _, handshake := range handshakes {
+			if handshake.T <= request.T && handshake.T > handshakeDone {
+				handshakeDone, found = handshake.T, true
+			}
+		}
+		if !found {
+			continue
+		}
+		elapsed := time.Duration((request.T - handshakeDone) * float64(time.Second))
+		if elapsed >= slowHTTPTransferThreshold {
+			out = append(out, request.Request.URL)
+		}
+	}
+	sort.Strings(out)
+	return
 }
 
 // newTestKeys constructs the test keys from the measurement.
@@ -57,6 +250,18 @@ func newTestKeys(measurement *model.Measurement) *testKeys {
 	var tk testKeys
 	runtimex.Try0(json.Unmarshal(rawTk, &tk))
 	tk.XExperimentVersion = measurement.TestVersion
+	var raw struct {
+		Queries       []*model.ArchivalDNSLookupResult          `json:"queries"`
+		Requests      []*model.ArchivalHTTPRequestResult        `json:"requests"`
+		TLSHandshakes []*model.ArchivalTLSOrQUICHandshakeResult `json:"tls_handshakes"`
+	}
+	runtimex.Try0(json.Unmarshal(rawTk, &raw))
+	tk.DNSQueries = newTestKeysDNSQueries(raw.Queries)
+	tk.ResolvedASNs = newTestKeysResolvedASNs(raw.Queries)
+	tk.CNAMEs = newTestKeysCNAMEs(raw.Queries)
+	tk.HTTPRedirects = newTestKeysHTTPRedirects(raw.Requests)
+	tk.SlowTLSHandshakes = newTestKeysSlowTLSHandshakes(raw.TLSHandshakes)
+	tk.SlowHTTPTransfers = newTestKeysSlowHTTPTransfers(raw.TLSHandshakes, raw.Requests)
 	return &tk
 }
 
@@ -68,6 +273,36 @@ func compareTestKeys(expected, got *testKeys) error {
 		cmpopts.IgnoreFields(testKeys{}, "XExperimentVersion"),
 	}
 
+	// only compare the DNS queries when we have an expectation
+	if expected.DNSQueries == nil {
+		options = append(options, cmpopts.IgnoreFields(testKeys{}, "DNSQueries"))
+	}
+
+	// only compare the resolved ASNs when we have an expectation
+	if expected.ResolvedASNs == nil {
+		options = append(options, cmpopts.IgnoreFields(testKeys{}, "ResolvedASNs"))
+	}
+
+	// only compare the CNAMEs when we have an expectation
+	if expected.CNAMEs == nil {
+		options = append(options, cmpopts.IgnoreFields(testKeys{}, "CNAMEs"))
+	}
+
+	// only compare the HTTP redirects when we have an expectation
+	if expected.HTTPRedirects == nil {
+		options = append(options, cmpopts.IgnoreFields(testKeys{}, "HTTPRedirects"))
+	}
+
+	// only compare the slow TLS handshakes when we have an expectation
+	if expected.SlowTLSHandshakes == nil {
+		options = append(options, cmpopts.IgnoreFields(testKeys{}, "SlowTLSHandshakes"))
+	}
+
+	// only compare the slow HTTP transfers when we have an expectation
+	if expected.SlowHTTPTransfers == nil {
+		options = append(options, cmpopts.IgnoreFields(testKeys{}, "SlowHTTPTransfers"))
+	}
+
 	switch got.XExperimentVersion {
 	case "0.4.2":
 		// ignore the fields that are specific to LTE
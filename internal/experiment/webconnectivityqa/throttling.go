@@ -0,0 +1,46 @@
+package webconnectivityqa
+
+import (
+	"net"
+
+	"github.com/apex/log"
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-cli/v3/internal/netemx"
+)
+
+// bandwidthThrottling is the case where the censor does not block a website but throttles
+// its traffic by delaying the packets, which makes both the TLS handshake and the transfer
+// of the response body slow.
+func bandwidthThrottling() *TestCase {
+	return &TestCase{
+		Name:  "bandwidthThrottling",
+		Flags: TestCaseFlagNoLTE, // it does not set any HTTP comparison value with HTTPS
+		Input: "https://www.example.org/",
+		Configure: func(env *netemx.QAEnv) {
+
+			// delay the packets of the flows using the www.example.org SNI
+			env.DPIEngine().AddRule(&netem.DPIThrottleTrafficForTLSSNI{
+				Delay:  slowTLSHandshakeThreshold,
+				Logger: log.Log,
+				PLR:    0,
+				SNI:    "www.example.org",
+			})
+
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSConsistency:    "consistent",
+			BodyLengthMatch:   true,
+			BodyProportion:    1,
+			StatusCodeMatch:   true,
+			HeadersMatch:      true,
+			TitleMatch:        true,
+			XStatus:           1,  // StatusSuccessSecure
+			XBlockingFlags:    32, // analysisFlagSuccess
+			Accessible:        true,
+			Blocking:          false,
+			SlowTLSHandshakes: []string{net.JoinHostPort(netemx.AddressWwwExampleCom, "443")},
+			SlowHTTPTransfers: []string{"https://www.example.org/"},
+		},
+	}
+}
@@ -0,0 +1,125 @@
+package webconnectivityqa
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netemx"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestBandwidthThrottling(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := bandwidthThrottling()
+	tc.Configure(env)
+
+	env.Do(func() {
+		// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
+		client := netxlite.NewHTTPClientStdlib(log.Log)
+		req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t0 := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if elapsed := time.Since(t0); elapsed < slowTLSHandshakeThreshold {
+			t.Fatal("expected a slow fetch, got", elapsed)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatal("unexpected status code", resp.StatusCode)
+		}
+	})
+}
+
+func TestNewTestKeysSlowTLSHandshakes(t *testing.T) {
+	t.Run("with no slow TLS handshakes", func(t *testing.T) {
+		handshakes := []*model.ArchivalTLSOrQUICHandshakeResult{{
+			Address: "93.184.216.34:443",
+			T0:      0.1,
+			T:       0.2,
+		}}
+		if got := newTestKeysSlowTLSHandshakes(handshakes); got != nil {
+			t.Fatal("expected nil, got", got)
+		}
+	})
+
+	t.Run("with slow TLS handshakes", func(t *testing.T) {
+		handshakes := []*model.ArchivalTLSOrQUICHandshakeResult{{
+			Address: "104.154.89.105:443",
+			T0:      0.1,
+			T:       1.1,
+		}, {
+			Address: "93.184.216.34:443",
+			T0:      0,
+			T:       0.5,
+		}, {
+			Address: "130.192.91.211:443",
+			T0:      0.1,
+			T:       0.2,
+		}}
+		expect := []string{"104.154.89.105:443", "93.184.216.34:443"}
+		if diff := cmp.Diff(expect, newTestKeysSlowTLSHandshakes(handshakes)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestNewTestKeysSlowHTTPTransfers(t *testing.T) {
+	failure := "connection_reset"
+
+	t.Run("with no slow HTTP transfers", func(t *testing.T) {
+		handshakes := []*model.ArchivalTLSOrQUICHandshakeResult{{
+			Address: "93.184.216.34:443",
+			T:       0.2,
+		}}
+		requests := []*model.ArchivalHTTPRequestResult{{
+			Request: model.ArchivalHTTPRequest{URL: "https://www.example.com/"},
+			T:       0.3,
+		}}
+		if got := newTestKeysSlowHTTPTransfers(handshakes, requests); got != nil {
+			t.Fatal("expected nil, got", got)
+		}
+	})
+
+	t.Run("with slow HTTP transfers", func(t *testing.T) {
+		handshakes := []*model.ArchivalTLSOrQUICHandshakeResult{{
+			Address: "93.184.216.34:443",
+			T:       0.2,
+		}, {
+			Address: "104.154.89.105:443",
+			T:       1.2,
+		}}
+		requests := []*model.ArchivalHTTPRequestResult{{
+			// slow because we measure since the end of the first handshake
+			Request: model.ArchivalHTTPRequest{URL: "https://www.example.com/"},
+			T:       1.1,
+		}, {
+			// fast because we measure since the end of the second handshake
+			Request: model.ArchivalHTTPRequest{URL: "https://badssl.com/"},
+			T:       1.3,
+		}, {
+			// ignored because the request failed
+			Failure: &failure,
+			Request: model.ArchivalHTTPRequest{URL: "https://www.example.org/"},
+			T:       3.0,
+		}, {
+			// ignored because there is no previous TLS handshake
+			Request: model.ArchivalHTTPRequest{URL: "http://www.example.org/"},
+			T:       0.1,
+		}}
+		expect := []string{"https://www.example.com/"}
+		if diff := cmp.Diff(expect, newTestKeysSlowHTTPTransfers(handshakes, requests)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -1,7 +1,10 @@
 package webconnectivityqa
 
 import (
+	"sync"
+
 	"github.com/apex/log"
+	"github.com/google/gopacket/layers"
 	"github.com/ooni/netem"
 	"github.com/ooni/probe-cli/v3/internal/netemx"
 )
@@ -74,3 +77,109 @@ func tlsBlockingConnectionResetWithInconsistentDNS() *TestCase {
 		},
 	}
 }
+
+// dpiStallTLSHandshakeAfterServerHello is a [netem.DPIRule] that lets the TCP handshake,
+// the ClientHello, and the first segment carrying data that the server sends back (i.e.,
+// the one containing the ServerHello) through but drops all the segments that follow, thus
+// stalling the TLS handshake until the client times out. The zero value is invalid; please,
+// fill all the fields marked as MANDATORY.
+type dpiStallTLSHandshakeAfterServerHello struct {
+	// Logger is the MANDATORY logger to use.
+	Logger netem.Logger
+
+	// SNI is the MANDATORY SNI.
+	SNI string
+
+	// flows maps the hash of each flow using SNI to the number of
+	// segments carrying data the server has sent so far.
+	flows map[uint64]int
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+}
+
+var _ netem.DPIRule = &dpiStallTLSHandshakeAfterServerHello{}
+
+// Filter implements netem.DPIRule.
+func (r *dpiStallTLSHandshakeAfterServerHello) Filter(
+	direction netem.DPIDirection, packet *netem.DissectedPacket) (*netem.DPIPolicy, bool) {
+	// short circuit for UDP packets
+	if packet.TransportProtocol() != layers.IPProtocolTCP {
+		return nil, false
+	}
+
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if r.flows == nil {
+		r.flows = make(map[uint64]int)
+	}
+
+	// remember the flows whose ClientHello uses the offending SNI
+	if direction == netem.DPIDirectionClientToServer {
+		if sni, err := netem.ExtractTLSServerName(packet.TCP.Payload); err == nil && sni == r.SNI {
+			r.flows[packet.FlowHash()] = 0
+		}
+		return nil, false
+	}
+
+	// let the segments not carrying data (e.g., SYN|ACK) and the
+	// segments of flows not using the offending SNI through
+	count, found := r.flows[packet.FlowHash()]
+	if !found || len(packet.TCP.Payload) <= 0 {
+		return nil, false
+	}
+
+	// let the first segment carrying data, i.e., the ServerHello, through
+	if r.flows[packet.FlowHash()] = count + 1; count <= 0 {
+		return nil, false
+	}
+
+	r.Logger.Infof(
+		"netem: dpi: stalling flow %s:%d %s:%d/%s after the ServerHello because SNI==%s",
+		packet.SourceIPAddress(),
+		packet.SourcePort(),
+		packet.DestinationIPAddress(),
+		packet.DestinationPort(),
+		packet.TransportProtocol(),
+		r.SNI,
+	)
+
+	// note: the DPI engine remembers the policy for the whole flow, hence we
+	// will also drop the segments the client and the server send later on
+	policy := &netem.DPIPolicy{
+		Delay:   0,
+		Flags:   0,
+		PLR:     1,
+		Spoofed: nil,
+	}
+	return policy, true
+}
+
+// tlsHandshakeStall is the case where a middlebox lets the TLS handshake begin and
+// then stalls it after the ServerHello, such that the TLS handshake times out, which
+// we should classify differently from the case where the middlebox resets the flow.
+func tlsHandshakeStall() *TestCase {
+	return &TestCase{
+		Name:     "tlsHandshakeStall",
+		Flags:    0,
+		Input:    "https://www.example.org/",
+		LongTest: true,
+		Configure: func(env *netemx.QAEnv) {
+
+			env.DPIEngine().AddRule(&dpiStallTLSHandshakeAfterServerHello{
+				Logger: log.Log,
+				SNI:    "www.example.org",
+			})
+
+		},
+		ExpectErr: false,
+		ExpectTestKeys: &testKeys{
+			DNSConsistency:        "consistent",
+			HTTPExperimentFailure: "generic_timeout_error",
+			XStatus:               8704, // StatusExperimentHTTP | StatusAnomalyUnknown
+			XBlockingFlags:        4,    // analysisFlagTLSBlocking
+			Accessible:            false,
+			Blocking:              "http-failure",
+		},
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/netemx"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/runtimex"
 )
 
 func TestBlockingTLSConnectionResetWithConsistentDNS(t *testing.T) {
@@ -96,3 +98,42 @@ func TestBlockingTLSConnectionResetWithInconsistentDNS(t *testing.T) {
 		})
 	})
 }
+
+func TestTLSHandshakeStall(t *testing.T) {
+	env := netemx.MustNewScenario(netemx.InternetScenario)
+	defer env.Close()
+
+	tc := tlsHandshakeStall()
+	tc.Configure(env)
+
+	env.Do(func() {
+		t.Run("the TLS handshake times out for the offending SNI", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
+			client := netxlite.NewHTTPClientStdlib(log.Log)
+			req := runtimex.Try1(http.NewRequestWithContext(ctx, "GET", "https://www.example.org/", nil))
+			resp, err := client.Do(req)
+			if err == nil || err.Error() != netxlite.FailureGenericTimeoutError {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil resp")
+			}
+		})
+
+		t.Run("the TLS handshake succeeds for other SNIs", func(t *testing.T) {
+			// TODO(https://github.com/ooni/probe/issues/2534): NewHTTPClientStdlib has QUIRKS but they're not needed here
+			client := netxlite.NewHTTPClientStdlib(log.Log)
+			req := runtimex.Try1(http.NewRequest("GET", "https://www.example.com/", nil))
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatal("unexpected status code", resp.StatusCode)
+			}
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package measurexlite
+
+//
+// Coalescing consecutive read events
+//
+
+import "github.com/ooni/probe-cli/v3/internal/model"
+
+// emitReadEvent emits the network event of a successful or failed Read. When
+// CoalesceReads is true, we merge consecutive successful reads from the same
+// endpoint and conn into a single pending event, which we emit when we see a failed
+// read, a read from another endpoint or conn, a write, or when draining the network
+// events. We never merge the empty reads we flag because of FlagEmptyReads.
+func (tx *Trace) emitReadEvent(ev *model.ArchivalNetworkEvent) {
+	if !tx.CoalesceReads {
+		tx.emitNetworkEvent(ev)
+		return
+	}
+	defer tx.pendingReadMu.Unlock()
+	tx.pendingReadMu.Lock()
+	pending := tx.pendingRead
+	flagged := tx.isFlaggedEmptyRead(ev)
+	if ev.Failure == nil && !flagged && pending != nil && pending.Address == ev.Address &&
+		pending.Proto == ev.Proto && connIndexOf(pending) == connIndexOf(ev) {
+		pending.NumBytes += ev.NumBytes
+		pending.T = ev.T
+		if tx.RecordCumulativeBytes {
+			// the latest event has the up-to-date total but the pending event has the offset
+			pending.Tags = withStreamOffsetTagOf(ev.Tags, pending.Tags)
+		}
+		return
+	}
+	if pending != nil {
+		tx.emitNetworkEvent(pending)
+	}
+	tx.pendingRead = nil
+	if ev.Failure != nil || flagged {
+		tx.emitNetworkEvent(ev)
+		return
+	}
+	tx.pendingRead = ev
+}
+
+// flushPendingRead emits the pending coalesced read event, if any.
+func (tx *Trace) flushPendingRead() {
+	if !tx.CoalesceReads {
+		return
+	}
+	defer tx.pendingReadMu.Unlock()
+	tx.pendingReadMu.Lock()
+	if tx.pendingRead != nil {
+		tx.emitNetworkEvent(tx.pendingRead)
+		tx.pendingRead = nil
+	}
+}
+
+// emitNetworkEvent emits the given network event unless the buffer is full.
+func (tx *Trace) emitNetworkEvent(ev *model.ArchivalNetworkEvent) {
+	select {
+	case tx.networkEvent <- ev:
+	default: // buffer is full
+	}
+}
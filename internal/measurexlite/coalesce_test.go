@@ -0,0 +1,225 @@
+package measurexlite
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/testingx"
+)
+
+func TestCoalesceReads(t *testing.T) {
+	// newConn creates a conn whose reads return bufsiz bytes unless readErr
+	// is not nil and whose remote address is the one in the *address string.
+	newConn := func(address *string, readErr *error) *mocks.Conn {
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				if *readErr != nil {
+					return 0, *readErr
+				}
+				return len(b), nil
+			},
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return &mocks.Addr{
+					MockNetwork: func() string {
+						return "tcp"
+					},
+					MockString: func() string {
+						return *address
+					},
+				}
+			},
+		}
+	}
+
+	// newTrace creates a trace with deterministic timing where each call
+	// to the TimeNow method advances the clock by one second.
+	newTrace := func(coalesce bool) *Trace {
+		zeroTime := time.Now()
+		td := testingx.NewTimeDeterministic(zeroTime)
+		trace := NewTrace(0, zeroTime)
+		trace.timeNowFn = td.Now
+		trace.CoalesceReads = coalesce
+		return trace
+	}
+
+	const bufsiz = 128
+
+	const numReads = 16
+
+	t.Run("we merge consecutive successful reads", func(t *testing.T) {
+		address := "1.1.1.1:443"
+		var readErr error
+		trace := newTrace(true)
+		conn := trace.MaybeWrapNetConn(newConn(&address, &readErr))
+		buffer := make([]byte, bufsiz)
+		for idx := 0; idx < numReads; idx++ {
+			if _, err := conn.Read(buffer); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expect := []*model.ArchivalNetworkEvent{{
+			Address:   "1.1.1.1:443",
+			Failure:   nil,
+			NumBytes:  bufsiz * numReads,
+			Operation: netxlite.ReadOperation,
+			Proto:     "tcp",
+			T0:        0,
+			T:         2*numReads - 1,
+			Tags:      []string{},
+		}}
+		if diff := cmp.Diff(expect, trace.NetworkEvents()); diff != "" {
+			t.Fatal(diff)
+		}
+
+		t.Run("we still count all the bytes received", func(t *testing.T) {
+			stats := trace.CloneBytesReceivedMap()
+			if stats["1.1.1.1:443 tcp"] != bufsiz*numReads {
+				t.Fatal("unexpected number of bytes received")
+			}
+		})
+	})
+
+	t.Run("we flush the pending read when a read fails", func(t *testing.T) {
+		address := "1.1.1.1:443"
+		var readErr error
+		trace := newTrace(true)
+		conn := trace.MaybeWrapNetConn(newConn(&address, &readErr))
+		buffer := make([]byte, bufsiz)
+		for idx := 0; idx < numReads; idx++ {
+			if _, err := conn.Read(buffer); err != nil {
+				t.Fatal(err)
+			}
+		}
+		readErr = netxlite.ECONNRESET
+		if _, err := conn.Read(buffer); !errors.Is(err, netxlite.ECONNRESET) {
+			t.Fatal("unexpected err", err)
+		}
+
+		failure := netxlite.FailureConnectionReset
+		expect := []*model.ArchivalNetworkEvent{{
+			Address:   "1.1.1.1:443",
+			Failure:   nil,
+			NumBytes:  bufsiz * numReads,
+			Operation: netxlite.ReadOperation,
+			Proto:     "tcp",
+			T0:        0,
+			T:         2*numReads - 1,
+			Tags:      []string{},
+		}, {
+			Address:   "1.1.1.1:443",
+			Failure:   &failure,
+			NumBytes:  0,
+			Operation: netxlite.ReadOperation,
+			Proto:     "tcp",
+			T0:        2 * numReads,
+			T:         2*numReads + 1,
+			Tags:      []string{},
+		}}
+		if diff := cmp.Diff(expect, trace.NetworkEvents()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we flush the pending read when the endpoint changes", func(t *testing.T) {
+		address := "1.1.1.1:443"
+		var readErr error
+		trace := newTrace(true)
+		conn := trace.MaybeWrapNetConn(newConn(&address, &readErr))
+		buffer := make([]byte, bufsiz)
+		for idx := 0; idx < 2*numReads; idx++ {
+			if idx == numReads {
+				address = "8.8.8.8:443"
+			}
+			if _, err := conn.Read(buffer); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expect := []*model.ArchivalNetworkEvent{{
+			Address:   "1.1.1.1:443",
+			Failure:   nil,
+			NumBytes:  bufsiz * numReads,
+			Operation: netxlite.ReadOperation,
+			Proto:     "tcp",
+			T0:        0,
+			T:         2*numReads - 1,
+			Tags:      []string{},
+		}, {
+			Address:   "8.8.8.8:443",
+			Failure:   nil,
+			NumBytes:  bufsiz * numReads,
+			Operation: netxlite.ReadOperation,
+			Proto:     "tcp",
+			T0:        2 * numReads,
+			T:         4*numReads - 1,
+			Tags:      []string{},
+		}}
+		if diff := cmp.Diff(expect, trace.NetworkEvents()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we flush the pending read before a write", func(t *testing.T) {
+		address := "1.1.1.1:443"
+		var readErr error
+		trace := newTrace(true)
+		conn := trace.MaybeWrapNetConn(newConn(&address, &readErr))
+		buffer := make([]byte, bufsiz)
+		for idx := 0; idx < numReads; idx++ {
+			if _, err := conn.Read(buffer); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := conn.Write(buffer); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Read(buffer); err != nil {
+			t.Fatal(err)
+		}
+
+		events := trace.NetworkEvents()
+		var got []string
+		for _, ev := range events {
+			got = append(got, ev.Operation)
+		}
+		expect := []string{netxlite.ReadOperation, netxlite.WriteOperation, netxlite.ReadOperation}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+		if events[0].NumBytes != bufsiz*numReads {
+			t.Fatal("unexpected number of bytes for the first read event")
+		}
+	})
+
+	t.Run("by default we emit an event for each read", func(t *testing.T) {
+		address := "1.1.1.1:443"
+		var readErr error
+		trace := newTrace(false)
+		conn := trace.MaybeWrapNetConn(newConn(&address, &readErr))
+		buffer := make([]byte, bufsiz)
+		for idx := 0; idx < numReads; idx++ {
+			if _, err := conn.Read(buffer); err != nil {
+				t.Fatal(err)
+			}
+		}
+		events := trace.NetworkEvents()
+		if len(events) != numReads {
+			t.Fatal("expected", numReads, "events, got", len(events))
+		}
+		for _, ev := range events {
+			if ev.NumBytes != bufsiz {
+				t.Fatal("unexpected number of bytes", ev.NumBytes)
+			}
+		}
+	})
+}
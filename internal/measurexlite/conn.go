@@ -7,6 +7,7 @@ package measurexlite
 import (
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -24,17 +25,48 @@ func MaybeClose(conn net.Conn) (err error) {
 // MaybeWrapNetConn implements model.Trace.MaybeWrapNetConn.
 func (tx *Trace) MaybeWrapNetConn(conn net.Conn) net.Conn {
 	return &connTrace{
-		Conn: conn,
-		tx:   tx,
+		Conn:  conn,
+		tx:    tx,
+		extra: append(tx.connIndexTags(), tx.interfaceTags(conn)...),
 	}
 }
 
+// WrapEstablishedConn is like [*Trace.MaybeWrapNetConn] but is meant for an already
+// established connection (e.g., a connection obtained from a custom tunnel). Before
+// wrapping the conn, this method emits a synthetic connect network event, which we
+// backdate by connectDuration, such that the archival data reflects that the conn existed
+// before the subsequent I/O events. Use a zero connectDuration if you do not know
+// how much time it took to establish the connection.
+func (tx *Trace) WrapEstablishedConn(conn net.Conn, connectDuration time.Duration) net.Conn {
+	finished := tx.TimeSince(tx.ZeroTime)
+	started := finished - connectDuration
+	if started < 0 {
+		started = 0 // do not emit events occurring before the beginning of the measurement
+	}
+	select {
+	case tx.networkEvent <- NewArchivalNetworkEvent(
+		tx.Index, started, netxlite.ConnectOperation, conn.RemoteAddr().Network(),
+		conn.RemoteAddr().String(), 0, nil, finished, tx.currentTags()...):
+	default: // buffer is full
+	}
+	return tx.MaybeWrapNetConn(conn)
+}
+
 // connTrace is a trace-aware net.Conn.
 type connTrace struct {
 	// Implementation note: it seems safe to use embedding here because net.Conn
 	// is an interface from the standard library that we don't control
 	net.Conn
 	tx *Trace
+
+	// extra contains OPTIONAL extra tags for this conn's events.
+	extra []string
+
+	// sampler decides which events to emit when SampleEveryN is set.
+	sampler eventSampler
+
+	// offsets tracks the stream offsets when RecordStreamOffsets is set.
+	offsets streamOffsets
 }
 
 var _ net.Conn = &connTrace{}
@@ -49,24 +81,28 @@ func (c *connTrace) Read(b []byte) (int, error) {
 	// perform the underlying network operation
 	count, err := c.Conn.Read(b)
 
-	// emit the network event
+	// update per receiver statistics
 	finished := c.tx.TimeSince(c.tx.ZeroTime)
-	select {
-	case c.tx.networkEvent <- NewArchivalNetworkEvent(
+	total := c.tx.updateBytesReceivedMapNetConn(network, addr, count)
+	offset := c.offsets.advanceRead(count)
+
+	// emit the network event
+	c.tx.summary.onNetworkEvent(netxlite.ReadOperation, count, err, started, finished)
+	ev := NewArchivalNetworkEvent(
 		c.tx.Index, started, netxlite.ReadOperation, network, addr, count,
-		err, finished, c.tx.tags...):
-	default: // buffer is full
+		err, finished, c.tx.tagsWithExtra(c.tx.withEmptyReadTag(c.tx.withStreamOffsetTag(
+			c.tx.withCumulativeBytesTag(c.extra, total), offset), count, err))...)
+	if c.tx.CoalesceReads || c.tx.sampleNetworkEvent(&c.sampler, ev) {
+		c.tx.emitReadEvent(ev)
 	}
 
-	// update per receiver statistics
-	c.tx.updateBytesReceivedMapNetConn(network, addr, count)
-
 	// return to the caller
 	return count, err
 }
 
-// updateBytesReceivedMapNetConn updates the [*Trace] bytes received map for a [net.Conn].
-func (tx *Trace) updateBytesReceivedMapNetConn(network, address string, count int) {
+// updateBytesReceivedMapNetConn updates the [*Trace] bytes received map for a [net.Conn]
+// and returns the total number of bytes received from the given endpoint.
+func (tx *Trace) updateBytesReceivedMapNetConn(network, address string, count int) int64 {
 	// normalize the network name
 	switch network {
 	case "udp", "udp4", "udp6":
@@ -79,9 +115,10 @@ func (tx *Trace) updateBytesReceivedMapNetConn(network, address string, count in
 	key := fmt.Sprintf("%s %s", address, network)
 
 	// lock and insert into the map
+	defer tx.bytesReceivedMu.Unlock()
 	tx.bytesReceivedMu.Lock()
 	tx.bytesReceivedMap[key] += int64(count)
-	tx.bytesReceivedMu.Unlock()
+	return tx.bytesReceivedMap[key]
 }
 
 // CloneBytesReceivedMap returns a clone of the internal bytes received map. The key
@@ -97,6 +134,26 @@ func (tx *Trace) CloneBytesReceivedMap() (out map[string]int64) {
 	return
 }
 
+// DiffBytesReceivedMaps returns the per-key difference between two snapshots of the
+// bytes received map obtained using [*Trace.CloneBytesReceivedMap]. For each key, the
+// returned value is the after value minus the before value, where a missing key counts
+// as zero, such that keys that disappeared have a negative value. The returned map
+// omits the keys whose difference is zero. Both arguments MAY be nil.
+func DiffBytesReceivedMaps(before, after map[string]int64) (out map[string]int64) {
+	out = make(map[string]int64)
+	for key, value := range after {
+		if delta := value - before[key]; delta != 0 {
+			out[key] = delta
+		}
+	}
+	for key, value := range before {
+		if _, found := after[key]; !found && value != 0 {
+			out[key] = -value
+		}
+	}
+	return
+}
+
 // Write implements net.Conn.Write and saves network events.
 func (c *connTrace) Write(b []byte) (int, error) {
 	network := c.RemoteAddr().Network()
@@ -106,16 +163,28 @@ func (c *connTrace) Write(b []byte) (int, error) {
 	count, err := c.Conn.Write(b)
 
 	finished := c.tx.TimeSince(c.tx.ZeroTime)
-	select {
-	case c.tx.networkEvent <- NewArchivalNetworkEvent(
+	offset := c.offsets.advanceWrite(count)
+	c.tx.summary.onNetworkEvent(netxlite.WriteOperation, count, err, started, finished)
+	c.tx.flushPendingRead() // a write interrupts consecutive reads
+	ev := NewArchivalNetworkEvent(
 		c.tx.Index, started, netxlite.WriteOperation, network, addr, count,
-		err, finished, c.tx.tags...):
-	default: // buffer is full
+		err, finished, c.tx.tagsWithExtra(c.tx.withStreamOffsetTag(c.extra, offset))...)
+	if c.tx.sampleNetworkEvent(&c.sampler, ev) {
+		select {
+		case c.tx.networkEvent <- ev:
+		default: // buffer is full
+		}
 	}
 
 	return count, err
 }
 
+// Close implements net.Conn.Close and emits the last sampled out network event, if any.
+func (c *connTrace) Close() error {
+	c.tx.flushSampledNetworkEvents(&c.sampler)
+	return c.Conn.Close()
+}
+
 // MaybeCloseUDPLikeConn is a convenience function for closing a [model.UDPLikeConn] when it is not nil.
 func MaybeCloseUDPLikeConn(conn model.UDPLikeConn) (err error) {
 	if conn != nil {
@@ -129,6 +198,7 @@ func (tx *Trace) MaybeWrapUDPLikeConn(conn model.UDPLikeConn) model.UDPLikeConn
 	return &udpLikeConnTrace{
 		UDPLikeConn: conn,
 		tx:          tx,
+		extra:       tx.connIndexTags(),
 	}
 }
 
@@ -138,6 +208,20 @@ type udpLikeConnTrace struct {
 	// contains fields deriving from how quic-go/quic-go uses the standard library
 	model.UDPLikeConn
 	tx *Trace
+
+	// extra contains OPTIONAL extra tags for this conn's events.
+	extra []string
+
+	// connIDTag is the OPTIONAL QUIC connection ID tag set using
+	// [*Trace.SetQUICConnectionID]. Accessing this field requires
+	// one to hold the connIDMu mutex.
+	connIDTag string
+
+	// connIDMu protects connIDTag from concurrent access.
+	connIDMu sync.Mutex
+
+	// sampler decides which events to emit when SampleEveryN is set.
+	sampler eventSampler
 }
 
 // Read implements model.UDPLikeConn.ReadFrom and saves network events.
@@ -148,30 +232,41 @@ func (c *udpLikeConnTrace) ReadFrom(b []byte) (int, net.Addr, error) {
 	// perform the network operation
 	count, addr, err := c.UDPLikeConn.ReadFrom(b)
 
-	// emit the network event
+	// possibly collect a download speed sample
 	finished := c.tx.TimeSince(c.tx.ZeroTime)
+	total, found := c.tx.maybeUpdateBytesReceivedMapUDPLikeConn(addr, count)
+
+	// emit the network event
+	c.tx.summary.onNetworkEvent(netxlite.ReadFromOperation, count, err, started, finished)
 	address := addrStringIfNotNil(addr)
-	select {
-	case c.tx.networkEvent <- NewArchivalNetworkEvent(
+	extra := c.extraTags()
+	if found {
+		extra = c.tx.withCumulativeBytesTag(extra, total)
+	}
+	extra = c.tx.withEmptyReadTag(extra, count, err)
+	ev := NewArchivalNetworkEvent(
 		c.tx.Index, started, netxlite.ReadFromOperation, "udp", address, count,
-		err, finished, c.tx.tags...):
-	default: // buffer is full
+		err, finished, c.tx.tagsWithExtra(extra)...)
+	if c.tx.sampleNetworkEvent(&c.sampler, ev) {
+		select {
+		case c.tx.networkEvent <- ev:
+		default: // buffer is full
+		}
 	}
 
-	// possibly collect a download speed sample
-	c.tx.maybeUpdateBytesReceivedMapUDPLikeConn(addr, count)
-
 	// return results to the caller
 	return count, addr, err
 }
 
-// maybeUpdateBytesReceivedMapUDPLikeConn updates the [*Trace] bytes received map for a [model.UDPLikeConn].
-func (tx *Trace) maybeUpdateBytesReceivedMapUDPLikeConn(addr net.Addr, count int) {
+// maybeUpdateBytesReceivedMapUDPLikeConn updates the [*Trace] bytes received map for a [model.UDPLikeConn]
+// and returns the total number of bytes received from addr and whether we updated the map.
+func (tx *Trace) maybeUpdateBytesReceivedMapUDPLikeConn(addr net.Addr, count int) (int64, bool) {
 	// Implementation note: the address may be nil if the operation failed given that we don't
 	// have a fixed peer address for UDP connections
 	if addr != nil {
-		tx.updateBytesReceivedMapNetConn(addr.Network(), addr.String(), count)
+		return tx.updateBytesReceivedMapNetConn(addr.Network(), addr.String(), count), true
 	}
+	return 0, false
 }
 
 // Write implements model.UDPLikeConn.WriteTo and saves network events.
@@ -182,16 +277,26 @@ func (c *udpLikeConnTrace) WriteTo(b []byte, addr net.Addr) (int, error) {
 	count, err := c.UDPLikeConn.WriteTo(b, addr)
 
 	finished := c.tx.TimeSince(c.tx.ZeroTime)
-	select {
-	case c.tx.networkEvent <- NewArchivalNetworkEvent(
+	c.tx.summary.onNetworkEvent(netxlite.WriteToOperation, count, err, started, finished)
+	ev := NewArchivalNetworkEvent(
 		c.tx.Index, started, netxlite.WriteToOperation, "udp", address, count,
-		err, finished, c.tx.tags...):
-	default: // buffer is full
+		err, finished, c.tx.tagsWithExtra(c.extraTags())...)
+	if c.tx.sampleNetworkEvent(&c.sampler, ev) {
+		select {
+		case c.tx.networkEvent <- ev:
+		default: // buffer is full
+		}
 	}
 
 	return count, err
 }
 
+// Close implements model.UDPLikeConn.Close and emits the last sampled out network event, if any.
+func (c *udpLikeConnTrace) Close() error {
+	c.tx.flushSampledNetworkEvents(&c.sampler)
+	return c.UDPLikeConn.Close()
+}
+
 // addrStringIfNotNil returns the string of the given addr
 // unless the addr is nil, in which case it returns an empty string.
 func addrStringIfNotNil(addr net.Addr) (out string) {
@@ -225,8 +330,17 @@ func NewAnnotationArchivalNetworkEvent(
 	return NewArchivalNetworkEvent(index, time, operation, "", "", 0, nil, time, tags...)
 }
 
+// NewFailureAnnotationArchivalNetworkEvent is like NewAnnotationArchivalNetworkEvent
+// but the annotation also carries the failure corresponding to the given error, which
+// is useful to record errors (e.g., EPERM) occurred outside of the conn wrappers.
+func NewFailureAnnotationArchivalNetworkEvent(
+	index int64, time time.Duration, operation string, err error, tags ...string) *model.ArchivalNetworkEvent {
+	return NewArchivalNetworkEvent(index, time, operation, "", "", 0, err, time, tags...)
+}
+
 // NetworkEvents drains the network events buffered inside the NetworkEvent channel.
 func (tx *Trace) NetworkEvents() (out []*model.ArchivalNetworkEvent) {
+	tx.flushPendingRead()
 	for {
 		select {
 		case ev := <-tx.networkEvent:
@@ -247,6 +361,25 @@ func (tx *Trace) FirstNetworkEventOrNil() *model.ArchivalNetworkEvent {
 	return ev[0]
 }
 
+// FirstFailure drains the network events buffered inside the NetworkEvents channel
+// and returns the earliest event (i.e., the one with the smallest T0) whose Failure
+// is not nil, along with true. When several failed events have the same T0, we return
+// the one that was emitted first. If no event failed, it returns nil and false. Note
+// that this method discards all the other events, so you should call NetworkEvents
+// and scan the events yourself if you also need them.
+func (tx *Trace) FirstFailure() (*model.ArchivalNetworkEvent, bool) {
+	var first *model.ArchivalNetworkEvent
+	for _, ev := range tx.NetworkEvents() {
+		if ev.Failure == nil {
+			continue
+		}
+		if first == nil || ev.T0 < first.T0 {
+			first = ev
+		}
+	}
+	return first, first != nil
+}
+
 // copyAndNormalizeTags ensures that we map nil tags to []string
 // and that we return a copy of the tags.
 func copyAndNormalizeTags(tags []string) []string {
@@ -1,6 +1,7 @@
 package measurexlite
 
 import (
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -481,6 +482,71 @@ func TestFirstNetworkEvent(t *testing.T) {
 	})
 }
 
+func TestFirstFailure(t *testing.T) {
+	failure := func(s string) *string {
+		return &s
+	}
+
+	t.Run("returns nil and false when buffer is empty", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		got, found := trace.FirstFailure()
+		if found || got != nil {
+			t.Fatal("expected nil event and false")
+		}
+	})
+
+	t.Run("returns nil and false when no event failed", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.networkEvent <- &model.ArchivalNetworkEvent{Operation: "read", T0: 1.0, T: 1.1}
+		trace.networkEvent <- &model.ArchivalNetworkEvent{Operation: "write", T0: 1.2, T: 1.3}
+		got, found := trace.FirstFailure()
+		if found || got != nil {
+			t.Fatal("expected nil event and false")
+		}
+	})
+
+	t.Run("returns the earliest failed event and drains the buffer", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		events := []*model.ArchivalNetworkEvent{{
+			Operation: "write",
+			T0:        1.0,
+			T:         1.1,
+		}, {
+			Failure:   failure(netxlite.FailureConnectionReset),
+			Operation: "read",
+			T0:        1.5,
+			T:         1.6,
+		}, {
+			Failure:   failure(netxlite.FailureGenericTimeoutError),
+			Operation: "read",
+			T0:        1.2,
+			T:         1.7,
+		}, {
+			Failure:   failure(netxlite.FailureEOFError),
+			Operation: "read",
+			T0:        1.2,
+			T:         1.8,
+		}, {
+			Operation: "close",
+			T0:        1.9,
+			T:         1.9,
+		}}
+		for _, ev := range events {
+			trace.networkEvent <- ev
+		}
+		got, found := trace.FirstFailure()
+		if !found {
+			t.Fatal("expected to find a failed event")
+		}
+		if diff := cmp.Diff(events[2], got); diff != "" {
+			t.Fatal(diff)
+		}
+		if evs := trace.NetworkEvents(); len(evs) != 0 {
+			t.Fatal("expected the buffer to be drained", len(evs))
+		}
+	})
+}
+
 func TestNewAnnotationArchivalNetworkEvent(t *testing.T) {
 	var (
 		index     int64 = 3
@@ -506,6 +572,33 @@ func TestNewAnnotationArchivalNetworkEvent(t *testing.T) {
 	}
 }
 
+func TestNewFailureAnnotationArchivalNetworkEvent(t *testing.T) {
+	var (
+		index     int64 = 3
+		duration        = 250 * time.Millisecond
+		operation       = "socket"
+		err             = fmt.Errorf("socket: %w", netxlite.ENETUNREACH)
+	)
+	failure := netxlite.FailureNetworkUnreachable
+	expect := &model.ArchivalNetworkEvent{
+		Address:       "",
+		Failure:       &failure,
+		NumBytes:      0,
+		Operation:     operation,
+		Proto:         "",
+		T0:            duration.Seconds(),
+		T:             duration.Seconds(),
+		TransactionID: index,
+		Tags:          []string{"antani"},
+	}
+	got := NewFailureAnnotationArchivalNetworkEvent(
+		index, duration, operation, err, "antani",
+	)
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func TestTrace_updateBytesReceivedMapNetConn(t *testing.T) {
 	t.Run("we handle tcp4, tcp6, udp4 and udp6 like they were tcp and udp", func(t *testing.T) {
 		// create a new trace
@@ -566,3 +659,149 @@ func TestTrace_maybeUpdateBytesReceivedMapUDPLikeConn(t *testing.T) {
 		}
 	})
 }
+
+func TestDiffBytesReceivedMaps(t *testing.T) {
+	type testcase struct {
+		name   string
+		before map[string]int64
+		after  map[string]int64
+		expect map[string]int64
+	}
+
+	cases := []testcase{{
+		name:   "with nil maps",
+		before: nil,
+		after:  nil,
+		expect: map[string]int64{},
+	}, {
+		name:   "with keys added between snapshots",
+		before: nil,
+		after: map[string]int64{
+			"1.1.1.1:443 tcp": 1024,
+			"8.8.8.8:443 udp": 0,
+		},
+		expect: map[string]int64{
+			"1.1.1.1:443 tcp": 1024,
+		},
+	}, {
+		name: "with keys removed between snapshots",
+		before: map[string]int64{
+			"1.1.1.1:443 tcp": 1024,
+			"8.8.8.8:443 udp": 0,
+		},
+		after: map[string]int64{},
+		expect: map[string]int64{
+			"1.1.1.1:443 tcp": -1024,
+		},
+	}, {
+		name: "with keys changed and unchanged between snapshots",
+		before: map[string]int64{
+			"1.1.1.1:443 tcp": 1024,
+			"8.8.8.8:443 udp": 512,
+		},
+		after: map[string]int64{
+			"1.1.1.1:443 tcp": 4096,
+			"8.8.8.8:443 udp": 512,
+			"9.9.9.9:53 udp":  128,
+		},
+		expect: map[string]int64{
+			"1.1.1.1:443 tcp": 3072,
+			"9.9.9.9:53 udp":  128,
+		},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := DiffBytesReceivedMaps(tc.before, tc.after)
+			if diff := cmp.Diff(tc.expect, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestWrapEstablishedConn(t *testing.T) {
+	newConn := func() net.Conn {
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return &mocks.Addr{
+					MockNetwork: func() string {
+						return "tcp"
+					},
+					MockString: func() string {
+						return "1.1.1.1:443"
+					},
+				}
+			},
+		}
+	}
+
+	t.Run("the connect event precedes the I/O events", func(t *testing.T) {
+		zeroTime := time.Now()
+		td := testingx.NewTimeDeterministic(zeroTime)
+		trace := NewTrace(0, zeroTime, "antani")
+		trace.timeNowFn = td.Now // deterministic time counting
+		td.Now()                 // make sure some time has elapsed since the zero time
+		td.Now()
+
+		conn := trace.WrapEstablishedConn(newConn(), 500*time.Millisecond)
+		if conn.(*connTrace).tx != trace {
+			t.Fatal("invalid trace")
+		}
+		buffer := make([]byte, 128)
+		conn.Write(buffer)
+		conn.Read(buffer)
+
+		events := trace.NetworkEvents()
+		expectOperations := []string{
+			netxlite.ConnectOperation,
+			netxlite.WriteOperation,
+			netxlite.ReadOperation,
+		}
+		if len(events) != len(expectOperations) {
+			t.Fatal("unexpected number of events", len(events))
+		}
+		for idx, ev := range events {
+			if ev.Operation != expectOperations[idx] {
+				t.Fatal("unexpected operation", idx, ev.Operation)
+			}
+			if idx > 0 && ev.T0 < events[idx-1].T {
+				t.Fatal("events are not ordered", idx)
+			}
+		}
+		expect := &model.ArchivalNetworkEvent{
+			Address:   "1.1.1.1:443",
+			Failure:   nil,
+			NumBytes:  0,
+			Operation: netxlite.ConnectOperation,
+			Proto:     "tcp",
+			T0:        1.5,
+			T:         2,
+			Tags:      []string{"antani"},
+		}
+		if diff := cmp.Diff(expect, events[0]); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we do not backdate before the zero time", func(t *testing.T) {
+		zeroTime := time.Now()
+		td := testingx.NewTimeDeterministic(zeroTime)
+		trace := NewTrace(0, zeroTime)
+		trace.timeNowFn = td.Now // deterministic time counting
+		trace.WrapEstablishedConn(newConn(), time.Hour)
+		events := trace.NetworkEvents()
+		if len(events) != 1 {
+			t.Fatal("expected a single event")
+		}
+		if events[0].T0 != 0 {
+			t.Fatal("unexpected T0", events[0].T0)
+		}
+	})
+}
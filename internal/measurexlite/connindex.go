@@ -0,0 +1,55 @@
+package measurexlite
+
+//
+// Correlating network events with the conn that produced them
+//
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// connIndexTagPrefix is the prefix of the tag containing the conn index.
+const connIndexTagPrefix = "conn_index="
+
+// connIndexTags returns the tags to add to the network events of a conn
+// we are wrapping, which contain the conn index when RecordConnIndex is true.
+func (tx *Trace) connIndexTags() []string {
+	if !tx.RecordConnIndex {
+		return nil
+	}
+	return []string{connIndexTagPrefix + strconv.FormatInt(tx.connIndex.Add(1), 10)}
+}
+
+// connIndexOf returns the conn index inside the tags of the given event
+// or zero when the event does not contain a valid conn index tag.
+func connIndexOf(ev *model.ArchivalNetworkEvent) int64 {
+	for _, tag := range ev.Tags {
+		if value, found := strings.CutPrefix(tag, connIndexTagPrefix); found {
+			index, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0
+			}
+			return index
+		}
+	}
+	return 0
+}
+
+// EventsByConn drains the network events buffered inside the NetworkEvents channel
+// and groups them by conn index, preserving their order within each conn. When
+// RecordConnIndex is true, the conn indexes are positive integers identifying the
+// conns we wrapped, in the order in which we wrapped them, which allows one to tell
+// apart conns using the same endpoint. We group the events without a conn index
+// (e.g., annotations or the events emitted when RecordConnIndex is false) using
+// the zero index. This function returns an empty map if there are no events.
+func (tx *Trace) EventsByConn() map[int64][]*model.ArchivalNetworkEvent {
+	out := make(map[int64][]*model.ArchivalNetworkEvent)
+	for _, ev := range tx.NetworkEvents() {
+		index := connIndexOf(ev)
+		out[index] = append(out[index], ev)
+	}
+	return out
+}
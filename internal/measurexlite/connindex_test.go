@@ -0,0 +1,153 @@
+package measurexlite
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestEventsByConn(t *testing.T) {
+	// newConn returns a conn to 1.1.1.1:443 whose reads and writes return count bytes
+	newConn := func(count int) *mocks.Conn {
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				return count, nil
+			},
+			MockWrite: func(b []byte) (int, error) {
+				return count, nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return &mocks.Addr{
+					MockString: func() string {
+						return "1.1.1.1:443"
+					},
+					MockNetwork: func() string {
+						return "tcp"
+					},
+				}
+			},
+		}
+	}
+
+	// summarize returns the operation, the number of bytes, and the tags of each event
+	type summary struct {
+		Operation string
+		NumBytes  int64
+		Tags      []string
+	}
+	summarize := func(events []*model.ArchivalNetworkEvent) (out []summary) {
+		for _, ev := range events {
+			out = append(out, summary{ev.Operation, ev.NumBytes, ev.Tags})
+		}
+		return
+	}
+
+	t.Run("we group the events of conns using the same endpoint", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordConnIndex = true
+		first := trace.MaybeWrapNetConn(newConn(4))
+		second := trace.MaybeWrapNetConn(newConn(8))
+		first.Write(make([]byte, 4))
+		second.Write(make([]byte, 8))
+		second.Read(make([]byte, 8))
+		first.Read(make([]byte, 4))
+
+		got := make(map[int64][]summary)
+		for index, events := range trace.EventsByConn() {
+			got[index] = summarize(events)
+		}
+		expect := map[int64][]summary{
+			1: {
+				{"write", 4, []string{"conn_index=1"}},
+				{"read", 4, []string{"conn_index=1"}},
+			},
+			2: {
+				{"write", 8, []string{"conn_index=2"}},
+				{"read", 8, []string{"conn_index=2"}},
+			},
+		}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("by default we group all the events using the zero index", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		first := trace.MaybeWrapNetConn(newConn(4))
+		second := trace.MaybeWrapNetConn(newConn(8))
+		first.Read(make([]byte, 4))
+		second.Read(make([]byte, 8))
+
+		got := trace.EventsByConn()
+		if len(got) != 1 || len(got[0]) != 2 {
+			t.Fatal("unexpected events", got)
+		}
+		for _, ev := range got[0] {
+			if len(ev.Tags) != 0 {
+				t.Fatal("unexpected tags", ev.Tags)
+			}
+		}
+	})
+
+	t.Run("we do not coalesce reads of distinct conns using the same endpoint", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordConnIndex = true
+		trace.CoalesceReads = true
+		first := trace.MaybeWrapNetConn(newConn(4))
+		second := trace.MaybeWrapNetConn(newConn(8))
+		first.Read(make([]byte, 4))
+		first.Read(make([]byte, 4))
+		second.Read(make([]byte, 8))
+
+		got := make(map[int64][]summary)
+		for index, events := range trace.EventsByConn() {
+			got[index] = summarize(events)
+		}
+		expect := map[int64][]summary{
+			1: {{"read", 8, []string{"conn_index=1"}}},
+			2: {{"read", 8, []string{"conn_index=2"}}},
+		}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we index UDP-like conns", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordConnIndex = true
+		trace.MaybeWrapNetConn(newConn(4)).Read(make([]byte, 4))
+		udpConn := trace.MaybeWrapUDPLikeConn(&mocks.UDPLikeConn{
+			MockWriteTo: func(p []byte, addr net.Addr) (int, error) {
+				return len(p), nil
+			},
+		})
+		udpConn.WriteTo(make([]byte, 16), &mocks.Addr{
+			MockString: func() string {
+				return "1.1.1.1:443"
+			},
+		})
+
+		got := trace.EventsByConn()
+		if len(got[2]) != 1 || got[2][0].Operation != "write_to" {
+			t.Fatal("unexpected events", got)
+		}
+	})
+
+	t.Run("with no events we return an empty map", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		if got := trace.EventsByConn(); got == nil || len(got) != 0 {
+			t.Fatal("unexpected result", got)
+		}
+	})
+
+	t.Run("we use the zero index for invalid tags", func(t *testing.T) {
+		ev := &model.ArchivalNetworkEvent{Tags: []string{"conn_index=xx"}}
+		if index := connIndexOf(ev); index != 0 {
+			t.Fatal("unexpected index", index)
+		}
+	})
+}
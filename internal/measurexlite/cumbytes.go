@@ -0,0 +1,16 @@
+package measurexlite
+
+//
+// Recording the cumulative bytes received from an endpoint
+//
+
+import "fmt"
+
+// withCumulativeBytesTag returns the extra tags plus the "cumulative_bytes=N" tag
+// when RecordCumulativeBytes is true. Otherwise, we return the extra tags.
+func (tx *Trace) withCumulativeBytesTag(extra []string, total int64) []string {
+	if !tx.RecordCumulativeBytes {
+		return extra
+	}
+	return append(append([]string{}, extra...), fmt.Sprintf("cumulative_bytes=%d", total))
+}
@@ -0,0 +1,134 @@
+package measurexlite
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+)
+
+func TestRecordCumulativeBytes(t *testing.T) {
+	remoteAddr := &mocks.Addr{
+		MockString: func() string {
+			return "1.1.1.1:443"
+		},
+		MockNetwork: func() string {
+			return "tcp"
+		},
+	}
+
+	// newConn returns a conn whose reads return the given sizes in sequence
+	newConn := func(sizes ...int) *mocks.Conn {
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				count := sizes[0]
+				sizes = sizes[1:]
+				return count, nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return remoteAddr
+			},
+		}
+	}
+
+	// cumulativeBytes returns the values of the cumulative_bytes tags
+	cumulativeBytes := func(t *testing.T, trace *Trace) (out []int64) {
+		for _, ev := range trace.NetworkEvents() {
+			for _, tag := range ev.Tags {
+				if value, found := strings.CutPrefix(tag, "cumulative_bytes="); found {
+					total, err := strconv.ParseInt(value, 10, 64)
+					if err != nil {
+						t.Fatal(err)
+					}
+					out = append(out, total)
+				}
+			}
+		}
+		return
+	}
+
+	t.Run("by default we do not record the cumulative bytes", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		conn := trace.MaybeWrapNetConn(newConn(4))
+		conn.Read(make([]byte, 4))
+		if values := cumulativeBytes(t, trace); len(values) != 0 {
+			t.Fatal("expected no cumulative_bytes tags", values)
+		}
+	})
+
+	t.Run("sequential reads record a monotonically increasing total", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordCumulativeBytes = true
+		conn := trace.MaybeWrapNetConn(newConn(3, 0, 5, 7))
+		for idx := 0; idx < 4; idx++ {
+			conn.Read(make([]byte, 16))
+		}
+		values := cumulativeBytes(t, trace)
+		if diff := cmp.Diff([]int64{3, 3, 8, 15}, values); diff != "" {
+			t.Fatal(diff)
+		}
+		expect := map[string]int64{"1.1.1.1:443 tcp": values[len(values)-1]}
+		if diff := cmp.Diff(expect, trace.CloneBytesReceivedMap()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("the total accounts for all the conns using the same endpoint", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordCumulativeBytes = true
+		first := trace.MaybeWrapNetConn(newConn(10))
+		second := trace.MaybeWrapNetConn(newConn(20))
+		first.Read(make([]byte, 16))
+		second.Read(make([]byte, 32))
+		if diff := cmp.Diff([]int64{10, 30}, cumulativeBytes(t, trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("coalesced reads carry the latest total", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.CoalesceReads = true
+		trace.RecordCumulativeBytes = true
+		conn := trace.MaybeWrapNetConn(newConn(3, 5))
+		conn.Read(make([]byte, 16))
+		conn.Read(make([]byte, 16))
+		if diff := cmp.Diff([]int64{8}, cumulativeBytes(t, trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("UDP reads record the total when we know the peer address", func(t *testing.T) {
+		udpAddr := &mocks.Addr{
+			MockString: func() string {
+				return "8.8.8.8:443"
+			},
+			MockNetwork: func() string {
+				return "udp"
+			},
+		}
+		var addrs = []net.Addr{udpAddr, nil, udpAddr}
+		trace := NewTrace(0, time.Now())
+		trace.RecordCumulativeBytes = true
+		conn := trace.MaybeWrapUDPLikeConn(&mocks.UDPLikeConn{
+			MockReadFrom: func(p []byte) (int, net.Addr, error) {
+				addr := addrs[0]
+				addrs = addrs[1:]
+				if addr == nil {
+					return 0, nil, fmt.Errorf("mocked error")
+				}
+				return 4, addr, nil
+			},
+		})
+		for idx := 0; idx < 3; idx++ {
+			conn.ReadFrom(make([]byte, 16))
+		}
+		if diff := cmp.Diff([]int64{4, 8}, cumulativeBytes(t, trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -51,43 +51,68 @@ func (tx *Trace) OnConnectDone(
 	started time.Time, network, domain, remoteAddr string, err error, finished time.Time) {
 	switch network {
 	case "tcp", "tcp4", "tcp6":
-
-		// insert into the tcpConnect buffer
-		select {
-		case tx.tcpConnect <- NewArchivalTCPConnectResult(
-			tx.Index,
-			started.Sub(tx.ZeroTime),
-			remoteAddr,
-			err,
-			finished.Sub(tx.ZeroTime),
-			tx.tags...,
-		):
-		default: // buffer is full
-		}
-
-		// insert into the networkEvent buffer
-		// see https://github.com/ooni/probe/issues/2254
-		select {
-		case tx.networkEvent <- NewArchivalNetworkEvent(
-			tx.Index,
-			started.Sub(tx.ZeroTime),
-			netxlite.ConnectOperation,
-			"tcp",
-			remoteAddr,
-			0,
-			err,
-			finished.Sub(tx.ZeroTime),
-			tx.tags...,
-		):
-		default: // buffer is full
-		}
-
+		tx.saveTCPConnect(tx.Index, started.Sub(tx.ZeroTime), remoteAddr, err, finished.Sub(tx.ZeroTime))
 	default:
 		// ignore UDP connect attempts because they cannot fail
 		// in interesting ways that make sense for censorship
 	}
 }
 
+// saveTCPConnect saves a TCP connect result and the corresponding network event
+// and returns the saved TCP connect result.
+func (tx *Trace) saveTCPConnect(index int64, started time.Duration, remoteAddr string,
+	err error, finished time.Duration) *model.ArchivalTCPConnectResult {
+	tags := tx.currentTags()
+
+	// insert into the tcpConnect buffer
+	result := NewArchivalTCPConnectResult(
+		index,
+		started,
+		remoteAddr,
+		err,
+		finished,
+		tags...,
+	)
+	select {
+	case tx.tcpConnect <- result:
+	default: // buffer is full
+	}
+
+	// insert into the networkEvent buffer
+	// see https://github.com/ooni/probe/issues/2254
+	select {
+	case tx.networkEvent <- NewArchivalNetworkEvent(
+		index,
+		started,
+		netxlite.ConnectOperation,
+		"tcp",
+		remoteAddr,
+		0,
+		err,
+		finished,
+		tags...,
+	):
+	default: // buffer is full
+	}
+
+	return result
+}
+
+// NewArchivalTCPConnectResult is like the [NewArchivalTCPConnectResult] function but
+// uses the tags of the trace and saves the result into the trace, such that experiments
+// using their own dialers can emit the same TCP connect observations and network events
+// emitted by the dialers created by the trace. We return the saved result, hence you
+// should not save the return value elsewhere if you also collect the results using
+// [*Trace.TCPConnects]. When conn is not nil, we use its remote address, which is
+// the address we actually connected to, instead of address.
+func (tx *Trace) NewArchivalTCPConnectResult(index int64, started time.Duration, address string,
+	conn net.Conn, err error, finished time.Duration) *model.ArchivalTCPConnectResult {
+	if conn != nil && conn.RemoteAddr() != nil {
+		address = conn.RemoteAddr().String()
+	}
+	return tx.saveTCPConnect(index, started, address, err, finished)
+}
+
 // NewArchivalTCPConnectResult generates a model.ArchivalTCPConnectResult
 // from the available information right after connect returns.
 func NewArchivalTCPConnectResult(index int64, started time.Duration, address string,
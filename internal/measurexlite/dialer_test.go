@@ -6,6 +6,7 @@ import (
 	"math"
 	"net"
 	"strconv"
+	"syscall"
 	"testing"
 	"time"
 
@@ -309,3 +310,84 @@ func TestArchivalPortToString(t *testing.T) {
 		}
 	})
 }
+
+func TestTraceNewArchivalTCPConnectResult(t *testing.T) {
+	t.Run("with a failure and without a conn", func(t *testing.T) {
+		trace := NewTrace(0, time.Now(), "antani")
+		got := trace.NewArchivalTCPConnectResult(
+			7, 100*time.Millisecond, "1.1.1.1:443", nil,
+			netxlite.NewTopLevelGenericErrWrapper(syscall.ECONNREFUSED), 300*time.Millisecond)
+		failure := netxlite.FailureConnectionRefused
+		expect := &model.ArchivalTCPConnectResult{
+			IP:   "1.1.1.1",
+			Port: 443,
+			Status: model.ArchivalTCPConnectStatus{
+				Blocked: nil,
+				Failure: &failure,
+				Success: false,
+			},
+			T0:            0.1,
+			T:             0.3,
+			Tags:          []string{"antani"},
+			TransactionID: 7,
+		}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+
+		t.Run("and we save the result into the trace", func(t *testing.T) {
+			if diff := cmp.Diff([]*model.ArchivalTCPConnectResult{expect}, trace.TCPConnects()); diff != "" {
+				t.Fatal(diff)
+			}
+			events := trace.NetworkEvents()
+			if len(events) != 1 {
+				t.Fatal("expected to see a single network event")
+			}
+			if events[0].Operation != netxlite.ConnectOperation || events[0].Address != "1.1.1.1:443" {
+				t.Fatal("unexpected network event", events[0])
+			}
+			if events[0].Failure == nil || *events[0].Failure != failure {
+				t.Fatal("unexpected failure", events[0].Failure)
+			}
+		})
+	})
+
+	t.Run("with success and a conn", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		conn := &mocks.Conn{
+			MockRemoteAddr: func() net.Addr {
+				return &net.TCPAddr{IP: net.IPv4(8, 8, 8, 8), Port: 443}
+			},
+		}
+		got := trace.NewArchivalTCPConnectResult(
+			3, time.Second, "dns.google:443", conn, nil, 2*time.Second)
+		expect := &model.ArchivalTCPConnectResult{
+			IP:   "8.8.8.8",
+			Port: 443,
+			Status: model.ArchivalTCPConnectStatus{
+				Blocked: nil,
+				Failure: nil,
+				Success: true,
+			},
+			T0:            1,
+			T:             2,
+			Tags:          []string{},
+			TransactionID: 3,
+		}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we return the same result we save into the trace", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordCaller = true
+		got := trace.NewArchivalTCPConnectResult(
+			1, 0, "1.1.1.1:443", nil, nil, time.Second)
+		saved := trace.TCPConnects()
+		if len(saved) != 1 || saved[0] != got {
+			t.Fatal("expected to see the returned result in the trace")
+		}
+
+	})
+}
@@ -53,7 +53,7 @@ func (r *resolverTrace) emitResolveStart() {
 	select {
 	case r.tx.networkEvent <- NewAnnotationArchivalNetworkEvent(
 		r.tx.Index, r.tx.TimeSince(r.tx.ZeroTime), "resolve_start",
-		r.tx.tags...,
+		r.tx.currentTags()...,
 	):
 	default: // buffer is full
 	}
@@ -64,7 +64,7 @@ func (r *resolverTrace) emiteResolveDone() {
 	select {
 	case r.tx.networkEvent <- NewAnnotationArchivalNetworkEvent(
 		r.tx.Index, r.tx.TimeSince(r.tx.ZeroTime), "resolve_done",
-		r.tx.tags...,
+		r.tx.currentTags()...,
 	):
 	default: // buffer is full
 	}
@@ -121,7 +121,7 @@ func (tx *Trace) OnDNSRoundTripForLookupHost(started time.Time, reso model.Resol
 		addrs,
 		err,
 		t,
-		tx.tags...,
+		tx.currentTags()...,
 	):
 
 	default:
@@ -164,6 +164,62 @@ func NewArchivalDNSLookupResultFromRoundTrip(index int64, started time.Duration,
 	}
 }
 
+// DNSRoundTripMaxWireSize is the maximum number of bytes of the query and of
+// the reply we include into a [model.ArchivalDNSRoundTripEvent].
+const DNSRoundTripMaxWireSize = 1 << 12
+
+// NewArchivalDNSRoundTrip generates a model.ArchivalDNSRoundTripEvent from the wire-format
+// query and reply exchanged with the DNS server at the given network and address, using the
+// tags of the trace, and saves it into the trace. We return the saved event, hence you
+// should not save the return value elsewhere if you also collect the events using
+// [*Trace.DNSRoundTrips]. We include at most DNSRoundTripMaxWireSize bytes of the query
+// and of the reply, respectively, to avoid bloating the measurement, and we set the
+// Truncated flag when we cut any of them. The reply MAY be nil when the round trip
+// failed before receiving a reply.
+func (tx *Trace) NewArchivalDNSRoundTrip(index int64, started time.Duration, network, address string,
+	query, reply []byte, finished time.Duration, err error) *model.ArchivalDNSRoundTripEvent {
+	ev := &model.ArchivalDNSRoundTripEvent{
+		Address:       address,
+		Failure:       NewFailure(err),
+		Network:       network,
+		RawQuery:      truncateDNSWireData(query),
+		RawReply:      truncateDNSWireData(reply),
+		Started:       started.Seconds(),
+		Finished:      finished.Seconds(),
+		Tags:          copyAndNormalizeTags(tx.currentTags()),
+		TransactionID: index,
+		Truncated:     len(query) > DNSRoundTripMaxWireSize || len(reply) > DNSRoundTripMaxWireSize,
+	}
+	select {
+	case tx.dnsRoundTrip <- ev:
+	default: // buffer is full
+	}
+	return ev
+}
+
+// DNSRoundTrips drains the DNS round trip events buffered inside the trace.
+func (tx *Trace) DNSRoundTrips() (out []*model.ArchivalDNSRoundTripEvent) {
+	for {
+		select {
+		case ev := <-tx.dnsRoundTrip:
+			out = append(out, ev)
+		default:
+			return
+		}
+	}
+}
+
+// truncateDNSWireData returns a copy of at most DNSRoundTripMaxWireSize bytes of data.
+func truncateDNSWireData(data []byte) []byte {
+	if len(data) <= 0 {
+		return nil
+	}
+	if len(data) > DNSRoundTripMaxWireSize {
+		data = data[:DNSRoundTripMaxWireSize]
+	}
+	return append([]byte{}, data...)
+}
+
 // maybeResponseRcode returns the response rcode (when available)
 func maybeResponseRcode(resp model.DNSResponse) (out int64) {
 	if resp != nil {
@@ -286,7 +342,7 @@ func (tx *Trace) OnDelayedDNSResponse(started time.Time, txp model.DNSTransport,
 		addrs,
 		err,
 		t,
-		tx.tags...,
+		tx.currentTags()...,
 	):
 		return nil
 
@@ -730,3 +730,69 @@ func TestNewArchivalDNSAnswers(t *testing.T) {
 		})
 	}
 }
+
+func TestNewArchivalDNSRoundTrip(t *testing.T) {
+	t.Run("with a successful round trip", func(t *testing.T) {
+		trace := NewTrace(0, time.Now(), "antani")
+		query := []byte{0xde, 0xad}
+		reply := []byte{0xbe, 0xef}
+		ev := trace.NewArchivalDNSRoundTrip(
+			7, time.Second, "udp", "8.8.8.8:53", query, reply, 2*time.Second, nil)
+		expected := &model.ArchivalDNSRoundTripEvent{
+			Address:       "8.8.8.8:53",
+			Failure:       nil,
+			Network:       "udp",
+			RawQuery:      query,
+			RawReply:      reply,
+			Started:       1,
+			Finished:      2,
+			Tags:          []string{"antani"},
+			TransactionID: 7,
+			Truncated:     false,
+		}
+		if diff := cmp.Diff(expected, ev); diff != "" {
+			t.Fatal(diff)
+		}
+		saved := trace.DNSRoundTrips()
+		if diff := cmp.Diff([]*model.ArchivalDNSRoundTripEvent{expected}, saved); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(trace.DNSRoundTrips()) != 0 {
+			t.Fatal("expected the buffer to be drained")
+		}
+	})
+
+	t.Run("with a failed round trip and large wire data", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		query := make([]byte, DNSRoundTripMaxWireSize+1)
+		ev := trace.NewArchivalDNSRoundTrip(
+			1, 0, "tcp", "8.8.8.8:53", query, nil, time.Second, netxlite.ErrOODNSNoAnswer)
+		expectedFailure := netxlite.FailureDNSNoAnswer
+		expected := &model.ArchivalDNSRoundTripEvent{
+			Address:       "8.8.8.8:53",
+			Failure:       &expectedFailure,
+			Network:       "tcp",
+			RawQuery:      make([]byte, DNSRoundTripMaxWireSize),
+			RawReply:      nil,
+			Started:       0,
+			Finished:      1,
+			Tags:          []string{},
+			TransactionID: 1,
+			Truncated:     true,
+		}
+		if diff := cmp.Diff(expected, ev); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when the buffer is full", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		for idx := 0; idx < DNSRoundTripBufferSize+1; idx++ {
+			trace.NewArchivalDNSRoundTrip(
+				int64(idx), 0, "udp", "8.8.8.8:53", nil, nil, time.Second, nil)
+		}
+		if got := len(trace.DNSRoundTrips()); got != DNSRoundTripBufferSize {
+			t.Fatal("unexpected number of events", got)
+		}
+	})
+}
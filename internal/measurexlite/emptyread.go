@@ -0,0 +1,26 @@
+package measurexlite
+
+//
+// Flagging reads returning zero bytes without any error
+//
+
+import "github.com/ooni/probe-cli/v3/internal/model"
+
+// emptyReadTag is the tag we add to empty reads when FlagEmptyReads is true.
+const emptyReadTag = "empty-read"
+
+// withEmptyReadTag returns the extra tags plus the "empty-read" tag when
+// FlagEmptyReads is true and the read returned zero bytes without any
+// error. Otherwise, we return the extra tags.
+func (tx *Trace) withEmptyReadTag(extra []string, count int, err error) []string {
+	if !tx.FlagEmptyReads || count != 0 || err != nil {
+		return extra
+	}
+	return append(append([]string{}, extra...), emptyReadTag)
+}
+
+// isFlaggedEmptyRead returns whether the given read event is an
+// empty read we have flagged using the "empty-read" tag.
+func (tx *Trace) isFlaggedEmptyRead(ev *model.ArchivalNetworkEvent) bool {
+	return tx.FlagEmptyReads && ev.Failure == nil && ev.NumBytes == 0
+}
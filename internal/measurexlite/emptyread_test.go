@@ -0,0 +1,113 @@
+package measurexlite
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+)
+
+func TestFlagEmptyReads(t *testing.T) {
+	tcpAddr := &mocks.Addr{
+		MockString: func() string {
+			return "1.1.1.1:443"
+		},
+		MockNetwork: func() string {
+			return "tcp"
+		},
+	}
+	udpAddr := &mocks.Addr{
+		MockString: func() string {
+			return "1.1.1.1:443"
+		},
+		MockNetwork: func() string {
+			return "udp"
+		},
+	}
+
+	// newConn returns a conn whose reads return the given sizes in sequence
+	newConn := func(sizes ...int) *mocks.Conn {
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				count := sizes[0]
+				sizes = sizes[1:]
+				return count, nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return tcpAddr
+			},
+		}
+	}
+
+	// collect returns the NumBytes and tags of all the network events
+	type event struct {
+		NumBytes int64
+		Tags     []string
+	}
+	collect := func(trace *Trace) (out []event) {
+		for _, ev := range trace.NetworkEvents() {
+			out = append(out, event{NumBytes: ev.NumBytes, Tags: ev.Tags})
+		}
+		return
+	}
+
+	t.Run("we do not flag empty reads by default", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		conn := trace.MaybeWrapNetConn(newConn(0))
+		conn.Read(make([]byte, 4))
+		expect := []event{{NumBytes: 0, Tags: []string{}}}
+		if diff := cmp.Diff(expect, collect(trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we only flag empty reads when the flag is set", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.FlagEmptyReads = true
+		conn := trace.MaybeWrapNetConn(newConn(4, 0))
+		conn.Read(make([]byte, 4))
+		conn.Read(make([]byte, 4))
+		expect := []event{
+			{NumBytes: 4, Tags: []string{}},
+			{NumBytes: 0, Tags: []string{"empty-read"}},
+		}
+		if diff := cmp.Diff(expect, collect(trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we do not coalesce flagged empty reads", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.CoalesceReads = true
+		trace.FlagEmptyReads = true
+		conn := trace.MaybeWrapNetConn(newConn(4, 4, 0, 4))
+		for idx := 0; idx < 4; idx++ {
+			conn.Read(make([]byte, 4))
+		}
+		expect := []event{
+			{NumBytes: 8, Tags: []string{}},
+			{NumBytes: 0, Tags: []string{"empty-read"}},
+			{NumBytes: 4, Tags: []string{}},
+		}
+		if diff := cmp.Diff(expect, collect(trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we flag empty UDP reads", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.FlagEmptyReads = true
+		conn := trace.MaybeWrapUDPLikeConn(&mocks.UDPLikeConn{
+			MockReadFrom: func(p []byte) (int, net.Addr, error) {
+				return 0, udpAddr, nil
+			},
+		})
+		conn.ReadFrom(make([]byte, 4))
+		expect := []event{{NumBytes: 0, Tags: []string{"empty-read"}}}
+		if diff := cmp.Diff(expect, collect(trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -75,6 +75,23 @@ func NewArchivalHTTPRequestResult(index int64, started time.Duration, network, a
 	}
 }
 
+// NewArchivalHTTPRequestResult is like the [NewArchivalHTTPRequestResult] function except
+// that it uses the trace's index and tags (including the tags added by [*Trace.WithTags]) and
+// assumes that we finished reading the response body when calling this method. Additionally,
+// when maxRespBodySize is positive, this method truncates the body to maxRespBodySize bytes,
+// such that the archival result contains a bounded body snapshot, and marks the body as
+// truncated. See the [NewArchivalHTTPRequestResult] function for the arguments' meaning.
+func (tx *Trace) NewArchivalHTTPRequestResult(started time.Duration, network, address, alpn string,
+	transport string, req *http.Request, resp *http.Response, maxRespBodySize int64, body []byte,
+	err error) *model.ArchivalHTTPRequestResult {
+	finished := tx.TimeSince(tx.ZeroTime)
+	if maxRespBodySize > 0 && int64(len(body)) > maxRespBodySize {
+		body = body[:maxRespBodySize]
+	}
+	return NewArchivalHTTPRequestResult(tx.Index, started, network, address, alpn, transport,
+		req, resp, maxRespBodySize, body, err, finished, tx.currentTags()...)
+}
+
 // httpRequestMethod returns the HTTP request method or an empty string
 func httpRequestMethod(req *http.Request) (out string) {
 	if req != nil {
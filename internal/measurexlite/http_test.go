@@ -349,3 +349,125 @@ func TestNewArchivalHTTPRequestResult(t *testing.T) {
 		})
 	}
 }
+
+func TestTraceNewArchivalHTTPRequestResult(t *testing.T) {
+	// newTrace creates a trace with deterministic timing where each call
+	// to the TimeNow method advances the clock by one second.
+	newTrace := func() *Trace {
+		zeroTime := time.Now()
+		td := testingx.NewTimeDeterministic(zeroTime)
+		trace := NewTrace(47, zeroTime, "antani")
+		trace.timeNowFn = td.Now
+		return trace
+	}
+
+	newRequest := func() *http.Request {
+		return &http.Request{
+			Method: "GET",
+			URL: &url.URL{
+				Scheme: "https",
+				Host:   "dns.google",
+				Path:   "/",
+			},
+			Header: http.Header{
+				"Accept": {"*/*"},
+			},
+		}
+	}
+
+	newResponse := func() *http.Response {
+		return &http.Response{
+			StatusCode: 200,
+			Header: http.Header{
+				"Server": {"Apache"},
+			},
+		}
+	}
+
+	t.Run("we use the trace index, tags, and time", func(t *testing.T) {
+		trace := newTrace()
+		started := trace.TimeSince(trace.ZeroTime)
+		var out *model.ArchivalHTTPRequestResult
+		trace.WithTags([]string{"redirect-hop-2"}, func() {
+			out = trace.NewArchivalHTTPRequestResult(started, "tcp", "8.8.8.8:443", "h2", "tcp",
+				newRequest(), newResponse(), 1<<19, []byte("deadbeef"), nil)
+		})
+		expect := &model.ArchivalHTTPRequestResult{
+			Network: "tcp",
+			Address: "8.8.8.8:443",
+			ALPN:    "h2",
+			Failure: nil,
+			Request: model.ArchivalHTTPRequest{
+				Body:            model.ArchivalScrubbedMaybeBinaryString(""),
+				BodyIsTruncated: false,
+				HeadersList: []model.ArchivalHTTPHeader{{
+					model.ArchivalScrubbedMaybeBinaryString("Accept"),
+					model.ArchivalScrubbedMaybeBinaryString("*/*"),
+				}},
+				Headers: map[string]model.ArchivalScrubbedMaybeBinaryString{
+					"Accept": "*/*",
+				},
+				Method:    "GET",
+				Tor:       model.ArchivalHTTPTor{},
+				Transport: "tcp",
+				URL:       "https://dns.google/",
+			},
+			Response: model.ArchivalHTTPResponse{
+				Body:            model.ArchivalScrubbedMaybeBinaryString("deadbeef"),
+				BodyIsTruncated: false,
+				Code:            200,
+				HeadersList: []model.ArchivalHTTPHeader{{
+					model.ArchivalScrubbedMaybeBinaryString("Server"),
+					model.ArchivalScrubbedMaybeBinaryString("Apache"),
+				}},
+				Headers: map[string]model.ArchivalScrubbedMaybeBinaryString{
+					"Server": "Apache",
+				},
+				Locations: []string{},
+			},
+			T0:            0,
+			T:             1,
+			Tags:          []string{"antani", "redirect-hop-2"},
+			TransactionID: 47,
+		}
+		if diff := cmp.Diff(expect, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we truncate the body", func(t *testing.T) {
+		trace := newTrace()
+		out := trace.NewArchivalHTTPRequestResult(0, "tcp", "8.8.8.8:443", "h2", "tcp",
+			newRequest(), newResponse(), 4, []byte("deadbeef"), nil)
+		if diff := cmp.Diff(model.ArchivalScrubbedMaybeBinaryString("dead"), out.Response.Body); diff != "" {
+			t.Fatal(diff)
+		}
+		if !out.Response.BodyIsTruncated {
+			t.Fatal("expected the body to be truncated")
+		}
+	})
+
+	t.Run("we do not truncate with a nonpositive maximum body size", func(t *testing.T) {
+		trace := newTrace()
+		out := trace.NewArchivalHTTPRequestResult(0, "tcp", "8.8.8.8:443", "h2", "tcp",
+			newRequest(), newResponse(), 0, []byte("deadbeef"), nil)
+		if diff := cmp.Diff(model.ArchivalScrubbedMaybeBinaryString("deadbeef"), out.Response.Body); diff != "" {
+			t.Fatal(diff)
+		}
+		if out.Response.BodyIsTruncated {
+			t.Fatal("expected the body to not be truncated")
+		}
+	})
+
+	t.Run("we record the failure", func(t *testing.T) {
+		trace := newTrace()
+		out := trace.NewArchivalHTTPRequestResult(0, "tcp", "8.8.8.8:443", "", "tcp",
+			newRequest(), nil, 1<<19, nil, netxlite.NewTopLevelGenericErrWrapper(netxlite.ECONNRESET))
+		if out.Failure == nil || *out.Failure != netxlite.FailureConnectionReset {
+			t.Fatal("unexpected failure", out.Failure)
+		}
+		if out.Response.Code != 0 {
+			t.Fatal("unexpected status code", out.Response.Code)
+		}
+	})
+}
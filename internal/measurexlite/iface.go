@@ -0,0 +1,76 @@
+package measurexlite
+
+//
+// Network interface tagging
+//
+
+import (
+	"net"
+)
+
+// interfaceTags returns the "interface=NAME" tag for the network interface
+// owning the local address of the given conn when RecordInterface is true. We
+// return nil when RecordInterface is false or we cannot find the interface.
+func (tx *Trace) interfaceTags(conn net.Conn) []string {
+	if !tx.RecordInterface {
+		return nil
+	}
+	addr := conn.LocalAddr()
+	if addr == nil {
+		return nil
+	}
+	name := tx.interfaceName(addr)
+	if name == "" {
+		return nil
+	}
+	return []string{"interface=" + name}
+}
+
+// interfaceName returns the name of the network interface owning the given
+// local address or an empty string. We cache the results to avoid enumerating
+// the network interfaces for each conn using the same local address.
+func (tx *Trace) interfaceName(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	key := ip.String()
+
+	defer tx.interfaceMu.Unlock()
+	tx.interfaceMu.Lock()
+	if name, found := tx.interfaceCache[key]; found {
+		return name
+	}
+	fn := tx.interfaceByIPFn
+	if fn == nil {
+		fn = interfaceNameByIP
+	}
+	name := fn(ip) // we also cache failures, which are unlikely to change
+	tx.interfaceCache[key] = name
+	return name
+}
+
+// interfaceNameByIP returns the name of the network interface having the given
+// IP address among its addresses or an empty string on failure.
+func interfaceNameByIP(ip net.IP) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				return iface.Name
+			}
+		}
+	}
+	return ""
+}
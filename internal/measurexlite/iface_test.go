@@ -0,0 +1,145 @@
+package measurexlite
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+)
+
+func TestRecordInterface(t *testing.T) {
+	// newConn returns a conn whose local address is the given address.
+	newConn := func(localAddr string) *mocks.Conn {
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockLocalAddr: func() net.Addr {
+				return &mocks.Addr{
+					MockNetwork: func() string {
+						return "tcp"
+					},
+					MockString: func() string {
+						return localAddr
+					},
+				}
+			},
+			MockRemoteAddr: func() net.Addr {
+				return &mocks.Addr{
+					MockNetwork: func() string {
+						return "tcp"
+					},
+					MockString: func() string {
+						return "1.1.1.1:443"
+					},
+				}
+			},
+		}
+	}
+
+	// newTrace returns a trace mapping 10.0.0.1 to eth0 and 10.0.0.2 to wlan0
+	// and counting the number of times we lookup an interface.
+	newTrace := func(record bool, lookups *int) *Trace {
+		trace := NewTrace(0, time.Now(), "antani")
+		trace.RecordInterface = record
+		trace.interfaceByIPFn = func(ip net.IP) string {
+			*lookups++
+			switch ip.String() {
+			case "10.0.0.1":
+				return "eth0"
+			case "10.0.0.2":
+				return "wlan0"
+			default:
+				return ""
+			}
+		}
+		return trace
+	}
+
+	// readAndGetTags reads from the wrapped conn and returns the event's tags.
+	readAndGetTags := func(t *testing.T, trace *Trace, conn net.Conn) []string {
+		if _, err := conn.Read(make([]byte, 8)); err != nil {
+			t.Fatal(err)
+		}
+		events := trace.NetworkEvents()
+		if len(events) != 1 {
+			t.Fatal("expected a single event")
+		}
+		return events[0].Tags
+	}
+
+	t.Run("we include the interface tag when RecordInterface is true", func(t *testing.T) {
+		var lookups int
+		trace := newTrace(true, &lookups)
+		conn := trace.MaybeWrapNetConn(newConn("10.0.0.1:54321"))
+		tags := readAndGetTags(t, trace, conn)
+		if diff := cmp.Diff([]string{"antani", "interface=eth0"}, tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we cache the mapping between addresses and interfaces", func(t *testing.T) {
+		var lookups int
+		trace := newTrace(true, &lookups)
+		for _, localAddr := range []string{"10.0.0.1:54321", "10.0.0.1:54322", "10.0.0.2:54323"} {
+			trace.MaybeWrapNetConn(newConn(localAddr))
+		}
+		if lookups != 2 {
+			t.Fatal("expected two lookups, got", lookups)
+		}
+		conn := trace.MaybeWrapNetConn(newConn("10.0.0.2:54324"))
+		tags := readAndGetTags(t, trace, conn)
+		if diff := cmp.Diff([]string{"antani", "interface=wlan0"}, tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we omit the tag when we cannot find the interface", func(t *testing.T) {
+		var lookups int
+		trace := newTrace(true, &lookups)
+		conn := trace.MaybeWrapNetConn(newConn("10.0.0.3:54321"))
+		tags := readAndGetTags(t, trace, conn)
+		if diff := cmp.Diff([]string{"antani"}, tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we omit the tag when the local address is invalid", func(t *testing.T) {
+		var lookups int
+		trace := newTrace(true, &lookups)
+		for _, localAddr := range []string{"10.0.0.1", "antani:54321"} {
+			conn := trace.MaybeWrapNetConn(newConn(localAddr))
+			tags := readAndGetTags(t, trace, conn)
+			if diff := cmp.Diff([]string{"antani"}, tags); diff != "" {
+				t.Fatal(diff)
+			}
+		}
+		if lookups != 0 {
+			t.Fatal("expected no lookups")
+		}
+	})
+
+	t.Run("we do nothing when RecordInterface is false", func(t *testing.T) {
+		var lookups int
+		trace := newTrace(false, &lookups)
+		conn := trace.MaybeWrapNetConn(newConn("10.0.0.1:54321"))
+		tags := readAndGetTags(t, trace, conn)
+		if diff := cmp.Diff([]string{"antani"}, tags); diff != "" {
+			t.Fatal(diff)
+		}
+		if lookups != 0 {
+			t.Fatal("expected no lookups")
+		}
+	})
+
+	t.Run("interfaceNameByIP finds the loopback interface", func(t *testing.T) {
+		if name := interfaceNameByIP(net.ParseIP("127.0.0.1")); name == "" {
+			t.Fatal("expected to find the loopback interface")
+		}
+		if name := interfaceNameByIP(net.ParseIP("192.0.2.1")); name != "" {
+			t.Fatal("did not expect to find an interface", name)
+		}
+	})
+}
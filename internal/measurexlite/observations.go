@@ -0,0 +1,134 @@
+package measurexlite
+
+//
+// Observations and their archival serialization
+//
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// Observations is the skeleton shared by most OONI measurements where
+// we group observations by type using standard test keys.
+type Observations struct {
+	// NetworkEvents contains I/O events.
+	NetworkEvents []*model.ArchivalNetworkEvent `json:"network_events"`
+
+	// Queries contains the DNS queries results.
+	Queries []*model.ArchivalDNSLookupResult `json:"queries"`
+
+	// Requests contains HTTP request results.
+	Requests []*model.ArchivalHTTPRequestResult `json:"requests"`
+
+	// TCPConnect contains the TCP connect results.
+	TCPConnect []*model.ArchivalTCPConnectResult `json:"tcp_connect"`
+
+	// TLSHandshakes contains the TLS handshakes results.
+	TLSHandshakes []*model.ArchivalTLSOrQUICHandshakeResult `json:"tls_handshakes"`
+
+	// QUICHandshakes contains the QUIC handshakes results.
+	QUICHandshakes []*model.ArchivalTLSOrQUICHandshakeResult `json:"quic_handshakes"`
+}
+
+// NewObservations initializes all measurements to empty arrays and returns the
+// Observations skeleton.
+func NewObservations() *Observations {
+	return &Observations{
+		NetworkEvents:  []*model.ArchivalNetworkEvent{},
+		Queries:        []*model.ArchivalDNSLookupResult{},
+		Requests:       []*model.ArchivalHTTPRequestResult{},
+		TCPConnect:     []*model.ArchivalTCPConnectResult{},
+		TLSHandshakes:  []*model.ArchivalTLSOrQUICHandshakeResult{},
+		QUICHandshakes: []*model.ArchivalTLSOrQUICHandshakeResult{},
+	}
+}
+
+// Observations drains the network events, DNS lookups, TCP connects, TLS handshakes
+// and QUIC handshakes buffered inside the [*Trace] and returns them. Because the
+// [*Trace] does not collect HTTP requests, the requests are always empty.
+func (tx *Trace) Observations() *Observations {
+	return &Observations{
+		NetworkEvents:  tx.NetworkEvents(),
+		Queries:        tx.DNSLookupsFromRoundTrip(),
+		Requests:       []*model.ArchivalHTTPRequestResult{}, // no extractor inside trace!
+		TCPConnect:     tx.TCPConnects(),
+		TLSHandshakes:  tx.TLSHandshakes(),
+		QUICHandshakes: tx.QUICHandshakes(),
+	}
+}
+
+// ObservationsSchemaV0 is the legacy archival layout of [Observations] used by
+// experiments based on [tracex] (e.g., urlgetter), which stores the observations using
+// the "network_events", "queries", "requests", "tcp_connect", and "tls_handshakes"
+// keys. Because this layout predates the "quic_handshakes" key, we store the QUIC
+// handshakes along with the TLS handshakes, sorted by time, like [tracex] does.
+//
+// [tracex]: https://pkg.go.dev/github.com/ooni/probe-cli/v3/internal/legacy/tracex
+const ObservationsSchemaV0 = 0
+
+// ObservationsSchemaV1 is the archival layout of [Observations], which stores the
+// observations using the "network_events", "queries", "requests", "tcp_connect",
+// "tls_handshakes", and "quic_handshakes" keys.
+const ObservationsSchemaV1 = 1
+
+// ErrUnknownObservationsSchema indicates that we don't know the
+// observations schema version passed to [MarshalObservations].
+var ErrUnknownObservationsSchema = errors.New("measurexlite: unknown observations schema")
+
+// observationsV0 is the archival layout of [ObservationsSchemaV0].
+type observationsV0 struct {
+	NetworkEvents []*model.ArchivalNetworkEvent             `json:"network_events"`
+	Queries       []*model.ArchivalDNSLookupResult          `json:"queries"`
+	Requests      []*model.ArchivalHTTPRequestResult        `json:"requests"`
+	TCPConnect    []*model.ArchivalTCPConnectResult         `json:"tcp_connect"`
+	TLSHandshakes []*model.ArchivalTLSOrQUICHandshakeResult `json:"tls_handshakes"`
+}
+
+// MarshalObservations serializes the given observations to JSON using the archival
+// layout identified by the given schema version (e.g., [ObservationsSchemaV1]). We always
+// emit empty lists rather than null for missing observations, and we treat nil observations
+// like empty observations. This function returns [ErrUnknownObservationsSchema] if we
+// don't know the schema version.
+func MarshalObservations(obs *Observations, version int) ([]byte, error) {
+	if obs == nil {
+		obs = NewObservations()
+	}
+	switch version {
+	case ObservationsSchemaV0:
+		handshakes := append(copyAndNormalizeSlice(obs.TLSHandshakes), obs.QUICHandshakes...)
+		sort.SliceStable(handshakes, func(i, j int) bool {
+			return handshakes[i].T < handshakes[j].T
+		})
+		return json.Marshal(&observationsV0{
+			NetworkEvents: copyAndNormalizeSlice(obs.NetworkEvents),
+			Queries:       copyAndNormalizeSlice(obs.Queries),
+			Requests:      copyAndNormalizeSlice(obs.Requests),
+			TCPConnect:    copyAndNormalizeSlice(obs.TCPConnect),
+			TLSHandshakes: handshakes,
+		})
+
+	case ObservationsSchemaV1:
+		return json.Marshal(&Observations{
+			NetworkEvents:  copyAndNormalizeSlice(obs.NetworkEvents),
+			Queries:        copyAndNormalizeSlice(obs.Queries),
+			Requests:       copyAndNormalizeSlice(obs.Requests),
+			TCPConnect:     copyAndNormalizeSlice(obs.TCPConnect),
+			TLSHandshakes:  copyAndNormalizeSlice(obs.TLSHandshakes),
+			QUICHandshakes: copyAndNormalizeSlice(obs.QUICHandshakes),
+		})
+
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownObservationsSchema, version)
+	}
+}
+
+// copyAndNormalizeSlice ensures that we map nil slices to empty
+// slices and that we return a copy of the original slice.
+func copyAndNormalizeSlice[T any](values []T) []T {
+	return append([]T{}, values...)
+}
@@ -0,0 +1,117 @@
+package measurexlite
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestObservations(t *testing.T) {
+	// newObservations returns observations collected using a trace
+	newObservations := func() *Observations {
+		trace := NewTrace(0, time.Now())
+		trace.NewArchivalTCPConnectResult(0, 0, "1.1.1.1:443", nil, nil, time.Second)
+		trace.tlsHandshake <- &model.ArchivalTLSOrQUICHandshakeResult{Network: "tcp", T: 2}
+		trace.quicHandshake <- &model.ArchivalTLSOrQUICHandshakeResult{Network: "udp", T: 1}
+		obs := trace.Observations()
+		if len(obs.NetworkEvents) != 1 || len(obs.TCPConnect) != 1 || len(obs.TLSHandshakes) != 1 ||
+			len(obs.QUICHandshakes) != 1 || len(obs.Queries) != 0 || obs.Requests == nil {
+			t.Fatalf("unexpected observations: %+v", obs)
+		}
+		return obs
+	}
+
+	// unmarshal unmarshals the serialized observations and returns the sorted keys
+	unmarshal := func(data []byte) (map[string][]map[string]any, []string) {
+		var out map[string][]map[string]any
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for key := range out {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return out, keys
+	}
+
+	expectKeys := []string{
+		"network_events", "queries", "quic_handshakes", "requests", "tcp_connect", "tls_handshakes",
+	}
+
+	t.Run("with ObservationsSchemaV1", func(t *testing.T) {
+		data, err := MarshalObservations(newObservations(), ObservationsSchemaV1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, keys := unmarshal(data)
+		if diff := cmp.Diff(expectKeys, keys); diff != "" {
+			t.Fatal(diff)
+		}
+		if out["queries"] == nil || len(out["queries"]) != 0 {
+			t.Fatal("expected an empty list of queries")
+		}
+		if len(out["tls_handshakes"]) != 1 || out["tls_handshakes"][0]["network"] != "tcp" {
+			t.Fatal("unexpected tls_handshakes", out["tls_handshakes"])
+		}
+		if len(out["quic_handshakes"]) != 1 || out["quic_handshakes"][0]["network"] != "udp" {
+			t.Fatal("unexpected quic_handshakes", out["quic_handshakes"])
+		}
+	})
+
+	t.Run("with ObservationsSchemaV0", func(t *testing.T) {
+		obs := newObservations()
+		data, err := MarshalObservations(obs, ObservationsSchemaV0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, keys := unmarshal(data)
+		expectKeysV0 := []string{
+			"network_events", "queries", "requests", "tcp_connect", "tls_handshakes",
+		}
+		if diff := cmp.Diff(expectKeysV0, keys); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(out["tcp_connect"]) != 1 || len(out["network_events"]) != 1 {
+			t.Fatal("unexpected tcp_connect or network_events", out)
+		}
+		handshakes := out["tls_handshakes"]
+		if len(handshakes) != 2 || handshakes[0]["network"] != "udp" || handshakes[1]["network"] != "tcp" {
+			t.Fatal("unexpected tls_handshakes", handshakes)
+		}
+		if len(obs.TLSHandshakes) != 1 || len(obs.QUICHandshakes) != 1 {
+			t.Fatal("expected the observations not to change")
+		}
+	})
+
+	t.Run("with nil observations", func(t *testing.T) {
+		data, err := MarshalObservations(nil, ObservationsSchemaV1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, keys := unmarshal(data)
+		if diff := cmp.Diff(expectKeys, keys); diff != "" {
+			t.Fatal(diff)
+		}
+		for key, value := range out {
+			if value == nil || len(value) != 0 {
+				t.Fatal("expected an empty list for", key)
+			}
+		}
+	})
+
+	t.Run("with an unknown schema version", func(t *testing.T) {
+		data, err := MarshalObservations(&Observations{}, 2)
+		if !errors.Is(err, ErrUnknownObservationsSchema) {
+			t.Fatal("unexpected err", err)
+		}
+		if data != nil {
+			t.Fatal("expected nil data")
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package measurexlite
+
+//
+// Recording the stream offsets of read and write events
+//
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// streamOffsetTagPrefix is the prefix of the tag containing the stream offset.
+const streamOffsetTagPrefix = "stream_offset="
+
+// streamOffsets tracks the running offsets of the byte streams of a conn. We
+// track the received and the sent bytes separately because they belong to two
+// distinct streams. The zero value is ready to use.
+type streamOffsets struct {
+	// read is the number of bytes read so far.
+	read int64
+
+	// written is the number of bytes written so far.
+	written int64
+
+	// mu protects the fields of this struct from concurrent access.
+	mu sync.Mutex
+}
+
+// advanceRead returns the offset of a read that returned count bytes and
+// advances the offset of the received bytes stream by count bytes.
+func (so *streamOffsets) advanceRead(count int) (offset int64) {
+	defer so.mu.Unlock()
+	so.mu.Lock()
+	offset = so.read
+	so.read += int64(count)
+	return
+}
+
+// advanceWrite is like advanceRead but for the sent bytes stream.
+func (so *streamOffsets) advanceWrite(count int) (offset int64) {
+	defer so.mu.Unlock()
+	so.mu.Lock()
+	offset = so.written
+	so.written += int64(count)
+	return
+}
+
+// withStreamOffsetTag returns the extra tags plus the "stream_offset=N" tag
+// when RecordStreamOffsets is true. Otherwise, we return the extra tags.
+func (tx *Trace) withStreamOffsetTag(extra []string, offset int64) []string {
+	if !tx.RecordStreamOffsets {
+		return extra
+	}
+	return append(append([]string{}, extra...), fmt.Sprintf("%s%d", streamOffsetTagPrefix, offset))
+}
+
+// withStreamOffsetTagOf returns a copy of the given tags where the stream
+// offset tag, if any, is replaced with the stream offset tag inside other. We use
+// this function when coalescing reads, such that the coalesced event has the
+// offset of the first read and the other tags of the latest read.
+func withStreamOffsetTagOf(tags, other []string) []string {
+	var offsetTag string
+	for _, tag := range other {
+		if strings.HasPrefix(tag, streamOffsetTagPrefix) {
+			offsetTag = tag
+		}
+	}
+	out := append([]string{}, tags...)
+	for idx, tag := range out {
+		if strings.HasPrefix(tag, streamOffsetTagPrefix) && offsetTag != "" {
+			out[idx] = offsetTag
+		}
+	}
+	return out
+}
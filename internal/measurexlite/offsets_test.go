@@ -0,0 +1,141 @@
+package measurexlite
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestRecordStreamOffsets(t *testing.T) {
+	remoteAddr := &mocks.Addr{
+		MockString: func() string {
+			return "1.1.1.1:443"
+		},
+		MockNetwork: func() string {
+			return "tcp"
+		},
+	}
+
+	// newConn returns a conn whose reads and writes return the given sizes in sequence
+	newConn := func(readSizes []int, writeSizes []int) *mocks.Conn {
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				count := readSizes[0]
+				readSizes = readSizes[1:]
+				return count, nil
+			},
+			MockWrite: func(b []byte) (int, error) {
+				count := writeSizes[0]
+				writeSizes = writeSizes[1:]
+				return count, nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return remoteAddr
+			},
+		}
+	}
+
+	// streamOffsets returns the values of the stream_offset tags of the events
+	// having the given operation
+	streamOffsets := func(t *testing.T, events []*model.ArchivalNetworkEvent, operation string) (out []int64) {
+		for _, ev := range events {
+			if ev.Operation != operation {
+				continue
+			}
+			for _, tag := range ev.Tags {
+				if value, found := strings.CutPrefix(tag, "stream_offset="); found {
+					offset, err := strconv.ParseInt(value, 10, 64)
+					if err != nil {
+						t.Fatal(err)
+					}
+					out = append(out, offset)
+				}
+			}
+		}
+		return
+	}
+
+	t.Run("by default we do not record the stream offsets", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		conn := trace.MaybeWrapNetConn(newConn([]int{4}, []int{4}))
+		conn.Read(make([]byte, 4))
+		conn.Write(make([]byte, 4))
+		events := trace.NetworkEvents()
+		if values := streamOffsets(t, events, netxlite.ReadOperation); len(values) != 0 {
+			t.Fatal("expected no stream_offset tags", values)
+		}
+		if values := streamOffsets(t, events, netxlite.WriteOperation); len(values) != 0 {
+			t.Fatal("expected no stream_offset tags", values)
+		}
+	})
+
+	t.Run("sequential reads record the cumulative preceding bytes", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordStreamOffsets = true
+		conn := trace.MaybeWrapNetConn(newConn([]int{3, 0, 5, 7}, nil))
+		for idx := 0; idx < 4; idx++ {
+			conn.Read(make([]byte, 16))
+		}
+		if diff := cmp.Diff([]int64{0, 3, 3, 8}, streamOffsets(t, trace.NetworkEvents(), netxlite.ReadOperation)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("reads and writes use distinct offsets", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordStreamOffsets = true
+		conn := trace.MaybeWrapNetConn(newConn([]int{10, 20}, []int{1, 2, 4}))
+		conn.Write(make([]byte, 16))
+		conn.Read(make([]byte, 16))
+		conn.Write(make([]byte, 16))
+		conn.Read(make([]byte, 16))
+		conn.Write(make([]byte, 16))
+		events := trace.NetworkEvents()
+		if diff := cmp.Diff([]int64{0, 10}, streamOffsets(t, events, netxlite.ReadOperation)); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff([]int64{0, 1, 3}, streamOffsets(t, events, netxlite.WriteOperation)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("each conn has its own offsets", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordStreamOffsets = true
+		first := trace.MaybeWrapNetConn(newConn([]int{6}, nil))
+		second := trace.MaybeWrapNetConn(newConn([]int{9}, nil))
+		first.Read(make([]byte, 16))
+		second.Read(make([]byte, 16))
+		if diff := cmp.Diff([]int64{0, 0}, streamOffsets(t, trace.NetworkEvents(), netxlite.ReadOperation)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("coalesced reads have the offset of the first read", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordStreamOffsets = true
+		trace.RecordCumulativeBytes = true
+		trace.CoalesceReads = true
+		conn := trace.MaybeWrapNetConn(newConn([]int{3, 5, 7}, []int{1}))
+		conn.Read(make([]byte, 16))
+		conn.Write(make([]byte, 16))
+		conn.Read(make([]byte, 16))
+		conn.Read(make([]byte, 16))
+		trace.flushPendingRead()
+		events := trace.NetworkEvents()
+		if diff := cmp.Diff([]int64{0, 3}, streamOffsets(t, events, netxlite.ReadOperation)); diff != "" {
+			t.Fatal(diff)
+		}
+		last := events[len(events)-1]
+		if diff := cmp.Diff([]string{"cumulative_bytes=15", "stream_offset=3"}, last.Tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
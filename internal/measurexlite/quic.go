@@ -52,7 +52,7 @@ func (tx *Trace) OnQUICHandshakeStart(now time.Time, remoteAddr string, config *
 	t := now.Sub(tx.ZeroTime)
 	select {
 	case tx.networkEvent <- NewAnnotationArchivalNetworkEvent(
-		tx.Index, t, "quic_handshake_start", tx.tags...):
+		tx.Index, t, "quic_handshake_start", tx.currentTags()...):
 	default:
 	}
 }
@@ -77,14 +77,14 @@ func (tx *Trace) OnQUICHandshakeDone(started time.Time, remoteAddr string, qconn
 		state,
 		err,
 		t,
-		tx.tags...,
+		tx.currentTags()...,
 	):
 	default: // buffer is full
 	}
 
 	select {
 	case tx.networkEvent <- NewAnnotationArchivalNetworkEvent(
-		tx.Index, t, "quic_handshake_done", tx.tags...):
+		tx.Index, t, "quic_handshake_done", tx.currentTags()...):
 	default: // buffer is full
 	}
 }
@@ -0,0 +1,41 @@
+package measurexlite
+
+//
+// QUIC connection ID tracking
+//
+
+import (
+	"encoding/hex"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// SetQUICConnectionID configures the QUIC connection ID used by the given conn,
+// which MUST have been wrapped by this trace using [*Trace.MaybeWrapUDPLikeConn]
+// or [*Trace.MaybeWrapUDPLikeConnWithContext]. Once set, the ReadFrom and WriteTo
+// network events of the conn include a "quic_conn_id=HEX" tag, which allows one
+// to correlate network events with QUIC connections. Calling this method again
+// replaces the connection ID. This method returns false, without doing anything,
+// if the conn has not been wrapped by this trace.
+func (tx *Trace) SetQUICConnectionID(conn model.UDPLikeConn, id []byte) bool {
+	c, good := conn.(*udpLikeConnTrace)
+	if !good || c.tx != tx {
+		return false
+	}
+	c.connIDMu.Lock()
+	c.connIDTag = "quic_conn_id=" + hex.EncodeToString(id)
+	c.connIDMu.Unlock()
+	return true
+}
+
+// extraTags returns the extra tags for the conn events, including the
+// QUIC connection ID tag, if configured.
+func (c *udpLikeConnTrace) extraTags() []string {
+	c.connIDMu.Lock()
+	tag := c.connIDTag
+	c.connIDMu.Unlock()
+	if tag == "" {
+		return c.extra
+	}
+	return append(append([]string{}, c.extra...), tag)
+}
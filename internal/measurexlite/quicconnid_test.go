@@ -0,0 +1,85 @@
+package measurexlite
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+)
+
+func TestSetQUICConnectionID(t *testing.T) {
+	remoteAddr := &mocks.Addr{
+		MockString: func() string {
+			return "1.1.1.1:443"
+		},
+		MockNetwork: func() string {
+			return "udp"
+		},
+	}
+
+	newUDPLikeConn := func() *mocks.UDPLikeConn {
+		return &mocks.UDPLikeConn{
+			MockReadFrom: func(p []byte) (int, net.Addr, error) {
+				return len(p), remoteAddr, nil
+			},
+			MockWriteTo: func(p []byte, addr net.Addr) (int, error) {
+				return len(p), nil
+			},
+		}
+	}
+
+	// collectTags returns the tags of all the network events inside the trace
+	collectTags := func(trace *Trace) (out [][]string) {
+		for _, ev := range trace.NetworkEvents() {
+			out = append(out, ev.Tags)
+		}
+		return
+	}
+
+	t.Run("events include the configured connection ID", func(t *testing.T) {
+		trace := NewTrace(0, time.Now(), "antani")
+		conn := trace.MaybeWrapUDPLikeConn(newUDPLikeConn())
+		conn.WriteTo(make([]byte, 4), remoteAddr)
+		if !trace.SetQUICConnectionID(conn, []byte{0xde, 0xad, 0xbe, 0xef}) {
+			t.Fatal("expected to set the connection ID")
+		}
+		conn.ReadFrom(make([]byte, 4))
+		conn.WriteTo(make([]byte, 4), remoteAddr)
+		expect := [][]string{
+			{"antani"},
+			{"antani", "quic_conn_id=deadbeef"},
+			{"antani", "quic_conn_id=deadbeef"},
+		}
+		if diff := cmp.Diff(expect, collectTags(trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("the connection ID tag follows the request ID tag", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		ctx := WithRequestID(context.Background(), "abc")
+		conn := trace.MaybeWrapUDPLikeConnWithContext(ctx, newUDPLikeConn())
+		trace.SetQUICConnectionID(conn, []byte{0x01})
+		trace.SetQUICConnectionID(conn, []byte{0x02}) // replaces the previous ID
+		conn.ReadFrom(make([]byte, 4))
+		expect := [][]string{{"request_id=abc", "quic_conn_id=02"}}
+		if diff := cmp.Diff(expect, collectTags(trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we refuse conns not wrapped by the trace", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		if trace.SetQUICConnectionID(newUDPLikeConn(), []byte{0x01}) {
+			t.Fatal("expected false for an unwrapped conn")
+		}
+		other := NewTrace(1, time.Now())
+		conn := other.MaybeWrapUDPLikeConn(newUDPLikeConn())
+		if trace.SetQUICConnectionID(conn, []byte{0x01}) {
+			t.Fatal("expected false for a conn wrapped by another trace")
+		}
+	})
+}
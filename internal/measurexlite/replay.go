@@ -0,0 +1,61 @@
+package measurexlite
+
+//
+// Replaying recorded network events
+//
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// MarshalNetworkEvents serializes the given network events, e.g., the ones returned
+// by [*Trace.NetworkEvents], to JSON, such that one could save them into a fixture
+// and later replay them using [UnmarshalNetworkEvents] and [*Trace.ReplayNetworkEvents].
+// We always emit an empty list rather than null when there are no events.
+func MarshalNetworkEvents(events []*model.ArchivalNetworkEvent) ([]byte, error) {
+	return json.Marshal(copyAndNormalizeSlice(events))
+}
+
+// ErrNullNetworkEvent indicates that [UnmarshalNetworkEvents] found a null event.
+var ErrNullNetworkEvent = errors.New("measurexlite: null network event")
+
+// UnmarshalNetworkEvents is the inverse of [MarshalNetworkEvents]. This function
+// returns [ErrNullNetworkEvent] if the list contains null events, which we cannot
+// replay and which [MarshalNetworkEvents] would not have produced.
+func UnmarshalNetworkEvents(data []byte) ([]*model.ArchivalNetworkEvent, error) {
+	var events []*model.ArchivalNetworkEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+	for _, ev := range events {
+		if ev == nil {
+			return nil, ErrNullNetworkEvent
+		}
+	}
+	return copyAndNormalizeSlice(events), nil
+}
+
+// ErrNetworkEventBufferFull indicates that the network-events channel buffer is full.
+var ErrNetworkEventBufferFull = errors.New(
+	"measurexlite: the network-events channel buffer is full")
+
+// ReplayNetworkEvents pushes the given network events, e.g., the ones returned by
+// [UnmarshalNetworkEvents], onto the network-events channel, after the events that
+// are already buffered, such that [*Trace.NetworkEvents] returns them as if we had
+// observed them live. We do not modify the events. This function stops and returns
+// [ErrNetworkEventBufferFull] if the channel buffer is full, in which case we have
+// only replayed the events preceding the first one we could not push.
+func (tx *Trace) ReplayNetworkEvents(events []*model.ArchivalNetworkEvent) error {
+	tx.flushPendingRead() // make sure we emit events in order
+	for _, ev := range events {
+		select {
+		case tx.networkEvent <- ev:
+		default:
+			return ErrNetworkEventBufferFull
+		}
+	}
+	return nil
+}
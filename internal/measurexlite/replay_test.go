@@ -0,0 +1,145 @@
+package measurexlite
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestReplayNetworkEvents(t *testing.T) {
+	// newEvents returns the network events observed by a trace using a conn
+	// whose first read succeeds, whose second read fails, and whose writes succeed.
+	newEvents := func(t *testing.T) []*model.ArchivalNetworkEvent {
+		var reads int
+		conn := &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				if reads++; reads > 1 {
+					return 0, io.EOF
+				}
+				return len(b), nil
+			},
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return &mocks.Addr{
+					MockString: func() string {
+						return "1.1.1.1:443"
+					},
+					MockNetwork: func() string {
+						return "tcp"
+					},
+				}
+			},
+		}
+		trace := NewTrace(0, time.Now(), "golden")
+		wrapped := trace.MaybeWrapNetConn(conn)
+		wrapped.Write(make([]byte, 16))
+		wrapped.Read(make([]byte, 32))
+		wrapped.Read(make([]byte, 32))
+		events := trace.NetworkEvents()
+		if len(events) != 3 {
+			t.Fatal("unexpected number of events", len(events))
+		}
+		return events
+	}
+
+	t.Run("we can round-trip events", func(t *testing.T) {
+		events := newEvents(t)
+		data, err := MarshalNetworkEvents(events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := UnmarshalNetworkEvents(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(events, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("replaying yields the same drain", func(t *testing.T) {
+		events := newEvents(t)
+		data, err := MarshalNetworkEvents(events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed, err := UnmarshalNetworkEvents(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trace := NewTrace(0, time.Now())
+		if err := trace.ReplayNetworkEvents(replayed); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(events, trace.NetworkEvents()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we marshal no events as an empty list", func(t *testing.T) {
+		data, err := MarshalNetworkEvents(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "[]" {
+			t.Fatal("unexpected data", string(data))
+		}
+		events, err := UnmarshalNetworkEvents(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if events == nil || len(events) != 0 {
+			t.Fatal("expected an empty non-nil list", events)
+		}
+	})
+
+	t.Run("we reject invalid data", func(t *testing.T) {
+		type testcase struct {
+			name   string
+			data   string
+			expect error
+		}
+		cases := []testcase{{
+			name:   "with invalid JSON",
+			data:   "{",
+			expect: nil, // we just check that there is an error
+		}, {
+			name:   "with null events",
+			data:   `[{"operation":"read"},null]`,
+			expect: ErrNullNetworkEvent,
+		}}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				events, err := UnmarshalNetworkEvents([]byte(tc.data))
+				if err == nil || (tc.expect != nil && !errors.Is(err, tc.expect)) {
+					t.Fatal("unexpected error", err)
+				}
+				if events != nil {
+					t.Fatal("expected nil events")
+				}
+			})
+		}
+	})
+
+	t.Run("we fail when the buffer is full", func(t *testing.T) {
+		events := make([]*model.ArchivalNetworkEvent, NetworkEventBufferSize+1)
+		for idx := range events {
+			events[idx] = &model.ArchivalNetworkEvent{Operation: "read", NumBytes: int64(idx)}
+		}
+		trace := NewTrace(0, time.Now())
+		if err := trace.ReplayNetworkEvents(events); !errors.Is(err, ErrNetworkEventBufferFull) {
+			t.Fatal("unexpected error", err)
+		}
+		if diff := cmp.Diff(events[:NetworkEventBufferSize], trace.NetworkEvents()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package measurexlite
+
+//
+// Request ID propagation
+//
+
+import (
+	"context"
+	"net"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// requestIDKey is the context key for the request ID.
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of the given context carrying the given
+// request ID. When you dial using the dialers created by a [*Trace] (e.g.,
+// [*Trace.NewDialerWithoutResolver]) and a context carrying a request ID, we
+// include the request ID in the tags of the conn network events. The netxlite
+// dialers pass us the dial context by calling [*Trace.MaybeWrapNetConnWithContext]
+// or [*Trace.MaybeWrapUDPLikeConnWithContext], which you can also call directly.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// ContextRequestID returns the request ID set using [WithRequestID] or
+// an empty string if the context does not carry any request ID.
+func ContextRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDTags returns the tags to attach to network events for the request
+// ID carried by the given context, if any, or nil otherwise.
+func requestIDTags(ctx context.Context) []string {
+	if id := ContextRequestID(ctx); id != "" {
+		return []string{"request_id=" + id}
+	}
+	return nil
+}
+
+// MaybeWrapNetConnWithContext is like [*Trace.MaybeWrapNetConn] but additionally
+// tags the network events with the request ID carried by the context, if any.
+func (tx *Trace) MaybeWrapNetConnWithContext(ctx context.Context, conn net.Conn) net.Conn {
+	return &connTrace{
+		Conn:  conn,
+		tx:    tx,
+		extra: append(append(tx.connIndexTags(), requestIDTags(ctx)...), tx.interfaceTags(conn)...),
+	}
+}
+
+// MaybeWrapUDPLikeConnWithContext is like [*Trace.MaybeWrapUDPLikeConn] but additionally
+// tags the network events with the request ID carried by the context, if any.
+func (tx *Trace) MaybeWrapUDPLikeConnWithContext(
+	ctx context.Context, conn model.UDPLikeConn) model.UDPLikeConn {
+	return &udpLikeConnTrace{
+		UDPLikeConn: conn,
+		tx:          tx,
+		extra:       append(tx.connIndexTags(), requestIDTags(ctx)...),
+	}
+}
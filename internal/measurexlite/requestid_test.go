@@ -0,0 +1,145 @@
+package measurexlite
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestContextRequestID(t *testing.T) {
+	t.Run("without a request ID", func(t *testing.T) {
+		if id := ContextRequestID(context.Background()); id != "" {
+			t.Fatal("unexpected request ID", id)
+		}
+	})
+
+	t.Run("with a request ID", func(t *testing.T) {
+		ctx := WithRequestID(context.Background(), "abc")
+		if id := ContextRequestID(ctx); id != "abc" {
+			t.Fatal("unexpected request ID", id)
+		}
+	})
+}
+
+func TestMaybeWrapConnWithContext(t *testing.T) {
+	remoteAddr := &mocks.Addr{
+		MockString: func() string {
+			return "1.1.1.1:443"
+		},
+		MockNetwork: func() string {
+			return "tcp"
+		},
+	}
+
+	newNetConn := func() net.Conn {
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return remoteAddr
+			},
+		}
+	}
+
+	newUDPLikeConn := func() *mocks.UDPLikeConn {
+		return &mocks.UDPLikeConn{
+			MockReadFrom: func(p []byte) (int, net.Addr, error) {
+				return len(p), remoteAddr, nil
+			},
+			MockWriteTo: func(p []byte, addr net.Addr) (int, error) {
+				return len(p), nil
+			},
+		}
+	}
+
+	// collectTags returns the tags of all the network events inside the trace
+	collectTags := func(trace *Trace) (out [][]string) {
+		for _, ev := range trace.NetworkEvents() {
+			out = append(out, ev.Tags)
+		}
+		return
+	}
+
+	t.Run("net.Conn events include the request ID", func(t *testing.T) {
+		trace := NewTrace(0, time.Now(), "antani")
+		ctx := WithRequestID(context.Background(), "abc")
+		conn := trace.MaybeWrapNetConnWithContext(ctx, newNetConn())
+		conn.Read(make([]byte, 4))
+		conn.Write(make([]byte, 4))
+		expect := [][]string{{"antani", "request_id=abc"}, {"antani", "request_id=abc"}}
+		if diff := cmp.Diff(expect, collectTags(trace)); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff([]string{"antani"}, trace.Tags()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("model.UDPLikeConn events include the request ID", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		ctx := WithRequestID(context.Background(), "abc")
+		conn := trace.MaybeWrapUDPLikeConnWithContext(ctx, newUDPLikeConn())
+		conn.ReadFrom(make([]byte, 4))
+		conn.WriteTo(make([]byte, 4), remoteAddr)
+		expect := [][]string{{"request_id=abc"}, {"request_id=abc"}}
+		if diff := cmp.Diff(expect, collectTags(trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("nothing changes without a request ID", func(t *testing.T) {
+		trace := NewTrace(0, time.Now(), "antani")
+		conn := trace.MaybeWrapNetConnWithContext(context.Background(), newNetConn())
+		conn.Read(make([]byte, 4))
+		expect := [][]string{{"antani"}}
+		if diff := cmp.Diff(expect, collectTags(trace)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestRequestIDWithDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}()
+
+	trace := NewTrace(0, time.Now())
+	dialer := trace.NewDialerWithoutResolver(model.DiscardLogger)
+	ctx := WithRequestID(context.Background(), "abc")
+	conn, err := dialer.DialContext(ctx, "tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("antani"))
+	conn.Close()
+
+	var tags [][]string
+	for _, ev := range trace.NetworkEvents() {
+		if ev.Operation == netxlite.WriteOperation {
+			tags = append(tags, ev.Tags)
+		}
+	}
+	expect := [][]string{{"request_id=abc"}}
+	if diff := cmp.Diff(expect, tags); diff != "" {
+		t.Fatal(diff)
+	}
+}
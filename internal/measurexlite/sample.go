@@ -0,0 +1,61 @@
+package measurexlite
+
+//
+// Sampling network events
+//
+
+import (
+	"sync"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// eventSampler decides which network events of a conn to emit when
+// [*Trace.SampleEveryN] is greater than one. The zero value is ready to use.
+type eventSampler struct {
+	// count is the number of events we have seen so far.
+	count int64
+
+	// skipped is the last event we did not emit, if any.
+	skipped *model.ArchivalNetworkEvent
+
+	// mu protects the fields of this struct from concurrent access.
+	mu sync.Mutex
+}
+
+// sampleNetworkEvent returns whether we should emit the given network event. We always
+// emit the first event, the failed events, and one in SampleEveryN events. We remember
+// the last event we did not emit, such that we can emit it when the conn is closed.
+func (tx *Trace) sampleNetworkEvent(s *eventSampler, ev *model.ArchivalNetworkEvent) bool {
+	if tx.SampleEveryN <= 1 {
+		return true
+	}
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	idx := s.count
+	s.count++
+	if idx == 0 || ev.Failure != nil || idx%int64(tx.SampleEveryN) == 0 {
+		s.skipped = nil
+		return true
+	}
+	s.skipped = ev
+	return false
+}
+
+// flushSampledNetworkEvents emits the last event we did not emit, if any, such that
+// the archival data contains the last event of the conn. We call this method when
+// the conn is closed.
+func (tx *Trace) flushSampledNetworkEvents(s *eventSampler) {
+	s.mu.Lock()
+	ev := s.skipped
+	s.skipped = nil
+	s.mu.Unlock()
+	if ev == nil {
+		return
+	}
+	tx.flushPendingRead() // make sure we emit events in order
+	select {
+	case tx.networkEvent <- ev:
+	default: // buffer is full
+	}
+}
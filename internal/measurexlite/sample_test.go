@@ -0,0 +1,155 @@
+package measurexlite
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestSampleEveryN(t *testing.T) {
+	tcpAddr := &mocks.Addr{
+		MockString: func() string {
+			return "1.1.1.1:443"
+		},
+		MockNetwork: func() string {
+			return "tcp"
+		},
+	}
+
+	const (
+		numReads = 400
+		readSize = 16
+	)
+
+	// failing contains the indexes of the reads that fail
+	failing := map[int]bool{3: true, 157: true, 311: true}
+
+	// newConn returns a conn whose reads fail at the failing indexes
+	newConn := func() *mocks.Conn {
+		var idx int
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				defer func() { idx++ }()
+				if failing[idx] {
+					return 0, netxlite.ECONNRESET
+				}
+				return readSize, nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return tcpAddr
+			},
+			MockClose: func() error {
+				return nil
+			},
+		}
+	}
+
+	// countFailures returns the number of failed events
+	countFailures := func(events []*model.ArchivalNetworkEvent) (count int) {
+		for _, ev := range events {
+			if ev.Failure != nil {
+				count++
+			}
+		}
+		return
+	}
+
+	// run performs the reads and closes the conn using a trace with the given sampling
+	run := func(sampleEveryN int) (*Trace, []*model.ArchivalNetworkEvent) {
+		trace := NewTrace(0, time.Now())
+		trace.SampleEveryN = sampleEveryN
+		conn := trace.MaybeWrapNetConn(newConn())
+		buffer := make([]byte, readSize)
+		for idx := 0; idx < numReads; idx++ {
+			conn.Read(buffer)
+		}
+		conn.Close()
+		return trace, trace.NetworkEvents()
+	}
+
+	t.Run("with sampling we emit roughly one in N events", func(t *testing.T) {
+		const sampleEveryN = 10
+		trace, events := run(sampleEveryN)
+
+		// we expect one in N reads, the failed reads, and the last read
+		expectMin, expectMax := numReads/sampleEveryN, numReads/sampleEveryN+len(failing)+1
+		if len(events) < expectMin || len(events) > expectMax {
+			t.Fatal("unexpected number of events", len(events))
+		}
+
+		t.Run("we never drop failed events", func(t *testing.T) {
+			if count := countFailures(events); count != len(failing) {
+				t.Fatal("unexpected number of failed events", count)
+			}
+		})
+
+		t.Run("we emit the first and the last event", func(t *testing.T) {
+			if events[0].T0 > events[1].T0 {
+				t.Fatal("events are not sorted")
+			}
+			last := events[len(events)-1]
+			for _, ev := range events {
+				if ev.T0 > last.T0 {
+					t.Fatal("the last emitted event is not the last event")
+				}
+			}
+		})
+
+		t.Run("we account for all the bytes", func(t *testing.T) {
+			expect := int64((numReads - len(failing)) * readSize)
+			if got := trace.CloneBytesReceivedMap()["1.1.1.1:443 tcp"]; got != expect {
+				t.Fatal("expected", expect, "got", got)
+			}
+		})
+	})
+
+	t.Run("without sampling we emit all the events", func(t *testing.T) {
+		for _, sampleEveryN := range []int{-1, 0, 1} {
+			trace := NewTrace(0, time.Now())
+			trace.SampleEveryN = sampleEveryN
+			conn := trace.MaybeWrapNetConn(newConn())
+			buffer := make([]byte, readSize)
+			for idx := 0; idx < NetworkEventBufferSize; idx++ {
+				conn.Read(buffer)
+			}
+			conn.Close()
+			if events := trace.NetworkEvents(); len(events) != NetworkEventBufferSize {
+				t.Fatal("unexpected number of events", len(events))
+			}
+		}
+	})
+}
+
+func TestEventSampler(t *testing.T) {
+	t.Run("we do not emit anything on close when the last event was emitted", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.SampleEveryN = 2
+		sampler := &eventSampler{}
+		for idx := 0; idx < 3; idx++ {
+			ev := &model.ArchivalNetworkEvent{}
+			if got := trace.sampleNetworkEvent(sampler, ev); got != (idx%2 == 0) {
+				t.Fatal("unexpected sampling decision for", idx)
+			}
+		}
+		trace.flushSampledNetworkEvents(sampler)
+		if events := trace.NetworkEvents(); len(events) != 0 {
+			t.Fatal("expected no events", len(events))
+		}
+	})
+
+	t.Run("we always emit failed events", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.SampleEveryN = 1000
+		sampler := &eventSampler{}
+		trace.sampleNetworkEvent(sampler, &model.ArchivalNetworkEvent{})
+		failure := errors.New("mocked error").Error()
+		if !trace.sampleNetworkEvent(sampler, &model.ArchivalNetworkEvent{Failure: &failure}) {
+			t.Fatal("expected to emit the failed event")
+		}
+	})
+}
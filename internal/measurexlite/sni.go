@@ -0,0 +1,39 @@
+package measurexlite
+
+//
+// Recording the SNI sent in the ClientHello
+//
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+)
+
+// sniTags returns the "sni=NAME" tag for the given config when RecordSNI is
+// true. We return nil when RecordSNI is false or the config is nil.
+func (tx *Trace) sniTags(config *tls.Config) []string {
+	if !tx.RecordSNI || config == nil {
+		return nil
+	}
+	return []string{"sni=" + TLSClientHelloSNI(config.ServerName)}
+}
+
+// TLSClientHelloSNI returns the SNI that crypto/tls, as well as utls, includes
+// into the ClientHello when the configured ServerName is serverName. Because the
+// SNI MUST NOT contain IP addresses, we return an empty string when serverName is
+// an IP address, meaning that the ClientHello does not contain any SNI. Otherwise,
+// we return serverName without any trailing dot.
+func TLSClientHelloSNI(serverName string) string {
+	host := serverName
+	if len(host) > 0 && host[0] == '[' && host[len(host)-1] == ']' {
+		host = host[1 : len(host)-1]
+	}
+	if idx := strings.LastIndex(host, "%"); idx > 0 {
+		host = host[:idx]
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return strings.TrimRight(serverName, ".")
+}
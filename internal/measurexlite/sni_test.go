@@ -0,0 +1,112 @@
+package measurexlite
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestRecordSNI(t *testing.T) {
+	// handshake performs a TLS handshake using a mocked handshaker that
+	// emits the handshake result into the trace and returns the tags of
+	// the emitted handshake result.
+	handshake := func(t *testing.T, trace *Trace, serverName string) []string {
+		trace.Netx = &mocks.MeasuringNetwork{
+			MockNewTLSHandshakerStdlib: func(logger model.DebugLogger) model.TLSHandshaker {
+				return &mocks.TLSHandshaker{
+					MockHandshake: func(ctx context.Context, conn net.Conn, config *tls.Config) (model.TLSConn, error) {
+						started := time.Now()
+						netxlite.ContextTraceOrDefault(ctx).OnTLSHandshakeDone(
+							started, "1.1.1.1:443", config, tls.ConnectionState{}, nil, time.Now())
+						return &mocks.TLSConn{}, nil
+					},
+				}
+			},
+		}
+		thx := trace.NewTLSHandshakerStdlib(model.DiscardLogger)
+		config := &tls.Config{ServerName: serverName}
+		if _, err := thx.Handshake(context.Background(), &mocks.Conn{}, config); err != nil {
+			t.Fatal(err)
+		}
+		results := trace.TLSHandshakes()
+		if len(results) != 1 {
+			t.Fatal("expected a single handshake result")
+		}
+		if results[0].ServerName != serverName {
+			t.Fatal("unexpected ServerName", results[0].ServerName)
+		}
+		return results[0].Tags
+	}
+
+	t.Run("when RecordSNI is false", func(t *testing.T) {
+		trace := NewTrace(0, time.Now(), "antani")
+		tags := handshake(t, trace, "www.example.com")
+		if diff := cmp.Diff([]string{"antani"}, tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when RecordSNI is true", func(t *testing.T) {
+		trace := NewTrace(0, time.Now(), "antani")
+		trace.RecordSNI = true
+		tags := handshake(t, trace, "www.example.com.")
+		if diff := cmp.Diff([]string{"antani", "sni=www.example.com"}, tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when RecordSNI is true and the ServerName is an IP address", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordSNI = true
+		tags := handshake(t, trace, "1.1.1.1")
+		if diff := cmp.Diff([]string{"sni="}, tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+	t.Run("when RecordSNI is true and the config is nil", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		trace.RecordSNI = true
+		if tags := trace.sniTags(nil); tags != nil {
+			t.Fatal("expected nil tags", tags)
+		}
+	})
+}
+
+func TestTLSClientHelloSNI(t *testing.T) {
+	cases := []struct {
+		serverName string
+		expect     string
+	}{{
+		serverName: "",
+		expect:     "",
+	}, {
+		serverName: "www.example.com",
+		expect:     "www.example.com",
+	}, {
+		serverName: "www.example.com..",
+		expect:     "www.example.com",
+	}, {
+		serverName: "8.8.8.8",
+		expect:     "",
+	}, {
+		serverName: "[2001:4860:4860::8888]",
+		expect:     "",
+	}, {
+		serverName: "fe80::1%eth0",
+		expect:     "",
+	}}
+	for _, tc := range cases {
+		t.Run(tc.serverName, func(t *testing.T) {
+			if got := TLSClientHelloSNI(tc.serverName); got != tc.expect {
+				t.Fatal("expected", tc.expect, "got", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package measurexlite
+
+//
+// Detecting ClientHello splitting from archived network events
+//
+
+import (
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// DetectSNISplit returns whether the given network events, which MUST be sorted
+// by time, show that a TLS ClientHello, and hence the SNI, was split across
+// multiple writes. For each window between a "tls_handshake_start" and the
+// matching "tls_handshake_done" (or the end of the events), we consider the
+// conn of the first successful write as the one performing the handshake and
+// we count its successful writes before its first read. Because the server
+// cannot reply until it has received the whole ClientHello, more than one
+// such write means that the ClientHello was split.
+//
+// The events should belong to a single conn, as is the case when you use a
+// [*Trace] for each conn, because the annotations marking the handshake window
+// do not include the conn address, so we cannot otherwise tell which handshake
+// each write belongs to when several handshakes run concurrently.
+func DetectSNISplit(events []*model.ArchivalNetworkEvent) bool {
+	var (
+		inHandshake bool
+		address     string
+		writes      int
+		helloDone   bool
+	)
+	for _, ev := range events {
+		switch ev.Operation {
+		case "tls_handshake_start":
+			inHandshake, address, writes, helloDone = true, "", 0, false
+
+		case "tls_handshake_done":
+			if writes > 1 {
+				return true
+			}
+			inHandshake = false
+
+		case netxlite.WriteOperation:
+			if !inHandshake || helloDone || ev.Failure != nil || ev.NumBytes <= 0 {
+				continue
+			}
+			if address == "" {
+				address = ev.Address
+			}
+			if ev.Address == address {
+				writes++
+			}
+
+		case netxlite.ReadOperation:
+			if inHandshake && address != "" && ev.Address == address {
+				helloDone = true
+			}
+		}
+	}
+	return inHandshake && writes > 1
+}
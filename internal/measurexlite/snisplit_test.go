@@ -0,0 +1,129 @@
+package measurexlite
+
+import (
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestDetectSNISplit(t *testing.T) {
+	// newEvent creates a network event for the given operation and address.
+	newEvent := func(operation, address string, numBytes int64) *model.ArchivalNetworkEvent {
+		return &model.ArchivalNetworkEvent{
+			Address:   address,
+			NumBytes:  numBytes,
+			Operation: operation,
+		}
+	}
+
+	// newFailedEvent is like newEvent but the event has failed.
+	newFailedEvent := func(operation, address string) *model.ArchivalNetworkEvent {
+		failure := netxlite.FailureConnectionReset
+		ev := newEvent(operation, address, 0)
+		ev.Failure = &failure
+		return ev
+	}
+
+	const (
+		address      = "93.184.216.34:443"
+		otherAddress = "104.16.248.249:443"
+	)
+
+	type testcase struct {
+		name   string
+		events []*model.ArchivalNetworkEvent
+		expect bool
+	}
+
+	cases := []testcase{{
+		name:   "with no events",
+		events: nil,
+		expect: false,
+	}, {
+		name: "with an unsplit ClientHello",
+		events: []*model.ArchivalNetworkEvent{
+			newEvent("connect", address, 0),
+			newEvent("tls_handshake_start", "", 0),
+			newEvent(netxlite.WriteOperation, address, 517),
+			newEvent(netxlite.ReadOperation, address, 4096),
+			newEvent(netxlite.WriteOperation, address, 64),
+			newEvent("tls_handshake_done", "", 0),
+		},
+		expect: false,
+	}, {
+		name: "with a ClientHello split across two writes",
+		events: []*model.ArchivalNetworkEvent{
+			newEvent("connect", address, 0),
+			newEvent("tls_handshake_start", "", 0),
+			newEvent(netxlite.WriteOperation, address, 5),
+			newEvent(netxlite.WriteOperation, address, 512),
+			newEvent(netxlite.ReadOperation, address, 4096),
+			newEvent(netxlite.WriteOperation, address, 64),
+			newEvent("tls_handshake_done", "", 0),
+		},
+		expect: true,
+	}, {
+		name: "with a split ClientHello and no tls_handshake_done",
+		events: []*model.ArchivalNetworkEvent{
+			newEvent("tls_handshake_start", "", 0),
+			newEvent(netxlite.WriteOperation, address, 5),
+			newEvent(netxlite.WriteOperation, address, 512),
+		},
+		expect: true,
+	}, {
+		name: "with writes outside of the handshake window",
+		events: []*model.ArchivalNetworkEvent{
+			newEvent(netxlite.WriteOperation, address, 5),
+			newEvent(netxlite.WriteOperation, address, 512),
+			newEvent("tls_handshake_start", "", 0),
+			newEvent(netxlite.WriteOperation, address, 517),
+			newEvent(netxlite.ReadOperation, address, 4096),
+			newEvent("tls_handshake_done", "", 0),
+			newEvent(netxlite.WriteOperation, address, 128),
+			newEvent(netxlite.WriteOperation, address, 128),
+		},
+		expect: false,
+	}, {
+		name: "with writes of another conn during the handshake",
+		events: []*model.ArchivalNetworkEvent{
+			newEvent("tls_handshake_start", "", 0),
+			newEvent(netxlite.WriteOperation, address, 517),
+			newEvent(netxlite.WriteOperation, otherAddress, 128),
+			newEvent(netxlite.ReadOperation, address, 4096),
+			newEvent("tls_handshake_done", "", 0),
+		},
+		expect: false,
+	}, {
+		name: "with a failed write after the ClientHello",
+		events: []*model.ArchivalNetworkEvent{
+			newEvent("tls_handshake_start", "", 0),
+			newEvent(netxlite.WriteOperation, address, 517),
+			newFailedEvent(netxlite.WriteOperation, address),
+			newEvent("tls_handshake_done", "", 0),
+		},
+		expect: false,
+	}, {
+		name: "with a split ClientHello in the second handshake",
+		events: []*model.ArchivalNetworkEvent{
+			newEvent("tls_handshake_start", "", 0),
+			newEvent(netxlite.WriteOperation, address, 517),
+			newEvent(netxlite.ReadOperation, address, 4096),
+			newEvent("tls_handshake_done", "", 0),
+			newEvent("tls_handshake_start", "", 0),
+			newEvent(netxlite.WriteOperation, otherAddress, 5),
+			newEvent(netxlite.WriteOperation, otherAddress, 512),
+			newEvent(netxlite.ReadOperation, otherAddress, 4096),
+			newEvent("tls_handshake_done", "", 0),
+		},
+		expect: true,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DetectSNISplit(tc.events); got != tc.expect {
+				t.Fatal("expected", tc.expect, "got", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package measurexlite
+
+//
+// Source port verification
+//
+
+import (
+	"net"
+	"strconv"
+)
+
+// MaybeWrapNetConnWithSourcePort is like [*Trace.MaybeWrapNetConn] but additionally
+// verifies that the local port of the conn is the requested source port. The network
+// events of the conn include a "source_port=PORT" tag containing the actual local
+// port and, when it differs from the requested port, e.g., because of NAT rewriting
+// or because the dialer ignored our request, a "source_port_mismatch=REQUESTED" tag
+// containing the requested port. When we cannot determine the local port, we
+// only include the "source_port_mismatch=REQUESTED" tag.
+func (tx *Trace) MaybeWrapNetConnWithSourcePort(conn net.Conn, port int) net.Conn {
+	return &connTrace{
+		Conn:  conn,
+		tx:    tx,
+		extra: append(append(tx.connIndexTags(), sourcePortTags(conn, port)...), tx.interfaceTags(conn)...),
+	}
+}
+
+// sourcePortTags returns the tags describing the actual and requested source port.
+func sourcePortTags(conn net.Conn, requested int) []string {
+	mismatch := "source_port_mismatch=" + strconv.Itoa(requested)
+	addr := conn.LocalAddr()
+	if addr == nil {
+		return []string{mismatch}
+	}
+	_, portString, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return []string{mismatch}
+	}
+	actual, err := strconv.Atoi(portString)
+	if err != nil {
+		return []string{mismatch}
+	}
+	tags := []string{"source_port=" + portString}
+	if actual != requested {
+		tags = append(tags, mismatch)
+	}
+	return tags
+}
@@ -0,0 +1,75 @@
+package measurexlite
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+)
+
+func TestMaybeWrapNetConnWithSourcePort(t *testing.T) {
+	// newNetConn returns a conn whose local address is the given one.
+	newNetConn := func(localAddr net.Addr) net.Conn {
+		return &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockLocalAddr: func() net.Addr {
+				return localAddr
+			},
+			MockRemoteAddr: func() net.Addr {
+				return &net.TCPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 443}
+			},
+		}
+	}
+
+	type testcase struct {
+		name      string
+		localAddr net.Addr
+		requested int
+		expect    []string
+	}
+
+	cases := []testcase{{
+		name:      "when the local port is the requested port",
+		localAddr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 54321},
+		requested: 54321,
+		expect:    []string{"antani", "source_port=54321"},
+	}, {
+		name:      "when the local port differs from the requested port",
+		localAddr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 40000},
+		requested: 54321,
+		expect:    []string{"antani", "source_port=40000", "source_port_mismatch=54321"},
+	}, {
+		name:      "when the local address is nil",
+		localAddr: nil,
+		requested: 54321,
+		expect:    []string{"antani", "source_port_mismatch=54321"},
+	}, {
+		name: "when the local address has no port",
+		localAddr: &mocks.Addr{
+			MockString: func() string {
+				return "10.0.0.1"
+			},
+		},
+		requested: 54321,
+		expect:    []string{"antani", "source_port_mismatch=54321"},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			trace := NewTrace(0, time.Now(), "antani")
+			conn := trace.MaybeWrapNetConnWithSourcePort(newNetConn(tc.localAddr), tc.requested)
+			conn.Read(make([]byte, 4))
+			events := trace.NetworkEvents()
+			if len(events) != 1 {
+				t.Fatal("expected a single event")
+			}
+			if diff := cmp.Diff(tc.expect, events[0].Tags); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
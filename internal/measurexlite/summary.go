@@ -0,0 +1,92 @@
+package measurexlite
+
+//
+// Summarizing a trace for logging
+//
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// traceSummary collects the statistics returned by [*Trace.Summary].
+type traceSummary struct {
+	// bytesOut is the number of bytes we successfully wrote.
+	bytesOut int64
+
+	// finished is when the last network event finished.
+	finished time.Duration
+
+	// firstFailure is the failure of the first network event that failed.
+	firstFailure string
+
+	// mu protects the fields of this structure.
+	mu sync.Mutex
+
+	// reads is the number of read events.
+	reads int64
+
+	// started is when the first network event started.
+	started time.Duration
+
+	// writes is the number of write events.
+	writes int64
+}
+
+// onNetworkEvent updates the summary after a network event.
+func (ts *traceSummary) onNetworkEvent(
+	operation string, count int, err error, started, finished time.Duration) {
+	defer ts.mu.Unlock()
+	ts.mu.Lock()
+	if ts.reads+ts.writes <= 0 || started < ts.started {
+		ts.started = started
+	}
+	if finished > ts.finished {
+		ts.finished = finished
+	}
+	switch operation {
+	case netxlite.ReadOperation, netxlite.ReadFromOperation:
+		ts.reads++
+	case netxlite.WriteOperation, netxlite.WriteToOperation:
+		ts.writes++
+		ts.bytesOut += int64(count)
+	}
+	if err != nil && ts.firstFailure == "" {
+		ts.firstFailure = *NewFailure(err)
+	}
+}
+
+// Summary returns a one-line summary of the network events of the conns wrapped
+// by this trace, which is useful for debug logging. For example:
+//
+//	reads=42 writes=3 bytes_in=12345 bytes_out=678 span=1.5s first_failure=connection_reset
+//
+// where bytes_in is the total of the bytes received map, span is the time between
+// the start of the first network event and the end of the last one, and we only
+// include first_failure when a network event failed. Because we collect these
+// statistics when the conns emit network events, this function does not drain the
+// buffered events and also accounts for the events we dropped because the buffer
+// was full. However, it does not account for the other kinds of events (e.g., TLS
+// handshakes).
+func (tx *Trace) Summary() string {
+	var bytesIn int64
+	for _, count := range tx.CloneBytesReceivedMap() {
+		bytesIn += count
+	}
+	tx.summary.mu.Lock()
+	reads, writes := tx.summary.reads, tx.summary.writes
+	bytesOut, firstFailure := tx.summary.bytesOut, tx.summary.firstFailure
+	span := tx.summary.finished - tx.summary.started
+	tx.summary.mu.Unlock()
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "reads=%d writes=%d bytes_in=%d bytes_out=%d span=%s",
+		reads, writes, bytesIn, bytesOut, span)
+	if firstFailure != "" {
+		fmt.Fprintf(&builder, " first_failure=%s", firstFailure)
+	}
+	return builder.String()
+}
@@ -0,0 +1,74 @@
+package measurexlite
+
+import (
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+)
+
+func TestTraceSummary(t *testing.T) {
+	remoteAddr := &mocks.Addr{
+		MockString: func() string {
+			return "1.1.1.1:443"
+		},
+		MockNetwork: func() string {
+			return "tcp"
+		},
+	}
+
+	// newTrace returns a trace whose clock advances by one second each time we read it.
+	newTrace := func() *Trace {
+		zeroTime := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+		trace := NewTrace(0, zeroTime)
+		now := zeroTime
+		trace.timeNowFn = func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}
+		return trace
+	}
+
+	t.Run("for an empty trace", func(t *testing.T) {
+		trace := newTrace()
+		expect := "reads=0 writes=0 bytes_in=0 bytes_out=0 span=0s"
+		if got := trace.Summary(); got != expect {
+			t.Fatal("expected", expect, "got", got)
+		}
+	})
+
+	t.Run("for a trace with known activity", func(t *testing.T) {
+		trace := newTrace()
+		reads := []error{nil, nil, syscall.ECONNRESET, io.EOF}
+		conn := trace.MaybeWrapNetConn(&mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				err := reads[0]
+				reads = reads[1:]
+				if err != nil {
+					return 0, err
+				}
+				return 10, nil
+			},
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockRemoteAddr: func() net.Addr {
+				return remoteAddr
+			},
+		})
+		conn.Write(make([]byte, 7))
+		for idx := 0; idx < 4; idx++ {
+			conn.Read(make([]byte, 16))
+		}
+		expect := "reads=4 writes=1 bytes_in=20 bytes_out=7 span=9s first_failure=connection_reset"
+		if got := trace.Summary(); got != expect {
+			t.Fatal("expected", expect, "got", got)
+		}
+		if events := trace.NetworkEvents(); len(events) != 5 {
+			t.Fatal("expected Summary not to drain the events", len(events))
+		}
+	})
+}
@@ -44,7 +44,7 @@ func (tx *Trace) OnTLSHandshakeStart(now time.Time, remoteAddr string, config *t
 	t := now.Sub(tx.ZeroTime)
 	select {
 	case tx.networkEvent <- NewAnnotationArchivalNetworkEvent(
-		tx.Index, t, "tls_handshake_start", tx.tags...):
+		tx.Index, t, "tls_handshake_start", tx.currentTags()...):
 	default: // buffer is full
 	}
 }
@@ -64,14 +64,14 @@ func (tx *Trace) OnTLSHandshakeDone(started time.Time, remoteAddr string, config
 		state,
 		err,
 		t,
-		tx.tags...,
+		tx.tagsWithExtra(tx.sniTags(config))...,
 	):
 	default: // buffer is full
 	}
 
 	select {
 	case tx.networkEvent <- NewAnnotationArchivalNetworkEvent(
-		tx.Index, t, "tls_handshake_done", tx.tags...):
+		tx.Index, t, "tls_handshake_done", tx.currentTags()...):
 	default: // buffer is full
 	}
 }
@@ -5,7 +5,13 @@ package measurexlite
 //
 
 import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -30,11 +36,87 @@ type Trace struct {
 	// once you have constructed a trace MAY lead to data races.
 	Index int64
 
+	// CoalesceReads is an OPTIONAL flag. When it is true, we merge consecutive
+	// successful reads from the same endpoint into a single network event whose
+	// NumBytes is the sum of the bytes read and which spans from the beginning
+	// of the first read to the end of the last read. We emit the merged event
+	// when a read fails, when reading from another endpoint, when writing, and
+	// when draining the network events. Set this field before you start measuring
+	// to avoid data races.
+	CoalesceReads bool
+
 	// Netx is the network to use for measuring. The constructor inits this
 	// field using a [*netxlite.Netx]. You MAY override this field for testing. Make
 	// sure you do that before you start measuring to avoid data races.
 	Netx model.MeasuringNetwork
 
+	// RecordCaller is a debug-only OPTIONAL flag. When it is true, each emitted
+	// event includes a "caller=FILE:LINE" tag identifying the code emitting the
+	// event, i.e., the first caller outside of measurexlite and netxlite. Because
+	// this requires walking the stack using [runtime.Callers] for each event, you
+	// SHOULD NOT enable this flag in production. Set this field before you start
+	// measuring to avoid data races.
+	RecordCaller bool
+
+	// RecordInterface is an OPTIONAL flag. When it is true, the network
+	// events of the conns we wrap include an "interface=NAME" tag identifying
+	// the network interface owning the conn's local address. We cache the
+	// mapping between local addresses and interfaces to avoid enumerating
+	// the interfaces for each conn. Set this field before you start measuring
+	// to avoid data races.
+	RecordInterface bool
+
+	// RecordSNI is an OPTIONAL flag. When it is true, the TLS handshake
+	// results include an "sni=NAME" tag containing the SNI actually sent in
+	// the ClientHello, which may differ from the configured ServerName, e.g.,
+	// because we never send IP addresses as the SNI. An empty NAME means that
+	// the ClientHello did not include any SNI. Set this field before you start
+	// measuring to avoid data races.
+	RecordSNI bool
+
+	// RecordCumulativeBytes is an OPTIONAL flag. When it is true, the read
+	// events of the conns we wrap include a "cumulative_bytes=N" tag containing
+	// the total number of bytes received from the event's endpoint, including
+	// the bytes of the event itself, as stored in the bytes received map (see
+	// [*Trace.CloneBytesReceivedMap]). Set this field before you start measuring
+	// to avoid data races.
+	RecordCumulativeBytes bool
+
+	// RecordStreamOffsets is an OPTIONAL flag. When it is true, the read and
+	// write events of the conns we wrap include a "stream_offset=N" tag containing
+	// the number of bytes the conn received (for reads) or sent (for writes)
+	// before the event, which allows one to reconstruct the byte streams using
+	// the events. When we coalesce reads (see CoalesceReads), the offset is the
+	// one of the first read. Set this field before you start measuring to avoid
+	// data races.
+	RecordStreamOffsets bool
+
+	// RecordConnIndex is an OPTIONAL flag. When it is true, we assign each
+	// conn we wrap a unique index within this trace, starting from one, and
+	// the network events of the conn include a "conn_index=N" tag containing
+	// such an index, which allows one to tell apart the events of conns using
+	// the same endpoint (see [*Trace.EventsByConn]). Set this field before you
+	// start measuring to avoid data races.
+	RecordConnIndex bool
+
+	// FlagEmptyReads is an OPTIONAL flag. When it is true, the read events
+	// of the conns we wrap include an "empty-read" tag when the read returned
+	// zero bytes without any error, which allows one to tell apart these odd
+	// reads from other reads. Set this field before you start measuring to
+	// avoid data races.
+	FlagEmptyReads bool
+
+	// SampleEveryN OPTIONALLY enables sampling the network events of the conns
+	// we wrap to reduce the tracing overhead. When it is greater than one, for
+	// each conn we emit the first event, the failed events, roughly one in
+	// SampleEveryN events, and, when closing the conn, the last event if we did not
+	// emit it already. We still account for all the bytes received (see
+	// [*Trace.CloneBytesReceivedMap]) and for all the events in [*Trace.Summary].
+	// We ignore this field for reads when CoalesceReads is true. A value lower
+	// than or equal to one means that we emit all the events. Set this field
+	// before you start measuring to avoid data races.
+	SampleEveryN int
+
 	// bytesReceivedMap maps a remote host with the bytes we received
 	// from such a remote host. Accessing this map requires one to
 	// additionally hold the bytesReceivedMu mutex.
@@ -44,12 +126,30 @@ type Trace struct {
 	// access from multiple goroutines.
 	bytesReceivedMu *sync.Mutex
 
+	// connIndex is MANDATORY and generates the conn indexes when
+	// RecordConnIndex is true.
+	connIndex *atomic.Int64
+
 	// dnsLookup is MANDATORY and buffers DNS Lookup observations.
 	dnsLookup chan *model.ArchivalDNSLookupResult
 
 	// delayedDNSResponse is MANDATORY and buffers delayed DNS responses.
 	delayedDNSResponse chan *model.ArchivalDNSLookupResult
 
+	// dnsRoundTrip is MANDATORY and buffers DNS round trip observations.
+	dnsRoundTrip chan *model.ArchivalDNSRoundTripEvent
+
+	// interfaceByIPFn is the OPTIONAL function mapping a local IP address to
+	// the name of the corresponding network interface for testing.
+	interfaceByIPFn func(ip net.IP) string
+
+	// interfaceCache maps a local IP address to the name of the corresponding
+	// network interface. Accessing this map requires one to hold the interfaceMu mutex.
+	interfaceCache map[string]string
+
+	// interfaceMu protects interfaceCache from concurrent access.
+	interfaceMu *sync.Mutex
+
 	// networkEvent is MANDATORY and buffers network events.
 	networkEvent chan *model.ArchivalNetworkEvent
 
@@ -59,12 +159,30 @@ type Trace struct {
 	// tlsHandshake is MANDATORY and buffers TLS handshake observations.
 	tlsHandshake chan *model.ArchivalTLSOrQUICHandshakeResult
 
+	// pendingRead is the OPTIONAL coalesced read event we have not emitted
+	// yet. Accessing this field requires one to hold the pendingReadMu mutex.
+	pendingRead *model.ArchivalNetworkEvent
+
+	// pendingReadMu protects pendingRead from concurrent access.
+	pendingReadMu *sync.Mutex
+
 	// quicHandshake is MANDATORY and buffers QUIC handshake observations.
 	quicHandshake chan *model.ArchivalTLSOrQUICHandshakeResult
 
+	// summary is MANDATORY and collects the statistics returned by [*Trace.Summary].
+	summary *traceSummary
+
 	// tags contains OPTIONAL tags to tag measurements.
 	tags []string
 
+	// tagsScopes contains the extra tags added by [*Trace.WithTags] that
+	// are currently active. Accessing this field requires one to additionally
+	// hold the tagsMu mutex.
+	tagsScopes []*tagsScope
+
+	// tagsMu protects tagsScopes from concurrent access.
+	tagsMu *sync.Mutex
+
 	// timeNowFn is OPTIONAL and can be used to override calls to time.Now
 	// to produce deterministic timing when testing.
 	timeNowFn func() time.Time
@@ -86,6 +204,9 @@ const DNSLookupBufferSize = 8
 // DNSResponseBufferSize is the [*Trace] buffer size for delayed DNS responses events.
 const DelayedDNSResponseBufferSize = 8
 
+// DNSRoundTripBufferSize is the [*Trace] buffer size for DNS round trip events.
+const DNSRoundTripBufferSize = 8
+
 // TCPConnectBufferSize is the [*Trace] buffer size for TCP connect events.
 const TCPConnectBufferSize = 8
 
@@ -112,9 +233,14 @@ const QUICHandshakeBufferSize = 8
 func NewTrace(index int64, zeroTime time.Time, tags ...string) *Trace {
 	return &Trace{
 		Index:            index,
+		CoalesceReads:    false,                           // emit an event for each read by default
 		Netx:             &netxlite.Netx{Underlying: nil}, // use the host network
+		RecordCaller:     false,                           // only useful for debugging
+		RecordInterface:  false,                           // avoid the lookup cost by default
+		RecordSNI:        false,                           // preserve the default tags
 		bytesReceivedMap: make(map[string]int64),
 		bytesReceivedMu:  &sync.Mutex{},
+		connIndex:        &atomic.Int64{},
 		dnsLookup: make(
 			chan *model.ArchivalDNSLookupResult,
 			DNSLookupBufferSize,
@@ -123,6 +249,13 @@ func NewTrace(index int64, zeroTime time.Time, tags ...string) *Trace {
 			chan *model.ArchivalDNSLookupResult,
 			DelayedDNSResponseBufferSize,
 		),
+		dnsRoundTrip: make(
+			chan *model.ArchivalDNSRoundTripEvent,
+			DNSRoundTripBufferSize,
+		),
+		interfaceByIPFn: nil, // use default
+		interfaceCache:  make(map[string]string),
+		interfaceMu:     &sync.Mutex{},
 		networkEvent: make(
 			chan *model.ArchivalNetworkEvent,
 			NetworkEventBufferSize,
@@ -135,13 +268,18 @@ func NewTrace(index int64, zeroTime time.Time, tags ...string) *Trace {
 			chan *model.ArchivalTLSOrQUICHandshakeResult,
 			TLSHandshakeBufferSize,
 		),
+		pendingRead:   nil,
+		pendingReadMu: &sync.Mutex{},
 		quicHandshake: make(
 			chan *model.ArchivalTLSOrQUICHandshakeResult,
 			QUICHandshakeBufferSize,
 		),
-		tags:      tags,
-		timeNowFn: nil, // use default
-		ZeroTime:  zeroTime,
+		summary:    &traceSummary{},
+		tags:       tags,
+		tagsScopes: nil,
+		tagsMu:     &sync.Mutex{},
+		timeNowFn:  nil, // use default
+		ZeroTime:   zeroTime,
 	}
 }
 
@@ -158,9 +296,129 @@ func (tx *Trace) TimeSince(t0 time.Time) time.Duration {
 	return tx.TimeNow().Sub(t0)
 }
 
-// Tags returns a copy of the tags configured for this trace.
+// Tags returns a copy of the tags configured for this trace, including the
+// extra tags added by any [*Trace.WithTags] call that is currently running.
 func (tx *Trace) Tags() []string {
-	return copyAndNormalizeTags(tx.tags)
+	return copyAndNormalizeTags(tx.scopedTags())
+}
+
+// tagsScope contains the extra tags added by a single [*Trace.WithTags] call.
+type tagsScope struct {
+	tags []string
+}
+
+// WithTags calls fn and, for the duration of the call, appends the given extra
+// tags to the tags of every event emitted by this trace. This is useful to mark the
+// events belonging to a sub-phase of a measurement (e.g., "redirect-hop-2") without
+// creating a distinct [*Trace] for each sub-phase.
+//
+// It is safe to call this method from several goroutines and to nest calls. The
+// extra tags apply to the whole trace, hence events emitted by other goroutines
+// while fn is running will also include them. When there are several active
+// scopes, their tags are appended in the order in which the scopes started.
+func (tx *Trace) WithTags(extra []string, fn func()) {
+	scope := &tagsScope{tags: append([]string{}, extra...)}
+	tx.tagsMu.Lock()
+	tx.tagsScopes = append(tx.tagsScopes, scope)
+	tx.tagsMu.Unlock()
+	defer tx.removeTagsScope(scope)
+	fn()
+}
+
+// removeTagsScope removes the given scope from the active scopes.
+func (tx *Trace) removeTagsScope(scope *tagsScope) {
+	defer tx.tagsMu.Unlock()
+	tx.tagsMu.Lock()
+	for idx, entry := range tx.tagsScopes {
+		if entry == scope {
+			tx.tagsScopes = append(tx.tagsScopes[:idx:idx], tx.tagsScopes[idx+1:]...)
+			return
+		}
+	}
+}
+
+// currentTags returns the tags for an event, i.e., the tags returned by scopedTags
+// followed, when RecordCaller is true, by the tag identifying the code emitting the event.
+func (tx *Trace) currentTags() []string {
+	tags := tx.scopedTags()
+	if tx.RecordCaller {
+		tags = append(append([]string{}, tags...), callerTag())
+	}
+	return tags
+}
+
+// tagsWithExtra is like currentTags but adds the extra tags after the scoped tags.
+func (tx *Trace) tagsWithExtra(extra []string) []string {
+	tags := tx.scopedTags()
+	if len(extra) <= 0 && !tx.RecordCaller {
+		return tags
+	}
+	out := append(append([]string{}, tags...), extra...)
+	if tx.RecordCaller {
+		out = append(out, callerTag())
+	}
+	return out
+}
+
+// callerTagSkippedPackages contains the prefixes of the functions we skip when
+// searching for the code emitting an event, which is the first function outside of
+// these packages in the stack, except for the test functions of these packages.
+var callerTagSkippedPackages = []string{
+	"github.com/ooni/probe-cli/v3/internal/measurexlite.",
+	"github.com/ooni/probe-cli/v3/internal/netxlite.",
+	"github.com/ooni/probe-cli/v3/internal/netxlite/",
+}
+
+// callerTag returns the "caller=FILE:LINE" tag for the code emitting an event, i.e.,
+// the first frame in the stack outside of measurexlite and netxlite. We use the
+// file base name and return "caller=unknown" when we only find runtime frames.
+func callerTag() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && !callerTagShouldSkip(frame) {
+			if strings.HasPrefix(frame.Function, "runtime.") {
+				break
+			}
+			return fmt.Sprintf("caller=%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return "caller=unknown"
+}
+
+// callerTagShouldSkip returns whether callerTag should skip the given frame.
+func callerTagShouldSkip(frame runtime.Frame) bool {
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	for _, prefix := range callerTagSkippedPackages {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopedTags returns the tags configured for this trace followed by the
+// tags of the scopes created using [*Trace.WithTags] that are currently active.
+func (tx *Trace) scopedTags() []string {
+	if tx.tagsMu == nil {
+		return tx.tags // the trace has not been created using NewTrace
+	}
+	defer tx.tagsMu.Unlock()
+	tx.tagsMu.Lock()
+	if len(tx.tagsScopes) <= 0 {
+		return tx.tags
+	}
+	out := append([]string{}, tx.tags...)
+	for _, scope := range tx.tagsScopes {
+		out = append(out, scope.tags...)
+	}
+	return out
 }
 
 var _ model.Trace = &Trace{}
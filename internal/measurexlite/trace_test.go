@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
+	"runtime"
 	"syscall"
 	"testing"
 	"time"
@@ -100,6 +102,25 @@ func TestNewTrace(t *testing.T) {
 			}
 		})
 
+		t.Run("dnsRoundTrip has the expected buffer size", func(t *testing.T) {
+			ff := &testingx.FakeFiller{}
+			var idx int
+		Loop:
+			for {
+				ev := &model.ArchivalDNSRoundTripEvent{}
+				ff.Fill(ev)
+				select {
+				case trace.dnsRoundTrip <- ev:
+					idx++
+				default:
+					break Loop
+				}
+			}
+			if idx != DNSRoundTripBufferSize {
+				t.Fatal("invalid dnsRoundTrip channel buffer size")
+			}
+		})
+
 		t.Run("tcpConnect has the expected buffer size", func(t *testing.T) {
 			ff := &testingx.FakeFiller{}
 			var idx int
@@ -386,3 +407,125 @@ func TestTags(t *testing.T) {
 		t.Fatal(diff)
 	}
 }
+
+func TestWithTags(t *testing.T) {
+	underlying := &mocks.Conn{
+		MockRead: func(b []byte) (int, error) {
+			return len(b), nil
+		},
+		MockRemoteAddr: func() net.Addr {
+			return &mocks.Addr{
+				MockNetwork: func() string {
+					return "tcp"
+				},
+				MockString: func() string {
+					return "1.1.1.1:443"
+				},
+			}
+		},
+	}
+	trace := NewTrace(0, time.Now(), "antani")
+	conn := trace.MaybeWrapNetConn(underlying)
+	buffer := make([]byte, 128)
+
+	conn.Read(buffer)
+	trace.WithTags([]string{"redirect-hop-2"}, func() {
+		conn.Read(buffer)
+		trace.WithTags([]string{"nested"}, func() {
+			conn.Read(buffer)
+		})
+		if diff := cmp.Diff([]string{"antani", "redirect-hop-2"}, trace.Tags()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+	conn.Read(buffer)
+
+	expect := [][]string{
+		{"antani"},
+		{"antani", "redirect-hop-2"},
+		{"antani", "redirect-hop-2", "nested"},
+		{"antani"},
+	}
+	events := trace.NetworkEvents()
+	if len(events) != len(expect) {
+		t.Fatal("unexpected number of events", len(events))
+	}
+	for idx, ev := range events {
+		if diff := cmp.Diff(expect[idx], ev.Tags); diff != "" {
+			t.Fatal(idx, diff)
+		}
+	}
+	if diff := cmp.Diff([]string{"antani"}, trace.Tags()); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestRecordCaller(t *testing.T) {
+	underlying := &mocks.Conn{
+		MockRead: func(b []byte) (int, error) {
+			return len(b), nil
+		},
+		MockWrite: func(b []byte) (int, error) {
+			return len(b), nil
+		},
+		MockRemoteAddr: func() net.Addr {
+			return &mocks.Addr{
+				MockNetwork: func() string {
+					return "tcp"
+				},
+				MockString: func() string {
+					return "1.1.1.1:443"
+				},
+			}
+		},
+	}
+
+	t.Run("when enabled, events carry the emitting site", func(t *testing.T) {
+		trace := NewTrace(0, time.Now(), "antani")
+		trace.RecordCaller = true
+		conn := trace.MaybeWrapNetConn(underlying)
+		buffer := make([]byte, 128)
+		var lines []int
+		conn.Read(buffer)
+		lines = append(lines, currentLine()-1)
+		conn.Write(buffer)
+		lines = append(lines, currentLine()-1)
+		trace.OnConnectDone(time.Now(), "tcp", "", "1.1.1.1:443", nil, time.Now())
+		lines = append(lines, currentLine()-1)
+
+		events := trace.NetworkEvents()
+		if len(events) != 3 {
+			t.Fatal("unexpected number of events", len(events))
+		}
+		for idx, ev := range events {
+			expect := []string{"antani", fmt.Sprintf("caller=trace_test.go:%d", lines[idx])}
+			if diff := cmp.Diff(expect, ev.Tags); diff != "" {
+				t.Fatal(diff)
+			}
+		}
+
+		// make sure the caller tag does not leak into the trace tags
+		if diff := cmp.Diff([]string{"antani"}, trace.Tags()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when disabled, events do not carry the emitting site", func(t *testing.T) {
+		trace := NewTrace(0, time.Now(), "antani")
+		conn := trace.MaybeWrapNetConn(underlying)
+		conn.Read(make([]byte, 128))
+		events := trace.NetworkEvents()
+		if len(events) != 1 {
+			t.Fatal("unexpected number of events", len(events))
+		}
+		if diff := cmp.Diff([]string{"antani"}, events[0].Tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+// currentLine returns the line of the code calling currentLine.
+func currentLine() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line
+}
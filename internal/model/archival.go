@@ -207,6 +207,27 @@ type ArchivalDNSAnswer struct {
 	TTL        *uint32 `json:"ttl"`
 }
 
+// ArchivalDNSRoundTripEvent is the OONI data format representation of a DNS
+// round trip, which contains the raw query and reply bytes along with the transport
+// we used. The RawQuery and RawReply fields MAY contain only a prefix of the
+// original messages because we bound their size to avoid bloating measurements,
+// in which case Truncated is true.
+//
+// This data format is not specified yet. We use the names used by other
+// specifications and by the legacy measurex package.
+type ArchivalDNSRoundTripEvent struct {
+	Address       string             `json:"resolver_address"`
+	Failure       *string            `json:"failure"`
+	Network       string             `json:"engine"`
+	RawQuery      ArchivalBinaryData `json:"raw_query"`
+	RawReply      ArchivalBinaryData `json:"raw_reply"`
+	Started       float64            `json:"started"`
+	Finished      float64            `json:"t"`
+	Tags          []string           `json:"tags,omitempty"`
+	TransactionID int64              `json:"transaction_id,omitempty"`
+	Truncated     bool               `json:"truncated,omitempty"`
+}
+
 //
 // TCP connect
 //
@@ -28,10 +28,16 @@ type THTCPConnectResult struct {
 
 // THTLSHandshakeResult is the result of the TLS handshake
 // attempt performed by the control vantage point.
+//
+// The TLSVersion, NegotiatedProtocol, and CertificateSubject fields are
+// OPTIONAL and only set by test helpers configured to record them.
 type THTLSHandshakeResult struct {
-	ServerName string  `json:"server_name"`
-	Status     bool    `json:"status"`
-	Failure    *string `json:"failure"`
+	ServerName         string  `json:"server_name"`
+	Status             bool    `json:"status"`
+	Failure            *string `json:"failure"`
+	TLSVersion         string  `json:"tls_version,omitempty"`
+	NegotiatedProtocol string  `json:"negotiated_protocol,omitempty"`
+	CertificateSubject string  `json:"certificate_subject,omitempty"`
 }
 
 // THHTTPRequestResult is the result of the HTTP request
@@ -66,6 +72,11 @@ type THIPInfo struct {
 
 	// Flags contains flags describing this address.
 	Flags int64 `json:"flags"`
+
+	// ResolvedBy OPTIONALLY contains the sorted identities of the
+	// TH resolvers that resolved this address. This field is empty
+	// when only the probe resolved this address.
+	ResolvedBy []string `json:"resolved_by,omitempty"`
 }
 
 const (
@@ -83,6 +94,15 @@ const (
 	// THIPInfoFlagValidForDomain indicates that an IP address
 	// is valid for the domain because it works with TLS
 	THIPInfoFlagValidForDomain
+
+	// THIPInfoFlagProbeOnly indicates that the probe has resolved
+	// this IP address but the test helper has not, which may be
+	// a signal of DNS-based censorship (e.g., injection)
+	THIPInfoFlagProbeOnly
+
+	// THIPInfoFlagTHOnly indicates that the test helper has resolved
+	// this IP address but the probe has not
+	THIPInfoFlagTHOnly
 )
 
 // THResponse is the response from the control service.
@@ -94,4 +114,31 @@ type THResponse struct {
 	HTTP3Request  *THHTTPRequestResult            `json:"http3_request"` // optional!
 	DNS           THDNSResult                     `json:"dns"`
 	IPInfo        map[string]*THIPInfo            `json:"ip_info,omitempty"`
+
+	// XPartial indicates that the TH stopped measuring because the
+	// request context was done (e.g., the client disconnected) and that
+	// this response only contains the results collected so far.
+	XPartial bool `json:"x_partial,omitempty"`
+
+	// XDiagnostics OPTIONALLY contains diagnostics about how the TH
+	// produced this response, which operators could use for capacity
+	// planning. The TH only sets this field when configured to do so.
+	XDiagnostics *THDiagnostics `json:"x_diagnostics,omitempty"`
+}
+
+// THDiagnostics contains diagnostics about how the TH produced a response.
+type THDiagnostics struct {
+	// IPInfo OPTIONALLY contains stats about generating the IP info.
+	IPInfo *THIPInfoStats `json:"ip_info,omitempty"`
+}
+
+// THIPInfoStats contains stats about generating the IP info.
+type THIPInfoStats struct {
+	// Duration is the wall-clock time it took to generate the
+	// IP info, in seconds.
+	Duration float64 `json:"duration"`
+
+	// Lookups maps each IP address to the wall-clock time it took
+	// to look up its information (e.g., its ASN), in seconds.
+	Lookups map[string]float64 `json:"lookups"`
 }
@@ -58,3 +58,12 @@ const AddressBitly = "67.199.248.11"
 
 // AddressBadSSLCom is the IP address of badssl.com.
 const AddressBadSSLCom = "104.154.89.105"
+
+// AddressWwwGeoDifferentialOrg is the IP address for www.geodifferential.org.
+const AddressWwwGeoDifferentialOrg = "104.21.32.10"
+
+// AddressWwwStalledBodyOrg is the IP address for www.stalledbody.org.
+const AddressWwwStalledBodyOrg = "104.21.48.77"
+
+// AddressWwwStreamResetOrg is the IP address for www.streamreset.org.
+const AddressWwwStreamResetOrg = "104.21.64.19"
@@ -38,6 +38,15 @@ func (f *dnsOverUDPServerFactoryForGetaddrinfo) MustNewServer(env NetStackServer
 	return dnsOverUDPResolverMustNewServer(env.ISPResolverConfig(), env.Logger(), stack)
 }
 
+type dnsOverUDPServerFactoryForRootResolver struct{}
+
+var _ NetStackServerFactory = &dnsOverUDPServerFactoryForRootResolver{}
+
+// MustNewServer implements NetStackServerFactory.
+func (f *dnsOverUDPServerFactoryForRootResolver) MustNewServer(env NetStackServerFactoryEnv, stack *netem.UNetStack) NetStackServer {
+	return dnsOverUDPResolverMustNewServer(env.RootResolverConfig(), env.Logger(), stack)
+}
+
 // dnsOverUDPResolverMustNewServer is an internal factory for creating a [NetStackServer] that
 // runs a DNS-over-UDP server using the configured logger, DNS config, and stack.
 func dnsOverUDPResolverMustNewServer(config *netem.DNSConfig, logger model.Logger, stack *netem.UNetStack) NetStackServer {
@@ -14,6 +14,10 @@ import (
 //
 // Use this factory along with [QAEnvOptionNetStack] to create HTTPS servers.
 type HTTPSecureServerFactory struct {
+	// EnableHTTP2 OPTIONALLY allows clients to negotiate HTTP/2 using ALPN. By default,
+	// the server only supports HTTP/1.1.
+	EnableHTTP2 bool
+
 	// Factory is the MANDATORY factory for creating the [http.Handler].
 	Factory HTTPHandlerFactory
 
@@ -33,6 +37,7 @@ var _ NetStackServerFactory = &HTTPSecureServerFactory{}
 func (f *HTTPSecureServerFactory) MustNewServer(env NetStackServerFactoryEnv, stack *netem.UNetStack) NetStackServer {
 	return &httpSecureServer{
 		closers:          []io.Closer{},
+		enableHTTP2:      f.EnableHTTP2,
 		env:              env,
 		factory:          f.Factory,
 		mu:               sync.Mutex{},
@@ -45,6 +50,7 @@ func (f *HTTPSecureServerFactory) MustNewServer(env NetStackServerFactoryEnv, st
 
 type httpSecureServer struct {
 	closers          []io.Closer
+	enableHTTP2      bool
 	env              NetStackServerFactoryEnv
 	factory          HTTPHandlerFactory
 	mu               sync.Mutex
@@ -95,6 +101,9 @@ func (srv *httpSecureServer) mustListenPortLocked(handler http.Handler, ipAddr n
 
 	// create TLS config for the server name
 	tlsConfig := srv.unet.MustNewServerTLSConfig(srv.serverNameMain, srv.serverNameExtras...)
+	if srv.enableHTTP2 {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
 
 	// serve requests in a background goroutine
 	srvr := &http.Server{
@@ -12,9 +12,12 @@ import (
 )
 
 func TestHTTPSecureServerFactory(t *testing.T) {
-	t.Run("when using the TLSConfig provided by netem", func(t *testing.T) {
+	// measure fetches the webpage and returns the HTTP major version we used
+	measure := func(t *testing.T, enableHTTP2 bool) int {
+		var protoMajor int
 		env := MustNewQAEnv(
 			QAEnvOptionNetStack(AddressWwwExampleCom, &HTTPSecureServerFactory{
+				EnableHTTP2: enableHTTP2,
 				Factory: HTTPHandlerFactoryFunc(func(env NetStackServerFactoryEnv, stack *netem.UNetStack) http.Handler {
 					return ExampleWebPageHandler()
 				}),
@@ -45,6 +48,20 @@ func TestHTTPSecureServerFactory(t *testing.T) {
 			if diff := cmp.Diff(ExampleWebPage, string(data)); diff != "" {
 				t.Fatal(diff)
 			}
+			protoMajor = resp.ProtoMajor
 		})
+		return protoMajor
+	}
+
+	t.Run("when using the TLSConfig provided by netem", func(t *testing.T) {
+		if protoMajor := measure(t, false); protoMajor != 1 {
+			t.Fatal("unexpected ProtoMajor", protoMajor)
+		}
+	})
+
+	t.Run("when we enable HTTP/2", func(t *testing.T) {
+		if protoMajor := measure(t, true); protoMajor != 2 {
+			t.Fatal("unexpected ProtoMajor", protoMajor)
+		}
 	})
 }
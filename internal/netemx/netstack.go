@@ -14,8 +14,12 @@ type NetStackServerFactoryEnv interface {
 	Logger() model.Logger
 
 	// OtherResolversConfig returns the configuration used by all the
-	// DNS resolvers except the ISP's DNS resolver.
+	// DNS resolvers except the ISP's DNS resolver and the root resolver.
 	OtherResolversConfig() *netem.DNSConfig
+
+	// RootResolverConfig returns the configuration used by the root resolver,
+	// which is the DNS resolver used by the servers (e.g., the test helpers).
+	RootResolverConfig() *netem.DNSConfig
 }
 
 // NetStackServerFactory constructs a new [NetStackServer].
@@ -112,8 +112,9 @@ func TestOOHelperDHandler(t *testing.T) {
 			},
 			IPInfo: map[string]*model.THIPInfo{
 				"93.184.216.34": {
-					ASN:   15133,
-					Flags: 10,
+					ASN:        15133,
+					Flags:      42, // resolved by TH, valid for domain, TH only
+					ResolvedBy: []string{"th"},
 				},
 			},
 		}
@@ -129,9 +129,12 @@ type QAEnv struct {
 	// once ensures Close has "once" semantics.
 	once sync.Once
 
-	// otherResolversConfig is the DNS config used by non-ISP resolvers.
+	// otherResolversConfig is the DNS config used by non-ISP and non-root resolvers.
 	otherResolversConfig *netem.DNSConfig
 
+	// rootResolverConfig is the DNS config used by the root resolver.
+	rootResolverConfig *netem.DNSConfig
+
 	// topology is the topology we're using.
 	topology *netem.StarTopology
 }
@@ -155,7 +158,7 @@ func MustNewQAEnv(options ...QAEnvOption) *QAEnv {
 	qaEnvOptionNetStack(config.ispResolver, &dnsOverUDPServerFactoryForGetaddrinfo{})(config)
 
 	// make sure we're going to create the root DNS resolver.
-	qaEnvOptionNetStack(config.rootResolver, &DNSOverUDPServerFactory{})(config)
+	qaEnvOptionNetStack(config.rootResolver, &dnsOverUDPServerFactoryForRootResolver{})(config)
 
 	// use a prefix logger for the QA env
 	prefixLogger := &logx.PrefixLogger{
@@ -174,6 +177,7 @@ func MustNewQAEnv(options ...QAEnvOption) *QAEnv {
 		dpi:                       netem.NewDPIEngine(prefixLogger),
 		once:                      sync.Once{},
 		otherResolversConfig:      netem.NewDNSConfig(),
+		rootResolverConfig:        netem.NewDNSConfig(),
 		topology:                  netem.MustNewStarTopology(prefixLogger),
 	}
 
@@ -240,6 +244,7 @@ func (env *QAEnv) mustNewNetStacks(config *qaEnvConfig) (closables []io.Closer)
 func (env *QAEnv) AddRecordToAllResolvers(domain string, cname string, addrs ...string) {
 	env.ISPResolverConfig().AddRecord(domain, cname, addrs...)
 	env.OtherResolversConfig().AddRecord(domain, cname, addrs...)
+	env.RootResolverConfig().AddRecord(domain, cname, addrs...)
 }
 
 // ISPResolverConfig returns the [*netem.DNSConfig] of the ISP resolver. Note that can safely
@@ -253,12 +258,20 @@ func (env *QAEnv) Logger() model.Logger {
 	return env.baseLogger
 }
 
-// OtherResolversConfig returns the [*netem.DNSConfig] of the non-ISP resolvers. Note that can safely
-// add new DNS records from concurrent goroutines at any time.
+// OtherResolversConfig returns the [*netem.DNSConfig] of the non-ISP resolvers except the root
+// resolver. Note that can safely add new DNS records from concurrent goroutines at any time.
 func (env *QAEnv) OtherResolversConfig() *netem.DNSConfig {
 	return env.otherResolversConfig
 }
 
+// RootResolverConfig returns the [*netem.DNSConfig] of the root resolver, which is the resolver
+// used by the servers, including the test helpers. Use this config to emulate the control's
+// resolver returning different results than the probe's resolvers. Note that can safely add
+// new DNS records from concurrent goroutines at any time.
+func (env *QAEnv) RootResolverConfig() *netem.DNSConfig {
+	return env.rootResolverConfig
+}
+
 // DPIEngine returns the [*netem.DPIEngine] we're using on the
 // link between the client stack and the router. You can safely
 // add new DPI rules from concurrent goroutines at any time.
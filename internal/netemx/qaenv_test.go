@@ -2,6 +2,7 @@ package netemx_test
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"testing"
@@ -60,6 +61,40 @@ func TestQAEnv(t *testing.T) {
 		})
 	})
 
+	// Here we're testing that:
+	//
+	// 1. the root resolver, used by the servers, has its own DNS config, so we can
+	// emulate the control's resolver returning different answers than the probe's.
+	t.Run("the root resolver uses its own DNS config", func(t *testing.T) {
+		// create QA env
+		env := netemx.MustNewQAEnv()
+		defer env.Close()
+
+		// configure DNS
+		env.AddRecordToAllResolvers("www.example.com", "", "10.0.17.1")
+		env.RootResolverConfig().RemoveRecord("www.example.com")
+
+		env.Do(func() {
+			// create a resolver using the root resolver
+			dialer := netxlite.NewDialerWithoutResolver(model.DiscardLogger)
+			endpoint := net.JoinHostPort(netemx.RootResolverAddress, "53")
+			reso := netxlite.NewParallelUDPResolver(model.DiscardLogger, dialer, endpoint)
+			defer reso.CloseIdleConnections()
+
+			// lookup the hostname
+			ctx := context.Background()
+			addrs, err := reso.LookupHost(ctx, "www.example.com")
+
+			// verify that the root resolver returns NXDOMAIN
+			if err == nil || err.Error() != netxlite.FailureDNSNXDOMAINError {
+				t.Fatal("unexpected error", err)
+			}
+			if len(addrs) != 0 {
+				t.Fatal("expected no addrs")
+			}
+		})
+	})
+
 	// Here we're testing that:
 	//
 	// 1. we can get the expected answer for www.example.com;
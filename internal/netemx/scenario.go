@@ -56,6 +56,9 @@ type ScenarioDomainAddresses struct {
 	// ServerNameExtras contains OPTIONAL extra names to also configure into the cert.
 	ServerNameExtras []string
 
+	// WebServerEnableHTTP2 OPTIONALLY enables HTTP/2 when Role is ScenarioRoleWebServer.
+	WebServerEnableHTTP2 bool
+
 	// WebServerFactory is the factory to use when Role is ScenarioRoleWebServer.
 	WebServerFactory HTTPHandlerFactory
 }
@@ -86,6 +89,34 @@ var InternetScenario = []*ScenarioDomainAddresses{{
 	WebServerFactory: ExampleWebPageHandlerFactory(),
 	ServerNameMain:   "www.example.com",
 	ServerNameExtras: []string{"example.com", "www.example.org", "example.org"},
+}, {
+	Domains: []string{"www.geodifferential.org"},
+	Addresses: []string{
+		AddressWwwGeoDifferentialOrg,
+	},
+	Role:             ScenarioRoleWebServer,
+	WebServerFactory: GeoDifferentialWebPageHandlerFactory(),
+	ServerNameMain:   "www.geodifferential.org",
+	ServerNameExtras: []string{},
+}, {
+	Domains: []string{"www.stalledbody.org"},
+	Addresses: []string{
+		AddressWwwStalledBodyOrg,
+	},
+	Role:             ScenarioRoleWebServer,
+	WebServerFactory: StalledBodyWebPageHandlerFactory(),
+	ServerNameMain:   "www.stalledbody.org",
+	ServerNameExtras: []string{},
+}, {
+	Domains: []string{"www.streamreset.org"},
+	Addresses: []string{
+		AddressWwwStreamResetOrg,
+	},
+	Role:                 ScenarioRoleWebServer,
+	WebServerEnableHTTP2: true,
+	WebServerFactory:     StreamResetWebPageHandlerFactory(),
+	ServerNameMain:       "www.streamreset.org",
+	ServerNameExtras:     []string{},
 }, {
 	Domains: []string{"0.th.ooni.org"},
 	Addresses: []string{
@@ -221,6 +252,7 @@ func MustNewScenario(config []*ScenarioDomainAddresses) *QAEnv {
 						Ports:   []int{80},
 					},
 					&HTTPSecureServerFactory{
+						EnableHTTP2:      sad.WebServerEnableHTTP2,
 						Factory:          sad.WebServerFactory,
 						Ports:            []int{443},
 						ServerNameMain:   sad.ServerNameMain,
@@ -3,8 +3,10 @@ package netemx
 import (
 	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/ooni/netem"
+	"github.com/ooni/probe-cli/v3/internal/geoipx"
 	"github.com/ooni/probe-cli/v3/internal/runtimex"
 )
 
@@ -113,6 +115,18 @@ const Blockpage = `<!doctype html>
 </html>
 `
 
+// MetaRefreshBlockpage is a blockpage that uses an HTML meta refresh rather than an
+// HTTP redirect to bounce the user to the portal explaining why the website is blocked.
+const MetaRefreshBlockpage = `<!doctype html>
+<html>
+<head>
+	<title>Redirecting</title>
+	<meta http-equiv="refresh" content="0; url=http://blockpage.local/">
+</head>
+<body></body>
+</html>
+`
+
 // BlockpageHandlerFactory returns a blockpage regardless of the incoming domain.
 func BlockpageHandlerFactory() HTTPHandlerFactory {
 	return HTTPHandlerFactoryFunc(func(env NetStackServerFactoryEnv, stack *netem.UNetStack) http.Handler {
@@ -123,6 +137,58 @@ func BlockpageHandlerFactory() HTTPHandlerFactory {
 	})
 }
 
+// StalledBodyWebPageHandlerFactory returns an [HTTPHandlerFactory] that, for the clients
+// belonging to the [DefaultClientASN] autonomous system, such as the probe, sends the
+// response headers of the [ExampleWebPage] and then stalls the body until the client gives
+// up, and otherwise returns the [ExampleWebPage], regardless of the incoming domain.
+func StalledBodyWebPageHandlerFactory() HTTPHandlerFactory {
+	return &ASNHandlerFactory{
+		ByASN: map[uint]HTTPHandlerFactory{
+			DefaultClientASN: HTTPHandlerFactoryFunc(func(env NetStackServerFactoryEnv, stack *netem.UNetStack) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Add("Content-Length", strconv.Itoa(len(ExampleWebPage)))
+					w.Header().Add("Date", "Thu, 24 Aug 2023 14:35:29 GMT")
+					w.WriteHeader(http.StatusOK)
+					if flusher, ok := w.(http.Flusher); ok {
+						flusher.Flush()
+					}
+					<-r.Context().Done()
+				})
+			}),
+		},
+		Default: HTTPHandlerFactoryFunc(func(env NetStackServerFactoryEnv, stack *netem.UNetStack) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Date", "Thu, 24 Aug 2023 14:35:29 GMT")
+				w.Write([]byte(ExampleWebPage))
+			})
+		}),
+	}
+}
+
+// StreamResetWebPageHandlerFactory returns an [HTTPHandlerFactory] that, for the clients
+// belonging to the [DefaultClientASN] autonomous system, such as the probe, aborts the
+// request after reading the request headers, which resets the stream when using HTTP/2
+// and closes the connection otherwise, and that otherwise returns the [ExampleWebPage],
+// regardless of the incoming domain. We use this factory to emulate a middlebox that
+// resets an HTTP/2 stream after seeing the request headers.
+func StreamResetWebPageHandlerFactory() HTTPHandlerFactory {
+	return &ASNHandlerFactory{
+		ByASN: map[uint]HTTPHandlerFactory{
+			DefaultClientASN: HTTPHandlerFactoryFunc(func(env NetStackServerFactoryEnv, stack *netem.UNetStack) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					panic(http.ErrAbortHandler)
+				})
+			}),
+		},
+		Default: HTTPHandlerFactoryFunc(func(env NetStackServerFactoryEnv, stack *netem.UNetStack) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Date", "Thu, 24 Aug 2023 14:35:29 GMT")
+				w.Write([]byte(ExampleWebPage))
+			})
+		}),
+	}
+}
+
 // DefaultURLShortenerMapping is the default URL shortener mapping we use.
 var DefaultURLShortenerMapping = map[string]string{
 	"/21645": "https://www.example.com/",
@@ -150,3 +216,79 @@ func URLShortenerFactory(mapping map[string]string) HTTPHandlerFactory {
 		})
 	})
 }
+
+// GeoBlockedWebPage is the webpage returned by [GeoDifferentialWebPageHandlerFactory] to
+// clients belonging to the [DefaultClientASN] autonomous system.
+const GeoBlockedWebPage = `<!doctype html>
+<html>
+<head>
+	<title>Not Available</title>
+</head>
+<body>
+<div>
+	<h1>Not Available</h1>
+	<p>This content is not available in your region.</p>
+</div>
+</body>
+</html>
+`
+
+// DefaultClientASN is the ASN to which the [DefaultClientAddress] belongs.
+const DefaultClientASN = 137
+
+// ASNHandlerFactory is an [HTTPHandlerFactory] whose handlers select the [http.Handler] to
+// use depending on the autonomous system to which the client's IP address belongs.
+type ASNHandlerFactory struct {
+	// ByASN OPTIONALLY maps an ASN to the factory creating the handler for the
+	// clients belonging to such an autonomous system.
+	ByASN map[uint]HTTPHandlerFactory
+
+	// Default is the MANDATORY factory creating the handler for the clients whose
+	// ASN is not inside ByASN or whose ASN we cannot determine.
+	Default HTTPHandlerFactory
+}
+
+var _ HTTPHandlerFactory = &ASNHandlerFactory{}
+
+// NewHandler implements HTTPHandlerFactory.
+func (f *ASNHandlerFactory) NewHandler(env NetStackServerFactoryEnv, stack *netem.UNetStack) http.Handler {
+	byASN := make(map[uint]http.Handler)
+	for asn, factory := range f.ByASN {
+		byASN[asn] = factory.NewHandler(env, stack)
+	}
+	fallback := f.Default.NewHandler(env, stack)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := fallback
+		if addr, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			if asn, _, err := geoipx.LookupASN(addr); err == nil && byASN[asn] != nil {
+				handler = byASN[asn]
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// GeoDifferentialWebPageHandlerFactory returns an [HTTPHandlerFactory] returning the
+// [GeoBlockedWebPage] to the clients belonging to the [DefaultClientASN] autonomous
+// system, such as the probe, and the [ExampleWebPage] to any other client, such as
+// the test helpers, regardless of the incoming domain. Like [ExampleWebPageHandler],
+// we include the Alt-Svc header only when returning the [ExampleWebPage].
+func GeoDifferentialWebPageHandlerFactory() HTTPHandlerFactory {
+	return &ASNHandlerFactory{
+		ByASN: map[uint]HTTPHandlerFactory{
+			DefaultClientASN: HTTPHandlerFactoryFunc(func(env NetStackServerFactoryEnv, stack *netem.UNetStack) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Add("Date", "Thu, 24 Aug 2023 14:35:29 GMT")
+					w.Write([]byte(GeoBlockedWebPage))
+				})
+			}),
+		},
+		Default: HTTPHandlerFactoryFunc(func(env NetStackServerFactoryEnv, stack *netem.UNetStack) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Alt-Svc", `h3=":443"`)
+				w.Header().Add("Date", "Thu, 24 Aug 2023 14:35:29 GMT")
+				w.Write([]byte(ExampleWebPage))
+			})
+		}),
+	}
+}
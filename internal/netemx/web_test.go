@@ -1,11 +1,16 @@
 package netemx
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestExampleWebPageHandler(t *testing.T) {
@@ -113,3 +118,139 @@ func TestURLShortenerFactory(t *testing.T) {
 		}
 	})
 }
+
+func TestGeoDifferentialWebPageHandlerFactory(t *testing.T) {
+	handler := GeoDifferentialWebPageHandlerFactory().NewHandler(nil, nil)
+
+	// fetch returns the body of the response to a request coming from remoteAddr
+	fetch := func(t *testing.T, remoteAddr string) string {
+		rr := httptest.NewRecorder()
+		req := &http.Request{
+			URL:        &url.URL{Path: "/"},
+			Body:       http.NoBody,
+			Host:       "www.geodifferential.org",
+			RemoteAddr: remoteAddr,
+		}
+		handler.ServeHTTP(rr, req)
+		result := rr.Result()
+		if result.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status code", result.StatusCode)
+		}
+		data, err := io.ReadAll(result.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	t.Run("clients in the probe's AS get the geoblocked webpage", func(t *testing.T) {
+		body := fetch(t, net.JoinHostPort(DefaultClientAddress, "54321"))
+		if diff := cmp.Diff(GeoBlockedWebPage, body); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("clients in other ASes get the real webpage", func(t *testing.T) {
+		body := fetch(t, net.JoinHostPort(AddressZeroThOONIOrg, "54321"))
+		if diff := cmp.Diff(ExampleWebPage, body); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("clients with an invalid address get the real webpage", func(t *testing.T) {
+		body := fetch(t, "antani")
+		if diff := cmp.Diff(ExampleWebPage, body); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestStalledBodyWebPageHandlerFactory(t *testing.T) {
+	handler := StalledBodyWebPageHandlerFactory().NewHandler(nil, nil)
+
+	// serve runs the handler for a request coming from remoteAddr using a context
+	// that is already canceled, such that the stalling handler returns
+	serve := func(remoteAddr string) *http.Response {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		rr := httptest.NewRecorder()
+		req := (&http.Request{
+			URL:        &url.URL{Path: "/"},
+			Body:       http.NoBody,
+			Host:       "www.stalledbody.org",
+			RemoteAddr: remoteAddr,
+		}).WithContext(ctx)
+		handler.ServeHTTP(rr, req)
+		return rr.Result()
+	}
+
+	t.Run("clients in the probe's AS get the headers and a stalled body", func(t *testing.T) {
+		result := serve(net.JoinHostPort(DefaultClientAddress, "54321"))
+		if result.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status code", result.StatusCode)
+		}
+		if cl := result.Header.Get("Content-Length"); cl != fmt.Sprintf("%d", len(ExampleWebPage)) {
+			t.Fatal("unexpected Content-Length", cl)
+		}
+		data, err := io.ReadAll(result.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 0 {
+			t.Fatal("expected no body")
+		}
+	})
+
+	t.Run("clients in other ASes get the real webpage", func(t *testing.T) {
+		result := serve(net.JoinHostPort(AddressZeroThOONIOrg, "54321"))
+		data, err := io.ReadAll(result.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(ExampleWebPage, string(data)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestStreamResetWebPageHandlerFactory(t *testing.T) {
+	handler := StreamResetWebPageHandlerFactory().NewHandler(nil, nil)
+
+	// serve runs the handler for a request coming from remoteAddr and
+	// returns the response along with the value passed to panic, if any
+	serve := func(remoteAddr string) (result *http.Response, recovered any) {
+		defer func() {
+			recovered = recover()
+		}()
+		rr := httptest.NewRecorder()
+		req := &http.Request{
+			URL:        &url.URL{Path: "/"},
+			Body:       http.NoBody,
+			Host:       "www.streamreset.org",
+			RemoteAddr: remoteAddr,
+		}
+		handler.ServeHTTP(rr, req)
+		return rr.Result(), nil
+	}
+
+	t.Run("the handler aborts the requests of clients in the probe's AS", func(t *testing.T) {
+		_, recovered := serve(net.JoinHostPort(DefaultClientAddress, "54321"))
+		if recovered != http.ErrAbortHandler {
+			t.Fatal("unexpected recovered value", recovered)
+		}
+	})
+
+	t.Run("clients in other ASes get the real webpage", func(t *testing.T) {
+		result, recovered := serve(net.JoinHostPort(AddressZeroThOONIOrg, "54321"))
+		if recovered != nil {
+			t.Fatal("unexpected recovered value", recovered)
+		}
+		data, err := io.ReadAll(result.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(ExampleWebPage, string(data)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -237,7 +237,7 @@ func (d *dialerResolverWithTracing) DialContext(ctx context.Context, network, ad
 		trace.OnConnectDone(started, network, onlyhost, target, err, finished)
 		if err == nil {
 			conn = &dialerErrWrapperConn{conn}
-			return trace.MaybeWrapNetConn(conn), nil
+			return traceMaybeWrapNetConn(ctx, trace, conn), nil
 		}
 		errorslist = append(errorslist, err)
 	}
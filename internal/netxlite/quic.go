@@ -147,7 +147,7 @@ func (d *quicDialerQUICGo) DialContext(ctx context.Context,
 	}
 	tlsConfig = d.maybeApplyTLSDefaults(tlsConfig, udpAddr.Port)
 	trace := ContextTraceOrDefault(ctx)
-	pconn = trace.MaybeWrapUDPLikeConn(pconn)
+	pconn = traceMaybeWrapUDPLikeConn(ctx, trace, pconn)
 	started := trace.TimeNow()
 	trace.OnQUICHandshakeStart(started, address, quicConfig)
 	qconn, err := d.dialEarly(ctx, pconn, udpAddr, tlsConfig, quicConfig)
@@ -41,6 +41,32 @@ func traceOrDefault(trace model.Trace) model.Trace {
 	return &traceDefault{}
 }
 
+// traceContextConnWrapper is the OPTIONAL interface implemented by traces that
+// want to use the dial context (e.g., to read values bound to it) when wrapping
+// the conns we create. We use these methods in place of MaybeWrapNetConn and
+// MaybeWrapUDPLikeConn when the trace implements this interface.
+type traceContextConnWrapper interface {
+	MaybeWrapNetConnWithContext(ctx context.Context, conn net.Conn) net.Conn
+	MaybeWrapUDPLikeConnWithContext(ctx context.Context, conn model.UDPLikeConn) model.UDPLikeConn
+}
+
+// traceMaybeWrapNetConn wraps the conn using the given trace and passes it the
+// context when the trace implements [traceContextConnWrapper].
+func traceMaybeWrapNetConn(ctx context.Context, trace model.Trace, conn net.Conn) net.Conn {
+	if tw, ok := trace.(traceContextConnWrapper); ok {
+		return tw.MaybeWrapNetConnWithContext(ctx, conn)
+	}
+	return trace.MaybeWrapNetConn(conn)
+}
+
+// traceMaybeWrapUDPLikeConn is like traceMaybeWrapNetConn but for UDPLikeConn.
+func traceMaybeWrapUDPLikeConn(ctx context.Context, trace model.Trace, conn model.UDPLikeConn) model.UDPLikeConn {
+	if tw, ok := trace.(traceContextConnWrapper); ok {
+		return tw.MaybeWrapUDPLikeConnWithContext(ctx, conn)
+	}
+	return trace.MaybeWrapUDPLikeConn(conn)
+}
+
 // traceDefault is a default model.Trace implementation where each method is a no-op.
 type traceDefault struct{}
 
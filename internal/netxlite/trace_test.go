@@ -2,9 +2,11 @@ package netxlite
 
 import (
 	"context"
+	"net"
 	"testing"
 
 	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 func TestContextTraceOrDefault(t *testing.T) {
@@ -38,3 +40,63 @@ func TestContextWithTrace(t *testing.T) {
 		}
 	})
 }
+
+// traceWithContextWrapping is a [*mocks.Trace] that also implements [traceContextConnWrapper].
+type traceWithContextWrapping struct {
+	*mocks.Trace
+	ctx context.Context
+}
+
+func (tx *traceWithContextWrapping) MaybeWrapNetConnWithContext(ctx context.Context, conn net.Conn) net.Conn {
+	tx.ctx = ctx
+	return conn
+}
+
+func (tx *traceWithContextWrapping) MaybeWrapUDPLikeConnWithContext(
+	ctx context.Context, conn model.UDPLikeConn) model.UDPLikeConn {
+	tx.ctx = ctx
+	return conn
+}
+
+func TestTraceMaybeWrapConnWithContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "antani")
+
+	t.Run("we pass the context to traces implementing traceContextConnWrapper", func(t *testing.T) {
+		tx := &traceWithContextWrapping{Trace: &mocks.Trace{}}
+		conn := &mocks.Conn{}
+		if traceMaybeWrapNetConn(ctx, tx, conn) != conn {
+			t.Fatal("unexpected conn")
+		}
+		if tx.ctx != ctx {
+			t.Fatal("did not pass the context when wrapping a net.Conn")
+		}
+		tx.ctx = nil
+		pconn := &mocks.UDPLikeConn{}
+		if traceMaybeWrapUDPLikeConn(ctx, tx, pconn) != pconn {
+			t.Fatal("unexpected conn")
+		}
+		if tx.ctx != ctx {
+			t.Fatal("did not pass the context when wrapping a UDPLikeConn")
+		}
+	})
+
+	t.Run("we otherwise use the context-less methods", func(t *testing.T) {
+		var netConnCalled, udpLikeConnCalled bool
+		tx := &mocks.Trace{
+			MockMaybeWrapNetConn: func(conn net.Conn) net.Conn {
+				netConnCalled = true
+				return conn
+			},
+			MockMaybeWrapUDPLikeConn: func(conn model.UDPLikeConn) model.UDPLikeConn {
+				udpLikeConnCalled = true
+				return conn
+			},
+		}
+		traceMaybeWrapNetConn(ctx, tx, &mocks.Conn{})
+		traceMaybeWrapUDPLikeConn(ctx, tx, &mocks.UDPLikeConn{})
+		if !netConnCalled || !udpLikeConnCalled {
+			t.Fatal("did not call the context-less methods")
+		}
+	})
+}
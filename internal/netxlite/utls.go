@@ -7,13 +7,19 @@ package netxlite
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"reflect"
+	"strings"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/runtimex"
 	utls "gitlab.com/yawning/utls.git"
+	"golang.org/x/crypto/cryptobyte"
 )
 
 // NewTLSHandshakerUTLS implements [model.MeasuringNetwork].
@@ -31,6 +37,104 @@ func NewTLSHandshakerUTLS(logger model.DebugLogger, id *utls.ClientHelloID) mode
 	return netx.NewTLSHandshakerUTLS(logger, id)
 }
 
+// NewTLSHandshakerUTLSRequireSCT is like NewTLSHandshakerUTLS except that, after
+// a successful handshake, the returned handshaker closes the connection and fails
+// with [ErrMissingSCT] when the server did not present any signed certificate
+// timestamp, which is useful to measure certificate transparency enforcement.
+//
+// We accept the SCTs delivered using the TLS extension and the SCTs embedded into
+// the leaf certificate. We do not parse the stapled OCSP response, therefore we
+// fail when the server only delivers the SCTs inside such a response. We also do
+// not verify the SCTs signatures: we only check whether there are any SCTs.
+func (netx *Netx) NewTLSHandshakerUTLSRequireSCT(logger model.DebugLogger, id *utls.ClientHelloID) model.TLSHandshaker {
+	return newTLSHandshakerLogger(&tlsHandshakerRequireSCT{
+		TLSHandshaker: &tlsHandshakerConfigurable{
+			NewConn:  newUTLSConnFactory(id),
+			provider: netx.MaybeCustomUnderlyingNetwork(),
+		},
+	}, logger)
+}
+
+// NewTLSHandshakerUTLSRequireSCT is equivalent to creating an empty [*Netx]
+// and calling its NewTLSHandshakerUTLSRequireSCT method.
+func NewTLSHandshakerUTLSRequireSCT(logger model.DebugLogger, id *utls.ClientHelloID) model.TLSHandshaker {
+	netx := &Netx{Underlying: nil}
+	return netx.NewTLSHandshakerUTLSRequireSCT(logger, id)
+}
+
+// NewTLSHandshakerUTLSRandom is like NewTLSHandshakerUTLS except that it randomly
+// selects the ClientHelloID to use from the given list when constructing the handshaker,
+// such that not all the probes present the same fingerprint. The selected ID does not
+// change for the lifetime of the handshaker. To give an ID more weight, include it more
+// than once in the list. The list MUST NOT be empty and the rng MUST NOT be nil; this
+// function panics otherwise. Note that the rng MUST NOT be used concurrently.
+func (netx *Netx) NewTLSHandshakerUTLSRandom(
+	logger model.DebugLogger, ids []*utls.ClientHelloID, rng *rand.Rand) model.TLSHandshaker {
+	return netx.NewTLSHandshakerUTLS(logger, utlsRandomClientHelloID(ids, rng))
+}
+
+// NewTLSHandshakerUTLSRandom is equivalent to creating an empty [*Netx]
+// and calling its NewTLSHandshakerUTLSRandom method.
+func NewTLSHandshakerUTLSRandom(
+	logger model.DebugLogger, ids []*utls.ClientHelloID, rng *rand.Rand) model.TLSHandshaker {
+	netx := &Netx{Underlying: nil}
+	return netx.NewTLSHandshakerUTLSRandom(logger, ids, rng)
+}
+
+// utlsRandomClientHelloID returns a random ClientHelloID from the given list.
+func utlsRandomClientHelloID(ids []*utls.ClientHelloID, rng *rand.Rand) *utls.ClientHelloID {
+	runtimex.Assert(len(ids) > 0, "netxlite: empty list of ClientHelloID")
+	runtimex.Assert(rng != nil, "netxlite: nil random number generator")
+	return ids[rng.Intn(len(ids))]
+}
+
+// ErrMissingSCT indicates that the server did not present any signed
+// certificate timestamp during the TLS handshake.
+var ErrMissingSCT = errors.New("utls: missing signed certificate timestamps")
+
+// oidExtensionSCT is the OID of the X.509v3 extension containing the
+// SCTs embedded into a certificate (see RFC 6962, Section 3.3).
+var oidExtensionSCT = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// tlsHasSCT returns whether the server presented SCTs using either the
+// TLS extension or the X.509v3 extension of the leaf certificate.
+func tlsHasSCT(state tls.ConnectionState) bool {
+	if len(state.SignedCertificateTimestamps) > 0 {
+		return true
+	}
+	if len(state.PeerCertificates) <= 0 {
+		return false
+	}
+	for _, ext := range state.PeerCertificates[0].Extensions {
+		if ext.Id.Equal(oidExtensionSCT) && len(ext.Value) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsHandshakerRequireSCT is a TLSHandshaker failing successful
+// handshakes where the server did not present any SCT.
+type tlsHandshakerRequireSCT struct {
+	TLSHandshaker model.TLSHandshaker
+}
+
+var _ model.TLSHandshaker = &tlsHandshakerRequireSCT{}
+
+// Handshake implements model.TLSHandshaker.
+func (h *tlsHandshakerRequireSCT) Handshake(
+	ctx context.Context, conn net.Conn, config *tls.Config) (model.TLSConn, error) {
+	tlsconn, err := h.TLSHandshaker.Handshake(ctx, conn, config)
+	if err != nil {
+		return nil, err
+	}
+	if !tlsHasSCT(tlsconn.ConnectionState()) {
+		tlsconn.Close()
+		return nil, MaybeNewErrWrapper(ClassifyTLSHandshakeError, TLSHandshakeOperation, ErrMissingSCT)
+	}
+	return tlsconn, nil
+}
+
 // UTLSConn implements TLSConn and uses a utls UConn as its underlying connection
 type UTLSConn struct {
 	// We include the real UConn
@@ -57,15 +161,22 @@ func newUTLSConnFactory(clientHello *utls.ClientHelloID) func(conn net.Conn, con
 // NewUTLSConn contains some fields we don't support.
 var errUTLSIncompatibleStdlibConfig = errors.New("utls: incompatible stdlib config")
 
-// NewUTLSConn creates a new connection with the given client hello ID.
-func NewUTLSConn(conn net.Conn, config *tls.Config, cid *utls.ClientHelloID) (*UTLSConn, error) {
-	supportedFields := map[string]bool{
-		"DynamicRecordSizingDisabled": true,
-		"InsecureSkipVerify":          true,
-		"NextProtos":                  true,
-		"RootCAs":                     true,
-		"ServerName":                  true,
-	}
+// utlsSupportedConfigFields contains the names of the [tls.Config] fields
+// that we know how to map to the corresponding [utls.Config] fields.
+var utlsSupportedConfigFields = map[string]bool{
+	"DynamicRecordSizingDisabled": true,
+	"InsecureSkipVerify":          true,
+	"KeyLogWriter":                true,
+	"NextProtos":                  true,
+	"RootCAs":                     true,
+	"ServerName":                  true,
+}
+
+// UnsupportedUTLSConfigFields returns the names of all the nonzero fields of
+// the given config that [NewUTLSConn] does not support, in the order in which
+// they are declared inside [tls.Config]. An empty result means that you can
+// pass the config to [NewUTLSConn] without it being rejected.
+func UnsupportedUTLSConfigFields(config *tls.Config) (out []string) {
 	value := reflect.ValueOf(config).Elem()
 	kind := value.Type()
 	for idx := 0; idx < value.NumField(); idx++ {
@@ -74,26 +185,118 @@ func NewUTLSConn(conn net.Conn, config *tls.Config, cid *utls.ClientHelloID) (*U
 			continue
 		}
 		fieldKind := kind.Field(idx)
-		if supportedFields[fieldKind.Name] {
+		if utlsSupportedConfigFields[fieldKind.Name] {
 			continue
 		}
-		err := fmt.Errorf("%w: field %s is nonzero", errUTLSIncompatibleStdlibConfig, fieldKind.Name)
+		out = append(out, fieldKind.Name)
+	}
+	return
+}
+
+// NewUTLSConn creates a new connection with the given client hello ID.
+func NewUTLSConn(conn net.Conn, config *tls.Config, cid *utls.ClientHelloID) (*UTLSConn, error) {
+	uConfig, err := newUTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return newUTLSConnWithConfig(conn, uConfig, cid), nil
+}
+
+// newUTLSConfig maps the given stdlib config to the corresponding utls config and
+// returns an error if the stdlib config contains fields we don't support.
+func newUTLSConfig(config *tls.Config) (*utls.Config, error) {
+	switch unsupported := UnsupportedUTLSConfigFields(config); len(unsupported) {
+	case 0:
+		// nothing to do
+	case 1:
+		err := fmt.Errorf("%w: field %s is nonzero", errUTLSIncompatibleStdlibConfig, unsupported[0])
+		return nil, err
+	default:
+		err := fmt.Errorf("%w: fields %s are nonzero", errUTLSIncompatibleStdlibConfig,
+			strings.Join(unsupported, ", "))
 		return nil, err
 	}
 	uConfig := &utls.Config{
 		DynamicRecordSizingDisabled: config.DynamicRecordSizingDisabled,
 		InsecureSkipVerify:          config.InsecureSkipVerify,
+		KeyLogWriter:                config.KeyLogWriter,
 		RootCAs:                     config.RootCAs,
 		NextProtos:                  config.NextProtos,
 		ServerName:                  config.ServerName,
 	}
+	return uConfig, nil
+}
+
+// newUTLSConnWithConfig creates a new connection using the given utls config.
+func newUTLSConnWithConfig(conn net.Conn, uConfig *utls.Config, cid *utls.ClientHelloID) *UTLSConn {
 	tlsConn := utls.UClient(conn, uConfig, *cid)
-	oconn := &UTLSConn{
+	return &UTLSConn{
 		UConn:             tlsConn,
 		testableHandshake: nil,
 		nc:                conn,
 	}
-	return oconn, nil
+}
+
+// errUTLSEmptyVerifyName indicates that you passed an empty verifyName
+// to NewUTLSConnFronted without disabling certificate verification.
+var errUTLSEmptyVerifyName = errors.New("utls: empty verify name")
+
+// errUTLSNoPeerCertificates indicates that the server did not send any certificate.
+var errUTLSNoPeerCertificates = errors.New("utls: no peer certificates")
+
+// NewUTLSConnFronted is like [NewUTLSConn] except that it sends the given frontSNI inside
+// the ClientHello and verifies the server certificate against the given verifyName. This
+// functionality allows measuring domain fronting. We ignore the config's ServerName and, when
+// the config's InsecureSkipVerify is true, we do not verify the certificate at all. When
+// the config's RootCAs is nil, we use the system roots, like [NewUTLSConn] does. An empty
+// frontSNI means that the ClientHello will not include any SNI. This function returns an
+// error when verifyName is empty and we need to verify the certificate.
+func NewUTLSConnFronted(conn net.Conn, config *tls.Config,
+	cid *utls.ClientHelloID, frontSNI, verifyName string) (*UTLSConn, error) {
+	uConfig, err := newUTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	uConfig.ServerName = frontSNI
+	if !config.InsecureSkipVerify {
+		if verifyName == "" {
+			return nil, errUTLSEmptyVerifyName
+		}
+		// Note: we disable the default verification, which would use the frontSNI,
+		// and we replace it with a verification using the verifyName.
+		uConfig.InsecureSkipVerify = true
+		uConfig.VerifyPeerCertificate = utlsVerifyPeerCertificate(verifyName, config.RootCAs)
+	}
+	return newUTLSConnWithConfig(conn, uConfig, cid), nil
+}
+
+// utlsVerifyPeerCertificate returns a function for verifying the certificate chain
+// sent by the server against the given verifyName and the given roots.
+func utlsVerifyPeerCertificate(verifyName string, roots *x509.CertPool) func(
+	rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var certs []*x509.Certificate
+		for _, rawCert := range rawCerts {
+			cert, err := x509.ParseCertificate(rawCert)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, cert)
+		}
+		if len(certs) < 1 {
+			return errUTLSNoPeerCertificates
+		}
+		opts := x509.VerifyOptions{
+			DNSName:       verifyName,
+			Intermediates: x509.NewCertPool(),
+			Roots:         roots,
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
 }
 
 // ErrUTLSHandshakePanic indicates that there was panic handshaking
@@ -148,3 +351,96 @@ func (c *UTLSConn) ConnectionState() tls.ConnectionState {
 func (c *UTLSConn) NetConn() net.Conn {
 	return c.nc
 }
+
+// GREASEValues returns the GREASE code points (see RFC 8701) included into the
+// ClientHello generated for this connection, in order of first appearance inside
+// the cipher suites, extensions, supported groups, key shares, and supported
+// versions. This method returns nil before we build the ClientHello, which
+// happens when handshaking or when calling BuildHandshakeState.
+func (c *UTLSConn) GREASEValues() (out []uint16) {
+	if !c.ClientHelloBuilt || c.HandshakeState.Hello == nil {
+		return nil
+	}
+	seen := make(map[uint16]bool)
+	maybeAppend := func(value uint16) {
+		if utlsIsGREASE(value) && !seen[value] {
+			seen[value] = true
+			out = append(out, value)
+		}
+	}
+	hello := c.HandshakeState.Hello
+	for _, suite := range hello.CipherSuites {
+		maybeAppend(suite)
+	}
+	for _, ext := range c.Extensions {
+		if grease, ok := ext.(*utls.UtlsGREASEExtension); ok {
+			maybeAppend(grease.Value)
+		}
+	}
+	for _, curve := range hello.SupportedCurves {
+		maybeAppend(uint16(curve))
+	}
+	for _, share := range hello.KeyShares {
+		maybeAppend(uint16(share.Group))
+	}
+	for _, version := range hello.SupportedVersions {
+		maybeAppend(version)
+	}
+	return
+}
+
+// ServerExtensions returns the extension code points included by the server into
+// its ServerHello, in the order in which the server sent them. Note that this method
+// does not include the TLS 1.3 EncryptedExtensions, which utls does not expose. This
+// method returns nil before the handshake or if we cannot parse the ServerHello.
+func (c *UTLSConn) ServerExtensions() []uint16 {
+	if c.HandshakeState.ServerHello == nil {
+		return nil
+	}
+	return utlsParseServerHelloExtensions(c.HandshakeState.ServerHello.Raw)
+}
+
+// utlsParseServerHelloExtensions parses the extension code points from the raw
+// ServerHello message (see RFC 8446 Sect. 4.1.3) and returns nil on failure.
+func utlsParseServerHelloExtensions(raw []byte) (out []uint16) {
+	var (
+		msg        = cryptobyte.String(raw)
+		msgType    uint8
+		body       cryptobyte.String
+		version    uint16
+		random     []byte
+		sessionID  cryptobyte.String
+		suite      uint16
+		compressed uint8
+		extensions cryptobyte.String
+	)
+	if !msg.ReadUint8(&msgType) || !msg.ReadUint24LengthPrefixed(&body) ||
+		!body.ReadUint16(&version) || !body.ReadBytes(&random, 32) ||
+		!body.ReadUint8LengthPrefixed(&sessionID) || !body.ReadUint16(&suite) ||
+		!body.ReadUint8(&compressed) {
+		return nil
+	}
+	if body.Empty() {
+		return nil // the server did not send any extension
+	}
+	if !body.ReadUint16LengthPrefixed(&extensions) || !body.Empty() {
+		return nil
+	}
+	for !extensions.Empty() {
+		var (
+			extension uint16
+			data      cryptobyte.String
+		)
+		if !extensions.ReadUint16(&extension) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil
+		}
+		out = append(out, extension)
+	}
+	return out
+}
+
+// utlsIsGREASE returns whether the given value is a GREASE code point, i.e., both
+// bytes are equal and the lowest nibble is 0xa (see RFC 8701).
+func utlsIsGREASE(value uint16) bool {
+	return (value>>8) == value&0xff && value&0xf == 0xa
+}
@@ -1,17 +1,29 @@
 package netxlite
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"math/rand"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/runtimex"
 	utls "gitlab.com/yawning/utls.git"
+	"golang.org/x/crypto/cryptobyte"
 )
 
 func TestNewTLSHandshakerUTLS(t *testing.T) {
@@ -26,6 +38,197 @@ func TestNewTLSHandshakerUTLS(t *testing.T) {
 	}
 }
 
+func TestNewTLSHandshakerUTLSRequireSCT(t *testing.T) {
+	th := NewTLSHandshakerUTLSRequireSCT(log.Log, &utls.HelloChrome_83)
+	logger := th.(*tlsHandshakerLogger)
+	if logger.DebugLogger != log.Log {
+		t.Fatal("invalid logger")
+	}
+	requireSCT := logger.TLSHandshaker.(*tlsHandshakerRequireSCT)
+	configurable := requireSCT.TLSHandshaker.(*tlsHandshakerConfigurable)
+	if configurable.NewConn == nil {
+		t.Fatal("expected non-nil NewConn")
+	}
+}
+
+func TestNewTLSHandshakerUTLSRandom(t *testing.T) {
+	ids := []*utls.ClientHelloID{
+		&utls.HelloChrome_83,
+		&utls.HelloFirefox_55,
+		&utls.HelloFirefox_63,
+		&utls.HelloIOS_12_1,
+	}
+
+	// newConfigurable returns the tlsHandshakerConfigurable using the given seed.
+	newConfigurable := func(t *testing.T, seed int64) *tlsHandshakerConfigurable {
+		th := NewTLSHandshakerUTLSRandom(log.Log, ids, rand.New(rand.NewSource(seed)))
+		logger := th.(*tlsHandshakerLogger)
+		if logger.DebugLogger != log.Log {
+			t.Fatal("invalid logger")
+		}
+		return logger.TLSHandshaker.(*tlsHandshakerConfigurable)
+	}
+
+	// helloIDStr returns the string representation of the ClientHelloID used by a new conn.
+	helloIDStr := func(t *testing.T, configurable *tlsHandshakerConfigurable) string {
+		conn, err := configurable.NewConn(&mocks.Conn{}, &tls.Config{ServerName: "example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn.(*UTLSConn).ClientHelloID.Str()
+	}
+
+	t.Run("the selection is deterministic given the seed", func(t *testing.T) {
+		expected := ids[rand.New(rand.NewSource(4)).Intn(len(ids))].Str()
+		for idx := 0; idx < 4; idx++ {
+			if got := helloIDStr(t, newConfigurable(t, 4)); got != expected {
+				t.Fatal("expected", expected, "got", got)
+			}
+		}
+	})
+
+	t.Run("we use the selected ID for all the conns", func(t *testing.T) {
+		configurable := newConfigurable(t, 11)
+		expected := helloIDStr(t, configurable)
+		for idx := 0; idx < 16; idx++ {
+			if got := helloIDStr(t, configurable); got != expected {
+				t.Fatal("expected", expected, "got", got)
+			}
+		}
+	})
+
+	t.Run("we panic with an empty list", func(t *testing.T) {
+		var recovered any
+		func() {
+			defer func() {
+				recovered = recover()
+			}()
+			NewTLSHandshakerUTLSRandom(log.Log, nil, rand.New(rand.NewSource(1)))
+		}()
+		if recovered == nil {
+			t.Fatal("expected a panic")
+		}
+	})
+}
+
+func TestTLSHandshakerRequireSCT(t *testing.T) {
+	// newHandshaker returns a handshaker whose successful handshakes return a
+	// conn with the given state and which records whether we closed the conn.
+	newHandshaker := func(state tls.ConnectionState, closed *bool) *tlsHandshakerRequireSCT {
+		return &tlsHandshakerRequireSCT{
+			TLSHandshaker: &mocks.TLSHandshaker{
+				MockHandshake: func(ctx context.Context, conn net.Conn, config *tls.Config) (model.TLSConn, error) {
+					tlsconn := &mocks.TLSConn{
+						Conn: mocks.Conn{
+							MockClose: func() error {
+								*closed = true
+								return nil
+							},
+						},
+						MockConnectionState: func() tls.ConnectionState {
+							return state
+						},
+					}
+					return tlsconn, nil
+				},
+			},
+		}
+	}
+
+	t.Run("on handshake failure", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		th := &tlsHandshakerRequireSCT{
+			TLSHandshaker: &mocks.TLSHandshaker{
+				MockHandshake: func(ctx context.Context, conn net.Conn, config *tls.Config) (model.TLSConn, error) {
+					return nil, expected
+				},
+			},
+		}
+		tlsconn, err := th.Handshake(context.Background(), &mocks.Conn{}, &tls.Config{})
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if tlsconn != nil {
+			t.Fatal("expected nil tlsconn")
+		}
+	})
+
+	// newLeaf returns a certificate with the given extensions.
+	newLeaf := func(extensions ...pkix.Extension) *x509.Certificate {
+		return &x509.Certificate{Extensions: extensions}
+	}
+
+	successes := []struct {
+		name  string
+		state tls.ConnectionState
+	}{{
+		name:  "with SCTs in the TLS extension",
+		state: tls.ConnectionState{SignedCertificateTimestamps: [][]byte{[]byte("sct")}},
+	}, {
+		name: "with SCTs embedded into the leaf certificate",
+		state: tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			newLeaf(pkix.Extension{Id: oidExtensionSCT, Value: []byte("sct")}),
+		}},
+	}}
+
+	for _, tc := range successes {
+		t.Run("on success "+tc.name, func(t *testing.T) {
+			var closed bool
+			th := newHandshaker(tc.state, &closed)
+			tlsconn, err := th.Handshake(context.Background(), &mocks.Conn{}, &tls.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tlsconn == nil {
+				t.Fatal("expected non-nil tlsconn")
+			}
+			if closed {
+				t.Fatal("should not have closed the conn")
+			}
+		})
+	}
+
+	failures := []struct {
+		name  string
+		state tls.ConnectionState
+	}{{
+		name:  "without SCTs",
+		state: tls.ConnectionState{},
+	}, {
+		name: "with SCTs embedded into an intermediate certificate only",
+		state: tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			newLeaf(),
+			newLeaf(pkix.Extension{Id: oidExtensionSCT, Value: []byte("sct")}),
+		}},
+	}, {
+		name: "with an empty SCT extension in the leaf certificate",
+		state: tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			newLeaf(pkix.Extension{Id: oidExtensionSCT}),
+		}},
+	}}
+
+	for _, tc := range failures {
+		t.Run("on success "+tc.name, func(t *testing.T) {
+			var closed bool
+			th := newHandshaker(tc.state, &closed)
+			tlsconn, err := th.Handshake(context.Background(), &mocks.Conn{}, &tls.Config{})
+			if !errors.Is(err, ErrMissingSCT) {
+				t.Fatal("unexpected error", err)
+			}
+			var errWrapper *ErrWrapper
+			if !errors.As(err, &errWrapper) || errWrapper.Operation != TLSHandshakeOperation {
+				t.Fatal("expected an ErrWrapper for the TLS handshake operation", err)
+			}
+			if tlsconn != nil {
+				t.Fatal("expected nil tlsconn")
+			}
+			if !closed {
+				t.Fatal("should have closed the conn")
+			}
+		})
+	}
+}
+
 func TestUTLSConn(t *testing.T) {
 	t.Run("Handshake", func(t *testing.T) {
 		t.Run("not interrupted with success", func(t *testing.T) {
@@ -157,3 +360,369 @@ func Test_newConnUTLSWithHelloID(t *testing.T) {
 		})
 	}
 }
+
+func TestUnsupportedUTLSConfigFields(t *testing.T) {
+	t.Run("with only supported fields", func(t *testing.T) {
+		config := &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h2", "http/1.1"},
+			ServerName:         "ooni.org",
+		}
+		if fields := UnsupportedUTLSConfigFields(config); len(fields) != 0 {
+			t.Fatal("expected no fields, got", fields)
+		}
+	})
+
+	t.Run("with multiple unsupported fields", func(t *testing.T) {
+		config := &tls.Config{
+			Time: func() time.Time {
+				return time.Now()
+			},
+			ServerName: "ooni.org",
+			MinVersion: tls.VersionTLS12,
+			MaxVersion: tls.VersionTLS13,
+		}
+		expect := []string{"Time", "MinVersion", "MaxVersion"}
+		if diff := cmp.Diff(expect, UnsupportedUTLSConfigFields(config)); diff != "" {
+			t.Fatal(diff)
+		}
+
+		t.Run("and NewUTLSConn reports all of them", func(t *testing.T) {
+			conn, err := NewUTLSConn(&mocks.Conn{}, config, &utls.HelloChrome_58)
+			if !errors.Is(err, errUTLSIncompatibleStdlibConfig) {
+				t.Fatal("unexpected err", err)
+			}
+			expectErr := "utls: incompatible stdlib config: fields Time, MinVersion, MaxVersion are nonzero"
+			if err.Error() != expectErr {
+				t.Fatal("unexpected err", err)
+			}
+			if conn != nil {
+				t.Fatal("expected nil conn here")
+			}
+		})
+	})
+}
+
+func TestUTLSConnWithKeyLogWriter(t *testing.T) {
+	srvr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srvr.Close()
+	URL := runtimex.Try1(url.Parse(srvr.URL))
+
+	tcpConn, err := net.Dial("tcp", URL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpConn.Close()
+
+	keylog := &bytes.Buffer{}
+	config := &tls.Config{
+		InsecureSkipVerify: true,
+		KeyLogWriter:       keylog,
+		ServerName:         "example.com",
+	}
+	conn, err := NewUTLSConn(tcpConn, config, &utls.HelloChrome_83)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.HandshakeContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(keylog.String(), "CLIENT_") {
+		t.Fatal("expected to see TLS secrets, got", keylog.String())
+	}
+}
+
+func TestUTLSConnGREASEValues(t *testing.T) {
+	newConn := func(t *testing.T, cid *utls.ClientHelloID) *UTLSConn {
+		conn, err := NewUTLSConn(&mocks.Conn{}, &tls.Config{ServerName: "ooni.org"}, cid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	t.Run("before building the ClientHello", func(t *testing.T) {
+		conn := newConn(t, &utls.HelloChrome_83)
+		if values := conn.GREASEValues(); values != nil {
+			t.Fatal("expected nil values", values)
+		}
+	})
+
+	t.Run("with a GREASEd ClientHello", func(t *testing.T) {
+		conn := newConn(t, &utls.HelloChrome_83)
+		if err := conn.BuildHandshakeState(); err != nil {
+			t.Fatal(err)
+		}
+		values := conn.GREASEValues()
+		if len(values) < 1 {
+			t.Fatal("expected to see GREASE values")
+		}
+		for _, value := range values {
+			if value&0x0f0f != 0x0a0a || value>>12 != (value>>4)&0x0f {
+				t.Fatalf("not a GREASE code point: %#04x", value)
+			}
+		}
+	})
+
+	t.Run("with a ClientHello without GREASE", func(t *testing.T) {
+		conn := newConn(t, &utls.HelloFirefox_55)
+		if err := conn.BuildHandshakeState(); err != nil {
+			t.Fatal(err)
+		}
+		if values := conn.GREASEValues(); len(values) != 0 {
+			t.Fatal("expected no GREASE values", values)
+		}
+	})
+}
+
+func TestUTLSIsGREASE(t *testing.T) {
+	for _, value := range []uint16{0x0a0a, 0x1a1a, 0xfafa} {
+		if !utlsIsGREASE(value) {
+			t.Fatalf("expected %#04x to be GREASE", value)
+		}
+	}
+	for _, value := range []uint16{0x0a1a, 0x1301, 0x0b0b, 0x001d} {
+		if utlsIsGREASE(value) {
+			t.Fatalf("expected %#04x to not be GREASE", value)
+		}
+	}
+}
+
+func TestUTLSConnServerExtensions(t *testing.T) {
+	// newServerHello returns a raw ServerHello containing the given extensions
+	newServerHello := func(extensions ...uint16) []byte {
+		var b cryptobyte.Builder
+		b.AddUint8(2) // server_hello
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(tls.VersionTLS12)
+			b.AddBytes(make([]byte, 32))
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(make([]byte, 32))
+			})
+			b.AddUint16(tls.TLS_AES_128_GCM_SHA256)
+			b.AddUint8(0)
+			if len(extensions) <= 0 {
+				return
+			}
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				for _, extension := range extensions {
+					b.AddUint16(extension)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint16(0)
+					})
+				}
+			})
+		})
+		return b.BytesOrPanic()
+	}
+
+	newConn := func(t *testing.T, serverHello *utls.ServerHelloMsg) *UTLSConn {
+		conn, err := NewUTLSConn(&mocks.Conn{}, &tls.Config{ServerName: "ooni.org"}, &utls.HelloChrome_83)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.HandshakeState.ServerHello = serverHello
+		return conn
+	}
+
+	t.Run("before the handshake", func(t *testing.T) {
+		conn := newConn(t, nil)
+		if extensions := conn.ServerExtensions(); extensions != nil {
+			t.Fatal("expected nil, got", extensions)
+		}
+	})
+
+	t.Run("with a ServerHello containing extensions", func(t *testing.T) {
+		conn := newConn(t, &utls.ServerHelloMsg{Raw: newServerHello(43, 51, 16)})
+		if diff := cmp.Diff([]uint16{43, 51, 16}, conn.ServerExtensions()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with a ServerHello without extensions", func(t *testing.T) {
+		conn := newConn(t, &utls.ServerHelloMsg{Raw: newServerHello()})
+		if extensions := conn.ServerExtensions(); extensions != nil {
+			t.Fatal("expected nil, got", extensions)
+		}
+	})
+
+	t.Run("with a truncated ServerHello", func(t *testing.T) {
+		raw := newServerHello(43, 51)
+		conn := newConn(t, &utls.ServerHelloMsg{Raw: raw[:len(raw)-3]})
+		if extensions := conn.ServerExtensions(); extensions != nil {
+			t.Fatal("expected nil, got", extensions)
+		}
+	})
+
+	t.Run("after a real TLS 1.3 handshake", func(t *testing.T) {
+		srvr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer srvr.Close()
+		URL := runtimex.Try1(url.Parse(srvr.URL))
+		tcpConn, err := net.Dial("tcp", URL.Host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tcpConn.Close()
+		config := &tls.Config{InsecureSkipVerify: true, ServerName: "example.com"}
+		conn, err := NewUTLSConn(tcpConn, config, &utls.HelloChrome_83)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.HandshakeContext(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// a TLS 1.3 ServerHello contains key_share (51) and supported_versions (43)
+		extensions := conn.ServerExtensions()
+		found := make(map[uint16]bool)
+		for _, extension := range extensions {
+			found[extension] = true
+		}
+		if !found[43] || !found[51] {
+			t.Fatal("unexpected extensions", extensions)
+		}
+	})
+}
+
+func TestNewUTLSConnFronted(t *testing.T) {
+	// newServer returns a TLS server recording the SNI sent by the client.
+	newServer := func(t *testing.T) (*httptest.Server, *x509.CertPool, func() string) {
+		var (
+			mu  sync.Mutex
+			sni string
+		)
+		srvr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srvr.TLS = &tls.Config{
+			GetConfigForClient: func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+				mu.Lock()
+				sni = chi.ServerName
+				mu.Unlock()
+				return nil, nil
+			},
+		}
+		srvr.StartTLS()
+		t.Cleanup(srvr.Close)
+		roots := x509.NewCertPool()
+		roots.AddCert(srvr.Certificate())
+		getSNI := func() string {
+			defer mu.Unlock()
+			mu.Lock()
+			return sni
+		}
+		return srvr, roots, getSNI
+	}
+
+	// handshake connects to the server and performs a fronted TLS handshake.
+	handshake := func(t *testing.T, srvr *httptest.Server,
+		config *tls.Config, frontSNI, verifyName string) error {
+		URL := runtimex.Try1(url.Parse(srvr.URL))
+		tcpConn, err := net.Dial("tcp", URL.Host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tcpConn.Close()
+		conn, err := NewUTLSConnFronted(tcpConn, config, &utls.HelloChrome_83, frontSNI, verifyName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn.HandshakeContext(context.Background())
+	}
+
+	t.Run("the ClientHello contains the frontSNI", func(t *testing.T) {
+		config := &tls.Config{ServerName: "ooni.org"}
+		conn, err := NewUTLSConnFronted(&mocks.Conn{}, config, &utls.HelloChrome_83, "www.google.com", "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.BuildHandshakeState(); err != nil {
+			t.Fatal(err)
+		}
+		if got := conn.HandshakeState.Hello.ServerName; got != "www.google.com" {
+			t.Fatal("unexpected SNI", got)
+		}
+	})
+
+	t.Run("we verify the certificate against the verifyName", func(t *testing.T) {
+		srvr, roots, getSNI := newServer(t)
+		config := &tls.Config{RootCAs: roots}
+		if err := handshake(t, srvr, config, "www.google.com", "example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if got := getSNI(); got != "www.google.com" {
+			t.Fatal("unexpected SNI", got)
+		}
+	})
+
+	t.Run("we reject a certificate not valid for the verifyName", func(t *testing.T) {
+		srvr, roots, getSNI := newServer(t)
+		config := &tls.Config{RootCAs: roots}
+		err := handshake(t, srvr, config, "example.com", "www.google.com")
+		var hostnameErr x509.HostnameError
+		if !errors.As(err, &hostnameErr) {
+			t.Fatal("unexpected err", err)
+		}
+		if hostnameErr.Host != "www.google.com" {
+			t.Fatal("unexpected host", hostnameErr.Host)
+		}
+		if got := getSNI(); got != "example.com" {
+			t.Fatal("unexpected SNI", got)
+		}
+	})
+
+	t.Run("we reject a certificate signed by an unknown authority", func(t *testing.T) {
+		srvr, _, _ := newServer(t)
+		config := &tls.Config{RootCAs: x509.NewCertPool()}
+		err := handshake(t, srvr, config, "www.google.com", "example.com")
+		var authorityErr x509.UnknownAuthorityError
+		if !errors.As(err, &authorityErr) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("we do not verify with InsecureSkipVerify", func(t *testing.T) {
+		srvr, _, getSNI := newServer(t)
+		config := &tls.Config{InsecureSkipVerify: true}
+		if err := handshake(t, srvr, config, "www.google.com", ""); err != nil {
+			t.Fatal(err)
+		}
+		if got := getSNI(); got != "www.google.com" {
+			t.Fatal("unexpected SNI", got)
+		}
+	})
+
+	t.Run("with an empty verifyName", func(t *testing.T) {
+		conn, err := NewUTLSConnFronted(&mocks.Conn{}, &tls.Config{}, &utls.HelloChrome_83, "www.google.com", "")
+		if !errors.Is(err, errUTLSEmptyVerifyName) {
+			t.Fatal("unexpected err", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn here")
+		}
+	})
+
+	t.Run("with unsupported fields", func(t *testing.T) {
+		config := &tls.Config{MinVersion: tls.VersionTLS13}
+		conn, err := NewUTLSConnFronted(&mocks.Conn{}, config, &utls.HelloChrome_83, "www.google.com", "example.com")
+		if !errors.Is(err, errUTLSIncompatibleStdlibConfig) {
+			t.Fatal("unexpected err", err)
+		}
+		if conn != nil {
+			t.Fatal("expected nil conn here")
+		}
+	})
+}
+
+func TestUTLSVerifyPeerCertificate(t *testing.T) {
+	t.Run("with no certificates", func(t *testing.T) {
+		verify := utlsVerifyPeerCertificate("example.com", x509.NewCertPool())
+		if err := verify(nil, nil); !errors.Is(err, errUTLSNoPeerCertificates) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with an invalid certificate", func(t *testing.T) {
+		verify := utlsVerifyPeerCertificate("example.com", x509.NewCertPool())
+		if err := verify([][]byte{[]byte("antani")}, nil); err == nil {
+			t.Fatal("expected an error here")
+		}
+	})
+}
@@ -29,6 +29,18 @@ const MaxAcceptableBodySize = 1 << 24
 // Handler is an [http.Handler] implementing the Web
 // Connectivity test helper HTTP API.
 type Handler struct {
+	// AlsoCleartextPort OPTIONALLY maps a port explicitly specified by the input URL
+	// to a complementary cleartext port to also measure (e.g., "8443" => "8080").
+	AlsoCleartextPort map[string]string
+
+	// AlsoTLSPort OPTIONALLY maps a port explicitly specified by the input URL to
+	// a complementary port to also measure using TLS (e.g., "8080" => "8443").
+	AlsoTLSPort map[string]string
+
+	// ASNLooker is the OPTIONAL [ASNLooker] to map IP addresses to ASNs. When
+	// this field is nil, we use the geoipx package as the database.
+	ASNLooker ASNLooker
+
 	// BaseLogger is the MANDATORY logger to use.
 	BaseLogger model.Logger
 
@@ -59,6 +71,16 @@ type Handler struct {
 
 	// NewTLSHandshaker is the MANDATORY factory for creating a new TLS handshaker.
 	NewTLSHandshaker func(model.Logger) model.TLSHandshaker
+
+	// RecordIPInfoStats OPTIONALLY enables recording how long generating the
+	// IP info took, along with the time taken by each address lookup, into
+	// the diagnostics of the response, which helps with capacity planning.
+	RecordIPInfoStats bool
+
+	// RecordTLSDetails OPTIONALLY enables recording the negotiated TLS version,
+	// the negotiated ALPN, and the subject of the leaf certificate into the
+	// result of each successful TLS handshake.
+	RecordTLSDetails bool
 }
 
 var _ http.Handler = &Handler{}
@@ -66,6 +88,9 @@ var _ http.Handler = &Handler{}
 // NewHandler constructs the [handler].
 func NewHandler() *Handler {
 	return &Handler{
+		AlsoCleartextPort: nil,
+		AlsoTLSPort:       nil,
+		ASNLooker:         geoipxASNLooker{},
 		BaseLogger:        log.Log,
 		Indexer:           &atomic.Int64{},
 		MaxAcceptableBody: MaxAcceptableBodySize,
@@ -100,6 +125,8 @@ func NewHandler() *Handler {
 		NewTLSHandshaker: func(logger model.Logger) model.TLSHandshaker {
 			return netxlite.NewTLSHandshakerStdlib(logger)
 		},
+		RecordIPInfoStats: false,
+		RecordTLSDetails:  false,
 	}
 }
 
@@ -9,46 +9,184 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/geoipx"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
+// ASNLooker maps an IP address to the corresponding ASN and organization name.
+type ASNLooker interface {
+	LookupASN(ip string) (asn uint, org string, err error)
+}
+
+// geoipxASNLooker is the default [ASNLooker] using [geoipx].
+type geoipxASNLooker struct{}
+
+var _ ASNLooker = geoipxASNLooker{}
+
+// LookupASN implements ASNLooker.
+func (geoipxASNLooker) LookupASN(ip string) (uint, string, error) {
+	return geoipx.LookupASN(ip)
+}
+
+// asnLookerOrDefault returns the given [ASNLooker] or the default one when it is nil.
+func asnLookerOrDefault(looker ASNLooker) ASNLooker {
+	if looker == nil {
+		return geoipxASNLooker{}
+	}
+	return looker
+}
+
+// thResolverIdentity is the identity of the single resolver used by newIPInfo.
+const thResolverIdentity = "th"
+
 // newIPInfo creates an IP to IPInfo mapping from addresses resolved
-// by the probe (inside [creq]) or the TH (inside [addrs]).
-func newIPInfo(creq *ctrlRequest, addrs []string) map[string]*model.THIPInfo {
-	discoveredby := make(map[string]int64)
+// by the probe (inside [creq]) or the TH (inside [addrs]). We use the OPTIONAL
+// [looker] to map addresses to ASNs and we use [geoipx] when it is nil. When
+// the OPTIONAL [stats] is not nil, we record in it how long this step took. This
+// function is like newIPInfoMulti with a single resolver named thResolverIdentity.
+func newIPInfo(looker ASNLooker, creq *ctrlRequest, addrs []string,
+	stats *model.THIPInfoStats) map[string]*model.THIPInfo {
+	return newIPInfoMulti(looker, creq, map[string][]string{thResolverIdentity: addrs}, stats)
+}
+
+// newIPInfoMulti creates an IP to IPInfo mapping from addresses resolved by
+// the probe (inside [creq]) and by several TH resolvers, indexed by resolver
+// identity (inside [addrSets]). We compute the union of such answers and we
+// record which resolvers produced each address inside the ResolvedBy field
+// of the returned IPInfo.
+func newIPInfoMulti(looker ASNLooker, creq *ctrlRequest, addrSets map[string][]string,
+	stats *model.THIPInfoStats) map[string]*model.THIPInfo {
+	defer newIPInfoStatsRecorder(stats)()
+	discoveredby := newIPInfoProbeFlags(creq)
+	resolvedby := make(map[string][]string)
+
+	for identity, addrs := range addrSets {
+		for _, addr := range addrs {
+			if addr = normalizeIPAddr(addr); addr == "" {
+				continue
+			}
+			discoveredby[addr] |= model.THIPInfoFlagResolvedByTH
+			resolvedby[addr] = appendUnique(resolvedby[addr], identity)
+		}
+	}
+
+	for _, identities := range resolvedby {
+		sort.Strings(identities) // make the output deterministic
+	}
+
+	return newIPInfoFromFlags(looker, discoveredby, resolvedby, stats)
+}
+
+// newIPInfoStatsRecorder returns a function recording into the OPTIONAL [stats]
+// the time elapsed since calling newIPInfoStatsRecorder. The returned function
+// does nothing when [stats] is nil.
+func newIPInfoStatsRecorder(stats *model.THIPInfoStats) func() {
+	if stats == nil {
+		return func() {}
+	}
+	t0 := time.Now()
+	return func() {
+		stats.Duration = time.Since(t0).Seconds()
+	}
+}
 
+// newIPInfoProbeFlags returns the flags of the addresses resolved by the probe.
+func newIPInfoProbeFlags(creq *ctrlRequest) map[string]int64 {
+	discoveredby := make(map[string]int64)
 	for _, epnt := range creq.TCPConnect {
 		addr, _, err := net.SplitHostPort(epnt)
-		if err != nil || net.ParseIP(addr) == nil {
+		if err != nil {
+			continue
+		}
+		if addr = normalizeIPAddr(addr); addr == "" {
 			continue
 		}
 		discoveredby[addr] |= model.THIPInfoFlagResolvedByProbe
 	}
+	return discoveredby
+}
 
-	for _, addr := range addrs {
-		if net.ParseIP(addr) != nil {
-			discoveredby[addr] |= model.THIPInfoFlagResolvedByTH
-		}
+// normalizeIPAddr returns the canonical representation of the given IP
+// address, where we map IPv4-mapped IPv6 addresses (e.g., ::ffff:1.2.3.4)
+// to their IPv4 form and we use the RFC 5952 form of IPv6 addresses (e.g.,
+// 2001:db8::1 for 2001:db8:0:0:0:0:0:1), such that all the representations
+// of the same address collapse into a single entry. We return an empty string
+// when the input is not a valid IP address.
+//
+// Because we use the canonical form as the IPInfo key, the key of an address
+// the probe did not send in canonical form (e.g., 1.2.3.4 for the IPv4-mapped
+// endpoint [::ffff:1.2.3.4]:443) no longer matches the endpoint the probe sent.
+// The same applies to the keys of the TCP connect and TLS handshake results,
+// since ipInfoToEndpoints derives the endpoints from the IPInfo keys.
+func normalizeIPAddr(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4.String()
 	}
+	return ip.String()
+}
 
+// newIPInfoFromFlags completes the IPInfo given the OPTIONAL [ASNLooker], the flags of
+// each IP address, and the OPTIONAL identities of the resolvers that resolved each address.
+// Because here we know who resolved each address, we also set the flags indicating
+// whether just the probe or just the test helper resolved an address. When the
+// OPTIONAL [stats] is not nil, we record in it how long each address lookup took.
+func newIPInfoFromFlags(looker ASNLooker, discoveredby map[string]int64,
+	resolvedby map[string][]string, stats *model.THIPInfoStats) map[string]*model.THIPInfo {
+	looker = asnLookerOrDefault(looker)
+	if stats != nil {
+		stats.Lookups = make(map[string]float64)
+	}
 	ipinfo := make(map[string]*model.THIPInfo)
 	for addr, flags := range discoveredby {
 		if netxlite.IsBogon(addr) { // note: we already excluded non-IP addrs above
 			flags |= model.THIPInfoFlagIsBogon
 		}
-		asn, _, _ := geoipx.LookupASN(addr) // AS0 on failure
+		flags |= newIPInfoExclusiveFlags(flags)
+		t0 := time.Now()
+		asn, _, _ := looker.LookupASN(addr) // AS0 on failure
+		if stats != nil {
+			stats.Lookups[addr] = time.Since(t0).Seconds()
+		}
 		ipinfo[addr] = &model.THIPInfo{
-			ASN:   int64(asn),
-			Flags: flags,
+			ASN:        int64(asn),
+			Flags:      flags,
+			ResolvedBy: resolvedby[addr],
 		}
 	}
-
 	return ipinfo
 }
 
+// newIPInfoExclusiveFlags returns the flag indicating that exactly one between
+// the probe and the test helper resolved an address given its current flags.
+func newIPInfoExclusiveFlags(flags int64) int64 {
+	const both = model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH
+	switch flags & both {
+	case model.THIPInfoFlagResolvedByProbe:
+		return model.THIPInfoFlagProbeOnly
+	case model.THIPInfoFlagResolvedByTH:
+		return model.THIPInfoFlagTHOnly
+	default:
+		return 0
+	}
+}
+
+// appendUnique appends value to values unless values already contains it.
+func appendUnique(values []string, value string) []string {
+	for _, entry := range values {
+		if entry == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
 // endpointInfo contains info about an endpoint to measure
 type endpointInfo struct {
 	// Addr is the address to measure
@@ -65,7 +203,9 @@ type endpointInfo struct {
 // and the [URL] provided by the probe to generate the list of endpoints
 // to measure. We choose ports as follows:
 //
-// 1. if the input URL contains a port, we use such a port;
+// 1. if the input URL contains a port, we use such a port and, additionally,
+// the complementary TLS port configured by [alsoTLSPort] and the complementary
+// cleartext port configured by [alsoCleartextPort], if any;
 //
 // 2. if the input URL scheme is "https", we choose port 443;
 //
@@ -74,15 +214,28 @@ type endpointInfo struct {
 // whether an IP address is valid for a domain;
 //
 // 4. otherwise, we don't generate any endpoint to measure.
-func ipInfoToEndpoints(URL *url.URL, ipinfo map[string]*model.THIPInfo) []endpointInfo {
-	var ports []string
+//
+// We use TLS with port 443 and with the complementary TLS port.
+func ipInfoToEndpoints(URL *url.URL, ipinfo map[string]*model.THIPInfo,
+	alsoTLSPort, alsoCleartextPort map[string]string) []endpointInfo {
+	type portInfo struct {
+		port string
+		tls  bool
+	}
+	var ports []portInfo
 
 	if port := URL.Port(); port != "" {
-		ports = []string{port} // as documented
+		ports = []portInfo{{port, port == "443"}} // as documented
+		if tlsPort, found := alsoTLSPort[port]; found && tlsPort != port {
+			ports = append(ports, portInfo{tlsPort, true}) // as documented
+		}
+		if cleartextPort, found := alsoCleartextPort[port]; found && cleartextPort != port {
+			ports = append(ports, portInfo{cleartextPort, false}) // as documented
+		}
 	} else if URL.Scheme == "https" {
-		ports = []string{"443"} // as documented
+		ports = []portInfo{{"443", true}} // as documented
 	} else if URL.Scheme == "http" {
-		ports = []string{"80", "443"} // as documented
+		ports = []portInfo{{"80", false}, {"443", true}} // as documented
 	}
 
 	out := []endpointInfo{}
@@ -91,11 +244,11 @@ func ipInfoToEndpoints(URL *url.URL, ipinfo map[string]*model.THIPInfo) []endpoi
 			continue // as documented
 		}
 		for _, port := range ports {
-			epnt := net.JoinHostPort(addr, port)
+			epnt := net.JoinHostPort(addr, port.port)
 			out = append(out, endpointInfo{
 				Addr: addr,
 				Epnt: epnt,
-				TLS:  port == "443",
+				TLS:  port.tls,
 			})
 		}
 	}
@@ -1,8 +1,10 @@
 package oohelperd
 
 import (
+	"errors"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -47,15 +49,17 @@ func Test_newIPInfo(t *testing.T) {
 		want: map[string]*model.THIPInfo{
 			"10.0.0.1": {
 				ASN:   0,
-				Flags: model.THIPInfoFlagIsBogon | model.THIPInfoFlagResolvedByProbe,
+				Flags: model.THIPInfoFlagIsBogon | model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagProbeOnly,
 			},
 			"8.8.8.8": {
-				ASN:   15169,
-				Flags: model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				ResolvedBy: []string{thResolverIdentity},
 			},
 			"8.8.4.4": {
-				ASN:   15169,
-				Flags: model.THIPInfoFlagResolvedByTH,
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByTH | model.THIPInfoFlagTHOnly,
+				ResolvedBy: []string{thResolverIdentity},
 			},
 		},
 	}, {
@@ -84,10 +88,201 @@ func Test_newIPInfo(t *testing.T) {
 			addrs: []string{},
 		},
 		want: map[string]*model.THIPInfo{},
+	}, {
+		name: "with IPv4-mapped IPv6 addresses",
+		args: args{
+			creq: &model.THRequest{
+				HTTPRequest:        "",
+				HTTPRequestHeaders: map[string][]string{},
+				TCPConnect: []string{
+					"[::ffff:8.8.8.8]:443",
+					"[::ffff:10.0.0.1]:443",
+				},
+			},
+			addrs: []string{
+				"8.8.8.8",
+				"::ffff:8.8.4.4",
+				"8.8.4.4",
+				"10.0.0.1",
+			},
+		},
+		want: map[string]*model.THIPInfo{
+			"10.0.0.1": {
+				ASN:        0,
+				Flags:      model.THIPInfoFlagIsBogon | model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				ResolvedBy: []string{thResolverIdentity},
+			},
+			"8.8.8.8": {
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				ResolvedBy: []string{thResolverIdentity},
+			},
+			"8.8.4.4": {
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByTH | model.THIPInfoFlagTHOnly,
+				ResolvedBy: []string{thResolverIdentity},
+			},
+		},
+	}, {
+		name: "with IPv6 addresses",
+		args: args{
+			creq: &model.THRequest{
+				HTTPRequest:        "",
+				HTTPRequestHeaders: map[string][]string{},
+				TCPConnect: []string{
+					"[2001:4860:4860::8888]:443",
+				},
+			},
+			addrs: []string{
+				"2001:4860:4860::8888",
+			},
+		},
+		want: map[string]*model.THIPInfo{
+			"2001:4860:4860::8888": {
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				ResolvedBy: []string{thResolverIdentity},
+			},
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newIPInfo(nil, tt.args.creq, tt.args.addrs, nil)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func Test_newIPInfoMulti(t *testing.T) {
+	type args struct {
+		creq     *ctrlRequest
+		addrSets map[string][]string
+	}
+	tests := []struct {
+		name string
+		args args
+		want map[string]*model.THIPInfo
+	}{{
+		name: "with empty input",
+		args: args{
+			creq: &model.THRequest{
+				HTTPRequest:        "",
+				HTTPRequestHeaders: map[string][]string{},
+				TCPConnect:         []string{},
+			},
+			addrSets: map[string][]string{},
+		},
+		want: map[string]*model.THIPInfo{},
+	}, {
+		name: "with overlapping answer sets",
+		args: args{
+			creq: &model.THRequest{
+				HTTPRequest:        "",
+				HTTPRequestHeaders: map[string][]string{},
+				TCPConnect: []string{
+					"8.8.8.8:443",
+				},
+			},
+			addrSets: map[string][]string{
+				"system": {"8.8.8.8", "8.8.4.4"},
+				"udp":    {"8.8.4.4", "8.8.8.8", "8.8.8.8"},
+			},
+		},
+		want: map[string]*model.THIPInfo{
+			"8.8.8.8": {
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				ResolvedBy: []string{"system", "udp"},
+			},
+			"8.8.4.4": {
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByTH | model.THIPInfoFlagTHOnly,
+				ResolvedBy: []string{"system", "udp"},
+			},
+		},
+	}, {
+		name: "with disjoint answer sets and also bogons",
+		args: args{
+			creq: &model.THRequest{
+				HTTPRequest:        "",
+				HTTPRequestHeaders: map[string][]string{},
+				TCPConnect: []string{
+					"10.0.0.1:443",
+					"8.8.8.8:443",
+				},
+			},
+			addrSets: map[string][]string{
+				"system": {"10.0.0.1", "dns.google"},
+				"udp":    {"8.8.4.4"},
+			},
+		},
+		want: map[string]*model.THIPInfo{
+			"10.0.0.1": {
+				ASN:        0,
+				Flags:      model.THIPInfoFlagIsBogon | model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				ResolvedBy: []string{"system"},
+			},
+			"8.8.8.8": {
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagProbeOnly,
+				ResolvedBy: nil,
+			},
+			"8.8.4.4": {
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByTH | model.THIPInfoFlagTHOnly,
+				ResolvedBy: []string{"udp"},
+			},
+		},
+	}, {
+		name: "with IPv4-mapped IPv6 addresses",
+		args: args{
+			creq: &model.THRequest{
+				HTTPRequest:        "",
+				HTTPRequestHeaders: map[string][]string{},
+				TCPConnect: []string{
+					"[::ffff:8.8.8.8]:443",
+				},
+			},
+			addrSets: map[string][]string{
+				"system": {"::ffff:8.8.8.8"},
+				"udp":    {"8.8.8.8"},
+			},
+		},
+		want: map[string]*model.THIPInfo{
+			"8.8.8.8": {
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				ResolvedBy: []string{"system", "udp"},
+			},
+		},
+	}, {
+		name: "with IPv6 addresses spelled differently",
+		args: args{
+			creq: &model.THRequest{
+				HTTPRequest:        "",
+				HTTPRequestHeaders: map[string][]string{},
+				TCPConnect: []string{
+					"[2001:4860:4860:0:0:0:0:8888]:443",
+				},
+			},
+			addrSets: map[string][]string{
+				"system": {"2001:4860:4860::8888"},
+				"udp":    {"2001:4860:4860:0000::8888"},
+			},
+		},
+		want: map[string]*model.THIPInfo{
+			"2001:4860:4860::8888": {
+				ASN:        15169,
+				Flags:      model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				ResolvedBy: []string{"system", "udp"},
+			},
+		},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := newIPInfo(tt.args.creq, tt.args.addrs)
+			got := newIPInfoMulti(nil, tt.args.creq, tt.args.addrSets, nil)
 			if diff := cmp.Diff(tt.want, got); diff != "" {
 				t.Fatal(diff)
 			}
@@ -97,8 +292,10 @@ func Test_newIPInfo(t *testing.T) {
 
 func Test_ipInfoToEndpoints(t *testing.T) {
 	type args struct {
-		URL    *url.URL
-		ipinfo map[string]*model.THIPInfo
+		URL               *url.URL
+		ipinfo            map[string]*model.THIPInfo
+		alsoTLSPort       map[string]string
+		alsoCleartextPort map[string]string
 	}
 	tests := []struct {
 		name string
@@ -236,13 +433,295 @@ func Test_ipInfoToEndpoints(t *testing.T) {
 			Epnt: "8.8.8.8:443",
 			TLS:  true,
 		}},
+	}, {
+		name: "with explicit port and complementary TLS port",
+		args: args{
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "example.com:8080",
+			},
+			ipinfo: map[string]*model.THIPInfo{
+				"8.8.8.8": {
+					ASN:   15169,
+					Flags: model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				},
+			},
+			alsoTLSPort: map[string]string{"8080": "8443"},
+		},
+		want: []endpointInfo{{
+			Addr: "8.8.8.8",
+			Epnt: "8.8.8.8:8080",
+			TLS:  false,
+		}, {
+			Addr: "8.8.8.8",
+			Epnt: "8.8.8.8:8443",
+			TLS:  true,
+		}},
+	}, {
+		name: "with explicit port and complementary cleartext port",
+		args: args{
+			URL: &url.URL{
+				Scheme: "https",
+				Host:   "example.com:8443",
+			},
+			ipinfo: map[string]*model.THIPInfo{
+				"8.8.8.8": {
+					ASN:   15169,
+					Flags: model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				},
+				"8.8.4.4": {
+					ASN:   15169,
+					Flags: model.THIPInfoFlagResolvedByProbe,
+				},
+			},
+			alsoTLSPort:       map[string]string{"8080": "8443"},
+			alsoCleartextPort: map[string]string{"8443": "8080"},
+		},
+		want: []endpointInfo{{
+			Addr: "8.8.4.4",
+			Epnt: "8.8.4.4:8080",
+			TLS:  false,
+		}, {
+			Addr: "8.8.4.4",
+			Epnt: "8.8.4.4:8443",
+			TLS:  false,
+		}, {
+			Addr: "8.8.8.8",
+			Epnt: "8.8.8.8:8080",
+			TLS:  false,
+		}, {
+			Addr: "8.8.8.8",
+			Epnt: "8.8.8.8:8443",
+			TLS:  false,
+		}},
+	}, {
+		name: "with complementary ports but without explicit port",
+		args: args{
+			URL: &url.URL{
+				Scheme: "https",
+				Host:   "example.com",
+			},
+			ipinfo: map[string]*model.THIPInfo{
+				"8.8.8.8": {
+					ASN:   15169,
+					Flags: model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagResolvedByTH,
+				},
+			},
+			alsoTLSPort:       map[string]string{"443": "8443"},
+			alsoCleartextPort: map[string]string{"443": "80"},
+		},
+		want: []endpointInfo{{
+			Addr: "8.8.8.8",
+			Epnt: "8.8.8.8:443",
+			TLS:  true,
+		}},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := ipInfoToEndpoints(tt.args.URL, tt.args.ipinfo)
+			got := ipInfoToEndpoints(tt.args.URL, tt.args.ipinfo, tt.args.alsoTLSPort, tt.args.alsoCleartextPort)
 			if diff := cmp.Diff(tt.want, got); diff != "" {
 				t.Fatal(diff)
 			}
 		})
 	}
 }
+
+// fakeASNLooker is a fake [ASNLooker] returning controlled values.
+type fakeASNLooker struct {
+	asns map[string]uint
+}
+
+var _ ASNLooker = &fakeASNLooker{}
+
+// LookupASN implements ASNLooker.
+func (fal *fakeASNLooker) LookupASN(ip string) (uint, string, error) {
+	asn, found := fal.asns[ip]
+	if !found {
+		return 0, "", errors.New("mocked error")
+	}
+	return asn, "Fake Org", nil
+}
+
+func Test_newIPInfoWithASNLooker(t *testing.T) {
+	looker := &fakeASNLooker{
+		asns: map[string]uint{
+			"8.8.8.8": 1234,
+			"8.8.4.4": 5678,
+		},
+	}
+	creq := &model.THRequest{
+		HTTPRequest:        "",
+		HTTPRequestHeaders: map[string][]string{},
+		TCPConnect: []string{
+			"8.8.8.8:443",
+			"130.192.91.211:443",
+		},
+	}
+
+	t.Run("newIPInfo uses the ASNLooker", func(t *testing.T) {
+		got := newIPInfo(looker, creq, []string{"8.8.4.4"}, nil)
+		expect := map[string]*model.THIPInfo{
+			"8.8.8.8": {
+				ASN:   1234,
+				Flags: model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagProbeOnly,
+			},
+			"8.8.4.4": {
+				ASN:        5678,
+				Flags:      model.THIPInfoFlagResolvedByTH | model.THIPInfoFlagTHOnly,
+				ResolvedBy: []string{thResolverIdentity},
+			},
+			"130.192.91.211": {
+				ASN:   0, // the looker fails for this address
+				Flags: model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagProbeOnly,
+			},
+		}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("newIPInfoMulti uses the ASNLooker", func(t *testing.T) {
+		got := newIPInfoMulti(looker, creq, map[string][]string{"udp": {"8.8.4.4"}}, nil)
+		expect := map[string]*model.THIPInfo{
+			"8.8.8.8": {
+				ASN:   1234,
+				Flags: model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagProbeOnly,
+			},
+			"8.8.4.4": {
+				ASN:        5678,
+				Flags:      model.THIPInfoFlagResolvedByTH | model.THIPInfoFlagTHOnly,
+				ResolvedBy: []string{"udp"},
+			},
+			"130.192.91.211": {
+				ASN:   0, // the looker fails for this address
+				Flags: model.THIPInfoFlagResolvedByProbe | model.THIPInfoFlagProbeOnly,
+			},
+		}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("a nil ASNLooker means using geoipx", func(t *testing.T) {
+		if _, ok := asnLookerOrDefault(nil).(geoipxASNLooker); !ok {
+			t.Fatal("expected the geoipx ASNLooker")
+		}
+		if asnLookerOrDefault(looker) != looker {
+			t.Fatal("expected the custom ASNLooker")
+		}
+	})
+}
+
+// slowASNLooker is an [ASNLooker] taking delay to look up each address.
+type slowASNLooker struct {
+	delay time.Duration
+}
+
+var _ ASNLooker = &slowASNLooker{}
+
+// LookupASN implements ASNLooker.
+func (sal *slowASNLooker) LookupASN(ip string) (uint, string, error) {
+	time.Sleep(sal.delay)
+	return 0, "", errors.New("mocked error")
+}
+
+func Test_newIPInfoStats(t *testing.T) {
+	const delay = 10 * time.Millisecond
+	looker := &slowASNLooker{delay: delay}
+	creq := &model.THRequest{
+		HTTPRequest:        "",
+		HTTPRequestHeaders: map[string][]string{},
+		TCPConnect: []string{
+			"8.8.8.8:443",
+			"8.8.4.4:443",
+		},
+	}
+
+	// checkStats checks whether the stats contain a lookup for each of the given
+	// addresses, whether each lookup took at least delay, and whether the duration
+	// accounts for all the lookups.
+	checkStats := func(t *testing.T, stats *model.THIPInfoStats, addrs ...string) {
+		if len(stats.Lookups) != len(addrs) {
+			t.Fatal("unexpected number of lookups", stats.Lookups)
+		}
+		var total float64
+		for _, addr := range addrs {
+			elapsed, found := stats.Lookups[addr]
+			if !found {
+				t.Fatal("missing lookup for", addr)
+			}
+			if elapsed < delay.Seconds() {
+				t.Fatal("lookup for", addr, "took less than the delay", elapsed)
+			}
+			total += elapsed
+		}
+		if stats.Duration < total {
+			t.Fatal("the duration does not account for the lookups", stats.Duration, total)
+		}
+	}
+
+	t.Run("newIPInfo records the stats", func(t *testing.T) {
+		stats := &model.THIPInfoStats{}
+		newIPInfo(looker, creq, []string{"8.8.4.4", "1.1.1.1"}, stats)
+		checkStats(t, stats, "8.8.8.8", "8.8.4.4", "1.1.1.1")
+	})
+
+	t.Run("newIPInfoMulti records the stats", func(t *testing.T) {
+		stats := &model.THIPInfoStats{}
+		newIPInfoMulti(looker, creq, map[string][]string{
+			"udp":    {"8.8.4.4"},
+			"system": {"1.1.1.1", "8.8.4.4"},
+		}, stats)
+		checkStats(t, stats, "8.8.8.8", "8.8.4.4", "1.1.1.1")
+	})
+
+	t.Run("we do not record anything with nil stats", func(t *testing.T) {
+		got := newIPInfo(looker, creq, []string{"1.1.1.1"}, nil)
+		if len(got) != 3 {
+			t.Fatal("unexpected ipinfo", got)
+		}
+	})
+}
+
+func Test_newIPInfoExclusiveFlags(t *testing.T) {
+	looker := &fakeASNLooker{}
+	creq := &model.THRequest{
+		HTTPRequest:        "",
+		HTTPRequestHeaders: map[string][]string{},
+		TCPConnect: []string{
+			"8.8.8.8:443", // probe only
+			"8.8.4.4:443", // both
+		},
+	}
+
+	onlyFlags := func(ipinfo map[string]*model.THIPInfo) map[string]int64 {
+		out := make(map[string]int64)
+		for addr, info := range ipinfo {
+			out[addr] = info.Flags & (model.THIPInfoFlagProbeOnly | model.THIPInfoFlagTHOnly)
+		}
+		return out
+	}
+
+	expect := map[string]int64{
+		"8.8.8.8": model.THIPInfoFlagProbeOnly,
+		"8.8.4.4": 0,
+		"1.1.1.1": model.THIPInfoFlagTHOnly,
+	}
+
+	t.Run("with newIPInfo", func(t *testing.T) {
+		got := newIPInfo(looker, creq, []string{"8.8.4.4", "1.1.1.1"}, nil)
+		if diff := cmp.Diff(expect, onlyFlags(got)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with newIPInfoMulti", func(t *testing.T) {
+		got := newIPInfoMulti(looker, creq, map[string][]string{
+			"udp":    {"8.8.4.4"},
+			"system": {"1.1.1.1"},
+		}, nil)
+		if diff := cmp.Diff(expect, onlyFlags(got)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -79,8 +79,13 @@ func measure(ctx context.Context, config *Handler, creq *ctrlRequest) (*ctrlResp
 	}
 
 	// obtain IP info and figure out the endpoints measurement plan
-	cresp.IPInfo = newIPInfo(creq, cresp.DNS.Addrs)
-	endpoints := ipInfoToEndpoints(URL, cresp.IPInfo)
+	var ipinfoStats *model.THIPInfoStats
+	if config.RecordIPInfoStats {
+		ipinfoStats = &model.THIPInfoStats{}
+		cresp.XDiagnostics = &model.THDiagnostics{IPInfo: ipinfoStats}
+	}
+	cresp.IPInfo = newIPInfo(config.ASNLooker, creq, cresp.DNS.Addrs, ipinfoStats)
+	endpoints := ipInfoToEndpoints(URL, cresp.IPInfo, config.AlsoTLSPort, config.AlsoCleartextPort)
 
 	// tcpconnect: start over all the endpoints
 	tcpconnch := make(chan *tcpResultPair, len(endpoints))
@@ -93,6 +98,7 @@ func measure(ctx context.Context, config *Handler, creq *ctrlRequest) (*ctrlResp
 			Logger:           logger,
 			NewDialer:        config.NewDialer,
 			NewTSLHandshaker: config.NewTLSHandshaker,
+			RecordTLSDetails: config.RecordTLSDetails,
 			URLHostname:      URL.Hostname(),
 			Out:              tcpconnch,
 			Wg:               wg,
@@ -114,18 +120,27 @@ func measure(ctx context.Context, config *Handler, creq *ctrlRequest) (*ctrlResp
 	})
 
 	// wait for endpoint measurements to complete
+	//
+	// Note that all the measurements honor the context, hence they stop promptly
+	// when the context is done (e.g., because the client disconnected).
 	wg.Wait()
 
 	// continue assembling the response
 	cresp.HTTPRequest = <-httpch
 
+	// do not start any further measurement if the context is done
+	if err := ctx.Err(); err != nil {
+		logger.Warnf("stopped measuring: %s", err.Error())
+		cresp.XPartial = true
+	}
+
 	// HTTP/3
 	quicconnch := make(chan *quicResult, len(endpoints))
 
 	// In the v3.17.x and possibly v3.18.x release cycles, QUIC is disabled by
 	// default but clients that know QUIC can enable it. We will eventually remove
 	// this flag and enable QUIC measurements for all clients.
-	if creq.XQUICEnabled && cresp.HTTPRequest.DiscoveredH3Endpoint != "" {
+	if !cresp.XPartial && creq.XQUICEnabled && cresp.HTTPRequest.DiscoveredH3Endpoint != "" {
 		// quicconnect: start over all the endpoints
 		for _, endpoint := range endpoints {
 			wg.Add(1)
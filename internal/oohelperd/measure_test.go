@@ -0,0 +1,199 @@
+package oohelperd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestMeasureWithCanceledContext(t *testing.T) {
+	// newHandler returns a handler where dialing and fetching the webpage
+	// block until the context is done, and which notifies started whenever
+	// we start dialing. The handler counts the outstanding dials.
+	newHandler := func(started chan<- string, outstanding *atomic.Int64) *Handler {
+		return &Handler{
+			BaseLogger:        log.Log,
+			Indexer:           &atomic.Int64{},
+			MaxAcceptableBody: 1 << 20,
+			NewDialer: func(logger model.Logger) model.Dialer {
+				return &mocks.Dialer{
+					MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+						outstanding.Add(1)
+						defer outstanding.Add(-1)
+						started <- address
+						<-ctx.Done()
+						return nil, netxlite.NewTopLevelGenericErrWrapper(ctx.Err())
+					},
+					MockCloseIdleConnections: func() {},
+				}
+			},
+			NewHTTPClient: func(logger model.Logger) model.HTTPClient {
+				return &mocks.HTTPClient{
+					MockDo: func(req *http.Request) (*http.Response, error) {
+						<-req.Context().Done()
+						return nil, req.Context().Err()
+					},
+					MockCloseIdleConnections: func() {},
+				}
+			},
+			NewResolver: func(logger model.Logger) model.Resolver {
+				panic("should not be called")
+			},
+		}
+	}
+
+	creq := &ctrlRequest{
+		HTTPRequest:        "https://8.8.8.8/",
+		HTTPRequestHeaders: map[string][]string{},
+		TCPConnect:         []string{"8.8.8.8:443", "8.8.4.4:443"},
+		XQUICEnabled:       true,
+	}
+
+	t.Run("we stop the endpoint probes and return partial results", func(t *testing.T) {
+		started := make(chan string, len(creq.TCPConnect))
+		outstanding := &atomic.Int64{}
+		handler := newHandler(started, outstanding)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			// cancel as soon as all the endpoint probes are in flight
+			for range creq.TCPConnect {
+				<-started
+			}
+			cancel()
+		}()
+
+		t0 := time.Now()
+		cresp, err := measure(ctx, handler, creq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(t0); elapsed > 5*time.Second {
+			t.Fatal("measure did not stop promptly", elapsed)
+		}
+		if outstanding.Load() != 0 {
+			t.Fatal("there are outstanding endpoint probes")
+		}
+		if !cresp.XPartial {
+			t.Fatal("expected the response to be marked as partial")
+		}
+		if len(cresp.TCPConnect) != len(creq.TCPConnect) {
+			t.Fatal("unexpected number of TCP connect results", len(cresp.TCPConnect))
+		}
+		for epnt, result := range cresp.TCPConnect {
+			// note: tcpMapFailure maps the interrupted failure to connect_error
+			if result.Status || result.Failure == nil || *result.Failure != "connect_error" {
+				t.Fatal("unexpected result for", epnt, result.Status, result.Failure)
+			}
+		}
+		if cresp.HTTP3Request != nil || len(cresp.QUICHandshake) != 0 {
+			t.Fatal("we should not have started further measurements")
+		}
+	})
+
+	t.Run("we do not mark as partial a response for a context that is not done", func(t *testing.T) {
+		handler := newHandler(make(chan string, len(creq.TCPConnect)), &atomic.Int64{})
+		handler.NewDialer = func(logger model.Logger) model.Dialer {
+			return &mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return nil, netxlite.NewTopLevelGenericErrWrapper(netxlite.ECONNREFUSED)
+				},
+				MockCloseIdleConnections: func() {},
+			}
+		}
+		handler.NewHTTPClient = func(logger model.Logger) model.HTTPClient {
+			return &mocks.HTTPClient{
+				MockDo: func(req *http.Request) (*http.Response, error) {
+					return nil, errors.New("mocked error")
+				},
+				MockCloseIdleConnections: func() {},
+			}
+		}
+		cresp, err := measure(context.Background(), handler, creq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cresp.XPartial {
+			t.Fatal("did not expect the response to be marked as partial")
+		}
+		if len(cresp.TCPConnect) != len(creq.TCPConnect) {
+			t.Fatal("unexpected number of TCP connect results", len(cresp.TCPConnect))
+		}
+	})
+}
+
+func TestMeasureRecordIPInfoStats(t *testing.T) {
+	newHandler := func(record bool) *Handler {
+		return &Handler{
+			ASNLooker:         &fakeASNLooker{},
+			BaseLogger:        log.Log,
+			Indexer:           &atomic.Int64{},
+			MaxAcceptableBody: 1 << 20,
+			NewDialer: func(logger model.Logger) model.Dialer {
+				return &mocks.Dialer{
+					MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+						return nil, netxlite.NewTopLevelGenericErrWrapper(netxlite.ECONNREFUSED)
+					},
+					MockCloseIdleConnections: func() {},
+				}
+			},
+			NewHTTPClient: func(logger model.Logger) model.HTTPClient {
+				return &mocks.HTTPClient{
+					MockDo: func(req *http.Request) (*http.Response, error) {
+						return nil, errors.New("mocked error")
+					},
+					MockCloseIdleConnections: func() {},
+				}
+			},
+			NewResolver: func(logger model.Logger) model.Resolver {
+				panic("should not be called")
+			},
+			RecordIPInfoStats: record,
+		}
+	}
+
+	creq := &ctrlRequest{
+		HTTPRequest:        "https://8.8.8.8/",
+		HTTPRequestHeaders: map[string][]string{},
+		TCPConnect:         []string{"8.8.8.8:443", "8.8.4.4:443"},
+	}
+
+	t.Run("we do not include diagnostics by default", func(t *testing.T) {
+		cresp, err := measure(context.Background(), newHandler(false), creq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cresp.XDiagnostics != nil {
+			t.Fatal("expected nil diagnostics")
+		}
+	})
+
+	t.Run("we include the IP info stats when configured to do so", func(t *testing.T) {
+		cresp, err := measure(context.Background(), newHandler(true), creq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cresp.XDiagnostics == nil || cresp.XDiagnostics.IPInfo == nil {
+			t.Fatal("expected the IP info stats")
+		}
+		stats := cresp.XDiagnostics.IPInfo
+		if len(stats.Lookups) != len(cresp.IPInfo) {
+			t.Fatal("unexpected number of lookups", stats.Lookups)
+		}
+		for addr := range cresp.IPInfo {
+			if _, found := stats.Lookups[addr]; !found {
+				t.Fatal("missing lookup for", addr)
+			}
+		}
+	})
+}
@@ -60,6 +60,9 @@ type tcpTLSConfig struct {
 	// Out is the MANDATORY where we'll post the TCP measurement results.
 	Out chan *tcpResultPair
 
+	// RecordTLSDetails OPTIONALLY enables recording the TLS handshake details.
+	RecordTLSDetails bool
+
 	// URLHostname is the MANDATORY URL.Hostname() to use.
 	URLHostname string
 
@@ -115,9 +118,21 @@ func tcpTLSDo(ctx context.Context, config *tcpTLSConfig) {
 		Status:     err == nil,
 		Failure:    newfailure(err),
 	}
+	if err == nil && config.RecordTLSDetails {
+		tlsRecordDetails(out.TLS, tlsConn.ConnectionState())
+	}
 	measurexlite.MaybeClose(tlsConn)
 }
 
+// tlsRecordDetails records the TLS handshake details inside the result.
+func tlsRecordDetails(result *ctrlTLSResult, state tls.ConnectionState) {
+	result.TLSVersion = netxlite.TLSVersionString(state.Version)
+	result.NegotiatedProtocol = state.NegotiatedProtocol
+	if len(state.PeerCertificates) > 0 {
+		result.CertificateSubject = state.PeerCertificates[0].Subject.String()
+	}
+}
+
 // tcpMapFailure attempts to map netxlite failures to the strings
 // used by the original OONI test helper.
 //
@@ -1,9 +1,18 @@
 package oohelperd
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/mocks"
+	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
@@ -38,3 +47,100 @@ func Test_tcpMapFailure(t *testing.T) {
 		})
 	}
 }
+
+func Test_tcpTLSDoWithRecordTLSDetails(t *testing.T) {
+	// run runs tcpTLSDo using a TLS handshaker returning the given error
+	// and, on success, a conn with a known connection state.
+	run := func(recordTLSDetails bool, handshakeErr error) *tcpResultPair {
+		conn := &mocks.Conn{
+			MockClose: func() error {
+				return nil
+			},
+		}
+		tlsConn := &mocks.TLSConn{
+			Conn: *conn,
+			MockConnectionState: func() tls.ConnectionState {
+				return tls.ConnectionState{
+					Version:            tls.VersionTLS13,
+					NegotiatedProtocol: "h2",
+					PeerCertificates: []*x509.Certificate{{
+						Subject: pkix.Name{CommonName: "www.example.com"},
+					}},
+				}
+			},
+		}
+		out := make(chan *tcpResultPair, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		tcpTLSDo(context.Background(), &tcpTLSConfig{
+			Address:   "93.184.216.34",
+			EnableTLS: true,
+			Endpoint:  "93.184.216.34:443",
+			Logger:    model.DiscardLogger,
+			NewDialer: func(model.Logger) model.Dialer {
+				return &mocks.Dialer{
+					MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+						return conn, nil
+					},
+					MockCloseIdleConnections: func() {},
+				}
+			},
+			NewTSLHandshaker: func(model.Logger) model.TLSHandshaker {
+				return &mocks.TLSHandshaker{
+					MockHandshake: func(ctx context.Context, conn net.Conn, config *tls.Config) (model.TLSConn, error) {
+						if handshakeErr != nil {
+							return nil, handshakeErr
+						}
+						return tlsConn, nil
+					},
+				}
+			},
+			Out:              out,
+			RecordTLSDetails: recordTLSDetails,
+			URLHostname:      "www.example.com",
+			Wg:               wg,
+		})
+		wg.Wait()
+		return <-out
+	}
+
+	t.Run("we record the details when enabled", func(t *testing.T) {
+		result := run(true, nil)
+		expect := &ctrlTLSResult{
+			ServerName:         "www.example.com",
+			Status:             true,
+			Failure:            nil,
+			TLSVersion:         "TLSv1.3",
+			NegotiatedProtocol: "h2",
+			CertificateSubject: "CN=www.example.com",
+		}
+		if diff := cmp.Diff(expect, result.TLS); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we do not record the details by default", func(t *testing.T) {
+		result := run(false, nil)
+		expect := &ctrlTLSResult{
+			ServerName: "www.example.com",
+			Status:     true,
+			Failure:    nil,
+		}
+		if diff := cmp.Diff(expect, result.TLS); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we do not record the details when the handshake fails", func(t *testing.T) {
+		result := run(true, errors.New("mocked error"))
+		failure := "unknown_failure: mocked error"
+		expect := &ctrlTLSResult{
+			ServerName: "www.example.com",
+			Status:     false,
+			Failure:    &failure,
+		}
+		if diff := cmp.Diff(expect, result.TLS); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}